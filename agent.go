@@ -2,6 +2,7 @@ package cke
 
 import (
 	"bytes"
+	"io"
 	"net"
 	"strings"
 	"time"
@@ -44,6 +45,12 @@ type Agent interface {
 	// RunWithTimeout run command with given timeout.
 	// If timeout is 0, the command will run indefinitely.
 	RunWithTimeout(command, input string, timeout time.Duration) (stdout, stderr []byte, err error)
+
+	// RunWithReader is the same as RunWithTimeout except that stdin is streamed from input.
+	RunWithReader(command string, input io.Reader, timeout time.Duration) (stdout, stderr []byte, err error)
+
+	// RunWithWriter is the same as RunWithTimeout except that stdout is streamed to output.
+	RunWithWriter(command string, output io.Writer, timeout time.Duration) (stderr []byte, err error)
 }
 
 type sshAgent struct {
@@ -55,7 +62,7 @@ type sshAgent struct {
 // SSHAgent creates an Agent that communicates over SSH.
 // It returns non-nil error when connection could not be established.
 func SSHAgent(node *Node, privkey string) (Agent, error) {
-	conn, err := agentDialer.Dial("tcp", node.Address+":22")
+	conn, err := agentDialer.Dial("tcp", net.JoinHostPort(node.Address, "22"))
 	if err != nil {
 		log.Error("failed to dial: ", map[string]interface{}{
 			log.FnError: err,
@@ -123,10 +130,28 @@ func (a sshAgent) RunWithInput(command, input string) error {
 }
 
 func (a sshAgent) RunWithTimeout(command, input string, timeout time.Duration) ([]byte, []byte, error) {
+	var r io.Reader
+	if len(input) > 0 {
+		r = strings.NewReader(input)
+	}
+	return a.RunWithReader(command, r, timeout)
+}
+
+func (a sshAgent) RunWithReader(command string, input io.Reader, timeout time.Duration) ([]byte, []byte, error) {
+	var stdoutBuff bytes.Buffer
+	stderr, err := a.run(command, input, &stdoutBuff, timeout)
+	return stdoutBuff.Bytes(), stderr, err
+}
+
+func (a sshAgent) RunWithWriter(command string, output io.Writer, timeout time.Duration) ([]byte, error) {
+	return a.run(command, nil, output, timeout)
+}
+
+func (a sshAgent) run(command string, input io.Reader, output io.Writer, timeout time.Duration) ([]byte, error) {
 	if timeout > 0 {
 		err := a.conn.SetDeadline(time.Now().Add(timeout))
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 
 		defer a.conn.SetDeadline(time.Time{})
@@ -137,20 +162,18 @@ func (a sshAgent) RunWithTimeout(command, input string, timeout time.Duration) (
 		log.Error("failed to create session: ", map[string]interface{}{
 			log.FnError: err,
 		})
-		return nil, nil, err
+		return nil, err
 	}
 	defer session.Close()
 
-	if len(input) > 0 {
-		session.Stdin = strings.NewReader(input)
+	if input != nil {
+		session.Stdin = input
 	}
 
-	var stdoutBuff bytes.Buffer
 	var stderrBuff bytes.Buffer
-	session.Stdout = &stdoutBuff
+	session.Stdout = output
 	session.Stderr = &stderrBuff
 	err = session.Run(command)
-	stdout := stdoutBuff.Bytes()
 	stderr := stderrBuff.Bytes()
 	if err != nil {
 		log.Error("failed to run command: ", map[string]interface{}{
@@ -158,7 +181,7 @@ func (a sshAgent) RunWithTimeout(command, input string, timeout time.Duration) (
 			"command":   command,
 			"stderr":    string(stderr),
 		})
-		return stdout, stderr, err
+		return stderr, err
 	}
-	return stdout, stderr, nil
+	return stderr, nil
 }
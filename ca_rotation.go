@@ -0,0 +1,85 @@
+package cke
+
+import (
+	"strings"
+	"time"
+)
+
+// CARotationStage is the type of the stages of CA rotation.
+type CARotationStage string
+
+// CA rotation stages in the order of execution.
+const (
+	// CARotationStagePrepare is the stage where ckecli generates the new CA.
+	CARotationStagePrepare = CARotationStage("prepare")
+	// CARotationStageBundle distributes the bundle of the old and new CA certificates.
+	CARotationStageBundle = CARotationStage("bundle")
+	// CARotationStageReissue reissues certificates from the new CA.
+	CARotationStageReissue = CARotationStage("reissue")
+	// CARotationStageDrop distributes only the new CA certificate.
+	CARotationStageDrop = CARotationStage("drop")
+)
+
+// CARotation records the progress of the rotation of a CA.
+type CARotation struct {
+	// CA is the name of the CA being rotated.  It is one of CAKeys.
+	CA    string          `json:"ca"`
+	Stage CARotationStage `json:"stage"`
+
+	// OldCert and NewCert are PEM encoded certificates of the old and new CA.
+	OldCert string `json:"old_cert"`
+	NewCert string `json:"new_cert"`
+
+	// OldIssuer and NewIssuer are the IDs of issuers in the Vault PKI.
+	// In the prepare stage, NewCert is empty and NewIssuer is the name of
+	// the issuer to be generated.
+	OldIssuer string `json:"old_issuer"`
+	NewIssuer string `json:"new_issuer"`
+
+	// Restarted is the list of addresses of nodes where the components
+	// using the CA have been restarted in the current stage.
+	Restarted []string `json:"restarted,omitempty"`
+
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Bundle returns the concatenation of the old and new CA certificates.
+func (r *CARotation) Bundle() string {
+	return strings.TrimRight(r.OldCert, "\n") + "\n" + strings.TrimRight(r.NewCert, "\n") + "\n"
+}
+
+// Certificate returns the CA certificate to be distributed in the current stage.
+func (r *CARotation) Certificate() string {
+	switch r.Stage {
+	case CARotationStagePrepare:
+		return r.OldCert
+	case CARotationStageDrop:
+		return r.NewCert
+	}
+	return r.Bundle()
+}
+
+// IsRestarted returns true if the components on the node have been restarted in the current stage.
+func (r *CARotation) IsRestarted(address string) bool {
+	for _, a := range r.Restarted {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+// WithRestarted returns a copy of r with address added to Restarted.
+func (r *CARotation) WithRestarted(address string) *CARotation {
+	nr := *r
+	nr.Restarted = append(append([]string(nil), r.Restarted...), address)
+	return &nr
+}
+
+// WithStage returns a copy of r proceeded to the stage.
+func (r *CARotation) WithStage(stage CARotationStage) *CARotation {
+	nr := *r
+	nr.Stage = stage
+	nr.Restarted = nil
+	return &nr
+}
@@ -0,0 +1,121 @@
+package cke
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultCertTTL is the default TTL of certificates for Kubernetes components.
+const DefaultCertTTL = 87600 * time.Hour
+
+// MinCertTTL is the minimum TTL of certificates for Kubernetes components.
+const MinCertTTL = time.Hour
+
+// certTTLTolerance is the allowance for clock skew between CKE and Vault
+// to decide if a certificate is issued with a TTL longer than the current one.
+const certTTLTolerance = time.Hour
+
+// CertificateParams is a set of parameters for the certificate of a component.
+type CertificateParams struct {
+	// CertTTL is the TTL of the certificate such as "720h".  Empty means DefaultCertTTL.
+	CertTTL string `json:"cert_ttl,omitempty"`
+
+	// CertRenewBefore is the remaining lifetime of the certificate to start renewal
+	// such as "240h".  Empty means one third of the TTL.
+	CertRenewBefore string `json:"cert_renew_before,omitempty"`
+}
+
+// GetCertTTL returns the TTL of the certificate.
+func (p CertificateParams) GetCertTTL() time.Duration {
+	if len(p.CertTTL) == 0 {
+		return DefaultCertTTL
+	}
+	ttl, err := time.ParseDuration(p.CertTTL)
+	if err != nil {
+		return DefaultCertTTL
+	}
+	return ttl
+}
+
+// GetCertRenewBefore returns the remaining lifetime of the certificate to start renewal.
+func (p CertificateParams) GetCertRenewBefore() time.Duration {
+	if len(p.CertRenewBefore) == 0 {
+		return p.GetCertTTL() / 3
+	}
+	d, err := time.ParseDuration(p.CertRenewBefore)
+	if err != nil {
+		return p.GetCertTTL() / 3
+	}
+	return d
+}
+
+// NeedsRenewal returns true if the certificate expiring at `expiry` needs to be reissued.
+//
+// A certificate is renewed when less than GetCertRenewBefore() remains,
+// or when it was issued with a TTL longer than the current one.
+// Zero `expiry` means that the expiry is unknown, and never needs renewal.
+func (p CertificateParams) NeedsRenewal(expiry, now time.Time) bool {
+	if expiry.IsZero() {
+		return false
+	}
+	remaining := expiry.Sub(now)
+	return remaining < p.GetCertRenewBefore() || remaining > p.GetCertTTL()+certTTLTolerance
+}
+
+func validateCertificateParams(p CertificateParams) error {
+	if len(p.CertTTL) != 0 {
+		ttl, err := time.ParseDuration(p.CertTTL)
+		if err != nil {
+			return fmt.Errorf("invalid cert_ttl: %w", err)
+		}
+		if ttl < MinCertTTL || ttl > DefaultCertTTL {
+			return fmt.Errorf("cert_ttl must be between %s and %s: %s", MinCertTTL, DefaultCertTTL, p.CertTTL)
+		}
+	}
+
+	if len(p.CertRenewBefore) != 0 {
+		d, err := time.ParseDuration(p.CertRenewBefore)
+		if err != nil {
+			return fmt.Errorf("invalid cert_renew_before: %w", err)
+		}
+		if d <= 0 || d >= p.GetCertTTL() {
+			return fmt.Errorf("cert_renew_before must be positive and shorter than cert_ttl: %s", p.CertRenewBefore)
+		}
+	}
+	return nil
+}
+
+// CertificateExpiry returns the expiry date of the first certificate in PEM data.
+func CertificateExpiry(data []byte) (time.Time, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return time.Time{}, errors.New("no PEM data")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
+
+// Component names of CertificateStatus other than containers on nodes.
+const (
+	CertComponentServiceAccount = "service-account"
+	CertComponentCA             = "ca"
+)
+
+// CertificateStatus represents the expiry of a certificate issued by CKE.
+type CertificateStatus struct {
+	// Node is the address of the node where the certificate is installed.
+	// Empty for certificates not bound to a node.
+	Node string `json:"node,omitempty"`
+	// Component is the name of the component that uses the certificate,
+	// or the resource key of a Secret for webhook certificates.
+	Component string `json:"component"`
+	// CA is the name of the CA that issued the certificate.
+	CA     string    `json:"ca"`
+	Expiry time.Time `json:"expiry"`
+}
@@ -0,0 +1,117 @@
+package cke
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestCertificateParams(t *testing.T) {
+	t.Parallel()
+
+	if ttl := (CertificateParams{}).GetCertTTL(); ttl != DefaultCertTTL {
+		t.Error("unexpected default TTL:", ttl)
+	}
+
+	p := CertificateParams{CertTTL: "720h"}
+	if ttl := p.GetCertTTL(); ttl != 720*time.Hour {
+		t.Error("unexpected TTL:", ttl)
+	}
+
+	now := time.Now()
+	testCases := []struct {
+		name   string
+		expiry time.Time
+		expect bool
+	}{
+		{"unknown", time.Time{}, false},
+		{"fresh", now.Add(720 * time.Hour), false},
+		{"valid", now.Add(300 * time.Hour), false},
+		{"renewal window", now.Add(200 * time.Hour), true},
+		{"expired", now.Add(-time.Hour), true},
+		{"longer TTL", now.Add(87600 * time.Hour), true},
+	}
+	for _, tc := range testCases {
+		if p.NeedsRenewal(tc.expiry, now) != tc.expect {
+			t.Errorf("%s: NeedsRenewal should return %v", tc.name, tc.expect)
+		}
+	}
+
+	p.CertRenewBefore = "100h"
+	if d := p.GetCertRenewBefore(); d != 100*time.Hour {
+		t.Error("unexpected renewal window:", d)
+	}
+	if p.NeedsRenewal(now.Add(200*time.Hour), now) {
+		t.Error("certificate outside of the renewal window should not be renewed")
+	}
+	if !p.NeedsRenewal(now.Add(50*time.Hour), now) {
+		t.Error("certificate in the renewal window should be renewed")
+	}
+}
+
+func TestValidateCertificateParams(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		params CertificateParams
+		valid  bool
+	}{
+		{"empty", CertificateParams{}, true},
+		{"ttl", CertificateParams{CertTTL: "720h"}, true},
+		{"short ttl", CertificateParams{CertTTL: "1m"}, false},
+		{"renew before", CertificateParams{CertTTL: "720h", CertRenewBefore: "240h"}, true},
+		{"renew before default ttl", CertificateParams{CertRenewBefore: "8760h"}, true},
+		{"invalid renew before", CertificateParams{CertRenewBefore: "foo"}, false},
+		{"negative renew before", CertificateParams{CertRenewBefore: "-1h"}, false},
+		{"renew before longer than ttl", CertificateParams{CertTTL: "720h", CertRenewBefore: "720h"}, false},
+	}
+	for _, tc := range testCases {
+		err := validateCertificateParams(tc.params)
+		if tc.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%s: should be invalid", tc.name)
+		}
+	}
+}
+
+func TestCertificateExpiry(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notAfter := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	expiry, err := CertificateExpiry(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expiry.Equal(notAfter) {
+		t.Error("unexpected expiry:", expiry)
+	}
+
+	if _, err := CertificateExpiry([]byte("foo")); err == nil {
+		t.Error("non-PEM data should be rejected")
+	}
+}
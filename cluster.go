@@ -1,21 +1,30 @@
 package cke
 
 import (
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"net"
+	"net/url"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/containernetworking/cni/libcni"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	v1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/clientcmd"
+	kubecontrollermanagerv1alpha1 "k8s.io/kube-controller-manager/config/v1alpha1"
+	kubeproxyv1alpha1 "k8s.io/kube-proxy/config/v1alpha1"
 	schedulerv1beta1 "k8s.io/kube-scheduler/config/v1beta1"
 	kubeletv1beta1 "k8s.io/kubelet/config/v1beta1"
 	"sigs.k8s.io/yaml"
@@ -27,11 +36,27 @@ type Node struct {
 	Hostname     string            `json:"hostname"`
 	User         string            `json:"user"`
 	ControlPlane bool              `json:"control_plane"`
+	Etcd         *bool             `json:"etcd,omitempty"`
 	Annotations  map[string]string `json:"annotations"`
 	Labels       map[string]string `json:"labels"`
 	Taints       []corev1.Taint    `json:"taints"`
 }
 
+// IsEtcdMember returns true if etcd runs on the node.
+// If Etcd is not specified, etcd runs on control plane nodes.
+func (n *Node) IsEtcdMember() bool {
+	if n.Etcd != nil {
+		return *n.Etcd
+	}
+	return n.ControlPlane
+}
+
+// IsKubernetesNode returns true if the node runs kubelet and kube-proxy.
+// Dedicated etcd nodes, which run etcd but are not control plane nodes, do not.
+func (n *Node) IsKubernetesNode() bool {
+	return n.ControlPlane || !n.IsEtcdMember()
+}
+
 // Nodename returns a hostname or address if hostname is empty
 func (n *Node) Nodename() string {
 	if len(n.Hostname) == 0 {
@@ -108,9 +133,150 @@ type EtcdParams struct {
 
 // APIServerParams is a set of extra parameters for kube-apiserver.
 type APIServerParams struct {
-	ServiceParams   `json:",inline"`
-	AuditLogEnabled bool   `json:"audit_log_enabled"`
-	AuditLogPolicy  string `json:"audit_log_policy"`
+	ServiceParams     `json:",inline"`
+	CertificateParams `json:",inline"`
+	AuditLogEnabled   bool             `json:"audit_log_enabled"`
+	AuditLogPolicy    string           `json:"audit_log_policy"`
+	Encryption        EncryptionParams `json:"encryption"`
+	OIDC              *OIDCParams      `json:"oidc,omitempty"`
+
+	// AuditLogPath is the path of audit log files.  Empty or "-" means standard output.
+	AuditLogPath      string              `json:"audit_log_path,omitempty"`
+	AuditLogMaxAge    int                 `json:"audit_log_max_age,omitempty"`
+	AuditLogMaxBackup int                 `json:"audit_log_max_backup,omitempty"`
+	AuditLogMaxSize   int                 `json:"audit_log_max_size,omitempty"`
+	AuditWebhook      *AuditWebhookParams `json:"audit_webhook,omitempty"`
+
+	Admission AdmissionParams `json:"admission"`
+
+	// RevocationWebhook configures the authorization webhook to deny requests
+	// with revoked user certificates.
+	RevocationWebhook *RevocationWebhookParams `json:"revocation_webhook,omitempty"`
+}
+
+// AuditLogToFile returns true if audit logs are written to files.
+func (p APIServerParams) AuditLogToFile() bool {
+	return len(p.AuditLogPath) > 0 && p.AuditLogPath != "-"
+}
+
+// AdmissionParams is a set of parameters for admission control of kube-apiserver.
+type AdmissionParams struct {
+	// EnablePlugins are admission plugins enabled in addition to the default ones.
+	EnablePlugins []string `json:"enable_plugins,omitempty"`
+	// DisablePlugins are admission plugins to be disabled.
+	DisablePlugins []string `json:"disable_plugins,omitempty"`
+
+	// PluginConfig is the configurations of admission plugins keyed by the plugin name.
+	// They are rendered into an AdmissionConfiguration file.
+	PluginConfig map[string]*unstructured.Unstructured `json:"plugin_config,omitempty"`
+
+	// SkipPodSecurityPolicy stops CKE from applying the static PodSecurityPolicy resources.
+	SkipPodSecurityPolicy bool `json:"skip_pod_security_policy,omitempty"`
+}
+
+// Audit webhook modes.
+// https://kubernetes.io/docs/tasks/debug-application-cluster/audit/#webhook-backend
+const (
+	AuditWebhookModeBatch          = "batch"
+	AuditWebhookModeBlocking       = "blocking"
+	AuditWebhookModeBlockingStrict = "blocking-strict"
+)
+
+// AuditWebhookParams is a set of parameters for the webhook backend of audit logs.
+//
+// Either Kubeconfig or URL must be specified.  If URL is specified, CKE renders
+// a kubeconfig file to send events to URL.
+type AuditWebhookParams struct {
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	URL        string `json:"url,omitempty"`
+	// CACert is x509 certificate in PEM format of the webhook server CA.
+	CACert string `json:"ca_cert,omitempty"`
+
+	Mode           string `json:"mode,omitempty"`
+	BatchMaxSize   int    `json:"batch_max_size,omitempty"`
+	BatchMaxWait   string `json:"batch_max_wait,omitempty"`
+	InitialBackoff string `json:"initial_backoff,omitempty"`
+}
+
+// GetMode returns the mode of the webhook backend.
+func (p *AuditWebhookParams) GetMode() string {
+	if len(p.Mode) == 0 {
+		return AuditWebhookModeBatch
+	}
+	return p.Mode
+}
+
+// RevocationWebhookParams is a set of parameters for the authorization webhook
+// served by CKE to deny requests with revoked user certificates.
+type RevocationWebhookParams struct {
+	// URL is the URL of "/authorize" endpoint of CKE.
+	URL string `json:"url"`
+	// CACert is x509 certificate in PEM format of the CA of CKE server.
+	CACert string `json:"ca_cert,omitempty"`
+}
+
+// OIDCParams is a set of parameters for OpenID Connect authentication.
+// https://kubernetes.io/docs/reference/access-authn-authz/authentication/#openid-connect-tokens
+type OIDCParams struct {
+	IssuerURL      string            `json:"issuer_url"`
+	ClientID       string            `json:"client_id"`
+	UsernameClaim  string            `json:"username_claim,omitempty"`
+	UsernamePrefix string            `json:"username_prefix,omitempty"`
+	GroupsClaim    string            `json:"groups_claim,omitempty"`
+	GroupsPrefix   string            `json:"groups_prefix,omitempty"`
+	RequiredClaims map[string]string `json:"required_claims,omitempty"`
+
+	// CACert is x509 certificate in PEM format of the issuer CA.
+	CACert string `json:"ca_cert,omitempty"`
+}
+
+// EncryptionProvider is the type of encryption providers for data at rest.
+type EncryptionProvider string
+
+// Encryption providers.
+const (
+	EncryptionProviderAESCBC = EncryptionProvider("aescbc")
+	EncryptionProviderKMS    = EncryptionProvider("kms")
+)
+
+// DefaultKMSTransitKey is the default name of the key in Vault transit engine.
+const DefaultKMSTransitKey = "k8s"
+
+// EncryptionParams is a set of parameters for encryption of resource data at rest.
+type EncryptionParams struct {
+	Provider  EncryptionProvider `json:"provider,omitempty"`
+	Resources []string           `json:"resources,omitempty"`
+	KMS       KMSParams          `json:"kms"`
+}
+
+// KMSParams is a set of parameters for the KMS plugin.
+type KMSParams struct {
+	// TransitKey is the name of the key in Vault transit engine.
+	TransitKey string `json:"transit_key,omitempty"`
+}
+
+// GetProvider returns the encryption provider.
+func (p EncryptionParams) GetProvider() EncryptionProvider {
+	if len(p.Provider) == 0 {
+		return EncryptionProviderAESCBC
+	}
+	return p.Provider
+}
+
+// GetResources returns the list of resources to be encrypted.
+func (p EncryptionParams) GetResources() []string {
+	if len(p.Resources) == 0 {
+		return []string{"secrets"}
+	}
+	return p.Resources
+}
+
+// GetTransitKey returns the name of the key in Vault transit engine.
+func (p KMSParams) GetTransitKey() string {
+	if len(p.TransitKey) == 0 {
+		return DefaultKMSTransitKey
+	}
+	return p.TransitKey
 }
 
 // CNIConfFile is a config file for CNI plugin deployed on worker nodes by CKE.
@@ -119,36 +285,65 @@ type CNIConfFile struct {
 	Content string `json:"content"`
 }
 
+// mergeComponentConfig merges the component configuration `config` given by users into `cfg`.
+func mergeComponentConfig(component string, gvk schema.GroupVersionKind, config *unstructured.Unstructured, cfg interface{}) error {
+	// FOR IMPLEMENTORS.
+	// DO NOT SUPPORT MORE THAN ONE ComponentConfig VERSIONS.
+	// When we need to upgrade the component config version, users will
+	// stop CKE, update cluster.yml in etcd, then start the new CKE.
+	// So, CKE should only support the latest config version.
+	if config.GetAPIVersion() != gvk.GroupVersion().String() {
+		return fmt.Errorf("unexpected %s API version: %s", component, config.GetAPIVersion())
+	}
+	if config.GetKind() != gvk.Kind {
+		return fmt.Errorf("wrong kind for %s config: %s", component, config.GetKind())
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, cfg)
+}
+
 // SchedulerParams is a set of extra parameters for kube-scheduler.
 type SchedulerParams struct {
-	ServiceParams `json:",inline"`
-	Config        *unstructured.Unstructured `json:"config,omitempty"`
+	ServiceParams     `json:",inline"`
+	CertificateParams `json:",inline"`
+	Config            *unstructured.Unstructured `json:"config,omitempty"`
 }
 
 // MergeConfig merges the input struct `base`.
 func (p SchedulerParams) MergeConfig(base *schedulerv1beta1.KubeSchedulerConfiguration) (*schedulerv1beta1.KubeSchedulerConfiguration, error) {
-	// FOR IMPLEMENTORS.
-	// DO NOT SUPPORT MORE THAN ONE ComponentConfig VERSIONS.
-	// When we need to upgrade the component config version, users will
-	// stop CKE, update cluster.yml in etcd, then start the new CKE.
-	// So, CKE should only support the latest config version.
 	cfg := *base
 	if p.Config == nil {
 		return &cfg, nil
 	}
 
-	if p.Config.GetAPIVersion() != schedulerv1beta1.SchemeGroupVersion.String() {
-		return nil, fmt.Errorf("unexpected kube-scheduler API version: %s", p.Config.GetAPIVersion())
-	}
-	if p.Config.GetKind() != "KubeSchedulerConfiguration" {
-		return nil, fmt.Errorf("wrong kind for kube-scheduler config: %s", p.Config.GetKind())
-	}
-
-	data, err := json.Marshal(p.Config)
+	err := mergeComponentConfig("kube-scheduler", schedulerv1beta1.SchemeGroupVersion.WithKind("KubeSchedulerConfiguration"), p.Config, &cfg)
 	if err != nil {
 		return nil, err
 	}
-	err = json.Unmarshal(data, &cfg)
+
+	cfg.TypeMeta = metav1.TypeMeta{}
+	return &cfg, nil
+}
+
+// ControllerManagerParams is a set of extra parameters for kube-controller-manager.
+type ControllerManagerParams struct {
+	ServiceParams     `json:",inline"`
+	CertificateParams `json:",inline"`
+	Config            *unstructured.Unstructured `json:"config,omitempty"`
+}
+
+// MergeConfig merges the input struct with `base`.
+func (p ControllerManagerParams) MergeConfig(base *kubecontrollermanagerv1alpha1.KubeControllerManagerConfiguration) (*kubecontrollermanagerv1alpha1.KubeControllerManagerConfiguration, error) {
+	cfg := *base
+	if p.Config == nil {
+		return &cfg, nil
+	}
+
+	err := mergeComponentConfig("kube-controller-manager", kubecontrollermanagerv1alpha1.SchemeGroupVersion.WithKind("KubeControllerManagerConfiguration"), p.Config, &cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -159,8 +354,26 @@ func (p SchedulerParams) MergeConfig(base *schedulerv1beta1.KubeSchedulerConfigu
 
 // ProxyParams is a set of extra parameters for kube-proxy.
 type ProxyParams struct {
-	ServiceParams `json:",inline"`
-	Mode          ProxyMode `json:"mode"`
+	ServiceParams     `json:",inline"`
+	CertificateParams `json:",inline"`
+	Mode              ProxyMode                  `json:"mode"`
+	Config            *unstructured.Unstructured `json:"config,omitempty"`
+}
+
+// MergeConfig merges the input struct with `base`.
+func (p ProxyParams) MergeConfig(base *kubeproxyv1alpha1.KubeProxyConfiguration) (*kubeproxyv1alpha1.KubeProxyConfiguration, error) {
+	cfg := *base
+	if p.Config == nil {
+		return &cfg, nil
+	}
+
+	err := mergeComponentConfig("kube-proxy", kubeproxyv1alpha1.SchemeGroupVersion.WithKind("KubeProxyConfiguration"), p.Config, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.TypeMeta = metav1.TypeMeta{}
+	return &cfg, nil
 }
 
 // GetMode returns the proxy mode.
@@ -192,38 +405,23 @@ func (m ProxyMode) Validate() error {
 
 // KubeletParams is a set of extra parameters for kubelet.
 type KubeletParams struct {
-	ServiceParams    `json:",inline"`
-	BootTaints       []corev1.Taint             `json:"boot_taints"`
-	CNIConfFile      CNIConfFile                `json:"cni_conf_file"`
-	Config           *unstructured.Unstructured `json:"config,omitempty"`
-	ContainerRuntime string                     `json:"container_runtime"`
-	CRIEndpoint      string                     `json:"cri_endpoint"`
+	ServiceParams     `json:",inline"`
+	CertificateParams `json:",inline"`
+	BootTaints        []corev1.Taint             `json:"boot_taints"`
+	CNIConfFile       CNIConfFile                `json:"cni_conf_file"`
+	Config            *unstructured.Unstructured `json:"config,omitempty"`
+	ContainerRuntime  string                     `json:"container_runtime"`
+	CRIEndpoint       string                     `json:"cri_endpoint"`
 }
 
 // MergeConfig merges the input struct with `base`.
 func (p KubeletParams) MergeConfig(base *kubeletv1beta1.KubeletConfiguration) (*kubeletv1beta1.KubeletConfiguration, error) {
-	// FOR IMPLEMENTORS.
-	// DO NOT SUPPORT MORE THAN ONE ComponentConfig VERSIONS.
-	// When we need to upgrade the component config version, users will
-	// stop CKE, update cluster.yml in etcd, then start the new CKE.
-	// So, CKE should only support the latest config version.
 	cfg := *base
 	if p.Config == nil {
 		return &cfg, nil
 	}
 
-	if p.Config.GetAPIVersion() != kubeletv1beta1.SchemeGroupVersion.String() {
-		return nil, fmt.Errorf("unexpected kubelet API version: %s", p.Config.GetAPIVersion())
-	}
-	if p.Config.GetKind() != "KubeletConfiguration" {
-		return nil, fmt.Errorf("wrong kind for kubelet config: %s", p.Config.GetKind())
-	}
-
-	data, err := json.Marshal(p.Config)
-	if err != nil {
-		return nil, err
-	}
-	err = json.Unmarshal(data, &cfg)
+	err := mergeComponentConfig("kubelet", kubeletv1beta1.SchemeGroupVersion.WithKind("KubeletConfiguration"), p.Config, &cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -240,28 +438,105 @@ type Reboot struct {
 	ProtectedNamespaces    *metav1.LabelSelector `json:"protected_namespaces,omitempty"`
 }
 
+// Default values for EtcdBackup.
+const (
+	DefaultEtcdBackupInterval = 24 * time.Hour
+	DefaultEtcdBackupRotate   = 14
+)
+
+// EtcdBackup is a set of configurations for scheduled etcd backups.
+type EtcdBackup struct {
+	Enabled  bool               `json:"enabled"`
+	Interval string             `json:"interval,omitempty"`
+	Rotate   int                `json:"rotate,omitempty"`
+	MaxAge   string             `json:"max_age,omitempty"`
+	Targets  []EtcdBackupTarget `json:"targets"`
+}
+
+// GetInterval returns the interval between backups.
+func (b EtcdBackup) GetInterval() time.Duration {
+	if len(b.Interval) == 0 {
+		return DefaultEtcdBackupInterval
+	}
+	d, err := time.ParseDuration(b.Interval)
+	if err != nil {
+		return DefaultEtcdBackupInterval
+	}
+	return d
+}
+
+// GetRotate returns the maximum number of backups to keep.
+func (b EtcdBackup) GetRotate() int {
+	if b.Rotate == 0 {
+		return DefaultEtcdBackupRotate
+	}
+	return b.Rotate
+}
+
+// GetMaxAge returns the maximum age of backups to keep.
+// Zero means that backups are not removed by their age.
+func (b EtcdBackup) GetMaxAge() time.Duration {
+	if len(b.MaxAge) == 0 {
+		return 0
+	}
+	d, err := time.ParseDuration(b.MaxAge)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// EtcdBackupTarget is a destination of etcd backups.
+// Exactly one of Local or S3 must be specified.
+type EtcdBackupTarget struct {
+	Name  string                 `json:"name"`
+	Local *EtcdBackupLocalTarget `json:"local,omitempty"`
+	S3    *EtcdBackupS3Target    `json:"s3,omitempty"`
+}
+
+// EtcdBackupLocalTarget stores backups in a directory of a node.
+type EtcdBackupLocalTarget struct {
+	Node string `json:"node"`
+	Dir  string `json:"dir"`
+}
+
+// EtcdBackupS3Target stores backups in an S3-compatible object storage.
+// Credentials are read from Vault.  See EtcdBackupSecret.
+type EtcdBackupS3Target struct {
+	Endpoint string `json:"endpoint"`
+	Region   string `json:"region,omitempty"`
+	Bucket   string `json:"bucket"`
+	Prefix   string `json:"prefix,omitempty"`
+	CACert   string `json:"ca_cert,omitempty"`
+}
+
 // Options is a set of optional parameters for k8s components.
 type Options struct {
-	Etcd              EtcdParams      `json:"etcd"`
-	Rivers            ServiceParams   `json:"rivers"`
-	EtcdRivers        ServiceParams   `json:"etcd-rivers"`
-	APIServer         APIServerParams `json:"kube-api"`
-	ControllerManager ServiceParams   `json:"kube-controller-manager"`
-	Scheduler         SchedulerParams `json:"kube-scheduler"`
-	Proxy             ProxyParams     `json:"kube-proxy"`
-	Kubelet           KubeletParams   `json:"kubelet"`
+	Etcd              EtcdParams              `json:"etcd"`
+	Rivers            ServiceParams           `json:"rivers"`
+	EtcdRivers        ServiceParams           `json:"etcd-rivers"`
+	KMSPlugin         ServiceParams           `json:"kms-plugin"`
+	APIServer         APIServerParams         `json:"kube-api"`
+	ControllerManager ControllerManagerParams `json:"kube-controller-manager"`
+	Scheduler         SchedulerParams         `json:"kube-scheduler"`
+	Proxy             ProxyParams             `json:"kube-proxy"`
+	Kubelet           KubeletParams           `json:"kubelet"`
 }
 
 // Cluster is a set of configurations for a etcd/Kubernetes cluster.
 type Cluster struct {
-	Name          string   `json:"name"`
-	Nodes         []*Node  `json:"nodes"`
-	TaintCP       bool     `json:"taint_control_plane"`
-	ServiceSubnet string   `json:"service_subnet"`
-	DNSServers    []string `json:"dns_servers"`
-	DNSService    string   `json:"dns_service"`
-	Reboot        Reboot   `json:"reboot"`
-	Options       Options  `json:"options"`
+	Name          string     `json:"name"`
+	Nodes         []*Node    `json:"nodes"`
+	TaintCP       bool       `json:"taint_control_plane"`
+	ServiceSubnet string     `json:"service_subnet"`
+	DNSServers    []string   `json:"dns_servers"`
+	DNSService    string     `json:"dns_service"`
+	Reboot        Reboot     `json:"reboot"`
+	EtcdBackup    EtcdBackup `json:"etcd_backup"`
+	Options       Options    `json:"options"`
+
+	// FeatureGates are Kubernetes feature gates set to all components.
+	FeatureGates map[string]bool `json:"feature_gates,omitempty"`
 }
 
 // Validate validates the cluster definition.
@@ -270,11 +545,6 @@ func (c *Cluster) Validate(isTmpl bool) error {
 		return errors.New("cluster name is empty")
 	}
 
-	_, _, err := net.ParseCIDR(c.ServiceSubnet)
-	if err != nil {
-		return err
-	}
-
 	fldPath := field.NewPath("nodes")
 	nodeAddressSet := make(map[string]struct{})
 	for i, n := range c.Nodes {
@@ -290,6 +560,10 @@ func (c *Cluster) Validate(isTmpl bool) error {
 		}
 	}
 
+	if !isTmpl && len(ControlPlanes(c.Nodes)) > 0 && len(EtcdNodes(c.Nodes)) == 0 {
+		return errors.New("no etcd nodes")
+	}
+
 	for _, a := range c.DNSServers {
 		if net.ParseIP(a) == nil {
 			return errors.New("invalid IP address: " + a)
@@ -303,7 +577,17 @@ func (c *Cluster) Validate(isTmpl bool) error {
 		}
 	}
 
-	err = validateReboot(c.Reboot)
+	err := validateReboot(c.Reboot)
+	if err != nil {
+		return err
+	}
+
+	err = validateEtcdBackup(c.EtcdBackup, c.Nodes, isTmpl)
+	if err != nil {
+		return err
+	}
+
+	err = validateFeatureGates(c.FeatureGates)
 	if err != nil {
 		return err
 	}
@@ -313,6 +597,11 @@ func (c *Cluster) Validate(isTmpl bool) error {
 		return err
 	}
 
+	err = validateIPFamilies(c, isTmpl)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -410,10 +699,32 @@ func ControlPlanes(nodes []*Node) []*Node {
 	})
 }
 
-// Workers returns workers []*Node
+// EtcdNodes returns nodes that run etcd.
+func EtcdNodes(nodes []*Node) []*Node {
+	return filterNodes(nodes, func(n *Node) bool {
+		return n.IsEtcdMember()
+	})
+}
+
+// EtcdOnlyNodes returns nodes that run etcd but are not control plane nodes.
+func EtcdOnlyNodes(nodes []*Node) []*Node {
+	return filterNodes(nodes, func(n *Node) bool {
+		return !n.ControlPlane && n.IsEtcdMember()
+	})
+}
+
+// KubernetesNodes returns nodes that run kubelet and kube-proxy.
+func KubernetesNodes(nodes []*Node) []*Node {
+	return filterNodes(nodes, func(n *Node) bool {
+		return n.IsKubernetesNode()
+	})
+}
+
+// Workers returns workers []*Node.
+// Dedicated etcd nodes are not workers.
 func Workers(nodes []*Node) []*Node {
 	return filterNodes(nodes, func(n *Node) bool {
-		return !n.ControlPlane
+		return !n.ControlPlane && n.IsKubernetesNode()
 	})
 }
 
@@ -442,6 +753,100 @@ func validateReboot(reboot Reboot) error {
 	return nil
 }
 
+// etcdBackupDirRegexp restricts local backup directories to be safe in shell commands.
+var etcdBackupDirRegexp = regexp.MustCompile(`^[0-9A-Za-z_./-]+$`)
+
+func validateEtcdBackup(b EtcdBackup, nodes []*Node, isTmpl bool) error {
+	if !b.Enabled {
+		return nil
+	}
+
+	if len(b.Interval) > 0 {
+		d, err := time.ParseDuration(b.Interval)
+		if err != nil {
+			return fmt.Errorf("invalid etcd_backup.interval: %w", err)
+		}
+		if d < time.Minute {
+			return errors.New("etcd_backup.interval must be one minute or longer")
+		}
+	}
+	if b.Rotate < 0 {
+		return errors.New("etcd_backup.rotate must not be negative")
+	}
+	if len(b.MaxAge) > 0 {
+		d, err := time.ParseDuration(b.MaxAge)
+		if err != nil {
+			return fmt.Errorf("invalid etcd_backup.max_age: %w", err)
+		}
+		if d <= 0 {
+			return errors.New("etcd_backup.max_age must be positive")
+		}
+	}
+
+	if len(b.Targets) == 0 {
+		return errors.New("etcd_backup.targets is empty")
+	}
+	names := make(map[string]bool)
+	for _, t := range b.Targets {
+		msgs := validation.IsDNS1123Label(t.Name)
+		if len(msgs) > 0 {
+			return fmt.Errorf("invalid etcd backup target name %q: %s", t.Name, strings.Join(msgs, ";"))
+		}
+		if names[t.Name] {
+			return errors.New("duplicate etcd backup target: " + t.Name)
+		}
+		names[t.Name] = true
+
+		switch {
+		case t.Local != nil && t.S3 != nil:
+			return errors.New("etcd backup target must have only one of local or s3: " + t.Name)
+		case t.Local != nil:
+			if !filepath.IsAbs(t.Local.Dir) {
+				return errors.New("etcd backup directory must be absolute: " + t.Local.Dir)
+			}
+			if !etcdBackupDirRegexp.MatchString(t.Local.Dir) {
+				return errors.New("etcd backup directory must consist of alphanumerics, '.', '_', '-', and '/': " + t.Local.Dir)
+			}
+			if isTmpl {
+				continue
+			}
+			found := false
+			for _, n := range nodes {
+				if n.Address == t.Local.Node {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return errors.New("etcd backup node is not in the cluster: " + t.Local.Node)
+			}
+		case t.S3 != nil:
+			u, err := url.Parse(t.S3.Endpoint)
+			if err != nil {
+				return err
+			}
+			if u.Scheme != "http" && u.Scheme != "https" {
+				return errors.New("invalid S3 endpoint: " + t.S3.Endpoint)
+			}
+			if len(t.S3.Bucket) == 0 {
+				return errors.New("S3 bucket is empty: " + t.Name)
+			}
+			if len(t.S3.CACert) > 0 {
+				block, _ := pem.Decode([]byte(t.S3.CACert))
+				if block == nil {
+					return errors.New("invalid PEM data in S3 ca_cert: " + t.Name)
+				}
+				if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+					return fmt.Errorf("invalid S3 ca_cert for %s: %w", t.Name, err)
+				}
+			}
+		default:
+			return errors.New("etcd backup target must have local or s3: " + t.Name)
+		}
+	}
+	return nil
+}
+
 func validateOptions(opts Options) error {
 	v := func(binds []Mount) error {
 		for _, m := range binds {
@@ -480,6 +885,18 @@ func validateOptions(opts Options) error {
 		return err
 	}
 
+	for _, p := range []CertificateParams{
+		opts.APIServer.CertificateParams,
+		opts.ControllerManager.CertificateParams,
+		opts.Scheduler.CertificateParams,
+		opts.Proxy.CertificateParams,
+		opts.Kubelet.CertificateParams,
+	} {
+		if err := validateCertificateParams(p); err != nil {
+			return err
+		}
+	}
+
 	base := &kubeletv1beta1.KubeletConfiguration{}
 	kubeletConfig, err := opts.Kubelet.MergeConfig(base)
 	if err != nil {
@@ -547,6 +964,30 @@ func validateOptions(opts Options) error {
 		}
 	}
 
+	if err := validateAudit(opts.APIServer); err != nil {
+		return err
+	}
+
+	if w := opts.APIServer.RevocationWebhook; w != nil {
+		if err := validateRevocationWebhook(w); err != nil {
+			return err
+		}
+	}
+
+	if err := validateEncryption(opts.APIServer.Encryption); err != nil {
+		return err
+	}
+
+	if opts.APIServer.OIDC != nil {
+		if err := validateOIDC(opts.APIServer.OIDC); err != nil {
+			return err
+		}
+	}
+
+	if err := validateAdmission(opts.APIServer.Admission); err != nil {
+		return err
+	}
+
 	if _, err := opts.Scheduler.MergeConfig(&schedulerv1beta1.KubeSchedulerConfiguration{}); err != nil {
 		return err
 	}
@@ -557,5 +998,325 @@ func validateOptions(opts Options) error {
 		}
 	}
 
+	kcmConfig, err := opts.ControllerManager.MergeConfig(&kubecontrollermanagerv1alpha1.KubeControllerManagerConfiguration{})
+	if err != nil {
+		return err
+	}
+	if err := validateControllerManagerConfig(kcmConfig); err != nil {
+		return err
+	}
+
+	proxyConfig, err := opts.Proxy.MergeConfig(&kubeproxyv1alpha1.KubeProxyConfiguration{})
+	if err != nil {
+		return err
+	}
+	if err := validateProxyConfig(opts.Proxy.Mode, proxyConfig); err != nil {
+		return err
+	}
+	if err := validateProxyArgs(opts.Proxy.ExtraArguments); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func validateControllerManagerConfig(cfg *kubecontrollermanagerv1alpha1.KubeControllerManagerConfiguration) error {
+	// kube-controller-manager does not read configuration files.
+	// Clear the fields that CKE passes as command-line flags, and reject the others.
+	// Keep this in sync with controllerManagerConfigArgs in op/k8s.
+	c := cfg.DeepCopy()
+	c.Generic.Controllers = nil
+	c.Generic.MinResyncPeriod = metav1.Duration{}
+	c.KubeCloudShared.ClusterCIDR = ""
+	c.KubeCloudShared.AllocateNodeCIDRs = false
+	c.KubeCloudShared.NodeMonitorPeriod = metav1.Duration{}
+	c.NodeIPAMController.NodeCIDRMaskSize = 0
+	c.NodeIPAMController.NodeCIDRMaskSizeIPv4 = 0
+	c.NodeIPAMController.NodeCIDRMaskSizeIPv6 = 0
+	c.NodeLifecycleController.NodeMonitorGracePeriod = metav1.Duration{}
+	c.NodeLifecycleController.NodeStartupGracePeriod = metav1.Duration{}
+	c.NodeLifecycleController.PodEvictionTimeout = metav1.Duration{}
+	c.PodGCController.TerminatedPodGCThreshold = 0
+	c.GarbageCollectorController.ConcurrentGCSyncs = 0
+	c.DeploymentController.ConcurrentDeploymentSyncs = 0
+	c.ReplicaSetController.ConcurrentRSSyncs = 0
+	if !reflect.DeepEqual(c, &kubecontrollermanagerv1alpha1.KubeControllerManagerConfiguration{}) {
+		return errors.New("unsupported fields in kube-controller-manager config")
+	}
+
+	if len(cfg.KubeCloudShared.ClusterCIDR) > 0 {
+		for _, cidr := range strings.Split(cfg.KubeCloudShared.ClusterCIDR, ",") {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return fmt.Errorf("invalid clusterCIDR in kube-controller-manager config: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// ipvsSchedulers are the IPVS schedulers supported by kube-proxy.
+var ipvsSchedulers = map[string]bool{
+	"rr": true, "wrr": true, "lc": true, "wlc": true, "lblc": true,
+	"lblcr": true, "dh": true, "sh": true, "sed": true, "nq": true,
+}
+
+// proxyArgsWithConfig are the command-line flags of kube-proxy that are
+// not overridden by the configuration file.  They are logging flags and --master.
+var proxyArgsWithConfig = map[string]bool{
+	"add-dir-header": true, "alsologtostderr": true, "log-backtrace-at": true,
+	"log-dir": true, "log-file": true, "log-file-max-size": true,
+	"log-flush-frequency": true, "logtostderr": true, "master": true,
+	"one-output": true, "skip-headers": true, "skip-log-headers": true,
+	"stderrthreshold": true, "v": true, "vmodule": true,
+}
+
+// validateProxyArgs rejects flags in extra_args of kube-proxy that
+// correspond to the fields of KubeProxyConfiguration.
+// kube-proxy ignores such flags as it runs with a configuration file.
+func validateProxyArgs(args []string) error {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+		if !proxyArgsWithConfig[name] {
+			return fmt.Errorf("kube-proxy flag %s is not allowed; use config instead", arg)
+		}
+	}
+	return nil
+}
+
+func validateProxyConfig(mode ProxyMode, cfg *kubeproxyv1alpha1.KubeProxyConfiguration) error {
+	if len(cfg.Mode) > 0 {
+		if err := ProxyMode(cfg.Mode).Validate(); err != nil {
+			return err
+		}
+		if len(mode) > 0 && mode != ProxyMode(cfg.Mode) {
+			return errors.New("kube-proxy mode conflicts with mode in config: " + string(cfg.Mode))
+		}
+	}
+	if len(cfg.IPVS.Scheduler) > 0 && !ipvsSchedulers[cfg.IPVS.Scheduler] {
+		return errors.New("invalid IPVS scheduler: " + cfg.IPVS.Scheduler)
+	}
+	for _, addr := range cfg.NodePortAddresses {
+		if _, _, err := net.ParseCIDR(addr); err != nil {
+			return fmt.Errorf("invalid nodePortAddresses in kube-proxy config: %w", err)
+		}
+	}
+	if len(cfg.HostnameOverride) > 0 || len(cfg.ClientConnection.Kubeconfig) > 0 {
+		return errors.New("hostnameOverride and clientConnection.kubeconfig in kube-proxy config are managed by CKE")
+	}
+	return nil
+}
+
+func validateEncryption(p EncryptionParams) error {
+	switch p.GetProvider() {
+	case EncryptionProviderAESCBC, EncryptionProviderKMS:
+	default:
+		return errors.New("invalid encryption provider: " + string(p.Provider))
+	}
+
+	resources := make(map[string]bool)
+	for _, r := range p.Resources {
+		if len(r) == 0 {
+			return errors.New("encryption resource is empty")
+		}
+		if resources[r] {
+			return errors.New("duplicate encryption resource: " + r)
+		}
+		resources[r] = true
+	}
+
+	if len(p.KMS.TransitKey) > 0 {
+		if msgs := validation.IsDNS1123Label(p.KMS.TransitKey); len(msgs) > 0 {
+			return errors.New("invalid transit key name: " + strings.Join(msgs, ";"))
+		}
+	}
+	return nil
+}
+
+func validateOIDC(p *OIDCParams) error {
+	u, err := url.Parse(p.IssuerURL)
+	if err != nil {
+		return fmt.Errorf("invalid OIDC issuer_url: %w", err)
+	}
+	// API server accepts only https issuers without query nor fragment.
+	if u.Scheme != "https" || len(u.Host) == 0 {
+		return errors.New("OIDC issuer_url must be an https URL: " + p.IssuerURL)
+	}
+	if len(u.RawQuery) > 0 || len(u.Fragment) > 0 {
+		return errors.New("OIDC issuer_url must not have query or fragment: " + p.IssuerURL)
+	}
+	if len(p.ClientID) == 0 {
+		return errors.New("OIDC client_id is empty")
+	}
+	for k := range p.RequiredClaims {
+		if len(k) == 0 || strings.ContainsAny(k, "=,") {
+			return errors.New("invalid OIDC required claim: " + k)
+		}
+	}
+	if len(p.CACert) > 0 {
+		block, _ := pem.Decode([]byte(p.CACert))
+		if block == nil {
+			return errors.New("invalid PEM data in OIDC ca_cert")
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return fmt.Errorf("invalid OIDC ca_cert: %w", err)
+		}
+	}
+	return nil
+}
+
+func validateAdmission(p AdmissionParams) error {
+	enabled := make(map[string]bool)
+	for _, name := range p.EnablePlugins {
+		if len(name) == 0 || strings.Contains(name, ",") {
+			return errors.New("invalid admission plugin name: " + name)
+		}
+		if enabled[name] {
+			return errors.New("duplicate admission plugin: " + name)
+		}
+		enabled[name] = true
+	}
+
+	disabled := make(map[string]bool)
+	for _, name := range p.DisablePlugins {
+		if len(name) == 0 || strings.Contains(name, ",") {
+			return errors.New("invalid admission plugin name: " + name)
+		}
+		if disabled[name] {
+			return errors.New("duplicate admission plugin: " + name)
+		}
+		if enabled[name] {
+			return errors.New("admission plugin is both enabled and disabled: " + name)
+		}
+		disabled[name] = true
+	}
+
+	for name, cfg := range p.PluginConfig {
+		if len(name) == 0 {
+			return errors.New("admission plugin name is empty in plugin_config")
+		}
+		if disabled[name] {
+			return errors.New("configuration for disabled admission plugin: " + name)
+		}
+		if cfg == nil || len(cfg.GetAPIVersion()) == 0 || len(cfg.GetKind()) == 0 {
+			return errors.New("admission plugin configuration must have apiVersion and kind: " + name)
+		}
+		if _, err := cfg.MarshalJSON(); err != nil {
+			return fmt.Errorf("invalid configuration for admission plugin %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func validateAudit(p APIServerParams) error {
+	hasOptions := len(p.AuditLogPath) > 0 || p.AuditLogMaxAge != 0 || p.AuditLogMaxBackup != 0 ||
+		p.AuditLogMaxSize != 0 || p.AuditWebhook != nil
+	if !p.AuditLogEnabled {
+		if hasOptions {
+			return errors.New("audit log options require audit_log_enabled")
+		}
+		return nil
+	}
+
+	if p.AuditLogToFile() {
+		if !filepath.IsAbs(p.AuditLogPath) || filepath.Clean(p.AuditLogPath) != p.AuditLogPath {
+			return errors.New("audit_log_path must be a clean absolute path: " + p.AuditLogPath)
+		}
+		if filepath.Dir(p.AuditLogPath) == "/" || strings.HasPrefix(p.AuditLogPath, "/etc/kubernetes/") {
+			return errors.New("audit_log_path must be in a dedicated directory: " + p.AuditLogPath)
+		}
+	} else if p.AuditLogMaxAge != 0 || p.AuditLogMaxBackup != 0 || p.AuditLogMaxSize != 0 {
+		return errors.New("audit log rotation requires audit_log_path to a file")
+	}
+	if p.AuditLogMaxAge < 0 || p.AuditLogMaxBackup < 0 || p.AuditLogMaxSize < 0 {
+		return errors.New("audit log rotation parameters must not be negative")
+	}
+
+	if p.AuditWebhook != nil {
+		return validateAuditWebhook(p.AuditWebhook)
+	}
+	return nil
+}
+
+func validateRevocationWebhook(w *RevocationWebhookParams) error {
+	u, err := url.Parse(w.URL)
+	if err != nil {
+		return fmt.Errorf("invalid revocation_webhook url: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return errors.New("invalid revocation_webhook url: " + w.URL)
+	}
+
+	if len(w.CACert) > 0 {
+		block, _ := pem.Decode([]byte(w.CACert))
+		if block == nil {
+			return errors.New("invalid PEM data in revocation_webhook ca_cert")
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return fmt.Errorf("invalid revocation_webhook ca_cert: %w", err)
+		}
+	}
+	return nil
+}
+
+func validateAuditWebhook(w *AuditWebhookParams) error {
+	switch {
+	case len(w.Kubeconfig) > 0 && len(w.URL) > 0:
+		return errors.New("audit_webhook must not have both kubeconfig and url")
+	case len(w.Kubeconfig) > 0:
+		if len(w.CACert) > 0 {
+			return errors.New("audit_webhook ca_cert must be specified in kubeconfig")
+		}
+		cfg, err := clientcmd.Load([]byte(w.Kubeconfig))
+		if err != nil {
+			return fmt.Errorf("invalid audit_webhook kubeconfig: %w", err)
+		}
+		if len(cfg.Clusters) == 0 {
+			return errors.New("no clusters in audit_webhook kubeconfig")
+		}
+	case len(w.URL) > 0:
+		u, err := url.Parse(w.URL)
+		if err != nil {
+			return fmt.Errorf("invalid audit_webhook url: %w", err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			return errors.New("invalid audit_webhook url: " + w.URL)
+		}
+	default:
+		return errors.New("audit_webhook must have kubeconfig or url")
+	}
+
+	if len(w.CACert) > 0 {
+		block, _ := pem.Decode([]byte(w.CACert))
+		if block == nil {
+			return errors.New("invalid PEM data in audit_webhook ca_cert")
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return fmt.Errorf("invalid audit_webhook ca_cert: %w", err)
+		}
+	}
+
+	switch w.GetMode() {
+	case AuditWebhookModeBatch:
+	case AuditWebhookModeBlocking, AuditWebhookModeBlockingStrict:
+		if w.BatchMaxSize != 0 || len(w.BatchMaxWait) > 0 {
+			return errors.New("audit_webhook batch options require batch mode")
+		}
+	default:
+		return errors.New("invalid audit_webhook mode: " + w.Mode)
+	}
+	if w.BatchMaxSize < 0 {
+		return errors.New("audit_webhook batch_max_size must not be negative")
+	}
+	for _, d := range []string{w.BatchMaxWait, w.InitialBackoff} {
+		if len(d) == 0 {
+			continue
+		}
+		if _, err := time.ParseDuration(d); err != nil {
+			return fmt.Errorf("invalid duration in audit_webhook: %w", err)
+		}
+	}
 	return nil
 }
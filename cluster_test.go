@@ -230,78 +230,938 @@ func testClusterValidate(t *testing.T) {
 			},
 			true,
 		},
+		{
+			"no etcd nodes",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Nodes: []*Node{
+					{Address: "10.0.0.1", User: "cybozu", ControlPlane: true, Etcd: new(bool)},
+					{Address: "10.0.0.2", User: "cybozu"},
+				},
+			},
+			true,
+		},
 		{
 			"invalid DNS server address",
 			Cluster{
 				Name:          "testcluster",
 				ServiceSubnet: "10.0.0.0/14",
-				DNSServers:    []string{"a.b.c.d"},
+				DNSServers:    []string{"a.b.c.d"},
+			},
+			true,
+		},
+		{
+			"invalid DNS service name",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				DNSService:    "hoge",
+			},
+			true,
+		},
+		{
+			"empty policy",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						AuditLogEnabled: true,
+						AuditLogPolicy:  "",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"invalid policy",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						AuditLogEnabled: true,
+						AuditLogPolicy:  "test",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"valid policy",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						AuditLogEnabled: true,
+						AuditLogPolicy: `apiVersion: audit.k8s.io/v1
+kind: Policy
+rules:
+- level: Metadata
+`,
+					},
+				},
+			},
+			false,
+		},
+		{
+			"valid kms encryption",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Encryption: EncryptionParams{
+							Provider:  EncryptionProviderKMS,
+							Resources: []string{"secrets", "configmaps"},
+							KMS:       KMSParams{TransitKey: "k8s-secrets"},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"invalid encryption provider",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Encryption: EncryptionParams{
+							Provider: "aesgcm",
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"duplicate encryption resources",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Encryption: EncryptionParams{
+							Resources: []string{"secrets", "secrets"},
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"invalid transit key",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Encryption: EncryptionParams{
+							Provider: EncryptionProviderKMS,
+							KMS:      KMSParams{TransitKey: "a/b"},
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"valid oidc",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						OIDC: &OIDCParams{
+							IssuerURL:      "https://accounts.example.com",
+							ClientID:       "kubernetes",
+							UsernameClaim:  "email",
+							GroupsClaim:    "groups",
+							GroupsPrefix:   "oidc:",
+							RequiredClaims: map[string]string{"hd": "example.com"},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"oidc issuer is not https",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						OIDC: &OIDCParams{
+							IssuerURL: "http://accounts.example.com",
+							ClientID:  "kubernetes",
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"oidc issuer with query",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						OIDC: &OIDCParams{
+							IssuerURL: "https://accounts.example.com/?foo=bar",
+							ClientID:  "kubernetes",
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"empty oidc client id",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						OIDC: &OIDCParams{
+							IssuerURL: "https://accounts.example.com",
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"invalid oidc ca",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						OIDC: &OIDCParams{
+							IssuerURL: "https://accounts.example.com",
+							ClientID:  "kubernetes",
+							CACert:    "foo",
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"invalid feature gate",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				FeatureGates:  map[string]bool{"Ephemeral-Containers": true},
+			},
+			true,
+		},
+		{
+			"valid admission",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Admission: AdmissionParams{
+							EnablePlugins:  []string{"EventRateLimit"},
+							DisablePlugins: []string{"DefaultStorageClass"},
+							PluginConfig: map[string]*unstructured.Unstructured{
+								"EventRateLimit": {
+									Object: map[string]interface{}{
+										"apiVersion": "eventratelimit.admission.k8s.io/v1alpha1",
+										"kind":       "Configuration",
+									},
+								},
+							},
+							SkipPodSecurityPolicy: true,
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"duplicate admission plugin",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Admission: AdmissionParams{
+							EnablePlugins: []string{"EventRateLimit", "EventRateLimit"},
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"admission plugin both enabled and disabled",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Admission: AdmissionParams{
+							EnablePlugins:  []string{"EventRateLimit"},
+							DisablePlugins: []string{"EventRateLimit"},
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"invalid admission plugin name",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Admission: AdmissionParams{
+							EnablePlugins: []string{"EventRateLimit,PodSecurity"},
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"admission plugin config without kind",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Admission: AdmissionParams{
+							PluginConfig: map[string]*unstructured.Unstructured{
+								"EventRateLimit": {Object: map[string]interface{}{}},
+							},
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"admission plugin config for disabled plugin",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Admission: AdmissionParams{
+							DisablePlugins: []string{"EventRateLimit"},
+							PluginConfig: map[string]*unstructured.Unstructured{
+								"EventRateLimit": {
+									Object: map[string]interface{}{
+										"apiVersion": "eventratelimit.admission.k8s.io/v1alpha1",
+										"kind":       "Configuration",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"valid audit backends",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						AuditLogEnabled: true,
+						AuditLogPolicy:  "rules: []",
+						AuditLogPath:    "/var/log/audit/audit.log",
+						AuditLogMaxAge:  7,
+						AuditWebhook: &AuditWebhookParams{
+							URL:          "https://siem.example.com/audit",
+							BatchMaxSize: 100,
+							BatchMaxWait: "5s",
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"audit options without audit log",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						AuditLogPath: "/var/log/audit/audit.log",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"audit log rotation for stdout",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						AuditLogEnabled: true,
+						AuditLogPolicy:  "rules: []",
+						AuditLogMaxSize: 100,
+					},
+				},
+			},
+			true,
+		},
+		{
+			"relative audit log path",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						AuditLogEnabled: true,
+						AuditLogPolicy:  "rules: []",
+						AuditLogPath:    "audit.log",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"audit webhook without server",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						AuditLogEnabled: true,
+						AuditLogPolicy:  "rules: []",
+						AuditWebhook:    &AuditWebhookParams{},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"audit webhook with both kubeconfig and url",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						AuditLogEnabled: true,
+						AuditLogPolicy:  "rules: []",
+						AuditWebhook: &AuditWebhookParams{
+							Kubeconfig: "apiVersion: v1\nkind: Config\nclusters:\n- name: siem\n  cluster:\n    server: https://siem.example.com\n",
+							URL:        "https://siem.example.com/audit",
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"audit webhook batch options in blocking mode",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						AuditLogEnabled: true,
+						AuditLogPolicy:  "rules: []",
+						AuditWebhook: &AuditWebhookParams{
+							URL:          "https://siem.example.com/audit",
+							Mode:         AuditWebhookModeBlocking,
+							BatchMaxSize: 100,
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"valid audit webhook kubeconfig",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						AuditLogEnabled: true,
+						AuditLogPolicy:  "rules: []",
+						AuditWebhook: &AuditWebhookParams{
+							Kubeconfig: "apiVersion: v1\nkind: Config\nclusters:\n- name: siem\n  cluster:\n    server: https://siem.example.com\n",
+							Mode:       AuditWebhookModeBlockingStrict,
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"invalid revocation webhook url",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						RevocationWebhook: &RevocationWebhookParams{
+							URL: "cke.example.com/authorize",
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"invalid revocation webhook ca_cert",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						RevocationWebhook: &RevocationWebhookParams{
+							URL:    "https://cke.example.com:10180/authorize",
+							CACert: "foo",
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"valid revocation webhook",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						RevocationWebhook: &RevocationWebhookParams{
+							URL: "https://cke.example.com:10180/authorize",
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"invalid proxy mode",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					Proxy: ProxyParams{
+						Mode: "foo",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"valid proxy config",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					Proxy: ProxyParams{
+						Config: &unstructured.Unstructured{
+							Object: map[string]interface{}{
+								"apiVersion":        "kubeproxy.config.k8s.io/v1alpha1",
+								"kind":              "KubeProxyConfiguration",
+								"mode":              "ipvs",
+								"ipvs":              map[string]interface{}{"scheduler": "lc"},
+								"conntrack":         map[string]interface{}{"maxPerCore": 65536},
+								"nodePortAddresses": []interface{}{"10.0.0.0/8"},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"valid cert_ttl",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						CertificateParams: CertificateParams{CertTTL: "720h"},
+					},
+					Kubelet: KubeletParams{
+						CertificateParams: CertificateParams{CertTTL: "87600h"},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"invalid cert_ttl",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					Scheduler: SchedulerParams{
+						CertificateParams: CertificateParams{CertTTL: "1 year"},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"too short cert_ttl",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					Proxy: ProxyParams{
+						CertificateParams: CertificateParams{CertTTL: "30m"},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"too long cert_ttl",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					ControllerManager: ControllerManagerParams{
+						CertificateParams: CertificateParams{CertTTL: "87601h"},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"invalid proxy config kind",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					Proxy: ProxyParams{
+						Config: &unstructured.Unstructured{},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"invalid IPVS scheduler",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					Proxy: ProxyParams{
+						Config: &unstructured.Unstructured{
+							Object: map[string]interface{}{
+								"apiVersion": "kubeproxy.config.k8s.io/v1alpha1",
+								"kind":       "KubeProxyConfiguration",
+								"ipvs":       map[string]interface{}{"scheduler": "foo"},
+							},
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"invalid nodePortAddresses",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					Proxy: ProxyParams{
+						Config: &unstructured.Unstructured{
+							Object: map[string]interface{}{
+								"apiVersion":        "kubeproxy.config.k8s.io/v1alpha1",
+								"kind":              "KubeProxyConfiguration",
+								"nodePortAddresses": []interface{}{"10.0.0.1"},
+							},
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"proxy mode conflicts with config",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					Proxy: ProxyParams{
+						Mode: ProxyModeIptables,
+						Config: &unstructured.Unstructured{
+							Object: map[string]interface{}{
+								"apiVersion": "kubeproxy.config.k8s.io/v1alpha1",
+								"kind":       "KubeProxyConfiguration",
+								"mode":       "ipvs",
+							},
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"proxy config with hostnameOverride",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					Proxy: ProxyParams{
+						Config: &unstructured.Unstructured{
+							Object: map[string]interface{}{
+								"apiVersion":       "kubeproxy.config.k8s.io/v1alpha1",
+								"kind":             "KubeProxyConfiguration",
+								"hostnameOverride": "foo",
+							},
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"proxy logging args",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					Proxy: ProxyParams{
+						ServiceParams: ServiceParams{
+							ExtraArguments: []string{"--v=2", "--log-file", "/var/log/kube-proxy.log"},
+						},
+					},
+				},
 			},
-			true,
+			false,
 		},
 		{
-			"invalid DNS service name",
+			"proxy args overridden by config",
 			Cluster{
 				Name:          "testcluster",
 				ServiceSubnet: "10.0.0.0/14",
-				DNSService:    "hoge",
+				Options: Options{
+					Proxy: ProxyParams{
+						ServiceParams: ServiceParams{
+							ExtraArguments: []string{"--ipvs-scheduler=lc"},
+						},
+					},
+				},
 			},
 			true,
 		},
 		{
-			"empty policy",
+			"valid controller manager config",
 			Cluster{
 				Name:          "testcluster",
 				ServiceSubnet: "10.0.0.0/14",
 				Options: Options{
-					APIServer: APIServerParams{
-						AuditLogEnabled: true,
-						AuditLogPolicy:  "",
+					ControllerManager: ControllerManagerParams{
+						Config: &unstructured.Unstructured{
+							Object: map[string]interface{}{
+								"apiVersion":              "kubecontrollermanager.config.k8s.io/v1alpha1",
+								"kind":                    "KubeControllerManagerConfiguration",
+								"kubeCloudShared":         map[string]interface{}{"clusterCIDR": "10.64.0.0/14", "allocateNodeCIDRs": true},
+								"nodeLifecycleController": map[string]interface{}{"podEvictionTimeout": "1m"},
+							},
+						},
 					},
 				},
 			},
-			true,
+			false,
 		},
 		{
-			"invalid policy",
+			"unsupported controller manager config",
 			Cluster{
 				Name:          "testcluster",
 				ServiceSubnet: "10.0.0.0/14",
 				Options: Options{
-					APIServer: APIServerParams{
-						AuditLogEnabled: true,
-						AuditLogPolicy:  "test",
+					ControllerManager: ControllerManagerParams{
+						Config: &unstructured.Unstructured{
+							Object: map[string]interface{}{
+								"apiVersion":    "kubecontrollermanager.config.k8s.io/v1alpha1",
+								"kind":          "KubeControllerManagerConfiguration",
+								"hpaController": map[string]interface{}{"horizontalPodAutoscalerSyncPeriod": "30s"},
+							},
+						},
 					},
 				},
 			},
 			true,
 		},
 		{
-			"valid policy",
+			"invalid clusterCIDR",
 			Cluster{
 				Name:          "testcluster",
 				ServiceSubnet: "10.0.0.0/14",
 				Options: Options{
-					APIServer: APIServerParams{
-						AuditLogEnabled: true,
-						AuditLogPolicy: `apiVersion: audit.k8s.io/v1
-kind: Policy
-rules:
-- level: Metadata
-`,
+					ControllerManager: ControllerManagerParams{
+						Config: &unstructured.Unstructured{
+							Object: map[string]interface{}{
+								"apiVersion":      "kubecontrollermanager.config.k8s.io/v1alpha1",
+								"kind":            "KubeControllerManagerConfiguration",
+								"kubeCloudShared": map[string]interface{}{"clusterCIDR": "10.64.0.0"},
+							},
+						},
 					},
 				},
 			},
+			true,
+		},
+		{
+			"IPv6 service subnet",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "fd00:10::/108",
+			},
 			false,
 		},
 		{
-			"invalid proxy mode",
+			"dual-stack service subnets",
 			Cluster{
 				Name:          "testcluster",
-				ServiceSubnet: "10.0.0.0/14",
+				ServiceSubnet: "10.0.0.0/14,fd00:10::/108",
+				FeatureGates:  map[string]bool{"IPv6DualStack": true},
 				Options: Options{
 					Proxy: ProxyParams{
-						Mode: "foo",
+						Config: &unstructured.Unstructured{
+							Object: map[string]interface{}{
+								"apiVersion":  "kubeproxy.config.k8s.io/v1alpha1",
+								"kind":        "KubeProxyConfiguration",
+								"clusterCIDR": "10.64.0.0/14,fd00:64::/56",
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"dual-stack without feature gate",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14,fd00:10::/108",
+				Options: Options{
+					Proxy: ProxyParams{
+						Config: &unstructured.Unstructured{
+							Object: map[string]interface{}{
+								"apiVersion":  "kubeproxy.config.k8s.io/v1alpha1",
+								"kind":        "KubeProxyConfiguration",
+								"clusterCIDR": "10.64.0.0/14,fd00:64::/56",
+							},
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"dual-stack without kube-proxy clusterCIDR",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14,fd00:10::/108",
+				FeatureGates:  map[string]bool{"IPv6DualStack": true},
+			},
+			true,
+		},
+		{
+			"dual-stack with single-stack clusterCIDR",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14,fd00:10::/108",
+				FeatureGates:  map[string]bool{"IPv6DualStack": true},
+				Options: Options{
+					Proxy: ProxyParams{
+						Config: &unstructured.Unstructured{
+							Object: map[string]interface{}{
+								"apiVersion":  "kubeproxy.config.k8s.io/v1alpha1",
+								"kind":        "KubeProxyConfiguration",
+								"clusterCIDR": "10.64.0.0/14",
+							},
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"service subnets of the same family",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14,10.8.0.0/14",
+				FeatureGates:  map[string]bool{"IPv6DualStack": true},
+			},
+			true,
+		},
+		{
+			"too many service subnets",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14,fd00:10::/108,10.8.0.0/14",
+				FeatureGates:  map[string]bool{"IPv6DualStack": true},
+			},
+			true,
+		},
+		{
+			"IPv6 nodes",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "fd00:10::/108",
+				Nodes: []*Node{
+					{Address: "fd00::1", Hostname: "node1", User: "cybozu", ControlPlane: true},
+				},
+			},
+			false,
+		},
+		{
+			"IPv6 node without hostname",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "fd00:10::/108",
+				Nodes: []*Node{
+					{Address: "fd00::1", User: "cybozu", ControlPlane: true},
+				},
+			},
+			true,
+		},
+		{
+			"node address of secondary family",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Nodes: []*Node{
+					{Address: "fd00::1", Hostname: "node1", User: "cybozu", ControlPlane: true},
+				},
+			},
+			true,
+		},
+		{
+			"controller manager clusterCIDR of different family",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					ControllerManager: ControllerManagerParams{
+						Config: &unstructured.Unstructured{
+							Object: map[string]interface{}{
+								"apiVersion":      "kubecontrollermanager.config.k8s.io/v1alpha1",
+								"kind":            "KubeControllerManagerConfiguration",
+								"kubeCloudShared": map[string]interface{}{"clusterCIDR": "fd00:64::/56"},
+							},
+						},
 					},
 				},
 			},
@@ -505,6 +1365,137 @@ rules:
 			true,
 		},
 
+		{
+			"etcd backup without targets",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				EtcdBackup: EtcdBackup{
+					Enabled: true,
+				},
+			},
+			true,
+		},
+		{
+			"etcd backup with too short interval",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				EtcdBackup: EtcdBackup{
+					Enabled:  true,
+					Interval: "10s",
+					Targets: []EtcdBackupTarget{
+						{Name: "s3", S3: &EtcdBackupS3Target{Endpoint: "http://10.0.0.1:9000", Bucket: "backup"}},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"etcd backup target with both local and s3",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				EtcdBackup: EtcdBackup{
+					Enabled: true,
+					Targets: []EtcdBackupTarget{
+						{
+							Name:  "both",
+							Local: &EtcdBackupLocalTarget{Node: "10.0.0.1", Dir: "/var/cke/etcd-backups"},
+							S3:    &EtcdBackupS3Target{Endpoint: "http://10.0.0.1:9000", Bucket: "backup"},
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"etcd backup node is not in the cluster",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				EtcdBackup: EtcdBackup{
+					Enabled: true,
+					Targets: []EtcdBackupTarget{
+						{Name: "local", Local: &EtcdBackupLocalTarget{Node: "10.0.0.1", Dir: "/var/cke/etcd-backups"}},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"duplicate etcd backup target",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				EtcdBackup: EtcdBackup{
+					Enabled: true,
+					Targets: []EtcdBackupTarget{
+						{Name: "s3", S3: &EtcdBackupS3Target{Endpoint: "http://10.0.0.1:9000", Bucket: "backup"}},
+						{Name: "s3", S3: &EtcdBackupS3Target{Endpoint: "http://10.0.0.2:9000", Bucket: "backup"}},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"unsafe etcd backup directory",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Nodes: []*Node{
+					{
+						Address: "10.0.0.1",
+						User:    "user",
+					},
+				},
+				EtcdBackup: EtcdBackup{
+					Enabled: true,
+					Targets: []EtcdBackupTarget{
+						{Name: "local", Local: &EtcdBackupLocalTarget{Node: "10.0.0.1", Dir: "/var/cke; rm -rf /"}},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"invalid S3 endpoint",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				EtcdBackup: EtcdBackup{
+					Enabled: true,
+					Targets: []EtcdBackupTarget{
+						{Name: "s3", S3: &EtcdBackupS3Target{Endpoint: "10.0.0.1:9000", Bucket: "backup"}},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"valid etcd backup",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Nodes: []*Node{
+					{
+						Address: "10.0.0.1",
+						User:    "user",
+					},
+				},
+				EtcdBackup: EtcdBackup{
+					Enabled:  true,
+					Interval: "1h",
+					Rotate:   3,
+					MaxAge:   "72h",
+					Targets: []EtcdBackupTarget{
+						{Name: "local", Local: &EtcdBackupLocalTarget{Node: "10.0.0.1", Dir: "/var/cke/etcd-backups"}},
+						{Name: "s3", S3: &EtcdBackupS3Target{Endpoint: "https://s3.example.com", Bucket: "backup", Prefix: "cke/"}},
+					},
+				},
+			},
+			false,
+		},
 		{
 			"duplicate node address",
 			Cluster{
@@ -717,9 +1708,52 @@ func testNodename(t *testing.T) {
 
 }
 
+func testNodeIsEtcdMember(t *testing.T) {
+	t.Parallel()
+
+	etcdNode := true
+	noEtcd := false
+	cases := []struct {
+		node     *Node
+		expected bool
+	}{
+		{&Node{ControlPlane: true}, true},
+		{&Node{ControlPlane: false}, false},
+		{&Node{ControlPlane: true, Etcd: &noEtcd}, false},
+		{&Node{ControlPlane: false, Etcd: &etcdNode}, true},
+	}
+	for _, c := range cases {
+		if c.node.IsEtcdMember() != c.expected {
+			t.Errorf("IsEtcdMember() for %#v should be %v", c.node, c.expected)
+		}
+	}
+
+	nodes := []*Node{
+		{Address: "10.0.0.1", ControlPlane: true, Etcd: &noEtcd},
+		{Address: "10.0.0.2", Etcd: &etcdNode},
+		{Address: "10.0.0.3"},
+	}
+	if n := ControlPlanes(nodes); len(n) != 1 || n[0].Address != "10.0.0.1" {
+		t.Error("unexpected control planes:", n)
+	}
+	if n := EtcdNodes(nodes); len(n) != 1 || n[0].Address != "10.0.0.2" {
+		t.Error("unexpected etcd nodes:", n)
+	}
+	if n := EtcdOnlyNodes(nodes); len(n) != 1 || n[0].Address != "10.0.0.2" {
+		t.Error("unexpected etcd only nodes:", n)
+	}
+	if n := Workers(nodes); len(n) != 1 || n[0].Address != "10.0.0.3" {
+		t.Error("unexpected workers:", n)
+	}
+	if n := KubernetesNodes(nodes); len(n) != 2 || n[0].Address != "10.0.0.1" || n[1].Address != "10.0.0.3" {
+		t.Error("unexpected kubernetes nodes:", n)
+	}
+}
+
 func TestCluster(t *testing.T) {
 	t.Run("YAML", testClusterYAML)
 	t.Run("Validate", testClusterValidate)
 	t.Run("ValidateNode", testClusterValidateNode)
 	t.Run("Nodename", testNodename)
+	t.Run("IsEtcdMember", testNodeIsEtcdMember)
 }
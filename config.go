@@ -0,0 +1,18 @@
+package cke
+
+import "github.com/cybozu-go/etcdutil"
+
+// Config is the configuration file of CKE and ckecli.
+type Config struct {
+	*etcdutil.Config
+
+	// SecretBackend is the configuration of SecretBackend.
+	SecretBackend SecretBackendConfig `json:"secret-backend"`
+}
+
+// NewConfig creates Config with default values.
+func NewConfig() *Config {
+	return &Config{
+		Config: NewEtcdConfig(),
+	}
+}
@@ -5,26 +5,40 @@ import "errors"
 // Constraints is a set of conditions that a cluster must satisfy
 type Constraints struct {
 	ControlPlaneCount        int `json:"control-plane-count"`
+	EtcdCount                int `json:"etcd-count"`
 	MinimumWorkers           int `json:"minimum-workers"`
 	MaximumWorkers           int `json:"maximum-workers"`
 	RebootMaximumUnreachable int `json:"maximum-unreachable-nodes-for-reboot"`
+	NodeUpgradeBatchSize     int `json:"node-upgrade-batch-size"`
 }
 
-// Check checks the cluster satisfies the constraints
-func (c *Constraints) Check(cluster *Cluster) error {
-	cpCount := 0
-	nodeCount := len(cluster.Nodes)
+// DefaultNodeUpgradeBatchSize is the default number of nodes to upgrade kubelet and kube-proxy at once.
+const DefaultNodeUpgradeBatchSize = 1
 
-	for _, n := range cluster.Nodes {
-		if n.ControlPlane {
-			cpCount++
-		}
+// GetNodeUpgradeBatchSize returns the number of nodes to upgrade kubelet and kube-proxy at once.
+func (c *Constraints) GetNodeUpgradeBatchSize() int {
+	if c.NodeUpgradeBatchSize <= 0 {
+		return DefaultNodeUpgradeBatchSize
 	}
+	return c.NodeUpgradeBatchSize
+}
+
+// Check checks the cluster satisfies the constraints
+func (c *Constraints) Check(cluster *Cluster) error {
+	cpCount := len(ControlPlanes(cluster.Nodes))
+	etcdCount := len(EtcdNodes(cluster.Nodes))
 
 	if cpCount != c.ControlPlaneCount {
 		return errors.New("number of control planes is not equal to the constraint")
 	}
-	workerCount := nodeCount - cpCount
+	expectedEtcdCount := c.EtcdCount
+	if expectedEtcdCount == 0 {
+		expectedEtcdCount = c.ControlPlaneCount
+	}
+	if etcdCount != expectedEtcdCount {
+		return errors.New("number of etcd nodes is not equal to the constraint")
+	}
+	workerCount := len(Workers(cluster.Nodes))
 	if c.MaximumWorkers != 0 && workerCount > c.MaximumWorkers {
 		return errors.New("number of worker nodes exceeds the maximum")
 	}
@@ -10,6 +10,17 @@ func testConstraintsCheck(t *testing.T) {
 		{ControlPlane: false},
 	}
 
+	etcdNode := true
+	noEtcd := false
+	dedicated := []*Node{
+		{ControlPlane: true, Etcd: &noEtcd},
+		{ControlPlane: true, Etcd: &noEtcd},
+		{Etcd: &etcdNode},
+		{Etcd: &etcdNode},
+		{Etcd: &etcdNode},
+		{ControlPlane: false},
+	}
+
 	tests := []struct {
 		name        string
 		constraints Constraints
@@ -40,6 +51,30 @@ func testConstraintsCheck(t *testing.T) {
 			cluster:     Cluster{Nodes: nodes[:]},
 			wantErr:     true,
 		},
+		{
+			name:        "dedicated etcd nodes",
+			constraints: Constraints{ControlPlaneCount: 2, EtcdCount: 3, MaximumWorkers: 4, MinimumWorkers: 1},
+			cluster:     Cluster{Nodes: dedicated},
+			wantErr:     false,
+		},
+		{
+			name:        "etcd count defaults to control plane count",
+			constraints: Constraints{ControlPlaneCount: 2, MaximumWorkers: 4, MinimumWorkers: 1},
+			cluster:     Cluster{Nodes: dedicated},
+			wantErr:     true,
+		},
+		{
+			name:        "explicit etcd count",
+			constraints: Constraints{ControlPlaneCount: 2, EtcdCount: 2, MaximumWorkers: 2, MinimumWorkers: 1},
+			cluster:     Cluster{Nodes: nodes[:]},
+			wantErr:     false,
+		},
+		{
+			name:        "too many etcd nodes",
+			constraints: Constraints{ControlPlaneCount: 2, EtcdCount: 2, MaximumWorkers: 4, MinimumWorkers: 1},
+			cluster:     Cluster{Nodes: dedicated},
+			wantErr:     true,
+		},
 		{
 			name:        "too few workers",
 			constraints: Constraints{ControlPlaneCount: 2, MaximumWorkers: 6, MinimumWorkers: 2},
@@ -7,6 +7,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"path/filepath"
 	"strings"
 )
@@ -23,8 +24,14 @@ type ContainerEngine interface {
 	Run(img Image, binds []Mount, command string) error
 	// RunWithInput runs a container as a foreground process with stdin as a string.
 	RunWithInput(img Image, binds []Mount, command, input string) error
+	// RunWithReader runs a container as a foreground process with stdin streamed from input.
+	// Unlike RunWithInput, this does not time out.
+	RunWithReader(img Image, binds []Mount, command string, input io.Reader) error
 	/// RunWithOutput runs a container as a foreground process and get stdout and stderr.
 	RunWithOutput(img Image, binds []Mount, command string) ([]byte, []byte, error)
+	// RunWithEntrypoint runs a container as a foreground process with the entrypoint of img replaced.
+	// args are passed to the entrypoint as they are.
+	RunWithEntrypoint(img Image, binds []Mount, entrypoint string, args []string) error
 	// RunSystem runs the named container as a system service.
 	RunSystem(name string, img Image, opts []string, params, extra ServiceParams) error
 	// Exists returns if named system container exists.
@@ -102,6 +109,19 @@ func (c docker) Run(img Image, binds []Mount, command string) error {
 }
 
 func (c docker) RunWithInput(img Image, binds []Mount, command, input string) error {
+	return c.agent.RunWithInput(runInteractiveCommand(img, binds, command), input)
+}
+
+func (c docker) RunWithReader(img Image, binds []Mount, command string, input io.Reader) error {
+	_, stderr, err := c.agent.RunWithReader(runInteractiveCommand(img, binds, command), input, 0)
+	if err != nil {
+		return fmt.Errorf("%w, stderr: %s", err, stderr)
+	}
+	return nil
+}
+
+// runInteractiveCommand returns a command line to run img with stdin attached.
+func runInteractiveCommand(img Image, binds []Mount, command string) string {
 	args := []string{
 		"docker",
 		"run",
@@ -120,8 +140,7 @@ func (c docker) RunWithInput(img Image, binds []Mount, command, input string) er
 		args = append(args, fmt.Sprintf("--volume=%s:%s:%s", m.Source, m.Destination, o))
 	}
 	args = append(args, img.Name(), command)
-
-	return c.agent.RunWithInput(strings.Join(args, " "), input)
+	return strings.Join(args, " ")
 }
 
 func (c docker) RunWithOutput(img Image, binds []Mount, command string) ([]byte, []byte, error) {
@@ -148,6 +167,36 @@ func (c docker) RunWithOutput(img Image, binds []Mount, command string) ([]byte,
 	return stdout, stderr, err
 }
 
+func (c docker) RunWithEntrypoint(img Image, binds []Mount, entrypoint string, cmdArgs []string) error {
+	args := []string{
+		"docker",
+		"run",
+		"--log-driver=journald",
+		"--rm",
+		"--network=host",
+		"--uts=host",
+		"--read-only",
+		"--entrypoint=" + shellQuote(entrypoint),
+	}
+	for _, m := range binds {
+		o := "rw"
+		if m.ReadOnly {
+			o = "ro"
+		}
+		args = append(args, fmt.Sprintf("--volume=%s:%s:%s", m.Source, m.Destination, o))
+	}
+	args = append(args, img.Name())
+	for _, a := range cmdArgs {
+		args = append(args, shellQuote(a))
+	}
+
+	stdout, stderr, err := c.agent.Run(strings.Join(args, " "))
+	if err != nil {
+		return fmt.Errorf("%w, stdout: %s, stderr: %s", err, stdout, stderr)
+	}
+	return nil
+}
+
 func (c docker) RunSystem(name string, img Image, opts []string, params, extra ServiceParams) error {
 	id, err := c.getID(name)
 	if err != nil {
@@ -396,3 +445,8 @@ func (c docker) VolumeExists(name string) (bool, error) {
 	}
 	return false, nil
 }
+
+// shellQuote quotes s as a single word for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,104 @@
+package cke
+
+import "time"
+
+// EncryptionKeyRotationStage is the type of the stages of encryption key rotation.
+type EncryptionKeyRotationStage string
+
+// Encryption key rotation stages in the order of execution.
+const (
+	// EncryptionKeyStagePrepare is recorded before the new key is stored in the secret backend.
+	// CKE does nothing in this stage.
+	EncryptionKeyStagePrepare = EncryptionKeyRotationStage("prepare")
+	// EncryptionKeyStageAdd adds the new key as a secondary key.
+	EncryptionKeyStageAdd = EncryptionKeyRotationStage("add")
+	// EncryptionKeyStagePromote promotes the new key to the primary key.
+	EncryptionKeyStagePromote = EncryptionKeyRotationStage("promote")
+	// EncryptionKeyStageRewrite rewrites all Secrets with the new key.
+	EncryptionKeyStageRewrite = EncryptionKeyRotationStage("rewrite")
+	// EncryptionKeyStageDrop removes the old key.
+	EncryptionKeyStageDrop = EncryptionKeyRotationStage("drop")
+)
+
+// EncryptionKeyRotation records the progress of the rotation of the key
+// to encrypt Kubernetes Secrets.
+type EncryptionKeyRotation struct {
+	Stage EncryptionKeyRotationStage `json:"stage"`
+
+	// OldKey and NewKey are the names of keys stored in Vault.
+	OldKey string `json:"old_key"`
+	NewKey string `json:"new_key"`
+
+	// Restarted is the list of addresses of nodes where kube-apiserver
+	// has been restarted in the current stage.
+	Restarted []string `json:"restarted,omitempty"`
+
+	StartedAt time.Time `json:"started_at"`
+}
+
+// IsRestarted returns true if kube-apiserver on the node has been restarted in the current stage.
+func (r *EncryptionKeyRotation) IsRestarted(address string) bool {
+	for _, a := range r.Restarted {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+// WithRestarted returns a copy of r with address added to Restarted.
+func (r *EncryptionKeyRotation) WithRestarted(address string) *EncryptionKeyRotation {
+	nr := *r
+	nr.Restarted = append(append([]string(nil), r.Restarted...), address)
+	return &nr
+}
+
+// WithStage returns a copy of r proceeded to the stage.
+func (r *EncryptionKeyRotation) WithStage(stage EncryptionKeyRotationStage) *EncryptionKeyRotation {
+	nr := *r
+	nr.Stage = stage
+	nr.Restarted = nil
+	return &nr
+}
+
+// EncryptedResources records the resources whose objects have been rewritten
+// by API servers with the encryption provider.
+type EncryptedResources struct {
+	Provider  EncryptionProvider `json:"provider"`
+	Resources []string           `json:"resources"`
+}
+
+// DefaultEncryptedResources returns EncryptedResources for clusters that have
+// not recorded it.  CKE has always encrypted Secrets with aescbc provider.
+func DefaultEncryptedResources() *EncryptedResources {
+	return &EncryptedResources{
+		Provider:  EncryptionProviderAESCBC,
+		Resources: []string{"secrets"},
+	}
+}
+
+// PendingResources returns the resources whose objects need to be rewritten
+// to apply the encryption parameters.
+//
+// added are resources that are newly encrypted, or all resources if the provider is changed.
+// removed are resources that are no longer encrypted and need to be decrypted.
+func (e *EncryptedResources) PendingResources(p EncryptionParams) (added, removed []string) {
+	current := p.GetResources()
+	encrypted := make(map[string]bool)
+	for _, r := range e.Resources {
+		encrypted[r] = true
+	}
+
+	for _, r := range current {
+		if e.Provider != p.GetProvider() || !encrypted[r] {
+			added = append(added, r)
+		}
+		delete(encrypted, r)
+	}
+	for _, r := range e.Resources {
+		if encrypted[r] {
+			removed = append(removed, r)
+		}
+	}
+	return added, removed
+}
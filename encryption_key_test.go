@@ -0,0 +1,54 @@
+package cke
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEncryptedResourcesPendingResources(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name      string
+		encrypted *EncryptedResources
+		params    EncryptionParams
+		added     []string
+		removed   []string
+	}{
+		{
+			name:      "default",
+			encrypted: DefaultEncryptedResources(),
+			params:    EncryptionParams{},
+		},
+		{
+			name:      "add",
+			encrypted: DefaultEncryptedResources(),
+			params:    EncryptionParams{Resources: []string{"secrets", "configmaps"}},
+			added:     []string{"configmaps"},
+		},
+		{
+			name:      "remove",
+			encrypted: &EncryptedResources{Provider: EncryptionProviderAESCBC, Resources: []string{"secrets", "configmaps"}},
+			params:    EncryptionParams{},
+			removed:   []string{"configmaps"},
+		},
+		{
+			name:      "provider",
+			encrypted: &EncryptedResources{Provider: EncryptionProviderAESCBC, Resources: []string{"secrets", "configmaps"}},
+			params:    EncryptionParams{Provider: EncryptionProviderKMS, Resources: []string{"configmaps"}},
+			added:     []string{"configmaps"},
+			removed:   []string{"secrets"},
+		},
+	}
+
+	for _, c := range cases {
+		added, removed := c.encrypted.PendingResources(c.params)
+		if !cmp.Equal(added, c.added) {
+			t.Errorf("%s: unexpected added resources: %s", c.name, cmp.Diff(added, c.added))
+		}
+		if !cmp.Equal(removed, c.removed) {
+			t.Errorf("%s: unexpected removed resources: %s", c.name, cmp.Diff(removed, c.removed))
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package cke
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const etcdBackupTimeFormat = "20060102-150405"
+
+// EtcdBackupName returns the name of an etcd backup taken at t.
+// The format is etcd-YYYYMMDD-hhmmss.backup in UTC, so that names
+// sort in chronological order.
+func EtcdBackupName(t time.Time) string {
+	return fmt.Sprintf("etcd-%s.backup", t.UTC().Format(etcdBackupTimeFormat))
+}
+
+// EtcdBackupEntry represents a successful etcd backup.
+type EtcdBackupEntry struct {
+	Name      string    `json:"name"`
+	Timestamp time.Time `json:"timestamp"`
+	Size      int64     `json:"size,string"`
+	Revision  int64     `json:"revision,string"`
+	Hash      uint32    `json:"hash"`
+	TotalKey  int       `json:"total_key"`
+	Targets   []string  `json:"targets"`
+}
+
+// EtcdRestoreRequest is a request to restore the etcd cluster from a backup.
+type EtcdRestoreRequest struct {
+	// Snapshot is the name of the backup to be restored.
+	Snapshot string `json:"snapshot"`
+	// Target is the name of the backup target to read the snapshot from.
+	// If empty, the targets are tried in the order of the configuration.
+	Target      string    `json:"target,omitempty"`
+	RequestedAt time.Time `json:"requested_at"`
+	// Step is the step of the restore operation to resume from.
+	// This is recorded once the snapshot has been restored on all members.
+	Step int `json:"step,omitempty"`
+}
+
+// ParseEtcdBackupName returns the time when the backup named name was taken.
+func ParseEtcdBackupName(name string) (time.Time, error) {
+	if !strings.HasPrefix(name, "etcd-") || !strings.HasSuffix(name, ".backup") {
+		return time.Time{}, errors.New("invalid etcd backup name: " + name)
+	}
+	ts := strings.TrimSuffix(strings.TrimPrefix(name, "etcd-"), ".backup")
+	return time.Parse(etcdBackupTimeFormat, ts)
+}
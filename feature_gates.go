@@ -0,0 +1,106 @@
+package cke
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var featureGateNamePattern = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+func validateFeatureGates(gates map[string]bool) error {
+	for name := range gates {
+		if !featureGateNamePattern.MatchString(name) {
+			return errors.New("invalid feature gate name: " + name)
+		}
+	}
+	return nil
+}
+
+// FeatureGateConflicts returns warning messages for feature gates that are
+// set to different values by per-component options.  Per-component options
+// take precedence over the cluster-wide feature gates.
+func (c *Cluster) FeatureGateConflicts() []string {
+	if len(c.FeatureGates) == 0 {
+		return nil
+	}
+
+	overrides := []struct {
+		component string
+		gates     map[string]bool
+	}{
+		{"kube-apiserver", parseFeatureGatesArgs(c.Options.APIServer.ExtraArguments)},
+		{"kube-controller-manager", parseFeatureGatesArgs(c.Options.ControllerManager.ExtraArguments)},
+		{"kube-scheduler", parseFeatureGatesArgs(c.Options.Scheduler.ExtraArguments)},
+		{"kube-proxy config", configFeatureGates(c.Options.Proxy.Config)},
+		{"kubelet", parseFeatureGatesArgs(c.Options.Kubelet.ExtraArguments)},
+		{"kubelet config", configFeatureGates(c.Options.Kubelet.Config)},
+	}
+
+	var msgs []string
+	for _, o := range overrides {
+		for name, v := range o.gates {
+			cv, ok := c.FeatureGates[name]
+			if !ok || cv == v {
+				continue
+			}
+			msgs = append(msgs, fmt.Sprintf("%s overrides feature gate %s=%t with %t", o.component, name, cv, v))
+		}
+	}
+	sort.Strings(msgs)
+	return msgs
+}
+
+// parseFeatureGatesArgs returns feature gates given by --feature-gates in args.
+// Invalid values are ignored.
+func parseFeatureGatesArgs(args []string) map[string]bool {
+	gates := make(map[string]bool)
+	for i, arg := range args {
+		var value string
+		switch {
+		case strings.HasPrefix(arg, "--feature-gates="):
+			value = strings.TrimPrefix(arg, "--feature-gates=")
+		case arg == "--feature-gates" && i+1 < len(args):
+			value = args[i+1]
+		default:
+			continue
+		}
+
+		for _, kv := range strings.Split(value, ",") {
+			fields := strings.SplitN(strings.TrimSpace(kv), "=", 2)
+			if len(fields) != 2 {
+				continue
+			}
+			v, err := strconv.ParseBool(fields[1])
+			if err != nil {
+				continue
+			}
+			gates[fields[0]] = v
+		}
+	}
+	return gates
+}
+
+// configFeatureGates returns featureGates in a component configuration.
+func configFeatureGates(cfg *unstructured.Unstructured) map[string]bool {
+	if cfg == nil {
+		return nil
+	}
+	m, ok := cfg.Object["featureGates"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	gates := make(map[string]bool)
+	for name, v := range m {
+		if b, ok := v.(bool); ok {
+			gates[name] = b
+		}
+	}
+	return gates
+}
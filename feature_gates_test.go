@@ -0,0 +1,47 @@
+package cke
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestFeatureGateConflicts(t *testing.T) {
+	t.Parallel()
+
+	c := NewCluster()
+	if msgs := c.FeatureGateConflicts(); len(msgs) != 0 {
+		t.Error("unexpected conflicts:", msgs)
+	}
+
+	c.FeatureGates = map[string]bool{
+		"EphemeralContainers": true,
+		"TTLAfterFinished":    true,
+	}
+	c.Options.APIServer.ExtraArguments = []string{"--feature-gates=EphemeralContainers=false,ServiceTopology=true"}
+	c.Options.Scheduler.ExtraArguments = []string{"--feature-gates", "TTLAfterFinished=true"}
+	c.Options.Proxy.Config = &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"featureGates": map[string]interface{}{
+				"TTLAfterFinished": false,
+			},
+		},
+	}
+	c.Options.Kubelet.Config = &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"featureGates": map[string]interface{}{
+				"EphemeralContainers": false,
+			},
+		},
+	}
+
+	expected := []string{
+		"kube-apiserver overrides feature gate EphemeralContainers=true with false",
+		"kube-proxy config overrides feature gate TTLAfterFinished=true with false",
+		"kubelet config overrides feature gate EphemeralContainers=true with false",
+	}
+	if msgs := c.FeatureGateConflicts(); !cmp.Equal(msgs, expected) {
+		t.Error("unexpected conflicts:", cmp.Diff(msgs, expected))
+	}
+}
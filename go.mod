@@ -11,6 +11,7 @@ require (
 	github.com/cybozu-go/netutil v1.3.0
 	github.com/cybozu-go/well v1.10.0
 	github.com/etcd-io/gofail v0.0.0-20190801230047-ad7f989257ca
+	github.com/golang/protobuf v1.4.3
 	github.com/google/go-cmp v0.5.4
 	github.com/hashicorp/vault/api v1.0.5-0.20210114202601-be05d85f3d42
 	github.com/howeyc/gopass v0.0.0-20190910152052-7cb4b85ec19c
@@ -25,10 +26,13 @@ require (
 	github.com/stretchr/testify v1.6.1 // indirect
 	github.com/vektah/gqlparser/v2 v2.1.0
 	golang.org/x/crypto v0.0.0-20200820211705-5c72a883971a
+	google.golang.org/grpc v1.27.0
 	k8s.io/api v0.19.7
 	k8s.io/apimachinery v0.19.7
 	k8s.io/apiserver v0.19.7
 	k8s.io/client-go v0.19.7
+	k8s.io/kube-controller-manager v0.19.7
+	k8s.io/kube-proxy v0.19.7
 	k8s.io/kube-scheduler v0.19.7
 	k8s.io/kubelet v0.19.7
 	k8s.io/utils v0.0.0-20210111153108-fddb29f9d009
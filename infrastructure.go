@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
+	"net"
 	"net/http"
 	"sync"
 	"sync/atomic"
@@ -49,14 +50,59 @@ func (c *certCache) get(issue func() (cert, key []byte, err error)) (cert, key [
 	return
 }
 
+// kubeHTTP caches the HTTPS client and the admin certificate for Kubernetes.
+// Both are replaced when the CA certificate of Kubernetes is changed by CA rotation.
 var kubeHTTP struct {
-	once   sync.Once
-	cache  *certCache
-	err    error
+	mu     sync.Mutex
 	ca     string
+	cache  *certCache
 	client *well.HTTPClient
 }
 
+// getKubeHTTP returns the HTTPS client trusting ca and the admin certificate.
+func getKubeHTTP(ca string, issue func() (cert, key []byte, err error)) (client *well.HTTPClient, cert, key []byte, err error) {
+	kubeHTTP.mu.Lock()
+	defer kubeHTTP.mu.Unlock()
+
+	if kubeHTTP.client == nil || kubeHTTP.ca != ca {
+		if kubeHTTP.client != nil {
+			kubeHTTP.client.CloseIdleConnections()
+		}
+
+		cp := x509.NewCertPool()
+		cp.AppendCertsFromPEM([]byte(ca))
+		kubeHTTP.client = &well.HTTPClient{
+			Client: &http.Client{
+				Transport: &http.Transport{
+					TLSClientConfig: &tls.Config{
+						RootCAs: cp,
+					},
+				},
+			},
+		}
+		kubeHTTP.cache = &certCache{
+			lifetime: time.Hour * 24,
+		}
+		kubeHTTP.ca = ca
+	}
+
+	cert, key, err = kubeHTTP.cache.get(issue)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return kubeHTTP.client, cert, key, nil
+}
+
+// etcdHTTP caches the HTTPS client for etcd members.
+// The client certificate is replaced with the latest one on every TLS handshake.
+var etcdHTTP struct {
+	mu      sync.Mutex
+	ca      string
+	certPEM string
+	cert    *tls.Certificate
+	client  *well.HTTPClient
+}
+
 func setVaultClient(client *vault.Client) {
 	vaultClient.Store(client)
 }
@@ -77,9 +123,11 @@ type Infrastructure interface {
 	Agent(addr string) Agent
 	Engine(addr string) ContainerEngine
 	Vault() (*vault.Client, error)
+	Secrets() SecretBackend
 	Storage() Storage
 
 	NewEtcdClient(ctx context.Context, endpoints []string) (*clientv3.Client, error)
+	EtcdHTTPSClient(ctx context.Context) (*well.HTTPClient, error)
 	K8sConfig(ctx context.Context, n *Node) (*rest.Config, error)
 	K8sClient(ctx context.Context, n *Node) (*kubernetes.Clientset, error)
 	HTTPClient() *well.HTTPClient
@@ -98,75 +146,52 @@ type ckeInfrastructure struct {
 
 	// following fields are accessed by multiple goroutines, hence
 	// they need to be guarded by sync.Once.
-	once     sync.Once
-	initErr  error
-	kubeCert []byte
-	kubeKey  []byte
+	once       sync.Once
+	initErr    error
+	kubeCA     string
+	kubeCert   []byte
+	kubeKey    []byte
+	kubeClient *well.HTTPClient
 }
 
 func (i *ckeInfrastructure) init(ctx context.Context) error {
-	kubeHTTP.once.Do(func() {
-		cache := &certCache{
-			lifetime: time.Hour * 24,
-		}
-		kubeHTTP.cache = cache
-
+	i.once.Do(func() {
 		ca, err := i.Storage().GetCACertificate(ctx, CAKubernetes)
 		if err != nil {
-			kubeHTTP.err = err
+			i.initErr = err
 			return
 		}
-		kubeHTTP.ca = ca
 
-		cp := x509.NewCertPool()
-		cp.AppendCertsFromPEM([]byte(kubeHTTP.ca))
-		kubeHTTP.client = &well.HTTPClient{
-			Client: &http.Client{
-				Transport: &http.Transport{
-					TLSClientConfig: &tls.Config{
-						RootCAs: cp,
-					},
-				},
-			},
-		}
-	})
-
-	if kubeHTTP.err != nil {
-		return kubeHTTP.err
-	}
-
-	i.once.Do(func() {
 		issue := func() (cert, key []byte, err error) {
-			c, k, e := KubernetesCA{}.IssueUserCert(ctx, i, RoleAdmin, AdminGroup, "25h")
+			c, k, e := KubernetesCA{}.IssueUserCert(ctx, i, RoleAdmin, []string{AdminGroup}, "", "25h")
 			if e != nil {
 				return nil, nil, e
 			}
 			return []byte(c), []byte(k), nil
 		}
-		cert, key, err := kubeHTTP.cache.get(issue)
+		client, cert, key, err := getKubeHTTP(ca, issue)
 		if err != nil {
 			i.initErr = err
 			return
 		}
 
+		i.kubeCA = ca
 		i.kubeCert = cert
 		i.kubeKey = key
+		i.kubeClient = client
 	})
 	return i.initErr
 }
 
 // NewInfrastructure creates a new Infrastructure instance
 func NewInfrastructure(ctx context.Context, c *Cluster, s Storage) (Infrastructure, error) {
-	vc, err := getVaultClient()
+	privkeys, err := getSecretBackend().ReadSecret(ctx, SSHSecret)
 	if err != nil {
 		return nil, err
 	}
-
-	secret, err := vc.Logical().Read(SSHSecret)
-	if err != nil {
-		return nil, err
+	if privkeys == nil {
+		return nil, errors.New("no ssh private keys in secret backend")
 	}
-	privkeys := secret.Data
 
 	agents := make(map[string]Agent)
 	defer func() {
@@ -225,9 +250,16 @@ func (i *ckeInfrastructure) Engine(addr string) ContainerEngine {
 }
 
 func (i *ckeInfrastructure) Vault() (*vault.Client, error) {
+	if LocalSecretBackendEnabled() {
+		return nil, ErrLocalSecretBackend
+	}
 	return getVaultClient()
 }
 
+func (i *ckeInfrastructure) Secrets() SecretBackend {
+	return getSecretBackend()
+}
+
 func (i *ckeInfrastructure) Storage() Storage {
 	return i.storage
 }
@@ -239,7 +271,7 @@ func (i *ckeInfrastructure) Close() {
 	i.agents = nil
 }
 
-func (i *ckeInfrastructure) NewEtcdClient(ctx context.Context, endpoints []string) (*clientv3.Client, error) {
+func (i *ckeInfrastructure) initEtcd(ctx context.Context) error {
 	i.etcdOnce.Do(func() {
 		serverCA, err := i.Storage().GetCACertificate(ctx, CAServer)
 		if err != nil {
@@ -256,9 +288,12 @@ func (i *ckeInfrastructure) NewEtcdClient(ctx context.Context, endpoints []strin
 		i.etcdCert = etcdCert
 		i.etcdKey = etcdKey
 	})
+	return i.etcdErr
+}
 
-	if i.etcdErr != nil {
-		return nil, i.etcdErr
+func (i *ckeInfrastructure) NewEtcdClient(ctx context.Context, endpoints []string) (*clientv3.Client, error) {
+	if err := i.initEtcd(ctx); err != nil {
+		return nil, err
 	}
 
 	cfg := &etcdutil.Config{
@@ -271,17 +306,62 @@ func (i *ckeInfrastructure) NewEtcdClient(ctx context.Context, endpoints []strin
 	return etcdutil.NewClient(cfg)
 }
 
+func (i *ckeInfrastructure) EtcdHTTPSClient(ctx context.Context) (*well.HTTPClient, error) {
+	if err := i.initEtcd(ctx); err != nil {
+		return nil, err
+	}
+
+	etcdHTTP.mu.Lock()
+	defer etcdHTTP.mu.Unlock()
+
+	if etcdHTTP.certPEM != i.etcdCert {
+		cert, err := tls.X509KeyPair([]byte(i.etcdCert), []byte(i.etcdKey))
+		if err != nil {
+			return nil, err
+		}
+		etcdHTTP.certPEM = i.etcdCert
+		etcdHTTP.cert = &cert
+	}
+
+	if etcdHTTP.client != nil && etcdHTTP.ca == i.serverCA {
+		return etcdHTTP.client, nil
+	}
+	if etcdHTTP.client != nil {
+		etcdHTTP.client.CloseIdleConnections()
+	}
+
+	cp := x509.NewCertPool()
+	cp.AppendCertsFromPEM([]byte(i.serverCA))
+	etcdHTTP.ca = i.serverCA
+	etcdHTTP.client = &well.HTTPClient{
+		Client: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					RootCAs: cp,
+					GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+						etcdHTTP.mu.Lock()
+						defer etcdHTTP.mu.Unlock()
+						return etcdHTTP.cert, nil
+					},
+				},
+				IdleConnTimeout: 90 * time.Second,
+			},
+		},
+	}
+	return etcdHTTP.client, nil
+}
+
 func (i *ckeInfrastructure) K8sConfig(ctx context.Context, n *Node) (*rest.Config, error) {
 	if err := i.init(ctx); err != nil {
 		return nil, err
 	}
 
 	return &rest.Config{
-		Host: "https://" + n.Address + ":6443",
+		Host: "https://" + net.JoinHostPort(n.Address, "6443"),
 		TLSClientConfig: rest.TLSClientConfig{
 			CertData: i.kubeCert,
 			KeyData:  i.kubeKey,
-			CAData:   []byte(kubeHTTP.ca),
+			CAData:   []byte(i.kubeCA),
 		},
 		Timeout: 5 * time.Second,
 	}, nil
@@ -304,5 +384,5 @@ func (i *ckeInfrastructure) HTTPSClient(ctx context.Context) (*well.HTTPClient,
 	if err != nil {
 		return nil, err
 	}
-	return kubeHTTP.client, nil
+	return i.kubeClient, nil
 }
@@ -0,0 +1,117 @@
+package cke
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func testKeyPair(t *testing.T, cn string) (cert, key string) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	key = string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return
+}
+
+func testEtcdInfrastructure(serverCA, cert, key string) *ckeInfrastructure {
+	inf := &ckeInfrastructure{serverCA: serverCA, etcdCert: cert, etcdKey: key}
+	inf.etcdOnce.Do(func() {})
+	return inf
+}
+
+func TestKubeHTTP(t *testing.T) {
+	ca1, _ := testKeyPair(t, "ca1")
+	ca2, _ := testKeyPair(t, "ca2")
+
+	var issued int
+	issue := func() (cert, key []byte, err error) {
+		issued++
+		c, k := testKeyPair(t, "admin")
+		return []byte(c), []byte(k), nil
+	}
+
+	c1, cert1, _, err := getKubeHTTP(ca1, issue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c2, cert2, _, err := getKubeHTTP(ca1, issue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c1 != c2 {
+		t.Error("client is not reused")
+	}
+	if string(cert1) != string(cert2) || issued != 1 {
+		t.Error("admin certificate is not cached")
+	}
+
+	c3, cert3, _, err := getKubeHTTP(ca2, issue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c3 == c1 {
+		t.Error("client is not rebuilt for the new CA")
+	}
+	if string(cert3) == string(cert1) || issued != 2 {
+		t.Error("admin certificate is not reissued for the new CA")
+	}
+}
+
+func TestEtcdHTTPSClient(t *testing.T) {
+	ctx := context.Background()
+	ca1, _ := testKeyPair(t, "ca1")
+	ca2, _ := testKeyPair(t, "ca2")
+	cert1, key1 := testKeyPair(t, "root")
+	cert2, key2 := testKeyPair(t, "root")
+
+	c1, err := testEtcdInfrastructure(ca1, cert1, key1).EtcdHTTPSClient(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c2, err := testEtcdInfrastructure(ca1, cert2, key2).EtcdHTTPSClient(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c1 != c2 {
+		t.Error("client is not reused")
+	}
+	if etcdHTTP.certPEM != cert2 {
+		t.Error("client certificate is not updated")
+	}
+
+	c3, err := testEtcdInfrastructure(ca2, cert2, key2).EtcdHTTPSClient(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c3 == c1 {
+		t.Error("client is not rebuilt for the new CA")
+	}
+}
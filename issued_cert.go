@@ -0,0 +1,128 @@
+package cke
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+)
+
+// Kinds of IssuedCertificate.
+const (
+	IssuedCertKubernetes = "kubernetes"
+	IssuedCertEtcd       = "etcd"
+)
+
+// CredentialGroupPrefix is the prefix of the group given to each Kubernetes
+// user certificate to identify it in authorization requests.
+const CredentialGroupPrefix = "cke:credential:"
+
+// IssuedCertificate is a record of a client certificate issued for a user.
+type IssuedCertificate struct {
+	// Serial is the serial number of the certificate in colon-separated hex.
+	Serial string `json:"serial"`
+	// Kind is either "kubernetes" or "etcd".
+	Kind   string   `json:"kind"`
+	User   string   `json:"user"`
+	Groups []string `json:"groups,omitempty"`
+	TTL    string   `json:"ttl"`
+
+	// IssuedBy is the identity of the issuer in the form of "USER@HOST".
+	IssuedBy string    `json:"issued_by"`
+	IssuedAt time.Time `json:"issued_at"`
+	Expiry   time.Time `json:"expiry"`
+
+	// CredentialID is the ID given to a Kubernetes user certificate as
+	// a group with CredentialGroupPrefix.
+	CredentialID string `json:"credential_id,omitempty"`
+
+	// RevokedAt is the time when the certificate was revoked.  Zero if not revoked.
+	RevokedAt time.Time `json:"revoked_at,omitempty"`
+}
+
+// IsRevoked returns true if the certificate has been revoked.
+func (c *IssuedCertificate) IsRevoked() bool {
+	return !c.RevokedAt.IsZero()
+}
+
+// IsRevocable returns true if requests with the certificate can be denied
+// after revocation.  kube-apiserver authorizes requests of AdminGroup without
+// asking the revocation webhook, so certificates of the group cannot be revoked.
+func (c *IssuedCertificate) IsRevocable() bool {
+	for _, g := range c.Groups {
+		if g == AdminGroup {
+			return false
+		}
+	}
+	return true
+}
+
+// NewIssuedCertificate creates a record of a client certificate in PEM format.
+func NewIssuedCertificate(kind, userName string, groups []string, ttl, credentialID, cert string) (*IssuedCertificate, error) {
+	block, _ := pem.Decode([]byte(cert))
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+	c, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IssuedCertificate{
+		Serial:       FormatSerial(c.SerialNumber.Bytes()),
+		Kind:         kind,
+		User:         userName,
+		Groups:       groups,
+		TTL:          ttl,
+		IssuedBy:     issuerIdentity(),
+		IssuedAt:     c.NotBefore,
+		Expiry:       c.NotAfter,
+		CredentialID: credentialID,
+	}, nil
+}
+
+// FormatSerial formats a serial number in colon-separated hex like Vault.
+func FormatSerial(serial []byte) string {
+	parts := make([]string, len(serial))
+	for i, b := range serial {
+		parts[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// NormalizeSerial converts a serial number given by users into the form of FormatSerial.
+func NormalizeSerial(serial string) (string, error) {
+	data, err := hex.DecodeString(strings.NewReplacer(":", "", "-", "").Replace(serial))
+	if err != nil || len(data) == 0 {
+		return "", fmt.Errorf("invalid serial number: %s", serial)
+	}
+	return FormatSerial(data), nil
+}
+
+// NewCredentialID generates a random ID for a Kubernetes user certificate.
+func NewCredentialID() (string, error) {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func issuerIdentity() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return name + "@" + host
+}
@@ -0,0 +1,23 @@
+package cke
+
+import "testing"
+
+func TestIssuedCertificateIsRevocable(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		groups   []string
+		expected bool
+	}{
+		{nil, true},
+		{[]string{"dev", "ops"}, true},
+		{[]string{AdminGroup}, false},
+		{[]string{"dev", AdminGroup}, false},
+	}
+	for _, c := range cases {
+		cert := &IssuedCertificate{Groups: c.groups}
+		if cert.IsRevocable() != c.expected {
+			t.Errorf("IsRevocable() for %v should be %v", c.groups, c.expected)
+		}
+	}
+}
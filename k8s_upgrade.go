@@ -0,0 +1,134 @@
+package cke
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KubernetesVersion represents a version of Kubernetes.
+type KubernetesVersion struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// ParseKubernetesVersion parses a version string such as "1.19.7" or "v1.19.7".
+// Extra fields after the patch version, like the build number of CKE images, are ignored.
+func ParseKubernetesVersion(s string) (KubernetesVersion, error) {
+	fields := strings.Split(strings.TrimPrefix(s, "v"), ".")
+	if len(fields) < 3 {
+		return KubernetesVersion{}, errors.New("invalid Kubernetes version: " + s)
+	}
+
+	var nums [3]int
+	for i := range nums {
+		n, err := strconv.Atoi(fields[i])
+		if err != nil || n < 0 {
+			return KubernetesVersion{}, errors.New("invalid Kubernetes version: " + s)
+		}
+		nums[i] = n
+	}
+	return KubernetesVersion{Major: nums[0], Minor: nums[1], Patch: nums[2]}, nil
+}
+
+// ParseKubernetesImageVersion returns the Kubernetes version of a container image
+// from its tag, e.g. "quay.io/cybozu/kubernetes:1.19.7.2".
+func ParseKubernetesImageVersion(image string) (KubernetesVersion, error) {
+	idx := strings.LastIndex(image, ":")
+	if idx == -1 {
+		return KubernetesVersion{}, errors.New("no tag in image: " + image)
+	}
+	return ParseKubernetesVersion(image[idx+1:])
+}
+
+// String implements fmt.Stringer.
+func (v KubernetesVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Compare returns -1, 0, or 1 if v is older than, equal to, or newer than w.
+func (v KubernetesVersion) Compare(w KubernetesVersion) int {
+	switch {
+	case v.Major != w.Major:
+		return compareInt(v.Major, w.Major)
+	case v.Minor != w.Minor:
+		return compareInt(v.Minor, w.Minor)
+	default:
+		return compareInt(v.Patch, w.Patch)
+	}
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// minorDistance returns the number of minor versions from v to w.
+// Different major versions are treated as infinitely distant.
+func (v KubernetesVersion) minorDistance(w KubernetesVersion) int {
+	if v.Major != w.Major {
+		return int(^uint(0) >> 1)
+	}
+	return w.Minor - v.Minor
+}
+
+// Maximum version skews allowed by Kubernetes.
+// https://kubernetes.io/docs/setup/release/version-skew-policy/
+const (
+	maxAPIServerUpgradeSkew = 1
+	maxKubeletSkew          = 2
+)
+
+// CheckKubernetesVersionSkew checks if the Kubernetes components running at
+// the given versions can be upgraded to target without violating the version skew policy.
+//
+// controlPlanes are versions of kube-apiserver, kube-controller-manager and kube-scheduler.
+// nodes are versions of kubelet and kube-proxy.
+func CheckKubernetesVersionSkew(target KubernetesVersion, controlPlanes, nodes []KubernetesVersion) error {
+	for _, v := range controlPlanes {
+		if target.Compare(v) < 0 {
+			return fmt.Errorf("downgrading control plane from %s to %s is not supported", v, target)
+		}
+		if v.minorDistance(target) > maxAPIServerUpgradeSkew {
+			return fmt.Errorf("control plane cannot skip minor versions: %s to %s", v, target)
+		}
+	}
+	for _, v := range nodes {
+		if target.Compare(v) < 0 {
+			return fmt.Errorf("downgrading kubelet from %s to %s is not supported", v, target)
+		}
+		if v.minorDistance(target) > maxKubeletSkew {
+			return fmt.Errorf("kubelet %s is too old for kube-apiserver %s", v, target)
+		}
+	}
+	return nil
+}
+
+// KubernetesUpgradeStage is the type of the stages of Kubernetes upgrade.
+type KubernetesUpgradeStage string
+
+// Kubernetes upgrade stages in the order of execution.
+const (
+	UpgradeStageEtcd        = KubernetesUpgradeStage("etcd")
+	UpgradeStageAPIServer   = KubernetesUpgradeStage("kube-apiserver")
+	UpgradeStageControllers = KubernetesUpgradeStage("controllers")
+	UpgradeStageNodes       = KubernetesUpgradeStage("nodes")
+)
+
+// KubernetesUpgrade records the progress of an upgrade of Kubernetes.
+type KubernetesUpgrade struct {
+	// From is the oldest version of Kubernetes components when the upgrade started.
+	From string `json:"from"`
+	// To is the container image of Kubernetes to be upgraded to.
+	To        string                 `json:"to"`
+	Stage     KubernetesUpgradeStage `json:"stage"`
+	StartedAt time.Time              `json:"started_at"`
+}
@@ -0,0 +1,69 @@
+package cke
+
+import "testing"
+
+func TestParseKubernetesImageVersion(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		image   string
+		version KubernetesVersion
+		valid   bool
+	}{
+		{"quay.io/cybozu/kubernetes:1.19.7.2", KubernetesVersion{1, 19, 7}, true},
+		{"quay.io/cybozu/kubernetes:v1.18.15", KubernetesVersion{1, 18, 15}, true},
+		{"localhost:5000/kubernetes:1.20.1", KubernetesVersion{1, 20, 1}, true},
+		{"quay.io/cybozu/kubernetes", KubernetesVersion{}, false},
+		{"quay.io/cybozu/kubernetes:latest", KubernetesVersion{}, false},
+		{"quay.io/cybozu/kubernetes:1.19", KubernetesVersion{}, false},
+		{"", KubernetesVersion{}, false},
+	}
+
+	for _, c := range cases {
+		v, err := ParseKubernetesImageVersion(c.image)
+		if c.valid != (err == nil) {
+			t.Errorf("%s: unexpected error: %v", c.image, err)
+			continue
+		}
+		if v != c.version {
+			t.Errorf("%s: expected %s, actual %s", c.image, c.version, v)
+		}
+	}
+
+	_, err := ParseKubernetesImageVersion(KubernetesImage.Name())
+	if err != nil {
+		t.Error("KubernetesImage has no valid version:", err)
+	}
+}
+
+func TestCheckKubernetesVersionSkew(t *testing.T) {
+	t.Parallel()
+
+	v := func(minor, patch int) KubernetesVersion {
+		return KubernetesVersion{Major: 1, Minor: minor, Patch: patch}
+	}
+
+	cases := []struct {
+		name          string
+		target        KubernetesVersion
+		controlPlanes []KubernetesVersion
+		nodes         []KubernetesVersion
+		valid         bool
+	}{
+		{"patch", v(19, 7), []KubernetesVersion{v(19, 4)}, []KubernetesVersion{v(19, 4)}, true},
+		{"minor", v(19, 7), []KubernetesVersion{v(18, 15), v(19, 7)}, []KubernetesVersion{v(18, 15)}, true},
+		{"old kubelet", v(19, 7), []KubernetesVersion{v(18, 15)}, []KubernetesVersion{v(17, 3)}, true},
+		{"skip minor", v(19, 7), []KubernetesVersion{v(17, 3)}, nil, false},
+		{"too old kubelet", v(19, 7), []KubernetesVersion{v(18, 15)}, []KubernetesVersion{v(16, 1)}, false},
+		{"downgrade control plane", v(19, 7), []KubernetesVersion{v(19, 8)}, nil, false},
+		{"downgrade kubelet", v(19, 7), nil, []KubernetesVersion{v(20, 0)}, false},
+		{"major", KubernetesVersion{2, 0, 0}, []KubernetesVersion{v(19, 7)}, nil, false},
+	}
+
+	for _, c := range cases {
+		err := CheckKubernetesVersionSkew(c.target, c.controlPlanes, c.nodes)
+		if c.valid != (err == nil) {
+			t.Errorf("%s: unexpected result: %v", c.name, err)
+		}
+	}
+}
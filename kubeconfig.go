@@ -1,6 +1,8 @@
 package cke
 
 import (
+	"encoding/base64"
+
 	"k8s.io/client-go/tools/clientcmd/api"
 )
 
@@ -47,3 +49,70 @@ func UserKubeconfig(cluster, userName, ca, clientCrt, clientKey, server string)
 
 	return cfg
 }
+
+// OIDCKubeconfig makes kubeconfig for users authenticated by OpenID Connect.
+// The credentials are obtained by kubelogin (https://github.com/int128/kubelogin).
+func OIDCKubeconfig(cluster, userName, ca, server string, oidc *OIDCParams, clientSecret string) *api.Config {
+	cfg := api.NewConfig()
+	c := api.NewCluster()
+	c.Server = server
+	c.CertificateAuthorityData = []byte(ca)
+	cfg.Clusters[cluster] = c
+
+	args := []string{
+		"oidc-login",
+		"get-token",
+		"--oidc-issuer-url=" + oidc.IssuerURL,
+		"--oidc-client-id=" + oidc.ClientID,
+	}
+	if len(clientSecret) > 0 {
+		args = append(args, "--oidc-client-secret="+clientSecret)
+	}
+	if len(oidc.CACert) > 0 {
+		args = append(args, "--certificate-authority-data="+base64.StdEncoding.EncodeToString([]byte(oidc.CACert)))
+	}
+
+	auth := api.NewAuthInfo()
+	auth.Exec = &api.ExecConfig{
+		APIVersion:  "client.authentication.k8s.io/v1beta1",
+		Command:     "kubectl",
+		Args:        args,
+		InstallHint: "kubelogin is required: https://github.com/int128/kubelogin",
+	}
+	cfg.AuthInfos[userName] = auth
+
+	ctx := api.NewContext()
+	ctx.AuthInfo = userName
+	ctx.Cluster = cluster
+	cfg.Contexts["default"] = ctx
+	cfg.CurrentContext = "default"
+
+	return cfg
+}
+
+// ExecKubeconfig makes kubeconfig for users whose client certificates are
+// obtained by running `command` as a client-go credential plugin.
+func ExecKubeconfig(cluster, userName, ca, server, command string, args []string) *api.Config {
+	cfg := api.NewConfig()
+	c := api.NewCluster()
+	c.Server = server
+	c.CertificateAuthorityData = []byte(ca)
+	cfg.Clusters[cluster] = c
+
+	auth := api.NewAuthInfo()
+	auth.Exec = &api.ExecConfig{
+		APIVersion:  "client.authentication.k8s.io/v1beta1",
+		Command:     command,
+		Args:        args,
+		InstallHint: "ckecli is required to obtain credentials",
+	}
+	cfg.AuthInfos[userName] = auth
+
+	ctx := api.NewContext()
+	ctx.AuthInfo = userName
+	ctx.Cluster = cluster
+	cfg.Contexts["default"] = ctx
+	cfg.CurrentContext = "default"
+
+	return cfg
+}
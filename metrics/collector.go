@@ -58,6 +58,14 @@ func NewCollector(client *v3.Client) prometheus.Collector {
 				collectors:  []prometheus.Collector{rebootQueueEntries},
 				isAvailable: isRebootAvailable,
 			},
+			"etcd_backup": {
+				collectors:  []prometheus.Collector{etcdLastSuccessfulBackup},
+				isAvailable: isEtcdBackupAvailable,
+			},
+			"certificate": {
+				collectors:  []prometheus.Collector{certificateExpiry},
+				isAvailable: isCertificateAvailable,
+			},
 			"sabakan_integration": {
 				collectors:  []prometheus.Collector{sabakanIntegrationSuccessful, sabakanIntegrationTimestampSeconds, sabakanWorkers, sabakanUnusedMachines},
 				isAvailable: isSabakanIntegrationAvailable,
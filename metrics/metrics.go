@@ -41,6 +41,23 @@ var rebootQueueEntries = prometheus.NewGauge(
 	},
 )
 
+var etcdLastSuccessfulBackup = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "etcd_last_successful_backup_timestamp_seconds",
+		Help:      "The Unix timestamp of the last successful etcd backup.",
+	},
+)
+
+var certificateExpiry = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "certificate_expiry_timestamp_seconds",
+		Help:      "The Unix timestamp when the certificate expires.",
+	},
+	[]string{"node", "component", "ca"},
+)
+
 var sabakanIntegrationSuccessful = prometheus.NewGauge(
 	prometheus.GaugeOpts{
 		Namespace: namespace,
@@ -53,6 +53,47 @@ func isRebootAvailable(_ context.Context, _ storage) (bool, error) {
 	return isLeader, nil
 }
 
+// UpdateEtcdBackup updates "etcd_last_successful_backup_timestamp_seconds".
+func UpdateEtcdBackup(lastSuccess time.Time) {
+	if lastSuccess.IsZero() {
+		etcdLastSuccessfulBackup.Set(0)
+		return
+	}
+	etcdLastSuccessfulBackup.Set(float64(lastSuccess.Unix()))
+}
+
+func isEtcdBackupAvailable(_ context.Context, _ storage) (bool, error) {
+	return isLeader, nil
+}
+
+type certificateLabels struct {
+	node      string
+	component string
+	ca        string
+}
+
+var certificateLabelSet = make(map[certificateLabels]bool)
+
+// UpdateCertificateExpiry updates "certificate_expiry_timestamp_seconds".
+// Series for certificates no longer listed in certs are deleted.
+func UpdateCertificateExpiry(certs []cke.CertificateStatus) {
+	current := make(map[certificateLabels]bool, len(certs))
+	for _, c := range certs {
+		certificateExpiry.WithLabelValues(c.Node, c.Component, c.CA).Set(float64(c.Expiry.Unix()))
+		current[certificateLabels{c.Node, c.Component, c.CA}] = true
+	}
+	for l := range certificateLabelSet {
+		if !current[l] {
+			certificateExpiry.DeleteLabelValues(l.node, l.component, l.ca)
+		}
+	}
+	certificateLabelSet = current
+}
+
+func isCertificateAvailable(_ context.Context, _ storage) (bool, error) {
+	return isLeader, nil
+}
+
 // UpdateSabakanIntegration updates Sabakan integration metrics.
 func UpdateSabakanIntegration(isSuccessful bool, workersByRole map[string]int, unusedMachines int, ts time.Time) {
 	sabakanIntegrationTimestampSeconds.Set(float64(ts.Unix()))
@@ -46,6 +46,38 @@ type updateRebootTestCase struct {
 	expected float64
 }
 
+type etcdBackupInput struct {
+	isLeader    bool
+	lastSuccess time.Time
+}
+
+type etcdBackupExpected struct {
+	returned bool
+	value    float64
+}
+
+type updateEtcdBackupTestCase struct {
+	name     string
+	input    etcdBackupInput
+	expected etcdBackupExpected
+}
+
+type certificateInput struct {
+	isLeader bool
+	certs    []cke.CertificateStatus
+}
+
+type certificateExpected struct {
+	returned bool
+	values   []labeledValue
+}
+
+type updateCertificateExpiryTestCase struct {
+	name     string
+	input    certificateInput
+	expected certificateExpected
+}
+
 type sabakanInput struct {
 	isLeader       bool
 	enabled        bool
@@ -71,6 +103,8 @@ func TestMetricsUpdater(t *testing.T) {
 	t.Run("UpdateLeader", testUpdateLeader)
 	t.Run("UpdateOperationPhase", testUpdateOperationPhase)
 	t.Run("UpdateReboot", testUpdateReboot)
+	t.Run("UpdateEtcdBackup", testUpdateEtcdBackup)
+	t.Run("UpdateCertificateExpiry", testUpdateCertificateExpiry)
 	t.Run("UpdateSabakanIntegration", testUpdateSabakanIntegration)
 }
 
@@ -295,6 +329,188 @@ func testUpdateReboot(t *testing.T) {
 	}
 }
 
+func testUpdateEtcdBackup(t *testing.T) {
+	testCases := []updateEtcdBackupTestCase{
+		{
+			name: "not leader",
+			input: etcdBackupInput{
+				isLeader:    false,
+				lastSuccess: time.Unix(1600000000, 0),
+			},
+			expected: etcdBackupExpected{
+				returned: false,
+			},
+		},
+		{
+			name: "never succeeded",
+			input: etcdBackupInput{
+				isLeader: true,
+			},
+			expected: etcdBackupExpected{
+				returned: true,
+				value:    0,
+			},
+		},
+		{
+			name: "succeeded",
+			input: etcdBackupInput{
+				isLeader:    true,
+				lastSuccess: time.Unix(1600000000, 0),
+			},
+			expected: etcdBackupExpected{
+				returned: true,
+				value:    1600000000,
+			},
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			defer ctx.Done()
+
+			collector, _ := newTestCollector()
+			handler := GetHandler(collector)
+
+			UpdateLeader(tt.input.isLeader)
+			UpdateEtcdBackup(tt.input.lastSuccess)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			handler.ServeHTTP(w, req)
+
+			metricsFamily, err := parseMetrics(w.Result())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			metricsFound := false
+			for _, mf := range metricsFamily {
+				if *mf.Name != "cke_etcd_last_successful_backup_timestamp_seconds" {
+					continue
+				}
+				for _, m := range mf.Metric {
+					metricsFound = true
+					if *m.Gauge.Value != tt.expected.value {
+						t.Errorf("value for cke_etcd_last_successful_backup_timestamp_seconds is wrong.  expected: %f, actual: %f", tt.expected.value, *m.Gauge.Value)
+					}
+				}
+			}
+			if metricsFound != tt.expected.returned {
+				t.Errorf("metrics etcd_last_successful_backup_timestamp_seconds found: %v, expected: %v", metricsFound, tt.expected.returned)
+			}
+		})
+	}
+}
+
+func testUpdateCertificateExpiry(t *testing.T) {
+	testCases := []updateCertificateExpiryTestCase{
+		{
+			name: "not leader",
+			input: certificateInput{
+				isLeader: false,
+				certs: []cke.CertificateStatus{
+					{Node: "10.0.0.11", Component: "kubelet", CA: cke.CAKubernetes, Expiry: time.Unix(1600000000, 0)},
+				},
+			},
+			expected: certificateExpected{
+				returned: false,
+			},
+		},
+		{
+			name: "leader",
+			input: certificateInput{
+				isLeader: true,
+				certs: []cke.CertificateStatus{
+					{Node: "10.0.0.11", Component: "kubelet", CA: cke.CAKubernetes, Expiry: time.Unix(1600000000, 0)},
+					{Component: cke.CertComponentCA, CA: cke.CAServer, Expiry: time.Unix(1700000000, 0)},
+				},
+			},
+			expected: certificateExpected{
+				returned: true,
+				values: []labeledValue{
+					{
+						labels: map[string]string{"node": "10.0.0.11", "component": "kubelet", "ca": cke.CAKubernetes},
+						value:  1600000000,
+					},
+					{
+						labels: map[string]string{"node": "", "component": cke.CertComponentCA, "ca": cke.CAServer},
+						value:  1700000000,
+					},
+				},
+			},
+		},
+		{
+			name: "removed",
+			input: certificateInput{
+				isLeader: true,
+				certs: []cke.CertificateStatus{
+					{Component: cke.CertComponentCA, CA: cke.CAServer, Expiry: time.Unix(1800000000, 0)},
+				},
+			},
+			expected: certificateExpected{
+				returned: true,
+				values: []labeledValue{
+					{
+						labels: map[string]string{"node": "", "component": cke.CertComponentCA, "ca": cke.CAServer},
+						value:  1800000000,
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			defer ctx.Done()
+
+			collector, _ := newTestCollector()
+			handler := GetHandler(collector)
+
+			UpdateLeader(tt.input.isLeader)
+			UpdateCertificateExpiry(tt.input.certs)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			handler.ServeHTTP(w, req)
+
+			metricsFamily, err := parseMetrics(w.Result())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			metricsFamilyFound := false
+			for _, mf := range metricsFamily {
+				if *mf.Name != "cke_certificate_expiry_timestamp_seconds" {
+					continue
+				}
+				metricsFamilyFound = true
+				if len(mf.Metric) != len(tt.expected.values) {
+					t.Errorf("unexpected number of cke_certificate_expiry_timestamp_seconds.  expected: %d, actual: %d", len(tt.expected.values), len(mf.Metric))
+				}
+				for _, exp := range tt.expected.values {
+					metricsFound := false
+					for _, m := range mf.Metric {
+						labels := labelToMap(m.Label)
+						if !hasLabels(labels, exp.labels) {
+							continue
+						}
+						metricsFound = true
+						if *m.Gauge.Value != exp.value {
+							t.Errorf("value for cke_certificate_expiry_timestamp_seconds with labels of %v is wrong.  expected: %f, actual: %f", exp.labels, exp.value, *m.Gauge.Value)
+						}
+					}
+					if !metricsFound {
+						t.Errorf("metrics cke_certificate_expiry_timestamp_seconds with labels of %v was not found", exp.labels)
+					}
+				}
+			}
+			if metricsFamilyFound != tt.expected.returned {
+				t.Errorf("metrics cke_certificate_expiry_timestamp_seconds found: %v, expected: %v", metricsFamilyFound, tt.expected.returned)
+			}
+		})
+	}
+}
+
 func testUpdateSabakanIntegration(t *testing.T) {
 	testCases := []updateSabakanIntegrationTestCase{
 		{
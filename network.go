@@ -0,0 +1,149 @@
+package cke
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	kubecontrollermanagerv1alpha1 "k8s.io/kube-controller-manager/config/v1alpha1"
+	kubeproxyv1alpha1 "k8s.io/kube-proxy/config/v1alpha1"
+)
+
+// featureGateIPv6DualStack is the name of the feature gate to enable
+// IPv4/IPv6 dual-stack networking in Kubernetes.
+const featureGateIPv6DualStack = "IPv6DualStack"
+
+// ParseCIDRs parses a comma-separated list of CIDRs such as ServiceSubnet.
+func ParseCIDRs(s string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, cidr := range strings.Split(s, ",") {
+		_, n, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// isIPv6 returns true if ip is an IPv6 address.
+func isIPv6(ip net.IP) bool {
+	return ip.To4() == nil
+}
+
+// HasIPv6 returns true if the cluster has IPv6 service subnets or node addresses.
+func (c *Cluster) HasIPv6() bool {
+	nets, err := ParseCIDRs(c.ServiceSubnet)
+	if err == nil {
+		for _, n := range nets {
+			if isIPv6(n.IP) {
+				return true
+			}
+		}
+	}
+	for _, n := range c.Nodes {
+		ip := net.ParseIP(n.Address)
+		if ip != nil && isIPv6(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateCIDRFamilies validates a comma-separated list of CIDRs for
+// single-stack or dual-stack networking.
+func validateCIDRFamilies(s string) ([]*net.IPNet, error) {
+	nets, err := ParseCIDRs(s)
+	if err != nil {
+		return nil, err
+	}
+	switch len(nets) {
+	case 1:
+	case 2:
+		if isIPv6(nets[0].IP) == isIPv6(nets[1].IP) {
+			return nil, fmt.Errorf("dual-stack CIDRs must be of different IP families: %s", s)
+		}
+	default:
+		return nil, fmt.Errorf("too many CIDRs: %s", s)
+	}
+	return nets, nil
+}
+
+// sameFamilies returns true if a and b consist of the same IP families in the same order.
+func sameFamilies(a, b []*net.IPNet) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if isIPv6(a[i].IP) != isIPv6(b[i].IP) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateIPFamilies validates the combination of IP families of
+// service subnets, node addresses, and the pod network.
+func validateIPFamilies(c *Cluster, isTmpl bool) error {
+	svcNets, err := validateCIDRFamilies(c.ServiceSubnet)
+	if err != nil {
+		return fmt.Errorf("invalid service subnet: %w", err)
+	}
+	dualStack := len(svcNets) == 2
+
+	if dualStack && !c.FeatureGates[featureGateIPv6DualStack] {
+		return errors.New("dual-stack service subnets require feature gate " + featureGateIPv6DualStack)
+	}
+
+	if !isTmpl {
+		// Node addresses must be of the primary IP family.
+		primaryV6 := isIPv6(svcNets[0].IP)
+		for _, n := range c.Nodes {
+			v6 := isIPv6(net.ParseIP(n.Address))
+			if v6 != primaryV6 {
+				return errors.New("node address is not of the primary IP family of service subnets: " + n.Address)
+			}
+			// IPv6 addresses cannot be used as Node names.
+			if v6 && len(n.Hostname) == 0 {
+				return errors.New("hostname is required for IPv6 node: " + n.Address)
+			}
+		}
+	}
+
+	// These won't raise an error because of prior validation by validateOptions.
+	kcmConfig, err := c.Options.ControllerManager.MergeConfig(&kubecontrollermanagerv1alpha1.KubeControllerManagerConfiguration{})
+	if err != nil {
+		return err
+	}
+	if cidr := kcmConfig.KubeCloudShared.ClusterCIDR; len(cidr) > 0 {
+		podNets, err := validateCIDRFamilies(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid clusterCIDR in kube-controller-manager config: %w", err)
+		}
+		if !sameFamilies(svcNets, podNets) {
+			return errors.New("IP families of clusterCIDR in kube-controller-manager config do not match service subnets")
+		}
+		if len(podNets) == 2 && kcmConfig.NodeIPAMController.NodeCIDRMaskSize != 0 {
+			return errors.New("nodeCIDRMaskSize cannot be used for dual-stack clusterCIDR; use nodeCIDRMaskSizeIPv4 and nodeCIDRMaskSizeIPv6")
+		}
+	}
+
+	proxyConfig, err := c.Options.Proxy.MergeConfig(&kubeproxyv1alpha1.KubeProxyConfiguration{})
+	if err != nil {
+		return err
+	}
+	if cidr := proxyConfig.ClusterCIDR; len(cidr) > 0 {
+		podNets, err := validateCIDRFamilies(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid clusterCIDR in kube-proxy config: %w", err)
+		}
+		if !sameFamilies(svcNets, podNets) {
+			return errors.New("IP families of clusterCIDR in kube-proxy config do not match service subnets")
+		}
+	} else if dualStack {
+		return errors.New("dual-stack clusters require clusterCIDR in kube-proxy config")
+	}
+
+	return nil
+}
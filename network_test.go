@@ -0,0 +1,42 @@
+package cke
+
+import "testing"
+
+func TestParseCIDRs(t *testing.T) {
+	t.Parallel()
+
+	nets, err := ParseCIDRs("10.0.0.0/14, fd00:10::/108")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nets) != 2 {
+		t.Fatal("unexpected number of CIDRs:", len(nets))
+	}
+	if nets[0].String() != "10.0.0.0/14" || nets[1].String() != "fd00:10::/108" {
+		t.Error("unexpected CIDRs:", nets)
+	}
+
+	if _, err := ParseCIDRs("10.0.0.0/14,"); err == nil {
+		t.Error("empty CIDR should be rejected")
+	}
+}
+
+func TestHasIPv6(t *testing.T) {
+	t.Parallel()
+
+	c := &Cluster{ServiceSubnet: "10.0.0.0/14", Nodes: []*Node{{Address: "10.1.0.1"}}}
+	if c.HasIPv6() {
+		t.Error("IPv4 cluster has IPv6")
+	}
+
+	c.ServiceSubnet = "10.0.0.0/14,fd00:10::/108"
+	if !c.HasIPv6() {
+		t.Error("dual-stack cluster does not have IPv6")
+	}
+
+	c.ServiceSubnet = "10.0.0.0/14"
+	c.Nodes = append(c.Nodes, &Node{Address: "fd00::1"})
+	if !c.HasIPv6() {
+		t.Error("cluster with IPv6 node does not have IPv6")
+	}
+}
@@ -0,0 +1,179 @@
+package op
+
+import (
+	"context"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/log"
+)
+
+type caRotationRecordOp struct {
+	rotation *cke.CARotation
+	finished bool
+}
+
+// CARotationRecordOp returns an Operator to record the progress of CA rotation.
+func CARotationRecordOp(rotation *cke.CARotation) cke.Operator {
+	return &caRotationRecordOp{
+		rotation: rotation,
+	}
+}
+
+func (o *caRotationRecordOp) Name() string {
+	return "ca-rotation-record"
+}
+
+func (o *caRotationRecordOp) NextCommand() cke.Commander {
+	if o.finished {
+		return nil
+	}
+
+	o.finished = true
+	return recordCARotationCommand{o.rotation}
+}
+
+func (o *caRotationRecordOp) Targets() []string {
+	return nil
+}
+
+type caRotationSwitchOp struct {
+	rotation *cke.CARotation
+	step     int
+}
+
+// CARotationSwitchOp returns an Operator to make the new CA issue certificates.
+// The rotation proceeds to the stage to reissue certificates.
+func CARotationSwitchOp(rotation *cke.CARotation) cke.Operator {
+	return &caRotationSwitchOp{
+		rotation: rotation,
+	}
+}
+
+func (o *caRotationSwitchOp) Name() string {
+	return "ca-rotation-switch"
+}
+
+func (o *caRotationSwitchOp) NextCommand() cke.Commander {
+	switch o.step {
+	case 0:
+		o.step++
+		return switchIssuerCommand{o.rotation}
+	case 1:
+		o.step++
+		return recordCARotationCommand{o.rotation.WithStage(cke.CARotationStageReissue)}
+	}
+	return nil
+}
+
+func (o *caRotationSwitchOp) Targets() []string {
+	return nil
+}
+
+type caRotationFinishOp struct {
+	rotation *cke.CARotation
+	step     int
+}
+
+// CARotationFinishOp returns an Operator to remove the old CA from Vault
+// and complete the rotation.
+func CARotationFinishOp(rotation *cke.CARotation) cke.Operator {
+	return &caRotationFinishOp{
+		rotation: rotation,
+	}
+}
+
+func (o *caRotationFinishOp) Name() string {
+	return "ca-rotation-finish"
+}
+
+func (o *caRotationFinishOp) NextCommand() cke.Commander {
+	switch o.step {
+	case 0:
+		o.step++
+		return dropIssuerCommand{o.rotation}
+	case 1:
+		o.step++
+		return finishCARotationCommand{o.rotation}
+	}
+	return nil
+}
+
+func (o *caRotationFinishOp) Targets() []string {
+	return nil
+}
+
+type recordCARotationCommand struct {
+	rotation *cke.CARotation
+}
+
+func (c recordCARotationCommand) Run(ctx context.Context, inf cke.Infrastructure, leaderKey string) error {
+	return inf.Storage().UpdateCARotation(ctx, leaderKey, c.rotation)
+}
+
+func (c recordCARotationCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "record-ca-rotation",
+		Target: c.rotation.CA + ":" + string(c.rotation.Stage),
+	}
+}
+
+type switchIssuerCommand struct {
+	rotation *cke.CARotation
+}
+
+func (c switchIssuerCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	vc, err := inf.Vault()
+	if err != nil {
+		return err
+	}
+	return cke.SetDefaultIssuer(vc, c.rotation.CA, c.rotation.NewIssuer)
+}
+
+func (c switchIssuerCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "switch-ca-issuer",
+		Target: c.rotation.CA,
+	}
+}
+
+type dropIssuerCommand struct {
+	rotation *cke.CARotation
+}
+
+func (c dropIssuerCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	vc, err := inf.Vault()
+	if err != nil {
+		return err
+	}
+	return cke.DeleteIssuer(vc, c.rotation.CA, c.rotation.OldIssuer)
+}
+
+func (c dropIssuerCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "drop-ca-issuer",
+		Target: c.rotation.CA,
+	}
+}
+
+type finishCARotationCommand struct {
+	rotation *cke.CARotation
+}
+
+func (c finishCARotationCommand) Run(ctx context.Context, inf cke.Infrastructure, leaderKey string) error {
+	err := inf.Storage().DeleteCARotation(ctx, leaderKey)
+	if err != nil {
+		return err
+	}
+
+	log.Info("CA rotation completed", map[string]interface{}{
+		"ca": c.rotation.CA,
+	})
+	return nil
+}
+
+func (c finishCARotationCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "finish-ca-rotation",
+		Target: c.rotation.CA,
+	}
+}
@@ -32,6 +32,8 @@ const (
 	RiversContainerName = "rivers"
 	// EtcdRiversContainerName is container name of etcd-rivers
 	EtcdRiversContainerName = "etcd-rivers"
+	// KMSPluginContainerName is container name of the KMS plugin for kube-apiserver
+	KMSPluginContainerName = "cke-kms-plugin"
 
 	// RiversUpstreamPort is upstream port of rivers container
 	RiversUpstreamPort = 6443
@@ -66,6 +68,23 @@ const (
 	// CKEAnnotationReboot is the annotation to mark reboot targets
 	CKEAnnotationReboot = "cke.cybozu.com/reboot"
 
+	// KMSPluginSocketDir is a directory for the UNIX domain socket of the KMS plugin
+	KMSPluginSocketDir = "/var/run/cke-kms"
+	// KMSPluginSocketPath is a path of the UNIX domain socket of the KMS plugin
+	KMSPluginSocketPath = KMSPluginSocketDir + "/kms.sock"
+	// KMSPluginConfigDir is a directory for the Vault config of the KMS plugin
+	KMSPluginConfigDir = "/etc/kubernetes/kms"
+	// KMSPluginConfigPath is a path for the Vault config of the KMS plugin
+	KMSPluginConfigPath = KMSPluginConfigDir + "/vault.json"
+
+	// ControllerManagerKubeConfigPath is a path for kube-controller-manager kubeconfig
+	ControllerManagerKubeConfigPath = "/etc/kubernetes/controller-manager/kubeconfig"
+
+	// ProxyConfigPath is a path for kube-proxy config
+	ProxyConfigPath = "/etc/kubernetes/proxy/config.yml"
+	// ProxyKubeConfigPath is a path for kube-proxy kubeconfig
+	ProxyKubeConfigPath = "/etc/kubernetes/proxy/kubeconfig"
+
 	// SchedulerConfigPath is a path for scheduler extender config
 	SchedulerConfigPath = "/etc/kubernetes/scheduler/config.yml"
 	// SchedulerKubeConfigPath is a path for scheduler kubeconfig
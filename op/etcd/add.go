@@ -2,9 +2,12 @@ package etcd
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"net"
 	"time"
 
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/etcdserverpb"
 	"github.com/cybozu-go/cke"
 	"github.com/cybozu-go/cke/op"
 	"github.com/cybozu-go/cke/op/common"
@@ -69,14 +72,24 @@ func (o *addMemberOp) NextCommand() cke.Commander {
 		return addMemberCommand{o.endpoints, o.targetNode, opts, extra}
 	case 8:
 		o.step++
-		return waitEtcdSyncCommand{etcdEndpoints([]*cke.Node{o.targetNode}), false}
+		return waitEtcdSyncCommand{o.otherEndpoints(), false, o.targetNode.Address}
 	case 9:
+		o.step++
+		return promoteMemberCommand{o.otherEndpoints(), o.targetNode}
+	case 10:
+		o.step++
+		return waitEtcdSyncCommand{etcdEndpoints(nodes), false, ""}
+	case 11:
 		o.step++
 		return common.VolumeCreateCommand(nodes, op.EtcdAddedMemberVolumeName)
 	}
 	return nil
 }
 
+func (o *addMemberOp) otherEndpoints() []string {
+	return excludeEndpoint(o.endpoints, o.targetNode)
+}
+
 func (o *addMemberOp) Targets() []string {
 	return []string{
 		o.targetNode.Address,
@@ -125,13 +138,10 @@ func (c addMemberCommand) Run(ctx context.Context, inf cke.Infrastructure, _ str
 		case <-time.After(10 * time.Second):
 		}
 
-		ct, cancel := context.WithTimeout(ctx, op.TimeoutDuration)
-		defer cancel()
-		resp, err := cli.MemberAdd(ct, []string{fmt.Sprintf("https://%s:2380", c.node.Address)})
+		members, err = addMember(ctx, cli, excludeEndpoint(c.endpoints, c.node), c.node)
 		if err != nil {
 			return err
 		}
-		members = resp.Members
 	}
 	log.Debug("retrieved memgers from etcd", map[string]interface{}{
 		"members": members,
@@ -166,3 +176,150 @@ func (c addMemberCommand) Command() cke.Command {
 		Name: "add-etcd-member",
 	}
 }
+
+func excludeEndpoint(endpoints []string, n *cke.Node) []string {
+	target := etcdEndpoints([]*cke.Node{n})[0]
+	var eps []string
+	for _, ep := range endpoints {
+		if ep != target {
+			eps = append(eps, ep)
+		}
+	}
+	return eps
+}
+
+// addMember adds n to the etcd cluster as a learner if all members
+// support learners, or as a voting member otherwise.
+func addMember(ctx context.Context, cli *clientv3.Client, endpoints []string, n *cke.Node) ([]*etcdserverpb.Member, error) {
+	peerURLs := []string{"https://" + net.JoinHostPort(n.Address, "2380")}
+
+	if !op.EtcdLearnerSupported(ctx, cli, endpoints) {
+		ct, cancel := context.WithTimeout(ctx, op.TimeoutDuration)
+		defer cancel()
+		resp, err := cli.MemberAdd(ct, peerURLs)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Members, nil
+	}
+
+	ct, cancel := context.WithTimeout(ctx, op.TimeoutDuration)
+	defer cancel()
+	err := op.EtcdAddLearner(ct, cli, peerURLs)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("added etcd learner", map[string]interface{}{
+		"node": n.Address,
+	})
+
+	resp, err := cli.MemberList(ct)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Members, nil
+}
+
+type promoteMemberCommand struct {
+	endpoints []string
+	node      *cke.Node
+}
+
+func (c promoteMemberCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	cli, err := inf.NewEtcdClient(ctx, c.endpoints)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	ct, cancel := context.WithTimeout(ctx, op.TimeoutDuration)
+	defer cancel()
+	resp, err := cli.MemberList(ct)
+	if err != nil {
+		return err
+	}
+
+	var id uint64
+	var found bool
+	for _, m := range resp.Members {
+		found, err = addressInURLs(c.node.Address, m.PeerURLs)
+		if err != nil {
+			return err
+		}
+		if found {
+			id = m.ID
+			break
+		}
+	}
+	if !found {
+		return errors.New("etcd member not found: " + c.node.Address)
+	}
+
+	learners, err := op.EtcdLearners(ctx, cli)
+	if err != nil {
+		return err
+	}
+	if !learners[id] {
+		return nil
+	}
+
+	err = op.EtcdPromoteLearner(ct, cli, id)
+	if err != nil {
+		return err
+	}
+	log.Info("promoted etcd learner", map[string]interface{}{
+		"node": c.node.Address,
+	})
+	return nil
+}
+
+func (c promoteMemberCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "promote-etcd-member",
+		Target: c.node.Address,
+	}
+}
+
+type promoteMemberOp struct {
+	endpoints  []string
+	targetNode *cke.Node
+	step       int
+}
+
+// PromoteMemberOp returns an Operator to promote a learner member
+// that has been added to etcd cluster and is running.
+func PromoteMemberOp(cp []*cke.Node, targetNode *cke.Node) cke.Operator {
+	return &promoteMemberOp{
+		endpoints:  excludeEndpoint(etcdEndpoints(cp), targetNode),
+		targetNode: targetNode,
+	}
+}
+
+func (o *promoteMemberOp) Name() string {
+	return "etcd-promote-member"
+}
+
+func (o *promoteMemberOp) NextCommand() cke.Commander {
+	nodes := []*cke.Node{o.targetNode}
+	switch o.step {
+	case 0:
+		o.step++
+		return waitEtcdSyncCommand{o.endpoints, false, o.targetNode.Address}
+	case 1:
+		o.step++
+		return promoteMemberCommand{o.endpoints, o.targetNode}
+	case 2:
+		o.step++
+		return waitEtcdSyncCommand{etcdEndpoints(nodes), false, ""}
+	case 3:
+		o.step++
+		return common.VolumeCreateCommand(nodes, op.EtcdAddedMemberVolumeName)
+	}
+	return nil
+}
+
+func (o *promoteMemberOp) Targets() []string {
+	return []string{
+		o.targetNode.Address,
+	}
+}
@@ -0,0 +1,244 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/coreos/etcd/snapshot"
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/log"
+)
+
+type backupOp struct {
+	endpoints []string
+	config    cke.EtcdBackup
+	entry     *cke.EtcdBackupEntry
+	step      int
+}
+
+// BackupOp returns an Operator to take a backup of etcd and store it in the backup targets.
+func BackupOp(cp []*cke.Node, config cke.EtcdBackup) cke.Operator {
+	return &backupOp{
+		endpoints: etcdEndpoints(cp),
+		config:    config,
+		entry:     new(cke.EtcdBackupEntry),
+	}
+}
+
+func (o *backupOp) Name() string {
+	return "etcd-backup"
+}
+
+func (o *backupOp) NextCommand() cke.Commander {
+	switch o.step {
+	case 0:
+		o.step++
+		return backupStartCommand{}
+	case 1:
+		o.step++
+		return backupSnapshotCommand{endpoints: o.endpoints, config: o.config, entry: o.entry}
+	case 2:
+		o.step++
+		return backupRegisterCommand{entry: o.entry}
+	case 3:
+		o.step++
+		return backupRotateCommand{config: o.config}
+	}
+	return nil
+}
+
+func (o *backupOp) Targets() []string {
+	names := make([]string, len(o.config.Targets))
+	for i, t := range o.config.Targets {
+		names[i] = t.Name
+	}
+	return names
+}
+
+type backupStartCommand struct{}
+
+func (c backupStartCommand) Run(ctx context.Context, inf cke.Infrastructure, leaderKey string) error {
+	return inf.Storage().PutEtcdBackupLastTry(ctx, leaderKey, time.Now())
+}
+
+func (c backupStartCommand) Command() cke.Command {
+	return cke.Command{
+		Name: "backup-start",
+	}
+}
+
+type backupSnapshotCommand struct {
+	endpoints []string
+	config    cke.EtcdBackup
+	entry     *cke.EtcdBackupEntry
+}
+
+func (c backupSnapshotCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	cli, err := inf.NewEtcdClient(ctx, c.endpoints)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	now := time.Now().UTC()
+	name := cke.EtcdBackupName(now)
+
+	f, err := ioutil.TempFile("", "etcd-backup-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+
+	r, err := cli.Snapshot(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	r.Close()
+	if err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+
+	st, err := snapshot.NewV3(nil).Status(f.Name())
+	if err != nil {
+		return fmt.Errorf("failed to check status of the new backup: %w", err)
+	}
+
+	var targets []string
+	for _, t := range c.config.Targets {
+		bt, err := newBackupTarget(ctx, inf, t)
+		if err != nil {
+			return err
+		}
+		_, err = f.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		err = bt.Put(ctx, name, f)
+		if err != nil {
+			return fmt.Errorf("failed to store backup to %s: %w", t.Name, err)
+		}
+		targets = append(targets, t.Name)
+	}
+
+	*c.entry = cke.EtcdBackupEntry{
+		Name:      name,
+		Timestamp: now,
+		Size:      st.TotalSize,
+		Revision:  st.Revision,
+		Hash:      st.Hash,
+		TotalKey:  st.TotalKey,
+		Targets:   targets,
+	}
+	log.Info("took etcd backup", map[string]interface{}{
+		"name":     name,
+		"revision": st.Revision,
+		"size":     st.TotalSize,
+	})
+	return nil
+}
+
+func (c backupSnapshotCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "backup-snapshot",
+		Target: strings.Join(c.endpoints, ","),
+	}
+}
+
+type backupRegisterCommand struct {
+	entry *cke.EtcdBackupEntry
+}
+
+func (c backupRegisterCommand) Run(ctx context.Context, inf cke.Infrastructure, leaderKey string) error {
+	return inf.Storage().RegisterEtcdBackupEntry(ctx, leaderKey, c.entry)
+}
+
+func (c backupRegisterCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "backup-register",
+		Target: c.entry.Name,
+	}
+}
+
+type backupRotateCommand struct {
+	config cke.EtcdBackup
+}
+
+// expiredBackups returns backups that should be removed from names.
+// names must be sorted in ascending order.
+func expiredBackups(names []string, rotate int, maxAge time.Duration, now time.Time) []string {
+	var expired []string
+	for i, name := range names {
+		if i < len(names)-rotate {
+			expired = append(expired, name)
+			continue
+		}
+		if maxAge == 0 || i == len(names)-1 {
+			continue
+		}
+		t, err := cke.ParseEtcdBackupName(name)
+		if err != nil {
+			continue
+		}
+		if now.Sub(t) > maxAge {
+			expired = append(expired, name)
+		}
+	}
+	return expired
+}
+
+func (c backupRotateCommand) Run(ctx context.Context, inf cke.Infrastructure, leaderKey string) error {
+	now := time.Now()
+	rotate := c.config.GetRotate()
+	maxAge := c.config.GetMaxAge()
+
+	for _, t := range c.config.Targets {
+		bt, err := newBackupTarget(ctx, inf, t)
+		if err != nil {
+			return err
+		}
+		names, err := bt.List(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list backups in %s: %w", t.Name, err)
+		}
+		for _, name := range expiredBackups(names, rotate, maxAge, now) {
+			err := bt.Remove(ctx, name)
+			if err != nil {
+				return fmt.Errorf("failed to remove backup %s from %s: %w", name, t.Name, err)
+			}
+		}
+	}
+
+	entries, err := inf.Storage().GetEtcdBackupEntries(ctx)
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name
+	}
+	for _, name := range expiredBackups(names, rotate, maxAge, now) {
+		err := inf.Storage().DeleteEtcdBackupEntry(ctx, leaderKey, name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c backupRotateCommand) Command() cke.Command {
+	return cke.Command{
+		Name: "backup-rotate",
+	}
+}
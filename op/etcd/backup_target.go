@@ -0,0 +1,180 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/cybozu-go/cke"
+)
+
+// backupTarget is a storage to keep etcd backups.
+type backupTarget interface {
+	// Put stores the data read from r as a backup named name.
+	Put(ctx context.Context, name string, r io.ReadSeeker) error
+	// Get writes the data of a backup named name to w.
+	Get(ctx context.Context, name string, w io.Writer) error
+	// List returns the names of stored backups in ascending order.
+	List(ctx context.Context) ([]string, error)
+	// Remove removes a backup.
+	Remove(ctx context.Context, name string) error
+}
+
+func newBackupTarget(ctx context.Context, inf cke.Infrastructure, t cke.EtcdBackupTarget) (backupTarget, error) {
+	switch {
+	case t.Local != nil:
+		return localBackupTarget{inf: inf, config: t.Local}, nil
+	case t.S3 != nil:
+		accessKey, secretKey, err := getS3Credentials(ctx, inf, t.Name)
+		if err != nil {
+			return nil, err
+		}
+		client, err := newS3Client(t.S3, accessKey, secretKey)
+		if err != nil {
+			return nil, err
+		}
+		return s3BackupTarget{client: client, prefix: t.S3.Prefix}, nil
+	}
+	return nil, errors.New("no backup storage is specified for " + t.Name)
+}
+
+func getS3Credentials(ctx context.Context, inf cke.Infrastructure, name string) (string, string, error) {
+	secret, err := inf.Secrets().ReadSecret(ctx, cke.EtcdBackupSecret+"/"+name)
+	if err != nil {
+		return "", "", err
+	}
+	if secret == nil {
+		return "", "", errors.New("no credentials for etcd backup target " + name)
+	}
+
+	accessKey, ok := secret["access_key_id"].(string)
+	if !ok {
+		return "", "", errors.New("no access_key_id for etcd backup target " + name)
+	}
+	secretKey, ok := secret["secret_access_key"].(string)
+	if !ok {
+		return "", "", errors.New("no secret_access_key for etcd backup target " + name)
+	}
+	return accessKey, secretKey, nil
+}
+
+func isBackupName(name string) bool {
+	_, err := cke.ParseEtcdBackupName(name)
+	return err == nil
+}
+
+// localBackupTarget keeps backups in a directory of a node.
+type localBackupTarget struct {
+	inf    cke.Infrastructure
+	config *cke.EtcdBackupLocalTarget
+}
+
+func (t localBackupTarget) agent() (cke.Agent, error) {
+	agent := t.inf.Agent(t.config.Node)
+	if agent == nil {
+		return nil, errors.New("unable to prepare agent for " + t.config.Node)
+	}
+	return agent, nil
+}
+
+func (t localBackupTarget) Put(ctx context.Context, name string, r io.ReadSeeker) error {
+	agent, err := t.agent()
+	if err != nil {
+		return err
+	}
+
+	dest := path.Join(t.config.Dir, name)
+	cmdline := fmt.Sprintf("mkdir -p %s && cat > %s.tmp && mv %s.tmp %s", t.config.Dir, dest, dest, dest)
+	_, stderr, err := agent.RunWithReader(cmdline, r, 0)
+	if err != nil {
+		return fmt.Errorf("%w, stderr: %s", err, stderr)
+	}
+	return nil
+}
+
+func (t localBackupTarget) Get(ctx context.Context, name string, w io.Writer) error {
+	agent, err := t.agent()
+	if err != nil {
+		return err
+	}
+
+	stderr, err := agent.RunWithWriter("cat "+path.Join(t.config.Dir, name), w, 0)
+	if err != nil {
+		return fmt.Errorf("%w, stderr: %s", err, stderr)
+	}
+	return nil
+}
+
+func (t localBackupTarget) List(ctx context.Context) ([]string, error) {
+	agent, err := t.agent()
+	if err != nil {
+		return nil, err
+	}
+
+	cmdline := fmt.Sprintf("mkdir -p %s && ls -1 %s", t.config.Dir, t.config.Dir)
+	stdout, stderr, err := agent.Run(cmdline)
+	if err != nil {
+		return nil, fmt.Errorf("%w, stderr: %s", err, stderr)
+	}
+
+	var names []string
+	for _, name := range strings.Fields(string(stdout)) {
+		if isBackupName(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (t localBackupTarget) Remove(ctx context.Context, name string) error {
+	agent, err := t.agent()
+	if err != nil {
+		return err
+	}
+
+	_, stderr, err := agent.Run("rm -f " + path.Join(t.config.Dir, name))
+	if err != nil {
+		return fmt.Errorf("%w, stderr: %s", err, stderr)
+	}
+	return nil
+}
+
+// s3BackupTarget keeps backups in an S3-compatible object storage.
+type s3BackupTarget struct {
+	client *s3Client
+	prefix string
+}
+
+func (t s3BackupTarget) Put(ctx context.Context, name string, r io.ReadSeeker) error {
+	return t.client.PutObject(ctx, t.prefix+name, r)
+}
+
+func (t s3BackupTarget) Get(ctx context.Context, name string, w io.Writer) error {
+	return t.client.GetObject(ctx, t.prefix+name, w)
+}
+
+func (t s3BackupTarget) List(ctx context.Context) ([]string, error) {
+	keys, err := t.client.ListObjects(ctx, t.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, t.prefix)
+		if isBackupName(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (t s3BackupTarget) Remove(ctx context.Context, name string) error {
+	return t.client.DeleteObject(ctx, t.prefix+name)
+}
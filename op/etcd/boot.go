@@ -2,6 +2,7 @@ package etcd
 
 import (
 	"context"
+	"net"
 	"strings"
 	"time"
 
@@ -56,7 +57,7 @@ func (o *bootOp) NextCommand() cke.Commander {
 		}
 		initialCluster := make([]string, len(o.nodes))
 		for i, n := range o.nodes {
-			initialCluster[i] = n.Address + "=https://" + n.Address + ":2380"
+			initialCluster[i] = n.Address + "=https://" + net.JoinHostPort(n.Address, "2380")
 		}
 		paramsMap := make(map[string]cke.ServiceParams)
 		for _, n := range o.nodes {
@@ -68,7 +69,7 @@ func (o *bootOp) NextCommand() cke.Commander {
 			common.WithExtra(o.params.ServiceParams))
 	case 5:
 		o.step++
-		return waitEtcdSyncCommand{o.endpoints, false}
+		return waitEtcdSyncCommand{o.endpoints, false, ""}
 	case 6:
 		o.step++
 		return setupEtcdAuthCommand{o.endpoints}
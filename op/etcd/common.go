@@ -3,6 +3,7 @@ package etcd
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"net/url"
 	"strings"
@@ -17,7 +18,7 @@ import (
 func etcdEndpoints(nodes []*cke.Node) []string {
 	endpoints := make([]string, len(nodes))
 	for i, n := range nodes {
-		endpoints[i] = "https://" + n.Address + ":2379"
+		endpoints[i] = "https://" + net.JoinHostPort(n.Address, "2379")
 	}
 	return endpoints
 }
@@ -47,7 +48,7 @@ func BuiltInParams(node *cke.Node, initialCluster []string, state string) cke.Se
 		"--name=" + node.Address,
 		"--listen-peer-urls=https://0.0.0.0:2380",
 		"--listen-client-urls=https://0.0.0.0:2379",
-		"--advertise-client-urls=https://" + node.Address + ":2379",
+		"--advertise-client-urls=https://" + net.JoinHostPort(node.Address, "2379"),
 		"--cert-file=" + op.EtcdPKIPath("server.crt"),
 		"--key-file=" + op.EtcdPKIPath("server.key"),
 		"--client-cert-auth=true",
@@ -68,7 +69,7 @@ func BuiltInParams(node *cke.Node, initialCluster []string, state string) cke.Se
 	}
 	if len(initialCluster) > 0 {
 		args = append(args,
-			"--initial-advertise-peer-urls=https://"+node.Address+":2380",
+			"--initial-advertise-peer-urls=https://"+net.JoinHostPort(node.Address, "2380"),
 			"--initial-cluster="+strings.Join(initialCluster, ","),
 			"--initial-cluster-token=cke",
 			"--initial-cluster-state="+state)
@@ -153,6 +154,9 @@ func (c prepareEtcdCertificatesCommand) Command() cke.Command {
 type waitEtcdSyncCommand struct {
 	endpoints       []string
 	checkRedundancy bool
+	// learner is the address of a member that has just been added.
+	// If not empty, this waits for the member to catch up with the cluster.
+	learner string
 }
 
 func (c waitEtcdSyncCommand) try(ctx context.Context, inf cke.Infrastructure) error {
@@ -171,6 +175,13 @@ func (c waitEtcdSyncCommand) try(ctx context.Context, inf cke.Infrastructure) er
 		return errors.New("no lease")
 	}
 
+	if len(c.learner) > 0 {
+		err := c.waitLearner(ctx, inf, resp.Revision)
+		if err != nil {
+			return err
+		}
+	}
+
 	if !c.checkRedundancy {
 		return nil
 	}
@@ -190,6 +201,26 @@ func (c waitEtcdSyncCommand) try(ctx context.Context, inf cke.Infrastructure) er
 	return nil
 }
 
+func (c waitEtcdSyncCommand) waitLearner(ctx context.Context, inf cke.Infrastructure, clusterRev int64) error {
+	cli, err := inf.NewEtcdClient(ctx, etcdEndpoints([]*cke.Node{{Address: c.learner}}))
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	// learners serve only serializable requests.
+	ct, cancel := context.WithTimeout(ctx, op.TimeoutDuration)
+	defer cancel()
+	resp, err := cli.Get(ct, "health", clientv3.WithSerializable())
+	if err != nil {
+		return err
+	}
+	if resp.Header.Revision < clusterRev {
+		return fmt.Errorf("learner %s is not in sync: revision %d < %d", c.learner, resp.Header.Revision, clusterRev)
+	}
+	return nil
+}
+
 func (c waitEtcdSyncCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
 	for i := 0; i < 9; i++ {
 		err := c.try(ctx, inf)
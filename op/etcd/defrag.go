@@ -0,0 +1,212 @@
+package etcd
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	"github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/cke/op"
+	"github.com/cybozu-go/log"
+)
+
+type defragOp struct {
+	cpNodes []*cke.Node
+	target  *cke.Node
+	step    int
+}
+
+// DefragOp returns an Operator to defragment the database of an etcd member.
+func DefragOp(cpNodes []*cke.Node, target *cke.Node) cke.Operator {
+	return &defragOp{
+		cpNodes: cpNodes,
+		target:  target,
+	}
+}
+
+func (o *defragOp) Name() string {
+	return "etcd-defrag"
+}
+
+func (o *defragOp) NextCommand() cke.Commander {
+	switch o.step {
+	case 0:
+		o.step++
+		return waitEtcdSyncCommand{etcdEndpoints(o.cpNodes), true, ""}
+	case 1:
+		o.step++
+		return defragCommand{etcdEndpoints(o.cpNodes), o.target.Address}
+	case 2:
+		o.step++
+		return waitEtcdSyncCommand{etcdEndpoints(o.cpNodes), false, ""}
+	}
+	return nil
+}
+
+func (o *defragOp) Targets() []string {
+	return []string{
+		o.target.Address,
+	}
+}
+
+type recoverNoSpaceOp struct {
+	cpNodes []*cke.Node
+	step    int
+}
+
+// RecoverNoSpaceOp returns an Operator to recover etcd cluster from NOSPACE alarm.
+// This compacts the keyspace, defragments all members one by one, and disarms the alarm.
+func RecoverNoSpaceOp(cpNodes []*cke.Node) cke.Operator {
+	return &recoverNoSpaceOp{
+		cpNodes: cpNodes,
+	}
+}
+
+func (o *recoverNoSpaceOp) Name() string {
+	return "etcd-recover-nospace"
+}
+
+func (o *recoverNoSpaceOp) NextCommand() cke.Commander {
+	endpoints := etcdEndpoints(o.cpNodes)
+
+	switch {
+	case o.step == 0:
+		o.step++
+		return compactCommand{endpoints}
+	case o.step <= len(o.cpNodes):
+		n := o.cpNodes[o.step-1]
+		o.step++
+		return defragCommand{endpoints, n.Address}
+	case o.step == len(o.cpNodes)+1:
+		o.step++
+		return disarmNoSpaceCommand{endpoints}
+	case o.step == len(o.cpNodes)+2:
+		o.step++
+		return waitEtcdSyncCommand{endpoints, false, ""}
+	}
+	return nil
+}
+
+func (o *recoverNoSpaceOp) Targets() []string {
+	ips := make([]string, len(o.cpNodes))
+	for i, n := range o.cpNodes {
+		ips[i] = n.Address
+	}
+	return ips
+}
+
+type compactCommand struct {
+	endpoints []string
+}
+
+func (c compactCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	cli, err := inf.NewEtcdClient(ctx, c.endpoints)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	ct, cancel := context.WithTimeout(ctx, op.TimeoutDuration)
+	defer cancel()
+	resp, err := cli.Get(ct, "health")
+	if err != nil {
+		return err
+	}
+
+	rev := resp.Header.Revision
+	// Compaction with physical option may take long time.
+	_, err = cli.Compact(ctx, rev, clientv3.WithCompactPhysical())
+	if err != nil && err != rpctypes.ErrCompacted {
+		return err
+	}
+
+	log.Info("compacted etcd keyspace", map[string]interface{}{
+		"revision": rev,
+	})
+	return nil
+}
+
+func (c compactCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "etcd-compact",
+		Target: strings.Join(c.endpoints, ","),
+	}
+}
+
+type defragCommand struct {
+	endpoints []string
+	address   string
+}
+
+func (c defragCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	cli, err := inf.NewEtcdClient(ctx, c.endpoints)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	// Defragmentation blocks the member and may take long time,
+	// so it is not bounded by op.TimeoutDuration.
+	endpoint := "https://" + net.JoinHostPort(c.address, "2379")
+	_, err = cli.Defragment(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+
+	log.Info("defragmented etcd member", map[string]interface{}{
+		"member": c.address,
+	})
+	return nil
+}
+
+func (c defragCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "etcd-defrag",
+		Target: c.address,
+	}
+}
+
+type disarmNoSpaceCommand struct {
+	endpoints []string
+}
+
+func (c disarmNoSpaceCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	cli, err := inf.NewEtcdClient(ctx, c.endpoints)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	ct, cancel := context.WithTimeout(ctx, op.TimeoutDuration)
+	defer cancel()
+	resp, err := cli.AlarmList(ct)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range resp.Alarms {
+		if a.Alarm != etcdserverpb.AlarmType_NOSPACE {
+			continue
+		}
+		ct2, cancel2 := context.WithTimeout(ctx, op.TimeoutDuration)
+		_, err := cli.AlarmDisarm(ct2, (*clientv3.AlarmMember)(a))
+		cancel2()
+		if err != nil {
+			return err
+		}
+		log.Info("disarmed etcd NOSPACE alarm", map[string]interface{}{
+			"member_id": a.MemberID,
+		})
+	}
+	return nil
+}
+
+func (c disarmNoSpaceCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "etcd-disarm-nospace",
+		Target: strings.Join(c.endpoints, ","),
+	}
+}
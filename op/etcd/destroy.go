@@ -43,7 +43,7 @@ func (o *destroyMemberOp) NextCommand() cke.Commander {
 		return common.VolumeRemoveCommand(o.targets, op.EtcdVolumeName(o.params))
 	case 4:
 		o.step++
-		return waitEtcdSyncCommand{o.endpoints, false}
+		return waitEtcdSyncCommand{o.endpoints, false, ""}
 	}
 	return nil
 }
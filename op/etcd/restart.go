@@ -4,6 +4,7 @@ import (
 	"github.com/cybozu-go/cke"
 	"github.com/cybozu-go/cke/op"
 	"github.com/cybozu-go/cke/op/common"
+	"net"
 )
 
 type etcdRestartOp struct {
@@ -11,6 +12,7 @@ type etcdRestartOp struct {
 	target  *cke.Node
 	params  cke.EtcdParams
 	step    int
+	files   *common.FilesBuilder
 }
 
 // RestartOp returns an Operator to restart an etcd member.
@@ -22,6 +24,17 @@ func RestartOp(cpNodes []*cke.Node, target *cke.Node, params cke.EtcdParams) cke
 	}
 }
 
+// CertsRestartOp returns an Operator to restart an etcd member.
+// Certificates of the member are reissued before restarting.
+func CertsRestartOp(cpNodes []*cke.Node, target *cke.Node, params cke.EtcdParams) cke.Operator {
+	return &etcdRestartOp{
+		cpNodes: cpNodes,
+		target:  target,
+		params:  params,
+		files:   common.NewFilesBuilder([]*cke.Node{target}),
+	}
+}
+
 func (o *etcdRestartOp) Name() string {
 	return "etcd-restart"
 }
@@ -30,14 +43,25 @@ func (o *etcdRestartOp) NextCommand() cke.Commander {
 	switch o.step {
 	case 0:
 		o.step++
-		return waitEtcdSyncCommand{etcdEndpoints(o.cpNodes), true}
+		return waitEtcdSyncCommand{etcdEndpoints(o.cpNodes), true, ""}
 	case 1:
 		o.step++
 		return common.ImagePullCommand([]*cke.Node{o.target}, cke.EtcdImage)
 	case 2:
 		o.step++
-		return common.StopContainerCommand(o.target, op.EtcdContainerName)
+		if o.files == nil {
+			// skip reissuing certificates.
+			o.step = 4
+			return o.NextCommand()
+		}
+		return prepareEtcdCertificatesCommand{o.files}
 	case 3:
+		o.step++
+		return o.files
+	case 4:
+		o.step++
+		return common.StopContainerCommand(o.target, op.EtcdContainerName)
+	case 5:
 		o.step++
 		opts := []string{
 			"--mount",
@@ -45,7 +69,7 @@ func (o *etcdRestartOp) NextCommand() cke.Commander {
 		}
 		var initialCluster []string
 		for _, n := range o.cpNodes {
-			initialCluster = append(initialCluster, n.Address+"=https://"+n.Address+":2380")
+			initialCluster = append(initialCluster, n.Address+"=https://"+net.JoinHostPort(n.Address, "2380"))
 		}
 		return common.RunContainerCommand([]*cke.Node{o.target}, op.EtcdContainerName, cke.EtcdImage,
 			common.WithOpts(opts),
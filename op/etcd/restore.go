@@ -0,0 +1,413 @@
+package etcd
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/etcd/snapshot"
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/cke/op"
+	"github.com/cybozu-go/cke/op/common"
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/well"
+)
+
+const (
+	restoreDir      = "/var/lib/cke/etcd-restore"
+	restoreSnapshot = "snapshot.db"
+
+	// restoreStepRestored is the step following the restoration of the snapshot.
+	// Once this is recorded, the snapshot need not be fetched nor restored again.
+	restoreStepRestored = 9
+)
+
+// restoreTempFile is the file on the CKE leader to keep the snapshot
+// between fetching and distributing it.  Snapshots can be too large
+// to keep in memory.
+var restoreTempFile = filepath.Join(os.TempDir(), "cke-etcd-restore.db")
+
+type restoreOp struct {
+	nodes      []*cke.Node
+	apiServers []*cke.Node
+	params     cke.EtcdParams
+	config     cke.EtcdBackup
+	request    *cke.EtcdRestoreRequest
+	step       int
+	files      *common.FilesBuilder
+}
+
+// RestoreOp returns an Operator to restore etcd cluster from a backup.
+// API servers running on apiServers are stopped during the restoration.
+func RestoreOp(nodes, apiServers []*cke.Node, params cke.EtcdParams, config cke.EtcdBackup, request *cke.EtcdRestoreRequest) cke.Operator {
+	return &restoreOp{
+		nodes:      nodes,
+		apiServers: apiServers,
+		params:     params,
+		config:     config,
+		request:    request,
+		files:      common.NewFilesBuilder(nodes),
+	}
+}
+
+func (o *restoreOp) Name() string {
+	return "etcd-restore"
+}
+
+func (o *restoreOp) NextCommand() cke.Commander {
+	volname := op.EtcdVolumeName(o.params)
+
+	switch o.step {
+	case 0:
+		o.step++
+		return common.ImagePullCommand(o.nodes, cke.EtcdImage)
+	case 1:
+		o.step++
+		if o.resumed() {
+			return o.NextCommand()
+		}
+		return restoreFetchCommand{config: o.config, request: o.request, path: restoreTempFile}
+	case 2:
+		o.step++
+		return common.StopContainersCommand(o.apiServers, op.KubeAPIServerContainerName)
+	case 3:
+		o.step++
+		return common.StopContainersCommand(o.nodes, op.EtcdContainerName)
+	case 4:
+		if o.resumed() {
+			o.step = restoreStepRestored
+			return o.NextCommand()
+		}
+		o.step++
+		return restoreDistributeCommand{nodes: o.nodes, path: restoreTempFile}
+	case 5:
+		o.step++
+		return common.VolumeRemoveCommand(o.nodes, volname)
+	case 6:
+		o.step++
+		return common.VolumeCreateCommand(o.nodes, volname)
+	case 7:
+		o.step++
+		return restoreSnapshotCommand{nodes: o.nodes, volname: volname}
+	case 8:
+		o.step++
+		return restoreProgressCommand{request: o.request, step: restoreStepRestored}
+	case 9:
+		o.step++
+		return restoreCleanupCommand{nodes: o.nodes}
+	case 10:
+		o.step++
+		return common.VolumeCreateCommand(o.nodes, op.EtcdAddedMemberVolumeName)
+	case 11:
+		o.step++
+		return prepareEtcdCertificatesCommand{o.files}
+	case 12:
+		o.step++
+		return o.files
+	case 13:
+		o.step++
+		opts := []string{
+			"--mount",
+			"type=volume,src=" + volname + ",dst=/var/lib/etcd",
+		}
+		paramsMap := make(map[string]cke.ServiceParams)
+		for _, n := range o.nodes {
+			paramsMap[n.Address] = BuiltInParams(n, nil, "")
+		}
+		return common.RunContainerCommand(o.nodes, op.EtcdContainerName, cke.EtcdImage,
+			common.WithOpts(opts),
+			common.WithParamsMap(paramsMap),
+			common.WithExtra(o.params.ServiceParams))
+	case 14:
+		o.step++
+		return waitEtcdSyncCommand{etcdEndpoints(o.nodes), false, ""}
+	case 15:
+		o.step++
+		return restoreFinishCommand{request: o.request}
+	default:
+		return nil
+	}
+}
+
+// resumed returns true if the snapshot has been restored by a previous run
+// of this operation, e.g. before the change of the leader.
+func (o *restoreOp) resumed() bool {
+	return o.request.Step >= restoreStepRestored
+}
+
+func (o *restoreOp) Targets() []string {
+	ips := make([]string, len(o.nodes))
+	for i, n := range o.nodes {
+		ips[i] = n.Address
+	}
+	return ips
+}
+
+// restoreFetchCommand downloads the snapshot into path.
+type restoreFetchCommand struct {
+	config  cke.EtcdBackup
+	request *cke.EtcdRestoreRequest
+	path    string
+}
+
+func (c restoreFetchCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	var entry *cke.EtcdBackupEntry
+	entries, err := inf.Storage().GetEtcdBackupEntries(ctx)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Name == c.request.Snapshot {
+			entry = e
+			break
+		}
+	}
+
+	f, err := os.OpenFile(c.path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fetched := false
+	for _, t := range c.config.Targets {
+		if len(c.request.Target) > 0 && t.Name != c.request.Target {
+			continue
+		}
+		bt, err := newBackupTarget(ctx, inf, t)
+		if err != nil {
+			return err
+		}
+		err = bt.Get(ctx, c.request.Snapshot, f)
+		if err != nil {
+			log.Warn("failed to get etcd backup", map[string]interface{}{
+				log.FnError: err,
+				"name":      c.request.Snapshot,
+				"target":    t.Name,
+			})
+			if err := truncateFile(f); err != nil {
+				return err
+			}
+			continue
+		}
+		fetched = true
+		break
+	}
+	if !fetched {
+		os.Remove(c.path)
+		return errors.New("failed to get etcd backup " + c.request.Snapshot)
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+
+	st, err := snapshot.NewV3(nil).Status(c.path)
+	if err != nil {
+		os.Remove(c.path)
+		return fmt.Errorf("failed to check status of the backup: %w", err)
+	}
+	if entry != nil && entry.Hash != st.Hash {
+		os.Remove(c.path)
+		return fmt.Errorf("hash mismatch for %s: expected %d, actual %d", c.request.Snapshot, entry.Hash, st.Hash)
+	}
+	return nil
+}
+
+func truncateFile(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.Seek(0, io.SeekStart)
+	return err
+}
+
+func (c restoreFetchCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "restore-fetch",
+		Target: c.request.Snapshot,
+	}
+}
+
+// restoreDistributeCommand streams the snapshot in path to the nodes, then removes path.
+type restoreDistributeCommand struct {
+	nodes []*cke.Node
+	path  string
+}
+
+func (c restoreDistributeCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	defer os.Remove(c.path)
+
+	fi, err := os.Stat(c.path)
+	if err != nil {
+		return err
+	}
+
+	binds := []cke.Mount{
+		{Source: restoreDir, Destination: filepath.Join("/mnt", restoreDir), Label: cke.LabelPrivate},
+	}
+
+	env := well.NewEnvironment(ctx)
+	for _, n := range c.nodes {
+		ce := inf.Engine(n.Address)
+		env.Go(func(ctx context.Context) error {
+			f, err := os.Open(c.path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			// write_files reads a tar archive, so wrap the snapshot
+			// without loading it in memory.
+			pr, pw := io.Pipe()
+			go func() {
+				tw := tar.NewWriter(pw)
+				err := tw.WriteHeader(&tar.Header{
+					Name: filepath.Join(restoreDir, restoreSnapshot),
+					Mode: 0644,
+					Size: fi.Size(),
+				})
+				if err == nil {
+					_, err = io.Copy(tw, f)
+				}
+				if err == nil {
+					err = tw.Close()
+				}
+				pw.CloseWithError(err)
+			}()
+			err = ce.RunWithReader(cke.ToolsImage, binds, "write_files /mnt", pr)
+			pr.Close()
+			return err
+		})
+	}
+	env.Stop()
+	return env.Wait()
+}
+
+func (c restoreDistributeCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "restore-distribute",
+		Target: filepath.Join(restoreDir, restoreSnapshot),
+	}
+}
+
+type restoreSnapshotCommand struct {
+	nodes   []*cke.Node
+	volname string
+}
+
+func (c restoreSnapshotCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	initialCluster := make([]string, len(c.nodes))
+	for i, n := range c.nodes {
+		initialCluster[i] = n.Address + "=https://" + net.JoinHostPort(n.Address, "2380")
+	}
+
+	// etcdctl refuses to restore into an existing directory,
+	// so restore into a sub directory then move its contents.
+	binds := []cke.Mount{
+		{Source: c.volname, Destination: "/var/lib/etcd"},
+		{Source: restoreDir, Destination: "/restore", ReadOnly: true},
+	}
+
+	env := well.NewEnvironment(ctx)
+	for _, n := range c.nodes {
+		n := n
+		ce := inf.Engine(n.Address)
+		env.Go(func(ctx context.Context) error {
+			args := []string{
+				"/usr/local/etcd/bin/etcdctl",
+				"snapshot",
+				"restore",
+				"/restore/" + restoreSnapshot,
+				"--name=" + n.Address,
+				"--initial-cluster=" + strings.Join(initialCluster, ","),
+				"--initial-cluster-token=cke",
+				"--initial-advertise-peer-urls=https://" + net.JoinHostPort(n.Address, "2380"),
+				"--data-dir=/var/lib/etcd/restore",
+			}
+			// args are passed as positional parameters so that
+			// the script needs no quoting.
+			script := `ETCDCTL_API=3 "$@" && ` +
+				`mv /var/lib/etcd/restore/member /var/lib/etcd/member && ` +
+				`rmdir /var/lib/etcd/restore`
+			return ce.RunWithEntrypoint(cke.EtcdImage, binds, "/bin/sh", append([]string{"-c", script, "sh"}, args...))
+		})
+	}
+	env.Stop()
+	return env.Wait()
+}
+
+func (c restoreSnapshotCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "restore-snapshot",
+		Target: c.volname,
+	}
+}
+
+type restoreProgressCommand struct {
+	request *cke.EtcdRestoreRequest
+	step    int
+}
+
+func (c restoreProgressCommand) Run(ctx context.Context, inf cke.Infrastructure, leaderKey string) error {
+	r := *c.request
+	r.Step = c.step
+	return inf.Storage().UpdateEtcdRestoreRequest(ctx, &r, leaderKey)
+}
+
+func (c restoreProgressCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "restore-progress",
+		Target: c.request.Snapshot,
+	}
+}
+
+type restoreCleanupCommand struct {
+	nodes []*cke.Node
+}
+
+func (c restoreCleanupCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	binds := []cke.Mount{
+		{Source: restoreDir, Destination: filepath.Join("/mnt", restoreDir)},
+	}
+
+	env := well.NewEnvironment(ctx)
+	for _, n := range c.nodes {
+		ce := inf.Engine(n.Address)
+		env.Go(func(ctx context.Context) error {
+			return ce.Run(cke.ToolsImage, binds, "empty-dir "+filepath.Join("/mnt", restoreDir))
+		})
+	}
+	env.Stop()
+	return env.Wait()
+}
+
+func (c restoreCleanupCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "restore-cleanup",
+		Target: restoreDir,
+	}
+}
+
+type restoreFinishCommand struct {
+	request *cke.EtcdRestoreRequest
+}
+
+func (c restoreFinishCommand) Run(ctx context.Context, inf cke.Infrastructure, leaderKey string) error {
+	log.Info("restored etcd from backup", map[string]interface{}{
+		"name": c.request.Snapshot,
+	})
+	return inf.Storage().DeleteEtcdRestoreRequest(ctx, leaderKey)
+}
+
+func (c restoreFinishCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "restore-finish",
+		Target: c.request.Snapshot,
+	}
+}
@@ -0,0 +1,298 @@
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/cke"
+)
+
+const (
+	defaultS3Region = "us-east-1"
+	s3TimeFormat    = "20060102T150405Z"
+	s3DateFormat    = "20060102"
+)
+
+// s3Client is a minimal client for S3-compatible object storages.
+// It uses path-style requests signed with AWS Signature Version 4.
+type s3Client struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+func newS3Client(t *cke.EtcdBackupS3Target, accessKey, secretKey string) (*s3Client, error) {
+	u, err := url.Parse(t.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+	}
+	if len(t.CACert) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(t.CACert)) {
+			return nil, errors.New("invalid CA certificate for " + t.Endpoint)
+		}
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs: pool,
+		}
+	}
+
+	region := t.Region
+	if len(region) == 0 {
+		region = defaultS3Region
+	}
+
+	return &s3Client{
+		endpoint:  u,
+		region:    region,
+		bucket:    t.Bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    &http.Client{Transport: transport},
+	}, nil
+}
+
+// PutObject uploads the data read from body as key.
+func (c *s3Client) PutObject(ctx context.Context, key string, body io.ReadSeeker) error {
+	resp, err := c.do(ctx, http.MethodPut, key, nil, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// GetObject downloads the data of key into w.
+func (c *s3Client) GetObject(ctx context.Context, key string, w io.Writer) error {
+	resp, err := c.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// DeleteObject deletes key.
+func (c *s3Client) DeleteObject(ctx context.Context, key string) error {
+	resp, err := c.do(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type s3ListBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// ListObjects returns the keys of the objects whose names start with prefix.
+func (c *s3Client) ListObjects(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	var token string
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		if len(prefix) > 0 {
+			query.Set("prefix", prefix)
+		}
+		if len(token) > 0 {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := c.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		result := new(s3ListBucketResult)
+		err = xml.NewDecoder(resp.Body).Decode(result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ListObjectsV2 response: %w", err)
+		}
+
+		for _, c := range result.Contents {
+			keys = append(keys, c.Key)
+		}
+		if !result.IsTruncated || len(result.NextContinuationToken) == 0 {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// do sends a request.  body is read twice to sign the payload and to send it.
+func (c *s3Client) do(ctx context.Context, method, key string, query url.Values, body io.ReadSeeker) (*http.Response, error) {
+	u := *c.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + c.bucket
+	if len(key) > 0 {
+		u.Path += "/" + key
+	}
+	u.RawQuery = canonicalS3Query(query)
+
+	if body == nil {
+		body = bytes.NewReader(nil)
+	}
+	h := sha256.New()
+	size, err := io.Copy(h, body)
+	if err != nil {
+		return nil, err
+	}
+	_, err = body.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, u.String(), ioutil.NopCloser(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.ContentLength = size
+	signS3Request(req, hex.EncodeToString(h.Sum(nil)), c.accessKey, c.secretKey, c.region, time.Now())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s: %s", method, u.Path, resp.Status, msg)
+	}
+	return resp, nil
+}
+
+// signS3Request adds AWS Signature Version 4 headers to req.
+// payloadHash is the hex-encoded SHA256 hash of the request body.
+func signS3Request(req *http.Request, payloadHash, accessKey, secretKey, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(s3TimeFormat)
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	scope := strings.Join([]string{now.Format(s3DateFormat), region, "s3", "aws4_request"}, "/")
+	signedHeaders, canonicalRequest := s3CanonicalRequest(req, payloadHash)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), now.Format(s3DateFormat))
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func s3CanonicalRequest(req *http.Request, payloadHash string) (string, string) {
+	host := req.Host
+	if len(host) == 0 {
+		host = req.URL.Host
+	}
+	headers := map[string]string{
+		"host":                 host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           req.Header.Get("x-amz-date"),
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3URIEncode(req.URL.Path, false),
+		canonicalS3Query(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	return signedHeaders, canonicalRequest
+}
+
+func canonicalS3Query(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var params []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			params = append(params, s3URIEncode(k, true)+"="+s3URIEncode(v, true))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// s3URIEncode encodes s as described in the Signature Version 4 document.
+func s3URIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -50,7 +50,7 @@ func (o *etcdStartOp) NextCommand() cke.Commander {
 			common.WithExtra(o.params.ServiceParams))
 	case 3:
 		o.step++
-		return waitEtcdSyncCommand{etcdEndpoints(o.nodes), false}
+		return waitEtcdSyncCommand{etcdEndpoints(o.nodes), false, ""}
 	default:
 		return nil
 	}
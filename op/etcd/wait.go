@@ -24,7 +24,7 @@ func (o *etcdWaitClusterOp) NextCommand() cke.Commander {
 	}
 	o.executed = true
 
-	return waitEtcdSyncCommand{o.endpoints, false}
+	return waitEtcdSyncCommand{o.endpoints, false, ""}
 }
 
 func (o *etcdWaitClusterOp) Targets() []string {
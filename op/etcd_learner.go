@@ -0,0 +1,150 @@
+package op
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/golang/protobuf/proto"
+)
+
+// The etcd client vendored in CKE (v3.3) does not know learners.
+// The following messages are subsets of the ones defined in etcd v3.4
+// to call the learner-related RPCs directly over the client connection.
+
+const (
+	etcdMemberListMethod    = "/etcdserverpb.Cluster/MemberList"
+	etcdMemberAddMethod     = "/etcdserverpb.Cluster/MemberAdd"
+	etcdMemberPromoteMethod = "/etcdserverpb.Cluster/MemberPromote"
+)
+
+type etcdMember struct {
+	ID        uint64   `protobuf:"varint,1,opt,name=ID,proto3"`
+	Name      string   `protobuf:"bytes,2,opt,name=name,proto3"`
+	PeerURLs  []string `protobuf:"bytes,3,rep,name=peerURLs,proto3"`
+	IsLearner bool     `protobuf:"varint,5,opt,name=isLearner,proto3"`
+}
+
+func (m *etcdMember) Reset()         { *m = etcdMember{} }
+func (m *etcdMember) String() string { return proto.CompactTextString(m) }
+func (*etcdMember) ProtoMessage()    {}
+
+type etcdMemberListRequest struct{}
+
+func (m *etcdMemberListRequest) Reset()         { *m = etcdMemberListRequest{} }
+func (m *etcdMemberListRequest) String() string { return proto.CompactTextString(m) }
+func (*etcdMemberListRequest) ProtoMessage()    {}
+
+type etcdMemberListResponse struct {
+	Members []*etcdMember `protobuf:"bytes,2,rep,name=members,proto3"`
+}
+
+func (m *etcdMemberListResponse) Reset()         { *m = etcdMemberListResponse{} }
+func (m *etcdMemberListResponse) String() string { return proto.CompactTextString(m) }
+func (*etcdMemberListResponse) ProtoMessage()    {}
+
+type etcdMemberAddRequest struct {
+	PeerURLs  []string `protobuf:"bytes,1,rep,name=peerURLs,proto3"`
+	IsLearner bool     `protobuf:"varint,2,opt,name=isLearner,proto3"`
+}
+
+func (m *etcdMemberAddRequest) Reset()         { *m = etcdMemberAddRequest{} }
+func (m *etcdMemberAddRequest) String() string { return proto.CompactTextString(m) }
+func (*etcdMemberAddRequest) ProtoMessage()    {}
+
+type etcdMemberAddResponse struct {
+	Member  *etcdMember   `protobuf:"bytes,2,opt,name=member,proto3"`
+	Members []*etcdMember `protobuf:"bytes,3,rep,name=members,proto3"`
+}
+
+func (m *etcdMemberAddResponse) Reset()         { *m = etcdMemberAddResponse{} }
+func (m *etcdMemberAddResponse) String() string { return proto.CompactTextString(m) }
+func (*etcdMemberAddResponse) ProtoMessage()    {}
+
+type etcdMemberPromoteRequest struct {
+	ID uint64 `protobuf:"varint,1,opt,name=ID,proto3"`
+}
+
+func (m *etcdMemberPromoteRequest) Reset()         { *m = etcdMemberPromoteRequest{} }
+func (m *etcdMemberPromoteRequest) String() string { return proto.CompactTextString(m) }
+func (*etcdMemberPromoteRequest) ProtoMessage()    {}
+
+type etcdMemberPromoteResponse struct {
+	Members []*etcdMember `protobuf:"bytes,2,rep,name=members,proto3"`
+}
+
+func (m *etcdMemberPromoteResponse) Reset()         { *m = etcdMemberPromoteResponse{} }
+func (m *etcdMemberPromoteResponse) String() string { return proto.CompactTextString(m) }
+func (*etcdMemberPromoteResponse) ProtoMessage()    {}
+
+// EtcdLearnerSupported returns true if etcd servers at all endpoints support learners.
+func EtcdLearnerSupported(ctx context.Context, cli *clientv3.Client, endpoints []string) bool {
+	for _, ep := range endpoints {
+		ct, cancel := context.WithTimeout(ctx, TimeoutDuration)
+		resp, err := cli.Status(ct, ep)
+		cancel()
+		if err != nil {
+			return false
+		}
+		if !etcdVersionAtLeast(resp.Version, 3, 4) {
+			return false
+		}
+	}
+	return true
+}
+
+func etcdVersionAtLeast(version string, major, minor int) bool {
+	fields := strings.SplitN(version, ".", 3)
+	if len(fields) < 2 {
+		return false
+	}
+	ma, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return false
+	}
+	mi, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return false
+	}
+	if ma != major {
+		return ma > major
+	}
+	return mi >= minor
+}
+
+// EtcdLearners returns the set of IDs of learner members.
+func EtcdLearners(ctx context.Context, cli *clientv3.Client) (map[uint64]bool, error) {
+	ct, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	resp := new(etcdMemberListResponse)
+	err := cli.ActiveConnection().Invoke(ct, etcdMemberListMethod, new(etcdMemberListRequest), resp)
+	if err != nil {
+		return nil, err
+	}
+
+	learners := make(map[uint64]bool)
+	for _, m := range resp.Members {
+		if m.IsLearner {
+			learners[m.ID] = true
+		}
+	}
+	return learners, nil
+}
+
+// EtcdAddLearner adds a learner member to the etcd cluster.
+// The servers must support learners.  Use EtcdLearnerSupported to check it.
+func EtcdAddLearner(ctx context.Context, cli *clientv3.Client, peerURLs []string) error {
+	req := &etcdMemberAddRequest{
+		PeerURLs:  peerURLs,
+		IsLearner: true,
+	}
+	return cli.ActiveConnection().Invoke(ctx, etcdMemberAddMethod, req, new(etcdMemberAddResponse))
+}
+
+// EtcdPromoteLearner promotes a learner member to a voting member.
+func EtcdPromoteLearner(ctx context.Context, cli *clientv3.Client, id uint64) error {
+	req := &etcdMemberPromoteRequest{ID: id}
+	return cli.ActiveConnection().Invoke(ctx, etcdMemberPromoteMethod, req, new(etcdMemberPromoteResponse))
+}
@@ -3,7 +3,10 @@ package k8s
 import (
 	"context"
 	"crypto/md5"
+	"encoding/json"
 	"fmt"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/cybozu-go/cke"
@@ -11,7 +14,14 @@ import (
 	"github.com/cybozu-go/cke/op/common"
 )
 
-const auditPolicyBasePath = "/etc/kubernetes/apiserver/audit-policy-%x.yaml"
+const (
+	admissionConfigBasePath    = "/etc/kubernetes/apiserver/admission-%x.yaml"
+	auditPolicyBasePath        = "/etc/kubernetes/apiserver/audit-policy-%x.yaml"
+	auditWebhookConfigBasePath = "/etc/kubernetes/apiserver/audit-webhook-%x.yaml"
+	oidcCABasePath             = "/etc/kubernetes/apiserver/oidc-ca-%x.crt"
+
+	revocationWebhookConfigBasePath = "/etc/kubernetes/apiserver/revocation-webhook-%x.yaml"
+)
 
 var (
 	// admissionPlugins is the recommended list of admission plugins.
@@ -40,19 +50,23 @@ type apiServerRestartOp struct {
 
 	serviceSubnet string
 	params        cke.APIServerParams
+	featureGates  map[string]bool
 
-	step  int
-	files *common.FilesBuilder
+	step      int
+	files     *common.FilesBuilder
+	paramsMap map[string]cke.ServiceParams
 }
 
 // APIServerRestartOp returns an Operator to restart kube-apiserver
-func APIServerRestartOp(nodes, cps []*cke.Node, serviceSubnet string, params cke.APIServerParams) cke.Operator {
+func APIServerRestartOp(nodes, cps []*cke.Node, serviceSubnet string, params cke.APIServerParams, featureGates map[string]bool) cke.Operator {
 	return &apiServerRestartOp{
 		nodes:         nodes,
 		cps:           cps,
 		serviceSubnet: serviceSubnet,
 		params:        params,
+		featureGates:  featureGates,
 		files:         common.NewFilesBuilder(nodes),
+		paramsMap:     make(map[string]cke.ServiceParams),
 	}
 }
 
@@ -67,10 +81,14 @@ func (o *apiServerRestartOp) NextCommand() cke.Commander {
 		return common.ImagePullCommand(o.nodes, cke.KubernetesImage)
 	case 1:
 		o.step++
-		return common.MakeDirsCommandWithMode(o.nodes, []string{encryptionConfigDir}, "700")
+		dirs := []string{encryptionConfigDir}
+		if o.params.AuditLogEnabled && o.params.AuditLogToFile() {
+			dirs = append(dirs, filepath.Dir(o.params.AuditLogPath))
+		}
+		return common.MakeDirsCommandWithMode(o.nodes, dirs, "700")
 	case 2:
 		o.step++
-		return prepareAPIServerFilesCommand{o.files, o.serviceSubnet, o.params}
+		return prepareAPIServerFilesCommand{o.files, o.nodes, o.cps, o.serviceSubnet, o.params, o.featureGates, o.paramsMap}
 	case 3:
 		o.step++
 		return o.files
@@ -82,14 +100,10 @@ func (o *apiServerRestartOp) NextCommand() cke.Commander {
 		opts := []string{
 			"--mount", "type=tmpfs,dst=/run/kubernetes",
 		}
-		paramsMap := make(map[string]cke.ServiceParams)
-		for _, n := range o.nodes {
-			paramsMap[n.Address] = APIServerParams(o.cps, n.Address, o.serviceSubnet, o.params.AuditLogEnabled, o.params.AuditLogPolicy)
-		}
 		return common.RunContainerCommand(o.nodes,
 			op.KubeAPIServerContainerName, cke.KubernetesImage,
 			common.WithOpts(opts),
-			common.WithParamsMap(paramsMap),
+			common.WithParamsMap(o.paramsMap),
 			common.WithExtra(o.params.ServiceParams))
 	default:
 		return nil
@@ -104,24 +118,47 @@ func (o *apiServerRestartOp) Targets() []string {
 	return ips
 }
 
+// prepareAPIServerFilesCommand prepares files for API server.
+// It also fills paramsMap with the parameters of API server for each node.
 type prepareAPIServerFilesCommand struct {
 	files         *common.FilesBuilder
+	nodes         []*cke.Node
+	cps           []*cke.Node
 	serviceSubnet string
 	params        cke.APIServerParams
+	featureGates  map[string]bool
+	paramsMap     map[string]cke.ServiceParams
 }
 
 func (c prepareAPIServerFilesCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
 	storage := inf.Storage()
 
+	rotation, err := storage.GetServiceAccountKeyRotation(ctx)
+	switch err {
+	case nil:
+	case cke.ErrNotFound:
+	default:
+		return err
+	}
+	additionalSACert := rotation.AdditionalCert()
+
+	for _, n := range c.nodes {
+		params, err := APIServerParams(c.cps, n.Address, c.serviceSubnet, c.params, c.featureGates, additionalSACert != "")
+		if err != nil {
+			return err
+		}
+		c.paramsMap[n.Address] = params
+	}
+
 	// server (and client) certs of API server.
 	f := func(ctx context.Context, n *cke.Node) (cert, key []byte, err error) {
-		c, k, e := cke.KubernetesCA{}.IssueForAPIServer(ctx, inf, n, c.serviceSubnet)
+		c, k, e := cke.KubernetesCA{}.IssueForAPIServer(ctx, inf, n, c.serviceSubnet, c.params.GetCertTTL())
 		if e != nil {
 			return nil, nil, e
 		}
 		return []byte(c), []byte(k), nil
 	}
-	err := c.files.AddKeyPair(ctx, op.K8sPKIPath("apiserver"), f)
+	err = c.files.AddKeyPair(ctx, op.K8sPKIPath("apiserver"), f)
 	if err != nil {
 		return err
 	}
@@ -181,6 +218,18 @@ func (c prepareAPIServerFilesCommand) Run(ctx context.Context, inf cke.Infrastru
 		return err
 	}
 
+	// Additional ServiceAccount cert to verify tokens during key rotation.
+	if additionalSACert != "" {
+		additionalCertData := []byte(additionalSACert)
+		g = func(ctx context.Context, n *cke.Node) ([]byte, error) {
+			return additionalCertData, nil
+		}
+		err = c.files.AddFile(ctx, op.K8sPKIPath("service-account-additional.crt"), g)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Aggregation cert.
 	agCert, err := storage.GetCACertificate(ctx, cke.CAKubernetesAggregation)
 	if err != nil {
@@ -209,7 +258,7 @@ func (c prepareAPIServerFilesCommand) Run(ctx context.Context, inf cke.Infrastru
 	}
 
 	// EncryptionConfiguration
-	enccfg, err := getEncryptionConfiguration(ctx, inf)
+	enccfg, err := getEncryptionConfiguration(ctx, inf, c.params.Encryption)
 	if err != nil {
 		return err
 	}
@@ -217,17 +266,75 @@ func (c prepareAPIServerFilesCommand) Run(ctx context.Context, inf cke.Infrastru
 	if err != nil {
 		return err
 	}
-	err = c.files.AddFile(ctx, encryptionConfigFile, func(ctx context.Context, node *cke.Node) ([]byte, error) {
+	err = c.files.AddFile(ctx, encryptionConfigFilePath(c.params.Encryption), func(ctx context.Context, node *cke.Node) ([]byte, error) {
 		return enccfgData, nil
 	})
 	if err != nil {
 		return err
 	}
 
+	// AdmissionConfiguration
+	if len(c.params.Admission.PluginConfig) > 0 {
+		data, err := admissionConfig(c.params.Admission)
+		if err != nil {
+			return err
+		}
+		path, err := admissionConfigFilePath(c.params.Admission)
+		if err != nil {
+			return err
+		}
+		err = c.files.AddFile(ctx, path, func(context.Context, *cke.Node) ([]byte, error) {
+			return data, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// CA of OIDC issuer
+	if oidc := c.params.OIDC; oidc != nil && len(oidc.CACert) > 0 {
+		err = c.files.AddFile(ctx, oidcCAFilePath(oidc.CACert), func(context.Context, *cke.Node) ([]byte, error) {
+			return []byte(oidc.CACert), nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// kubeconfig for revocation webhook
+	if w := c.params.RevocationWebhook; w != nil {
+		data, err := revocationWebhookKubeconfig(w)
+		if err != nil {
+			return err
+		}
+		err = c.files.AddFile(ctx, revocationWebhookConfigFilePath(w), func(context.Context, *cke.Node) ([]byte, error) {
+			return data, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if !c.params.AuditLogEnabled {
+		return nil
+	}
+
 	// audit log policy
-	if c.params.AuditLogEnabled {
-		return c.files.AddFile(ctx, auditPolicyFilePath(c.params.AuditLogPolicy), func(context.Context, *cke.Node) ([]byte, error) {
-			return []byte(c.params.AuditLogPolicy), nil
+	err = c.files.AddFile(ctx, auditPolicyFilePath(c.params.AuditLogPolicy), func(context.Context, *cke.Node) ([]byte, error) {
+		return []byte(c.params.AuditLogPolicy), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// kubeconfig for audit webhook backend
+	if w := c.params.AuditWebhook; w != nil {
+		data, err := auditWebhookKubeconfig(w)
+		if err != nil {
+			return err
+		}
+		return c.files.AddFile(ctx, auditWebhookConfigFilePath(w), func(context.Context, *cke.Node) ([]byte, error) {
+			return data, nil
 		})
 	}
 
@@ -240,12 +347,167 @@ func (c prepareAPIServerFilesCommand) Command() cke.Command {
 	}
 }
 
+func admissionConfigFilePath(p cke.AdmissionParams) (string, error) {
+	// json.Marshal sorts map keys, so the path is stable.
+	data, err := json.Marshal(p.PluginConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode admission plugin configurations: %w", err)
+	}
+	return fmt.Sprintf(admissionConfigBasePath, md5.Sum(data)), nil
+}
+
+// enabledAdmissionPlugins returns the admission plugins to be enabled.
+func enabledAdmissionPlugins(p cke.AdmissionParams) []string {
+	var plugins []string
+	for _, name := range admissionPlugins {
+		if !containsString(p.DisablePlugins, name) {
+			plugins = append(plugins, name)
+		}
+	}
+	for _, name := range p.EnablePlugins {
+		if !containsString(plugins, name) {
+			plugins = append(plugins, name)
+		}
+	}
+	return plugins
+}
+
+// admissionArgs returns command-line arguments of API server to disable
+// and configure admission plugins.
+func admissionArgs(p cke.AdmissionParams) ([]string, error) {
+	var args []string
+	if len(p.DisablePlugins) > 0 {
+		args = append(args, "--disable-admission-plugins="+strings.Join(p.DisablePlugins, ","))
+	}
+	if len(p.PluginConfig) > 0 {
+		path, err := admissionConfigFilePath(p)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--admission-control-config-file="+path)
+	}
+	return args, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 func auditPolicyFilePath(policy string) string {
 	return fmt.Sprintf(auditPolicyBasePath, md5.Sum([]byte(policy)))
 }
 
+func auditWebhookConfigFilePath(w *cke.AuditWebhookParams) string {
+	return fmt.Sprintf(auditWebhookConfigBasePath, md5.Sum([]byte(w.Kubeconfig+"\n"+w.URL+"\n"+w.CACert)))
+}
+
+// auditArgs returns command-line arguments of API server for audit logs.
+func auditArgs(params cke.APIServerParams) []string {
+	var args []string
+	if params.AuditLogToFile() {
+		args = append(args, "--audit-log-path="+params.AuditLogPath)
+		if params.AuditLogMaxAge > 0 {
+			args = append(args, fmt.Sprintf("--audit-log-maxage=%d", params.AuditLogMaxAge))
+		}
+		if params.AuditLogMaxBackup > 0 {
+			args = append(args, fmt.Sprintf("--audit-log-maxbackup=%d", params.AuditLogMaxBackup))
+		}
+		if params.AuditLogMaxSize > 0 {
+			args = append(args, fmt.Sprintf("--audit-log-maxsize=%d", params.AuditLogMaxSize))
+		}
+	} else {
+		args = append(args, "--audit-log-path=-")
+	}
+	args = append(args, "--audit-policy-file="+auditPolicyFilePath(params.AuditLogPolicy))
+
+	w := params.AuditWebhook
+	if w == nil {
+		return args
+	}
+	args = append(args,
+		"--audit-webhook-config-file="+auditWebhookConfigFilePath(w),
+		"--audit-webhook-mode="+w.GetMode(),
+	)
+	if w.BatchMaxSize > 0 {
+		args = append(args, fmt.Sprintf("--audit-webhook-batch-max-size=%d", w.BatchMaxSize))
+	}
+	if len(w.BatchMaxWait) > 0 {
+		args = append(args, "--audit-webhook-batch-max-wait="+w.BatchMaxWait)
+	}
+	if len(w.InitialBackoff) > 0 {
+		args = append(args, "--audit-webhook-initial-backoff="+w.InitialBackoff)
+	}
+	return args
+}
+
+func revocationWebhookConfigFilePath(w *cke.RevocationWebhookParams) string {
+	return fmt.Sprintf(revocationWebhookConfigBasePath, md5.Sum([]byte(w.URL+"\n"+w.CACert)))
+}
+
+// authorizationArgs returns command-line arguments of API server for authorization.
+func authorizationArgs(params cke.APIServerParams) []string {
+	w := params.RevocationWebhook
+	if w == nil {
+		return []string{"--authorization-mode=Node,RBAC"}
+	}
+
+	// The webhook precedes RBAC so that its denials take effect.
+	return []string{
+		"--authorization-mode=Node,Webhook,RBAC",
+		"--authorization-webhook-config-file=" + revocationWebhookConfigFilePath(w),
+		"--authorization-webhook-version=v1",
+	}
+}
+
+func oidcCAFilePath(ca string) string {
+	return fmt.Sprintf(oidcCABasePath, md5.Sum([]byte(ca)))
+}
+
+// oidcArgs returns command-line arguments of API server for OIDC authentication.
+func oidcArgs(p *cke.OIDCParams) []string {
+	args := []string{
+		"--oidc-issuer-url=" + p.IssuerURL,
+		"--oidc-client-id=" + p.ClientID,
+	}
+	if len(p.UsernameClaim) > 0 {
+		args = append(args, "--oidc-username-claim="+p.UsernameClaim)
+	}
+	if len(p.UsernamePrefix) > 0 {
+		args = append(args, "--oidc-username-prefix="+p.UsernamePrefix)
+	}
+	if len(p.GroupsClaim) > 0 {
+		args = append(args, "--oidc-groups-claim="+p.GroupsClaim)
+	}
+	if len(p.GroupsPrefix) > 0 {
+		args = append(args, "--oidc-groups-prefix="+p.GroupsPrefix)
+	}
+
+	// sort claims to keep the arguments stable.
+	claims := make([]string, 0, len(p.RequiredClaims))
+	for k := range p.RequiredClaims {
+		claims = append(claims, k)
+	}
+	sort.Strings(claims)
+	for _, k := range claims {
+		args = append(args, "--oidc-required-claim="+k+"="+p.RequiredClaims[k])
+	}
+
+	if len(p.CACert) > 0 {
+		args = append(args, "--oidc-ca-file="+oidcCAFilePath(p.CACert))
+	}
+	return args
+}
+
 // APIServerParams returns parameters for API server.
-func APIServerParams(controlPlanes []*cke.Node, advertiseAddress, serviceSubnet string, auditLogEnabeled bool, auditLogPolicy string) cke.ServiceParams {
+// If additionalSAKey is true, the additional key to verify service account
+// tokens during key rotation is added.
+// An error is returned if the admission plugin configurations cannot be encoded.
+func APIServerParams(controlPlanes []*cke.Node, advertiseAddress, serviceSubnet string, params cke.APIServerParams, featureGates map[string]bool, additionalSAKey bool) (cke.ServiceParams, error) {
 	args := []string{
 		"kube-apiserver",
 		"--allow-privileged",
@@ -266,7 +528,7 @@ func APIServerParams(controlPlanes []*cke.Node, advertiseAddress, serviceSubnet
 		"--kubelet-client-key=" + op.K8sPKIPath("apiserver.key"),
 		"--kubelet-https=true",
 
-		"--enable-admission-plugins=" + strings.Join(admissionPlugins, ","),
+		"--enable-admission-plugins=" + strings.Join(enabledAdmissionPlugins(params.Admission), ","),
 
 		// for service accounts
 		"--service-account-key-file=" + op.K8sPKIPath("service-account.crt"),
@@ -281,38 +543,69 @@ func APIServerParams(controlPlanes []*cke.Node, advertiseAddress, serviceSubnet
 		"--proxy-client-cert-file=" + op.K8sPKIPath("aggregation.crt"),
 		"--proxy-client-key-file=" + op.K8sPKIPath("aggregation.key"),
 
-		"--authorization-mode=Node,RBAC",
-
 		"--advertise-address=" + advertiseAddress,
 
 		// See https://github.com/cybozu-go/neco/issues/397
 		"--endpoint-reconciler-type=none",
 
 		"--service-cluster-ip-range=" + serviceSubnet,
-		"--encryption-provider-config=" + encryptionConfigFile,
+		"--encryption-provider-config=" + encryptionConfigFilePath(params.Encryption),
 	}
-	if auditLogEnabeled {
-		args = append(args, "--audit-log-path=-")
-		args = append(args, "--audit-policy-file="+auditPolicyFilePath(auditLogPolicy))
+	if additionalSAKey {
+		args = append(args, "--service-account-key-file="+op.K8sPKIPath("service-account-additional.crt"))
+	}
+	args = append(args, authorizationArgs(params)...)
+	admission, err := admissionArgs(params.Admission)
+	if err != nil {
+		return cke.ServiceParams{}, err
+	}
+	args = append(args, admission...)
+	if params.AuditLogEnabled {
+		args = append(args, auditArgs(params)...)
+	}
+	if params.OIDC != nil {
+		args = append(args, oidcArgs(params.OIDC)...)
+	}
+	args = append(args, featureGatesArgs(featureGates)...)
+
+	binds := []cke.Mount{
+		{
+			Source:      "/etc/machine-id",
+			Destination: "/etc/machine-id",
+			ReadOnly:    true,
+			Propagation: "",
+			Label:       "",
+		},
+		{
+			Source:      "/etc/kubernetes",
+			Destination: "/etc/kubernetes",
+			ReadOnly:    true,
+			Propagation: "",
+			Label:       cke.LabelShared,
+		},
+	}
+	if params.AuditLogEnabled && params.AuditLogToFile() {
+		dir := filepath.Dir(params.AuditLogPath)
+		binds = append(binds, cke.Mount{
+			Source:      dir,
+			Destination: dir,
+			ReadOnly:    false,
+			Propagation: "",
+			Label:       cke.LabelPrivate,
+		})
+	}
+	if params.Encryption.GetProvider() == cke.EncryptionProviderKMS {
+		binds = append(binds, cke.Mount{
+			Source:      op.KMSPluginSocketDir,
+			Destination: op.KMSPluginSocketDir,
+			ReadOnly:    false,
+			Propagation: "",
+			Label:       cke.LabelShared,
+		})
 	}
 
 	return cke.ServiceParams{
 		ExtraArguments: args,
-		ExtraBinds: []cke.Mount{
-			{
-				Source:      "/etc/machine-id",
-				Destination: "/etc/machine-id",
-				ReadOnly:    true,
-				Propagation: "",
-				Label:       "",
-			},
-			{
-				Source:      "/etc/kubernetes",
-				Destination: "/etc/kubernetes",
-				ReadOnly:    true,
-				Propagation: "",
-				Label:       cke.LabelShared,
-			},
-		},
-	}
+		ExtraBinds:     binds,
+	}, nil
 }
@@ -0,0 +1,208 @@
+package k8s
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/cke/op"
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestOIDCArgs(t *testing.T) {
+	t.Parallel()
+
+	p := &cke.OIDCParams{
+		IssuerURL:      "https://accounts.example.com",
+		ClientID:       "kubernetes",
+		UsernameClaim:  "email",
+		GroupsClaim:    "groups",
+		GroupsPrefix:   "oidc:",
+		RequiredClaims: map[string]string{"hd": "example.com", "aud": "kubernetes"},
+		CACert:         "dummy",
+	}
+	expected := []string{
+		"--oidc-issuer-url=https://accounts.example.com",
+		"--oidc-client-id=kubernetes",
+		"--oidc-username-claim=email",
+		"--oidc-groups-claim=groups",
+		"--oidc-groups-prefix=oidc:",
+		"--oidc-required-claim=aud=kubernetes",
+		"--oidc-required-claim=hd=example.com",
+		"--oidc-ca-file=" + oidcCAFilePath("dummy"),
+	}
+	if args := oidcArgs(p); !cmp.Equal(args, expected) {
+		t.Error("unexpected args:", cmp.Diff(args, expected))
+	}
+
+	params, err := APIServerParams(nil, "10.0.0.1", "10.68.0.0/16", cke.APIServerParams{OIDC: p}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, arg := range params.ExtraArguments {
+		if strings.HasPrefix(arg, "--oidc-issuer-url=") {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("OIDC arguments are not added to API server:", params.ExtraArguments)
+	}
+}
+
+func TestAuditArgs(t *testing.T) {
+	t.Parallel()
+
+	params := cke.APIServerParams{
+		AuditLogEnabled: true,
+		AuditLogPolicy:  "policy",
+	}
+	expected := []string{
+		"--audit-log-path=-",
+		"--audit-policy-file=" + auditPolicyFilePath("policy"),
+	}
+	if args := auditArgs(params); !cmp.Equal(args, expected) {
+		t.Error("unexpected args for stdout:", cmp.Diff(args, expected))
+	}
+
+	webhook := &cke.AuditWebhookParams{
+		URL:          "https://siem.example.com/audit",
+		BatchMaxSize: 100,
+		BatchMaxWait: "5s",
+	}
+	params.AuditLogPath = "/var/log/audit/audit.log"
+	params.AuditLogMaxAge = 7
+	params.AuditLogMaxSize = 100
+	params.AuditWebhook = webhook
+	expected = []string{
+		"--audit-log-path=/var/log/audit/audit.log",
+		"--audit-log-maxage=7",
+		"--audit-log-maxsize=100",
+		"--audit-policy-file=" + auditPolicyFilePath("policy"),
+		"--audit-webhook-config-file=" + auditWebhookConfigFilePath(webhook),
+		"--audit-webhook-mode=batch",
+		"--audit-webhook-batch-max-size=100",
+		"--audit-webhook-batch-max-wait=5s",
+	}
+	if args := auditArgs(params); !cmp.Equal(args, expected) {
+		t.Error("unexpected args for file and webhook:", cmp.Diff(args, expected))
+	}
+
+	sp, err := APIServerParams(nil, "10.0.0.1", "10.68.0.0/16", params, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, b := range sp.ExtraBinds {
+		if b.Source == "/var/log/audit" && !b.ReadOnly {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("audit log directory is not mounted:", sp.ExtraBinds)
+	}
+}
+
+func TestAuthorizationArgs(t *testing.T) {
+	t.Parallel()
+
+	expected := []string{"--authorization-mode=Node,RBAC"}
+	if args := authorizationArgs(cke.APIServerParams{}); !cmp.Equal(args, expected) {
+		t.Error("unexpected args without webhook:", cmp.Diff(args, expected))
+	}
+
+	webhook := &cke.RevocationWebhookParams{
+		URL: "https://cke.example.com:10180/authorize",
+	}
+	expected = []string{
+		"--authorization-mode=Node,Webhook,RBAC",
+		"--authorization-webhook-config-file=" + revocationWebhookConfigFilePath(webhook),
+		"--authorization-webhook-version=v1",
+	}
+	if args := authorizationArgs(cke.APIServerParams{RevocationWebhook: webhook}); !cmp.Equal(args, expected) {
+		t.Error("unexpected args with webhook:", cmp.Diff(args, expected))
+	}
+}
+
+func TestServiceAccountKeyArgs(t *testing.T) {
+	t.Parallel()
+
+	additional := "--service-account-key-file=" + op.K8sPKIPath("service-account-additional.crt")
+
+	params, err := APIServerParams(nil, "10.0.0.1", "10.68.0.0/16", cke.APIServerParams{}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if containsString(params.ExtraArguments, additional) {
+		t.Error("additional key should not be added without rotation:", params.ExtraArguments)
+	}
+
+	params, err = APIServerParams(nil, "10.0.0.1", "10.68.0.0/16", cke.APIServerParams{}, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsString(params.ExtraArguments, additional) {
+		t.Error("additional key should be added during rotation:", params.ExtraArguments)
+	}
+}
+
+func TestAdmissionArgs(t *testing.T) {
+	t.Parallel()
+
+	params, err := APIServerParams(nil, "10.0.0.1", "10.68.0.0/16", cke.APIServerParams{}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "--enable-admission-plugins=" + strings.Join(admissionPlugins, ",")
+	if !containsString(params.ExtraArguments, expected) {
+		t.Error("default admission plugins are not enabled:", params.ExtraArguments)
+	}
+	for _, arg := range params.ExtraArguments {
+		if strings.HasPrefix(arg, "--disable-admission-plugins=") || strings.HasPrefix(arg, "--admission-control-config-file=") {
+			t.Error("unexpected argument:", arg)
+		}
+	}
+
+	cfg := &unstructured.Unstructured{}
+	cfg.SetAPIVersion("eventratelimit.admission.k8s.io/v1alpha1")
+	cfg.SetKind("Configuration")
+	p := cke.AdmissionParams{
+		EnablePlugins:  []string{"EventRateLimit", "NodeRestriction"},
+		DisablePlugins: []string{"DefaultStorageClass"},
+		PluginConfig:   map[string]*unstructured.Unstructured{"EventRateLimit": cfg},
+	}
+	plugins := enabledAdmissionPlugins(p)
+	if containsString(plugins, "DefaultStorageClass") {
+		t.Error("disabled plugin is enabled:", plugins)
+	}
+	if plugins[len(plugins)-1] != "EventRateLimit" || len(plugins) != len(admissionPlugins) {
+		t.Error("unexpected plugins:", plugins)
+	}
+
+	path, err := admissionConfigFilePath(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedArgs := []string{
+		"--disable-admission-plugins=DefaultStorageClass",
+		"--admission-control-config-file=" + path,
+	}
+	args, err := admissionArgs(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(args, expectedArgs) {
+		t.Error("unexpected args:", cmp.Diff(args, expectedArgs))
+	}
+
+	// configurations that cannot be encoded into JSON
+	bad := cke.AdmissionParams{
+		PluginConfig: map[string]*unstructured.Unstructured{
+			"EventRateLimit": {Object: map[string]interface{}{"limits": make(chan int)}},
+		},
+	}
+	if _, err := admissionArgs(bad); err == nil {
+		t.Error("admissionArgs should fail for bad plugin configurations")
+	}
+}
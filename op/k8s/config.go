@@ -2,6 +2,10 @@ package k8s
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/cybozu-go/cke"
@@ -9,12 +13,18 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	k8sjson "k8s.io/apimachinery/pkg/runtime/serializer/json"
+	admissionv1 "k8s.io/apiserver/pkg/apis/apiserver/v1"
 	apiserverv1 "k8s.io/apiserver/pkg/apis/config/v1"
+	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
+	controllermanagerv1alpha1 "k8s.io/kube-controller-manager/config/v1alpha1"
+	proxyv1alpha1 "k8s.io/kube-proxy/config/v1alpha1"
 	schedulerv1beta1 "k8s.io/kube-scheduler/config/v1beta1"
 	kubeletv1beta1 "k8s.io/kubelet/config/v1beta1"
 	"k8s.io/utils/pointer"
+	"sigs.k8s.io/yaml"
 )
 
 var (
@@ -49,10 +59,168 @@ func encodeToYAML(obj runtime.Object) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// featureGatesArgs returns command-line arguments to set feature gates.
+func featureGatesArgs(featureGates map[string]bool) []string {
+	if len(featureGates) == 0 {
+		return nil
+	}
+
+	gates := make([]string, 0, len(featureGates))
+	for k, v := range featureGates {
+		gates = append(gates, fmt.Sprintf("%s=%t", k, v))
+	}
+	sort.Strings(gates)
+	return []string{"--feature-gates=" + strings.Join(gates, ",")}
+}
+
+// admissionConfig returns AdmissionConfiguration for API server in YAML.
+func admissionConfig(p cke.AdmissionParams) ([]byte, error) {
+	names := make([]string, 0, len(p.PluginConfig))
+	for name := range p.PluginConfig {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cfg := admissionv1.AdmissionConfiguration{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: admissionv1.SchemeGroupVersion.String(),
+			Kind:       "AdmissionConfiguration",
+		},
+	}
+	for _, name := range names {
+		data, err := json.Marshal(p.PluginConfig[name])
+		if err != nil {
+			return nil, err
+		}
+		cfg.Plugins = append(cfg.Plugins, admissionv1.AdmissionPluginConfiguration{
+			Name:          name,
+			Configuration: &runtime.Unknown{Raw: data},
+		})
+	}
+	return yaml.Marshal(cfg)
+}
+
+// auditWebhookKubeconfig returns kubeconfig for the webhook backend of audit logs.
+func auditWebhookKubeconfig(w *cke.AuditWebhookParams) ([]byte, error) {
+	if len(w.Kubeconfig) > 0 {
+		return []byte(w.Kubeconfig), nil
+	}
+
+	cfg := api.NewConfig()
+	c := api.NewCluster()
+	c.Server = w.URL
+	if len(w.CACert) > 0 {
+		c.CertificateAuthorityData = []byte(w.CACert)
+	}
+	cfg.Clusters["audit-webhook"] = c
+	cfg.AuthInfos["audit-webhook"] = api.NewAuthInfo()
+
+	ctx := api.NewContext()
+	ctx.AuthInfo = "audit-webhook"
+	ctx.Cluster = "audit-webhook"
+	cfg.Contexts["default"] = ctx
+	cfg.CurrentContext = "default"
+
+	return clientcmd.Write(*cfg)
+}
+
+// revocationWebhookKubeconfig returns kubeconfig for the authorization webhook
+// to deny requests with revoked user certificates.
+func revocationWebhookKubeconfig(w *cke.RevocationWebhookParams) ([]byte, error) {
+	cfg := api.NewConfig()
+	c := api.NewCluster()
+	c.Server = w.URL
+	if len(w.CACert) > 0 {
+		c.CertificateAuthorityData = []byte(w.CACert)
+	}
+	cfg.Clusters["revocation-webhook"] = c
+	cfg.AuthInfos["revocation-webhook"] = api.NewAuthInfo()
+
+	ctx := api.NewContext()
+	ctx.AuthInfo = "revocation-webhook"
+	ctx.Cluster = "revocation-webhook"
+	cfg.Contexts["default"] = ctx
+	cfg.CurrentContext = "default"
+
+	return clientcmd.Write(*cfg)
+}
+
 func controllerManagerKubeconfig(cluster string, ca, clientCrt, clientKey string) *api.Config {
 	return cke.Kubeconfig(cluster, "system:kube-controller-manager", ca, clientCrt, clientKey)
 }
 
+// encodeConfigurationToYAML encodes a component configuration to YAML.
+//
+// encodeToYAML cannot be used for configurations having pointers to
+// metav1.Duration because the unstructured converter panics for nil values.
+func encodeConfigurationToYAML(obj interface{}, gvk schema.GroupVersionKind) ([]byte, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	m["apiVersion"], m["kind"] = gvk.ToAPIVersionAndKind()
+	return yaml.Marshal(m)
+}
+
+// GenerateControllerManagerConfiguration generates kube-controller-manager configuration.
+// `params` must be validated beforehand.
+func GenerateControllerManagerConfiguration(params cke.ControllerManagerParams) *controllermanagerv1alpha1.KubeControllerManagerConfiguration {
+	// default values
+	base := controllermanagerv1alpha1.KubeControllerManagerConfiguration{}
+
+	// This won't raise an error because of prior validation
+	c, err := params.MergeConfig(&base)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// controllerManagerConfigArgs translates the configuration to command-line flags
+// because kube-controller-manager does not read configuration files.
+// Keep this in sync with validateControllerManagerConfig in cke package.
+func controllerManagerConfigArgs(c *controllermanagerv1alpha1.KubeControllerManagerConfiguration) []string {
+	var args []string
+	addString := func(flag, value string) {
+		if len(value) > 0 {
+			args = append(args, fmt.Sprintf("--%s=%s", flag, value))
+		}
+	}
+	addInt := func(flag string, value int64) {
+		if value != 0 {
+			args = append(args, fmt.Sprintf("--%s=%d", flag, value))
+		}
+	}
+	addDuration := func(flag string, value time.Duration) {
+		if value != 0 {
+			args = append(args, fmt.Sprintf("--%s=%s", flag, value))
+		}
+	}
+
+	addString("controllers", strings.Join(c.Generic.Controllers, ","))
+	addDuration("min-resync-period", c.Generic.MinResyncPeriod.Duration)
+	addString("cluster-cidr", c.KubeCloudShared.ClusterCIDR)
+	if c.KubeCloudShared.AllocateNodeCIDRs {
+		args = append(args, "--allocate-node-cidrs=true")
+	}
+	addDuration("node-monitor-period", c.KubeCloudShared.NodeMonitorPeriod.Duration)
+	addInt("node-cidr-mask-size", int64(c.NodeIPAMController.NodeCIDRMaskSize))
+	addInt("node-cidr-mask-size-ipv4", int64(c.NodeIPAMController.NodeCIDRMaskSizeIPv4))
+	addInt("node-cidr-mask-size-ipv6", int64(c.NodeIPAMController.NodeCIDRMaskSizeIPv6))
+	addDuration("node-monitor-grace-period", c.NodeLifecycleController.NodeMonitorGracePeriod.Duration)
+	addDuration("node-startup-grace-period", c.NodeLifecycleController.NodeStartupGracePeriod.Duration)
+	addDuration("pod-eviction-timeout", c.NodeLifecycleController.PodEvictionTimeout.Duration)
+	addInt("terminated-pod-gc-threshold", int64(c.PodGCController.TerminatedPodGCThreshold))
+	addInt("concurrent-gc-syncs", int64(c.GarbageCollectorController.ConcurrentGCSyncs))
+	addInt("concurrent-deployment-syncs", int64(c.DeploymentController.ConcurrentDeploymentSyncs))
+	addInt("concurrent-replicaset-syncs", int64(c.ReplicaSetController.ConcurrentRSSyncs))
+	return args
+}
+
 func schedulerKubeconfig(cluster string, ca, clientCrt, clientKey string) *api.Config {
 	return cke.Kubeconfig(cluster, "system:kube-scheduler", ca, clientCrt, clientKey)
 }
@@ -101,9 +269,41 @@ func kubeletKubeconfig(cluster string, n *cke.Node, caPath, certPath, keyPath st
 	return cfg
 }
 
+// GenerateProxyConfiguration generates kube-proxy configuration for the node.
+// `params` must be validated beforehand.
+//
+// featureGates are the cluster-wide feature gates.  Those in `params` take precedence.
+func GenerateProxyConfiguration(params cke.ProxyParams, featureGates map[string]bool, n *cke.Node) *proxyv1alpha1.KubeProxyConfiguration {
+	// default values
+	base := &proxyv1alpha1.KubeProxyConfiguration{}
+	if len(featureGates) > 0 {
+		base.FeatureGates = make(map[string]bool, len(featureGates))
+		for k, v := range featureGates {
+			base.FeatureGates[k] = v
+		}
+	}
+
+	// This won't raise an error because of prior validation
+	c, err := params.MergeConfig(base)
+	if err != nil {
+		panic(err)
+	}
+
+	// forced values
+	if len(params.Mode) > 0 || len(c.Mode) == 0 {
+		c.Mode = proxyv1alpha1.ProxyMode(params.GetMode())
+	}
+	c.HostnameOverride = n.Nodename()
+	c.ClientConnection.Kubeconfig = op.ProxyKubeConfigPath
+
+	return c
+}
+
 // GenerateKubeletConfiguration generates kubelet configuration.
 // `params` must be validated beforehand.
-func GenerateKubeletConfiguration(params cke.KubeletParams, nodeAddress string, running *kubeletv1beta1.KubeletConfiguration) *kubeletv1beta1.KubeletConfiguration {
+//
+// featureGates are the cluster-wide feature gates.  Those in `params` take precedence.
+func GenerateKubeletConfiguration(params cke.KubeletParams, featureGates map[string]bool, nodeAddress string, running *kubeletv1beta1.KubeletConfiguration) *kubeletv1beta1.KubeletConfiguration {
 	caPath := op.K8sPKIPath("ca.crt")
 	tlsCertPath := op.K8sPKIPath("kubelet.crt")
 	tlsKeyPath := op.K8sPKIPath("kubelet.key")
@@ -115,6 +315,12 @@ func GenerateKubeletConfiguration(params cke.KubeletParams, nodeAddress string,
 		HealthzBindAddress:    "0.0.0.0",
 		VolumePluginDir:       "/opt/volume/bin",
 	}
+	if len(featureGates) > 0 {
+		base.FeatureGates = make(map[string]bool, len(featureGates))
+		for k, v := range featureGates {
+			base.FeatureGates[k] = v
+		}
+	}
 
 	// This won't raise an error because of prior validation
 	c, err := params.MergeConfig(base)
@@ -9,9 +9,12 @@ import (
 	"github.com/google/go-cmp/cmp"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	controllermanagerv1alpha1 "k8s.io/kube-controller-manager/config/v1alpha1"
+	proxyv1alpha1 "k8s.io/kube-proxy/config/v1alpha1"
 	schedulerv1beta1 "k8s.io/kube-scheduler/config/v1beta1"
 	kubeletv1beta1 "k8s.io/kubelet/config/v1beta1"
 	"k8s.io/utils/pointer"
+	"sigs.k8s.io/yaml"
 )
 
 func TestGenerateSchedulerConfiguration(t *testing.T) {
@@ -39,6 +42,106 @@ func TestGenerateSchedulerConfiguration(t *testing.T) {
 	}
 }
 
+func TestGenerateControllerManagerConfiguration(t *testing.T) {
+	t.Parallel()
+
+	conf := GenerateControllerManagerConfiguration(cke.ControllerManagerParams{})
+	if !reflect.DeepEqual(conf, &controllermanagerv1alpha1.KubeControllerManagerConfiguration{}) {
+		t.Error("unexpected default configuration:", conf)
+	}
+	if args := controllerManagerConfigArgs(conf); len(args) != 0 {
+		t.Error("unexpected args:", args)
+	}
+
+	cfg := &unstructured.Unstructured{}
+	cfg.SetGroupVersionKind(controllermanagerv1alpha1.SchemeGroupVersion.WithKind("KubeControllerManagerConfiguration"))
+	cfg.Object["generic"] = map[string]interface{}{
+		"controllers": []interface{}{"*", "-bootstrapsigner"},
+	}
+	cfg.Object["kubeCloudShared"] = map[string]interface{}{
+		"clusterCIDR":       "10.64.0.0/14",
+		"allocateNodeCIDRs": true,
+	}
+	cfg.Object["nodeIPAMController"] = map[string]interface{}{
+		"nodeCIDRMaskSize": 24,
+	}
+	cfg.Object["nodeLifecycleController"] = map[string]interface{}{
+		"podEvictionTimeout": "1m",
+	}
+
+	conf = GenerateControllerManagerConfiguration(cke.ControllerManagerParams{Config: cfg})
+	expected := []string{
+		"--controllers=*,-bootstrapsigner",
+		"--cluster-cidr=10.64.0.0/14",
+		"--allocate-node-cidrs=true",
+		"--node-cidr-mask-size=24",
+		"--pod-eviction-timeout=1m0s",
+	}
+	if args := controllerManagerConfigArgs(conf); !cmp.Equal(args, expected) {
+		t.Error("unexpected args:", cmp.Diff(args, expected))
+	}
+}
+
+func TestGenerateProxyConfiguration(t *testing.T) {
+	t.Parallel()
+
+	n := &cke.Node{Address: "1.2.3.4", Hostname: "node1"}
+
+	expected := &proxyv1alpha1.KubeProxyConfiguration{
+		HostnameOverride: "node1",
+		Mode:             proxyv1alpha1.ProxyMode(cke.ProxyModeIPVS),
+	}
+	expected.ClientConnection.Kubeconfig = "/etc/kubernetes/proxy/kubeconfig"
+	conf := GenerateProxyConfiguration(cke.ProxyParams{}, nil, n)
+	if !reflect.DeepEqual(conf, expected) {
+		t.Errorf("GenerateProxyConfiguration() generated unexpected result:\n%s", cmp.Diff(conf, expected))
+	}
+
+	cfg := &unstructured.Unstructured{}
+	cfg.SetGroupVersionKind(proxyv1alpha1.SchemeGroupVersion.WithKind("KubeProxyConfiguration"))
+	cfg.Object["mode"] = "iptables"
+	cfg.Object["ipvs"] = map[string]interface{}{
+		"scheduler": "lc",
+	}
+	cfg.Object["conntrack"] = map[string]interface{}{
+		"maxPerCore": 65536,
+	}
+	cfg.Object["nodePortAddresses"] = []interface{}{"10.0.0.0/8"}
+	cfg.Object["featureGates"] = map[string]interface{}{
+		"EphemeralContainers": false,
+	}
+	gates := map[string]bool{"EphemeralContainers": true, "TTLAfterFinished": true}
+
+	expected.Mode = proxyv1alpha1.ProxyMode(cke.ProxyModeIptables)
+	expected.IPVS.Scheduler = "lc"
+	expected.Conntrack.MaxPerCore = pointer.Int32Ptr(65536)
+	expected.NodePortAddresses = []string{"10.0.0.0/8"}
+	expected.FeatureGates = map[string]bool{"EphemeralContainers": false, "TTLAfterFinished": true}
+	conf = GenerateProxyConfiguration(cke.ProxyParams{Config: cfg}, gates, n)
+	if !reflect.DeepEqual(conf, expected) {
+		t.Errorf("GenerateProxyConfiguration() generated unexpected result:\n%s", cmp.Diff(conf, expected))
+	}
+	if !gates["EphemeralContainers"] {
+		t.Error("cluster-wide feature gates are modified")
+	}
+
+	data, err := encodeConfigurationToYAML(conf, proxyv1alpha1.SchemeGroupVersion.WithKind("KubeProxyConfiguration"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &proxyv1alpha1.KubeProxyConfiguration{}
+	if err := yaml.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Kind != "KubeProxyConfiguration" {
+		t.Error("unexpected kind:", decoded.Kind)
+	}
+	decoded.TypeMeta = metav1.TypeMeta{}
+	if !reflect.DeepEqual(decoded, conf) {
+		t.Error("encoded configuration differs:", cmp.Diff(decoded, conf))
+	}
+}
+
 func TestGenerateKubeletConfiguration(t *testing.T) {
 	t.Parallel()
 
@@ -102,9 +205,90 @@ func TestGenerateKubeletConfiguration(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		conf := GenerateKubeletConfiguration(c.Input, "1.2.3.4", c.Running)
+		conf := GenerateKubeletConfiguration(c.Input, nil, "1.2.3.4", c.Running)
 		if !cmp.Equal(conf, c.Expected) {
 			t.Errorf("case %q: GenerateKubeletConfiguration() generated unexpected result:\n%s", c.Name, cmp.Diff(conf, c.Expected))
 		}
 	}
 }
+
+func TestAdmissionConfig(t *testing.T) {
+	t.Parallel()
+
+	podSecurity := &unstructured.Unstructured{}
+	podSecurity.SetAPIVersion("pod-security.admission.config.k8s.io/v1alpha1")
+	podSecurity.SetKind("PodSecurityConfiguration")
+	podSecurity.Object["defaults"] = map[string]interface{}{"enforce": "baseline"}
+	eventRateLimit := &unstructured.Unstructured{}
+	eventRateLimit.SetAPIVersion("eventratelimit.admission.k8s.io/v1alpha1")
+	eventRateLimit.SetKind("Configuration")
+
+	data, err := admissionConfig(cke.AdmissionParams{
+		PluginConfig: map[string]*unstructured.Unstructured{
+			"PodSecurity":    podSecurity,
+			"EventRateLimit": eventRateLimit,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+		Plugins    []struct {
+			Name          string                 `json:"name"`
+			Configuration map[string]interface{} `json:"configuration"`
+		} `json:"plugins"`
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.APIVersion != "apiserver.config.k8s.io/v1" || cfg.Kind != "AdmissionConfiguration" {
+		t.Error("unexpected type:", cfg.APIVersion, cfg.Kind)
+	}
+	if len(cfg.Plugins) != 2 {
+		t.Fatal("unexpected plugins:", string(data))
+	}
+	if cfg.Plugins[0].Name != "EventRateLimit" || cfg.Plugins[1].Name != "PodSecurity" {
+		t.Error("plugins are not sorted:", string(data))
+	}
+	defaults, _ := cfg.Plugins[1].Configuration["defaults"].(map[string]interface{})
+	if defaults["enforce"] != "baseline" {
+		t.Error("unexpected PodSecurity configuration:", cfg.Plugins[1].Configuration)
+	}
+}
+
+func TestFeatureGates(t *testing.T) {
+	t.Parallel()
+
+	if args := featureGatesArgs(nil); len(args) != 0 {
+		t.Error("unexpected args:", args)
+	}
+
+	gates := map[string]bool{"TTLAfterFinished": true, "EphemeralContainers": false}
+	expected := []string{"--feature-gates=EphemeralContainers=false,TTLAfterFinished=true"}
+	if args := featureGatesArgs(gates); !cmp.Equal(args, expected) {
+		t.Error("unexpected args:", cmp.Diff(args, expected))
+	}
+
+	params := cke.KubeletParams{
+		Config: &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": kubeletv1beta1.SchemeGroupVersion.String(),
+				"kind":       "KubeletConfiguration",
+				"featureGates": map[string]interface{}{
+					"TTLAfterFinished": false,
+				},
+			},
+		},
+	}
+	conf := GenerateKubeletConfiguration(params, gates, "1.2.3.4", nil)
+	expectedGates := map[string]bool{"TTLAfterFinished": false, "EphemeralContainers": false}
+	if !cmp.Equal(conf.FeatureGates, expectedGates) {
+		t.Error("unexpected kubelet feature gates:", cmp.Diff(conf.FeatureGates, expectedGates))
+	}
+	if !gates["TTLAfterFinished"] {
+		t.Error("cluster-wide feature gates are modified")
+	}
+}
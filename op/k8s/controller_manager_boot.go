@@ -7,6 +7,7 @@ import (
 	"github.com/cybozu-go/cke/op"
 	"github.com/cybozu-go/cke/op/common"
 	"k8s.io/client-go/tools/clientcmd"
+	controllermanagerv1alpha1 "k8s.io/kube-controller-manager/config/v1alpha1"
 )
 
 type controllerManagerBootOp struct {
@@ -14,19 +15,21 @@ type controllerManagerBootOp struct {
 
 	cluster       string
 	serviceSubnet string
-	params        cke.ServiceParams
+	params        cke.ControllerManagerParams
+	featureGates  map[string]bool
 
 	step  int
 	files *common.FilesBuilder
 }
 
 // ControllerManagerBootOp returns an Operator to bootstrap kube-controller-manager
-func ControllerManagerBootOp(nodes []*cke.Node, cluster string, serviceSubnet string, params cke.ServiceParams) cke.Operator {
+func ControllerManagerBootOp(nodes []*cke.Node, cluster string, serviceSubnet string, params cke.ControllerManagerParams, featureGates map[string]bool) cke.Operator {
 	return &controllerManagerBootOp{
 		nodes:         nodes,
 		cluster:       cluster,
 		serviceSubnet: serviceSubnet,
 		params:        params,
+		featureGates:  featureGates,
 		files:         common.NewFilesBuilder(nodes),
 	}
 }
@@ -42,7 +45,7 @@ func (o *controllerManagerBootOp) NextCommand() cke.Commander {
 		return common.ImagePullCommand(o.nodes, cke.KubernetesImage)
 	case 1:
 		o.step++
-		return prepareControllerManagerFilesCommand{o.cluster, o.files}
+		return prepareControllerManagerFilesCommand{o.cluster, o.params, o.files}
 	case 2:
 		o.step++
 		return o.files
@@ -50,8 +53,8 @@ func (o *controllerManagerBootOp) NextCommand() cke.Commander {
 		o.step++
 		return common.RunContainerCommand(o.nodes,
 			op.KubeControllerManagerContainerName, cke.KubernetesImage,
-			common.WithParams(ControllerManagerParams(o.cluster, o.serviceSubnet)),
-			common.WithExtra(o.params))
+			common.WithParams(ControllerManagerParams(o.cluster, o.serviceSubnet, GenerateControllerManagerConfiguration(o.params), o.featureGates)),
+			common.WithExtra(o.params.ServiceParams))
 	default:
 		return nil
 	}
@@ -67,11 +70,11 @@ func (o *controllerManagerBootOp) Targets() []string {
 
 type prepareControllerManagerFilesCommand struct {
 	cluster string
+	params  cke.ControllerManagerParams
 	files   *common.FilesBuilder
 }
 
 func (c prepareControllerManagerFilesCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
-	const kubeconfigPath = "/etc/kubernetes/controller-manager/kubeconfig"
 	storage := inf.Storage()
 
 	ca, err := storage.GetCACertificate(ctx, cke.CAKubernetes)
@@ -79,14 +82,14 @@ func (c prepareControllerManagerFilesCommand) Run(ctx context.Context, inf cke.I
 		return err
 	}
 	g := func(ctx context.Context, n *cke.Node) ([]byte, error) {
-		crt, key, err := cke.KubernetesCA{}.IssueForControllerManager(ctx, inf)
+		crt, key, err := cke.KubernetesCA{}.IssueForControllerManager(ctx, inf, c.params.GetCertTTL())
 		if err != nil {
 			return nil, err
 		}
 		cfg := controllerManagerKubeconfig(c.cluster, ca, crt, key)
 		return clientcmd.Write(*cfg)
 	}
-	err = c.files.AddFile(ctx, kubeconfigPath, g)
+	err = c.files.AddFile(ctx, op.ControllerManagerKubeConfigPath, g)
 	if err != nil {
 		return err
 	}
@@ -109,12 +112,12 @@ func (c prepareControllerManagerFilesCommand) Command() cke.Command {
 }
 
 // ControllerManagerParams returns parameters for kube-controller-manager.
-func ControllerManagerParams(clusterName, serviceSubnet string) cke.ServiceParams {
+func ControllerManagerParams(clusterName, serviceSubnet string, cfg *controllermanagerv1alpha1.KubeControllerManagerConfiguration, featureGates map[string]bool) cke.ServiceParams {
 	args := []string{
 		"kube-controller-manager",
 		"--cluster-name=" + clusterName,
 		"--service-cluster-ip-range=" + serviceSubnet,
-		"--kubeconfig=/etc/kubernetes/controller-manager/kubeconfig",
+		"--kubeconfig=" + op.ControllerManagerKubeConfigPath,
 
 		// ToDo: cluster signing
 		// https://kubernetes.io/docs/tasks/tls/managing-tls-in-a-cluster/#a-note-to-cluster-administrators
@@ -133,6 +136,8 @@ func ControllerManagerParams(clusterName, serviceSubnet string) cke.ServiceParam
 		"--service-account-private-key-file=" + op.K8sPKIPath("service-account.key"),
 		"--use-service-account-credentials=true",
 	}
+	args = append(args, featureGatesArgs(featureGates)...)
+	args = append(args, controllerManagerConfigArgs(cfg)...)
 	return cke.ServiceParams{
 		ExtraArguments: args,
 		ExtraBinds: []cke.Mount{
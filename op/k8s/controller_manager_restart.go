@@ -11,19 +11,22 @@ type controllerManagerRestartOp struct {
 
 	cluster       string
 	serviceSubnet string
-	params        cke.ServiceParams
+	params        cke.ControllerManagerParams
+	featureGates  map[string]bool
 
-	pulled   bool
-	finished bool
+	step  int
+	files *common.FilesBuilder
 }
 
 // ControllerManagerRestartOp returns an Operator to restart kube-controller-manager
-func ControllerManagerRestartOp(nodes []*cke.Node, cluster, serviceSubnet string, params cke.ServiceParams) cke.Operator {
+func ControllerManagerRestartOp(nodes []*cke.Node, cluster, serviceSubnet string, params cke.ControllerManagerParams, featureGates map[string]bool) cke.Operator {
 	return &controllerManagerRestartOp{
 		nodes:         nodes,
 		cluster:       cluster,
 		serviceSubnet: serviceSubnet,
 		params:        params,
+		featureGates:  featureGates,
+		files:         common.NewFilesBuilder(nodes),
 	}
 }
 
@@ -32,19 +35,25 @@ func (o *controllerManagerRestartOp) Name() string {
 }
 
 func (o *controllerManagerRestartOp) NextCommand() cke.Commander {
-	if !o.pulled {
-		o.pulled = true
+	switch o.step {
+	case 0:
+		o.step++
 		return common.ImagePullCommand(o.nodes, cke.KubernetesImage)
-	}
-
-	if !o.finished {
-		o.finished = true
+	case 1:
+		o.step++
+		return prepareControllerManagerFilesCommand{o.cluster, o.params, o.files}
+	case 2:
+		o.step++
+		return o.files
+	case 3:
+		o.step++
 		return common.RunContainerCommand(o.nodes, op.KubeControllerManagerContainerName, cke.KubernetesImage,
-			common.WithParams(ControllerManagerParams(o.cluster, o.serviceSubnet)),
-			common.WithExtra(o.params),
+			common.WithParams(ControllerManagerParams(o.cluster, o.serviceSubnet, GenerateControllerManagerConfiguration(o.params), o.featureGates)),
+			common.WithExtra(o.params.ServiceParams),
 			common.WithRestart())
+	default:
+		return nil
 	}
-	return nil
 }
 
 func (o *controllerManagerRestartOp) Targets() []string {
@@ -2,25 +2,45 @@ package k8s
 
 import (
 	"context"
+	"crypto/md5"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/cke/op"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	apiserverv1 "k8s.io/apiserver/pkg/apis/config/v1"
 )
 
 const (
-	encryptionConfigDir  = "/etc/kubernetes/apiserver"
-	encryptionConfigFile = encryptionConfigDir + "/encryption.yml"
+	encryptionConfigDir      = "/etc/kubernetes/apiserver"
+	encryptionConfigFile     = encryptionConfigDir + "/encryption.yml"
+	encryptionConfigBasePath = encryptionConfigDir + "/encryption-%x.yml"
+
+	kmsProviderName = "cke-vault"
+	kmsCacheSize    = 1000
+	kmsTimeout      = 3 * time.Second
 )
 
-func getEncryptionSecret(ctx context.Context, inf cke.Infrastructure, key string) (string, error) {
-	vc, err := inf.Vault()
-	if err != nil {
-		return "", err
+// encryptionConfigFilePath returns the path of EncryptionConfiguration.
+// The path varies with the parameters so that kube-apiserver gets restarted
+// when they are changed.
+func encryptionConfigFilePath(params cke.EncryptionParams) string {
+	provider := params.GetProvider()
+	resources := params.GetResources()
+	if provider == cke.EncryptionProviderAESCBC && len(resources) == 1 && resources[0] == "secrets" {
+		return encryptionConfigFile
 	}
 
-	secret, err := vc.Logical().Read(cke.K8sSecret)
+	key := string(provider) + ":" + strings.Join(resources, ",")
+	return fmt.Sprintf(encryptionConfigBasePath, md5.Sum([]byte(key)))
+}
+
+func getEncryptionSecret(ctx context.Context, inf cke.Infrastructure, key string) (string, error) {
+	secret, err := inf.Secrets().ReadSecret(ctx, cke.K8sSecret)
 	if err != nil {
 		return "", err
 	}
@@ -28,14 +48,14 @@ func getEncryptionSecret(ctx context.Context, inf cke.Infrastructure, key string
 		return "", errors.New("no encryption secrets for API server")
 	}
 
-	data, ok := secret.Data[key]
+	data, ok := secret[key]
 	if !ok {
 		return "", errors.New("no secret data for " + key)
 	}
 	return data.(string), nil
 }
 
-func getEncryptionConfiguration(ctx context.Context, inf cke.Infrastructure) (*apiserverv1.EncryptionConfiguration, error) {
+func getEncryptionConfiguration(ctx context.Context, inf cke.Infrastructure, params cke.EncryptionParams) (*apiserverv1.EncryptionConfiguration, error) {
 	data, err := getEncryptionSecret(ctx, inf, "aescbc")
 	if err != nil {
 		return nil, err
@@ -47,15 +67,107 @@ func getEncryptionConfiguration(ctx context.Context, inf cke.Infrastructure) (*a
 		return nil, err
 	}
 
-	return &apiserverv1.EncryptionConfiguration{
+	rotation, err := inf.Storage().GetEncryptionKeyRotation(ctx)
+	switch err {
+	case nil:
+		keys, err := arrangeEncryptionKeys(aescfg.Keys, rotation)
+		if err != nil {
+			return nil, err
+		}
+		aescfg.Keys = keys
+	case cke.ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	encrypted, err := inf.Storage().GetEncryptedResources(ctx)
+	switch err {
+	case nil:
+	case cke.ErrNotFound:
+		encrypted = cke.DefaultEncryptedResources()
+	default:
+		return nil, err
+	}
+	_, removed := encrypted.PendingResources(params)
+
+	return buildEncryptionConfiguration(params, aescfg, removed), nil
+}
+
+// buildEncryptionConfiguration builds EncryptionConfiguration for the parameters.
+// The first provider is used for encryption.  aescbc and identity providers are
+// always kept to decrypt data written before the provider is changed.
+//
+// removed are resources that are no longer encrypted.  They are written in plain
+// text but kept decryptable until all of their objects are rewritten.
+func buildEncryptionConfiguration(params cke.EncryptionParams, aescfg *apiserverv1.AESConfiguration, removed []string) *apiserverv1.EncryptionConfiguration {
+	var kms []apiserverv1.ProviderConfiguration
+	if params.GetProvider() == cke.EncryptionProviderKMS {
+		cacheSize := int32(kmsCacheSize)
+		kms = append(kms, apiserverv1.ProviderConfiguration{
+			KMS: &apiserverv1.KMSConfiguration{
+				Name:      kmsProviderName,
+				CacheSize: &cacheSize,
+				Endpoint:  "unix://" + op.KMSPluginSocketPath,
+				Timeout:   &metav1.Duration{Duration: kmsTimeout},
+			},
+		})
+	}
+	aescbc := apiserverv1.ProviderConfiguration{AESCBC: aescfg}
+	identity := apiserverv1.ProviderConfiguration{Identity: &apiserverv1.IdentityConfiguration{}}
+
+	cfg := &apiserverv1.EncryptionConfiguration{
 		Resources: []apiserverv1.ResourceConfiguration{
 			{
-				Resources: []string{"secrets"},
-				Providers: []apiserverv1.ProviderConfiguration{
-					{AESCBC: aescfg},
-					{Identity: &apiserverv1.IdentityConfiguration{}},
-				},
+				Resources: params.GetResources(),
+				Providers: append(kms, aescbc, identity),
 			},
 		},
-	}, nil
+	}
+	if len(removed) > 0 {
+		cfg.Resources = append(cfg.Resources, apiserverv1.ResourceConfiguration{
+			Resources: removed,
+			Providers: append([]apiserverv1.ProviderConfiguration{identity}, append(kms, aescbc)...),
+		})
+	}
+	return cfg
+}
+
+// arrangeEncryptionKeys returns the list of keys for the stage of the rotation.
+// The first key is used for encryption, and all keys are used for decryption.
+func arrangeEncryptionKeys(keys []apiserverv1.Key, r *cke.EncryptionKeyRotation) ([]apiserverv1.Key, error) {
+	var oldKey, newKey *apiserverv1.Key
+	for i := range keys {
+		switch keys[i].Name {
+		case r.OldKey:
+			oldKey = &keys[i]
+		case r.NewKey:
+			newKey = &keys[i]
+		}
+	}
+	if r.Stage == cke.EncryptionKeyStagePrepare {
+		// The new key may not have been stored yet.
+		if oldKey == nil {
+			return nil, errors.New("no encryption key named " + r.OldKey)
+		}
+		return []apiserverv1.Key{*oldKey}, nil
+	}
+	if newKey == nil {
+		return nil, errors.New("no encryption key named " + r.NewKey)
+	}
+
+	switch r.Stage {
+	case cke.EncryptionKeyStageAdd:
+		if oldKey == nil {
+			return []apiserverv1.Key{*newKey}, nil
+		}
+		return []apiserverv1.Key{*oldKey, *newKey}, nil
+	case cke.EncryptionKeyStagePromote, cke.EncryptionKeyStageRewrite:
+		if oldKey == nil {
+			return []apiserverv1.Key{*newKey}, nil
+		}
+		return []apiserverv1.Key{*newKey, *oldKey}, nil
+	case cke.EncryptionKeyStageDrop:
+		return []apiserverv1.Key{*newKey}, nil
+	}
+	return nil, errors.New("unknown encryption key rotation stage: " + string(r.Stage))
 }
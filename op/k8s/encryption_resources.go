@@ -0,0 +1,151 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/log"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+)
+
+// objectsListLimit is the maximum number of objects to be listed at once.
+const objectsListLimit = 500
+
+type encryptionRewriteOp struct {
+	apiserver *cke.Node
+	resources []string
+	encrypted *cke.EncryptedResources
+	step      int
+}
+
+// EncryptionRewriteOp returns an Operator to rewrite all objects of resources
+// so that they are stored with the current encryption configuration.
+// encrypted is recorded after all objects are rewritten.
+func EncryptionRewriteOp(apiserver *cke.Node, resources []string, encrypted *cke.EncryptedResources) cke.Operator {
+	return &encryptionRewriteOp{
+		apiserver: apiserver,
+		resources: resources,
+		encrypted: encrypted,
+	}
+}
+
+func (o *encryptionRewriteOp) Name() string {
+	return "encryption-rewrite-resources"
+}
+
+func (o *encryptionRewriteOp) NextCommand() cke.Commander {
+	switch o.step {
+	case 0:
+		o.step++
+		return rewriteResourcesCommand{o.apiserver, o.resources}
+	case 1:
+		o.step++
+		return recordEncryptedResourcesCommand{o.encrypted}
+	}
+	return nil
+}
+
+func (o *encryptionRewriteOp) Targets() []string {
+	return []string{
+		o.apiserver.Address,
+	}
+}
+
+type rewriteResourcesCommand struct {
+	apiserver *cke.Node
+	resources []string
+}
+
+func (c rewriteResourcesCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	cfg, err := inf.K8sConfig(ctx, c.apiserver)
+	if err != nil {
+		return err
+	}
+	dc, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(dc))
+	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range c.resources {
+		gvr, err := mapper.ResourceFor(schema.ParseGroupResource(r).WithVersion(""))
+		if err != nil {
+			return err
+		}
+
+		count, err := rewriteObjects(ctx, dyn.Resource(gvr))
+		if err != nil {
+			return err
+		}
+		log.Info("rewrote objects with the current encryption configuration", map[string]interface{}{
+			"resource": r,
+			"count":    count,
+		})
+	}
+	return nil
+}
+
+func rewriteObjects(ctx context.Context, ri dynamic.NamespaceableResourceInterface) (int, error) {
+	var count int
+	opts := metav1.ListOptions{Limit: objectsListLimit}
+	for {
+		objs, err := ri.List(ctx, opts)
+		if err != nil {
+			return count, err
+		}
+
+		for _, obj := range objs.Items {
+			obj := obj
+			// Updating without modification makes API server store the object
+			// with the current encryption configuration.
+			_, err := ri.Namespace(obj.GetNamespace()).Update(ctx, &obj, metav1.UpdateOptions{})
+			switch {
+			case err == nil:
+				count++
+			case k8serr.IsNotFound(err), k8serr.IsConflict(err):
+				// The object has been deleted or updated by others, so it is
+				// already stored with the current configuration.
+			default:
+				return count, err
+			}
+		}
+
+		if len(objs.GetContinue()) == 0 {
+			return count, nil
+		}
+		opts.Continue = objs.GetContinue()
+	}
+}
+
+func (c rewriteResourcesCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "rewrite-resources",
+		Target: strings.Join(c.resources, ","),
+	}
+}
+
+type recordEncryptedResourcesCommand struct {
+	encrypted *cke.EncryptedResources
+}
+
+func (c recordEncryptedResourcesCommand) Run(ctx context.Context, inf cke.Infrastructure, leaderKey string) error {
+	return inf.Storage().PutEncryptedResources(ctx, leaderKey, c.encrypted)
+}
+
+func (c recordEncryptedResourcesCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "record-encrypted-resources",
+		Target: strings.Join(c.encrypted.Resources, ","),
+	}
+}
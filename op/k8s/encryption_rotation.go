@@ -0,0 +1,188 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/log"
+	apiserverv1 "k8s.io/apiserver/pkg/apis/config/v1"
+)
+
+type encryptionKeyRecordOp struct {
+	rotation *cke.EncryptionKeyRotation
+	finished bool
+}
+
+// EncryptionKeyRecordOp returns an Operator to record the progress of encryption key rotation.
+func EncryptionKeyRecordOp(rotation *cke.EncryptionKeyRotation) cke.Operator {
+	return &encryptionKeyRecordOp{
+		rotation: rotation,
+	}
+}
+
+func (o *encryptionKeyRecordOp) Name() string {
+	return "encryption-key-record"
+}
+
+func (o *encryptionKeyRecordOp) NextCommand() cke.Commander {
+	if o.finished {
+		return nil
+	}
+
+	o.finished = true
+	return recordEncryptionKeyCommand{o.rotation}
+}
+
+func (o *encryptionKeyRecordOp) Targets() []string {
+	return nil
+}
+
+type encryptionKeyRewriteOp struct {
+	apiserver *cke.Node
+	resources []string
+	rotation  *cke.EncryptionKeyRotation
+	step      int
+}
+
+// EncryptionKeyRewriteOp returns an Operator to rewrite all objects of the encrypted
+// resources with the current encryption key.
+// The rotation proceeds to the stage to drop the old key after all objects are rewritten.
+func EncryptionKeyRewriteOp(apiserver *cke.Node, resources []string, rotation *cke.EncryptionKeyRotation) cke.Operator {
+	return &encryptionKeyRewriteOp{
+		apiserver: apiserver,
+		resources: resources,
+		rotation:  rotation,
+	}
+}
+
+func (o *encryptionKeyRewriteOp) Name() string {
+	return "encryption-key-rewrite"
+}
+
+func (o *encryptionKeyRewriteOp) NextCommand() cke.Commander {
+	switch o.step {
+	case 0:
+		o.step++
+		return rewriteResourcesCommand{o.apiserver, o.resources}
+	case 1:
+		o.step++
+		return recordEncryptionKeyCommand{o.rotation.WithStage(cke.EncryptionKeyStageDrop)}
+	}
+	return nil
+}
+
+func (o *encryptionKeyRewriteOp) Targets() []string {
+	return []string{
+		o.apiserver.Address,
+	}
+}
+
+type encryptionKeyFinishOp struct {
+	rotation *cke.EncryptionKeyRotation
+	step     int
+}
+
+// EncryptionKeyFinishOp returns an Operator to remove the old encryption key
+// from Vault and complete the rotation.
+func EncryptionKeyFinishOp(rotation *cke.EncryptionKeyRotation) cke.Operator {
+	return &encryptionKeyFinishOp{
+		rotation: rotation,
+	}
+}
+
+func (o *encryptionKeyFinishOp) Name() string {
+	return "encryption-key-finish"
+}
+
+func (o *encryptionKeyFinishOp) NextCommand() cke.Commander {
+	switch o.step {
+	case 0:
+		o.step++
+		return dropEncryptionKeyCommand{o.rotation}
+	case 1:
+		o.step++
+		return finishEncryptionKeyCommand{}
+	}
+	return nil
+}
+
+func (o *encryptionKeyFinishOp) Targets() []string {
+	return nil
+}
+
+type recordEncryptionKeyCommand struct {
+	rotation *cke.EncryptionKeyRotation
+}
+
+func (c recordEncryptionKeyCommand) Run(ctx context.Context, inf cke.Infrastructure, leaderKey string) error {
+	return inf.Storage().UpdateEncryptionKeyRotation(ctx, leaderKey, c.rotation)
+}
+
+func (c recordEncryptionKeyCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "record-encryption-key-rotation",
+		Target: string(c.rotation.Stage),
+	}
+}
+
+type dropEncryptionKeyCommand struct {
+	rotation *cke.EncryptionKeyRotation
+}
+
+func (c dropEncryptionKeyCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	secret, err := inf.Secrets().ReadSecret(ctx, cke.K8sSecret)
+	if err != nil {
+		return err
+	}
+	if secret == nil {
+		return errors.New("no encryption secrets for API server")
+	}
+	data, ok := secret["aescbc"]
+	if !ok {
+		return errors.New("no secret data for aescbc")
+	}
+
+	aescfg := new(apiserverv1.AESConfiguration)
+	err = json.Unmarshal([]byte(data.(string)), aescfg)
+	if err != nil {
+		return err
+	}
+	aescfg.Keys, err = arrangeEncryptionKeys(aescfg.Keys, c.rotation)
+	if err != nil {
+		return err
+	}
+	cfgData, err := json.Marshal(aescfg)
+	if err != nil {
+		return err
+	}
+
+	secret["aescbc"] = string(cfgData)
+	return inf.Secrets().WriteSecret(ctx, cke.K8sSecret, secret)
+}
+
+func (c dropEncryptionKeyCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "drop-encryption-key",
+		Target: c.rotation.OldKey,
+	}
+}
+
+type finishEncryptionKeyCommand struct{}
+
+func (c finishEncryptionKeyCommand) Run(ctx context.Context, inf cke.Infrastructure, leaderKey string) error {
+	err := inf.Storage().DeleteEncryptionKeyRotation(ctx, leaderKey)
+	if err != nil {
+		return err
+	}
+
+	log.Info("encryption key rotation completed", nil)
+	return nil
+}
+
+func (c finishEncryptionKeyCommand) Command() cke.Command {
+	return cke.Command{
+		Name: "finish-encryption-key-rotation",
+	}
+}
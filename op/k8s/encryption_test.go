@@ -0,0 +1,143 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/cybozu-go/cke"
+	"github.com/google/go-cmp/cmp"
+	apiserverv1 "k8s.io/apiserver/pkg/apis/config/v1"
+)
+
+func TestArrangeEncryptionKeys(t *testing.T) {
+	t.Parallel()
+
+	oldKey := apiserverv1.Key{Name: "old", Secret: "b2xk"}
+	newKey := apiserverv1.Key{Name: "new", Secret: "bmV3"}
+	keys := []apiserverv1.Key{oldKey, newKey}
+
+	cases := []struct {
+		stage    cke.EncryptionKeyRotationStage
+		expected []apiserverv1.Key
+	}{
+		{cke.EncryptionKeyStagePrepare, []apiserverv1.Key{oldKey}},
+		{cke.EncryptionKeyStageAdd, []apiserverv1.Key{oldKey, newKey}},
+		{cke.EncryptionKeyStagePromote, []apiserverv1.Key{newKey, oldKey}},
+		{cke.EncryptionKeyStageRewrite, []apiserverv1.Key{newKey, oldKey}},
+		{cke.EncryptionKeyStageDrop, []apiserverv1.Key{newKey}},
+	}
+
+	for _, c := range cases {
+		r := &cke.EncryptionKeyRotation{Stage: c.stage, OldKey: "old", NewKey: "new"}
+		actual, err := arrangeEncryptionKeys(keys, r)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.stage, err)
+			continue
+		}
+		if !cmp.Equal(actual, c.expected) {
+			t.Errorf("%s: unexpected keys: %s", c.stage, cmp.Diff(actual, c.expected))
+		}
+	}
+
+	_, err := arrangeEncryptionKeys([]apiserverv1.Key{oldKey}, &cke.EncryptionKeyRotation{
+		Stage:  cke.EncryptionKeyStagePromote,
+		OldKey: "old",
+		NewKey: "new",
+	})
+	if err == nil {
+		t.Error("arrangeEncryptionKeys should fail without the new key")
+	}
+}
+
+func TestBuildEncryptionConfiguration(t *testing.T) {
+	t.Parallel()
+
+	aescfg := &apiserverv1.AESConfiguration{
+		Keys: []apiserverv1.Key{{Name: "key", Secret: "a2V5"}},
+	}
+
+	cfg := buildEncryptionConfiguration(cke.EncryptionParams{}, aescfg, nil)
+	if len(cfg.Resources) != 1 {
+		t.Fatal("unexpected resources:", cfg.Resources)
+	}
+	if !cmp.Equal(cfg.Resources[0].Resources, []string{"secrets"}) {
+		t.Error("secrets should be encrypted by default:", cfg.Resources[0].Resources)
+	}
+	providers := cfg.Resources[0].Providers
+	if len(providers) != 2 || providers[0].AESCBC == nil || providers[1].Identity == nil {
+		t.Error("unexpected providers for aescbc:", providers)
+	}
+
+	params := cke.EncryptionParams{
+		Provider:  cke.EncryptionProviderKMS,
+		Resources: []string{"secrets", "configmaps"},
+	}
+	cfg = buildEncryptionConfiguration(params, aescfg, nil)
+	if !cmp.Equal(cfg.Resources[0].Resources, params.Resources) {
+		t.Error("unexpected resources for kms:", cfg.Resources[0].Resources)
+	}
+	providers = cfg.Resources[0].Providers
+	if len(providers) != 3 || providers[0].KMS == nil || providers[1].AESCBC == nil || providers[2].Identity == nil {
+		t.Fatal("unexpected providers for kms:", providers)
+	}
+	if providers[0].KMS.Endpoint != "unix:///var/run/cke-kms/kms.sock" {
+		t.Error("unexpected KMS endpoint:", providers[0].KMS.Endpoint)
+	}
+
+	cfg = buildEncryptionConfiguration(cke.EncryptionParams{}, aescfg, []string{"configmaps"})
+	if len(cfg.Resources) != 2 {
+		t.Fatal("removed resources should be configured:", cfg.Resources)
+	}
+	if !cmp.Equal(cfg.Resources[1].Resources, []string{"configmaps"}) {
+		t.Error("unexpected removed resources:", cfg.Resources[1].Resources)
+	}
+	providers = cfg.Resources[1].Providers
+	if len(providers) != 2 || providers[0].Identity == nil || providers[1].AESCBC == nil {
+		t.Error("removed resources should be written in plain text:", providers)
+	}
+}
+
+func TestEncryptionConfigFilePath(t *testing.T) {
+	t.Parallel()
+
+	if p := encryptionConfigFilePath(cke.EncryptionParams{}); p != encryptionConfigFile {
+		t.Error("default parameters should use the default path:", p)
+	}
+
+	kms := encryptionConfigFilePath(cke.EncryptionParams{Provider: cke.EncryptionProviderKMS})
+	if kms == encryptionConfigFile {
+		t.Error("kms provider should use a different path")
+	}
+	cms := encryptionConfigFilePath(cke.EncryptionParams{Resources: []string{"secrets", "configmaps"}})
+	if cms == encryptionConfigFile || cms == kms {
+		t.Error("different resources should use a different path:", cms)
+	}
+}
+
+func TestEncryptionKeyRewriteOp(t *testing.T) {
+	t.Parallel()
+
+	apiserver := &cke.Node{Address: "10.0.0.1"}
+	resources := []string{"secrets", "configmaps"}
+	r := &cke.EncryptionKeyRotation{Stage: cke.EncryptionKeyStageRewrite, OldKey: "old", NewKey: "new"}
+	o := EncryptionKeyRewriteOp(apiserver, resources, r)
+
+	rewrite, ok := o.NextCommand().(rewriteResourcesCommand)
+	if !ok {
+		t.Fatal("objects should be rewritten first")
+	}
+	if !cmp.Equal(rewrite.resources, resources) {
+		t.Error("all encrypted resources should be rewritten:", rewrite.resources)
+	}
+
+	record, ok := o.NextCommand().(recordEncryptionKeyCommand)
+	if !ok {
+		t.Fatal("the rotation should be recorded after rewriting objects")
+	}
+	if record.rotation.Stage != cke.EncryptionKeyStageDrop {
+		t.Error("the rotation should proceed to drop stage:", record.rotation.Stage)
+	}
+
+	if c := o.NextCommand(); c != nil {
+		t.Error("unexpected command:", c.Command())
+	}
+}
@@ -0,0 +1,134 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/cke/op"
+	"github.com/cybozu-go/cke/op/common"
+)
+
+type kmsPluginBootOp struct {
+	nodes []*cke.Node
+
+	encryption cke.EncryptionParams
+	params     cke.ServiceParams
+
+	step  int
+	files *common.FilesBuilder
+}
+
+// KMSPluginBootOp returns an Operator to bootstrap the KMS plugin for kube-apiserver.
+func KMSPluginBootOp(nodes []*cke.Node, encryption cke.EncryptionParams, params cke.ServiceParams) cke.Operator {
+	return &kmsPluginBootOp{
+		nodes:      nodes,
+		encryption: encryption,
+		params:     params,
+		files:      common.NewFilesBuilder(nodes),
+	}
+}
+
+func (o *kmsPluginBootOp) Name() string {
+	return "kms-plugin-bootstrap"
+}
+
+func (o *kmsPluginBootOp) NextCommand() cke.Commander {
+	switch o.step {
+	case 0:
+		o.step++
+		return common.ImagePullCommand(o.nodes, cke.ToolsImage)
+	case 1:
+		o.step++
+		return common.MakeDirsCommand(o.nodes, []string{op.KMSPluginSocketDir})
+	case 2:
+		o.step++
+		return common.MakeDirsCommandWithMode(o.nodes, []string{op.KMSPluginConfigDir}, "700")
+	case 3:
+		o.step++
+		return prepareKMSPluginFilesCommand{o.files}
+	case 4:
+		o.step++
+		return o.files
+	case 5:
+		o.step++
+		return common.RunContainerCommand(o.nodes, op.KMSPluginContainerName, cke.ToolsImage,
+			common.WithParams(KMSPluginParams(o.encryption)),
+			common.WithExtra(o.params))
+	default:
+		return nil
+	}
+}
+
+func (o *kmsPluginBootOp) Targets() []string {
+	ips := make([]string, len(o.nodes))
+	for i, n := range o.nodes {
+		ips[i] = n.Address
+	}
+	return ips
+}
+
+type prepareKMSPluginFilesCommand struct {
+	files *common.FilesBuilder
+}
+
+func (c prepareKMSPluginFilesCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	// The plugin logs in to Vault with its own AppRole that can use only
+	// the transit secrets engine.  The credentials of CKE must not be
+	// stored on the nodes.
+	cfg, err := inf.Storage().GetKMSVaultConfig(ctx)
+	switch err {
+	case nil:
+	case cke.ErrNotFound:
+		return errors.New("no vault config for the KMS plugin; run ckecli vault init or ckecli vault kms-config")
+	default:
+		return err
+	}
+	if err := cfg.ValidateForKMS(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	return c.files.AddFile(ctx, op.KMSPluginConfigPath, func(context.Context, *cke.Node) ([]byte, error) {
+		return data, nil
+	})
+}
+
+func (c prepareKMSPluginFilesCommand) Command() cke.Command {
+	return cke.Command{
+		Name: "prepare-kms-plugin-files",
+	}
+}
+
+// KMSPluginParams returns parameters for the KMS plugin.
+func KMSPluginParams(encryption cke.EncryptionParams) cke.ServiceParams {
+	args := []string{
+		"vault-kms-plugin",
+		"--listen=" + op.KMSPluginSocketPath,
+		"--config=" + op.KMSPluginConfigPath,
+		"--key=" + encryption.KMS.GetTransitKey(),
+	}
+	return cke.ServiceParams{
+		ExtraArguments: args,
+		ExtraBinds: []cke.Mount{
+			{
+				Source:      op.KMSPluginSocketDir,
+				Destination: op.KMSPluginSocketDir,
+				ReadOnly:    false,
+				Propagation: "",
+				Label:       cke.LabelShared,
+			},
+			{
+				Source:      op.KMSPluginConfigDir,
+				Destination: op.KMSPluginConfigDir,
+				ReadOnly:    true,
+				Propagation: "",
+				Label:       cke.LabelShared,
+			},
+		},
+	}
+}
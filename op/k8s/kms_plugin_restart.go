@@ -0,0 +1,64 @@
+package k8s
+
+import (
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/cke/op"
+	"github.com/cybozu-go/cke/op/common"
+)
+
+type kmsPluginRestartOp struct {
+	nodes []*cke.Node
+
+	encryption cke.EncryptionParams
+	params     cke.ServiceParams
+
+	step  int
+	files *common.FilesBuilder
+}
+
+// KMSPluginRestartOp returns an Operator to restart the KMS plugin for kube-apiserver.
+func KMSPluginRestartOp(nodes []*cke.Node, encryption cke.EncryptionParams, params cke.ServiceParams) cke.Operator {
+	return &kmsPluginRestartOp{
+		nodes:      nodes,
+		encryption: encryption,
+		params:     params,
+		files:      common.NewFilesBuilder(nodes),
+	}
+}
+
+func (o *kmsPluginRestartOp) Name() string {
+	return "kms-plugin-restart"
+}
+
+func (o *kmsPluginRestartOp) NextCommand() cke.Commander {
+	switch o.step {
+	case 0:
+		o.step++
+		return common.ImagePullCommand(o.nodes, cke.ToolsImage)
+	case 1:
+		o.step++
+		return common.MakeDirsCommandWithMode(o.nodes, []string{op.KMSPluginConfigDir}, "700")
+	case 2:
+		o.step++
+		return prepareKMSPluginFilesCommand{o.files}
+	case 3:
+		o.step++
+		return o.files
+	case 4:
+		o.step++
+		return common.RunContainerCommand(o.nodes, op.KMSPluginContainerName, cke.ToolsImage,
+			common.WithParams(KMSPluginParams(o.encryption)),
+			common.WithExtra(o.params),
+			common.WithRestart())
+	default:
+		return nil
+	}
+}
+
+func (o *kmsPluginRestartOp) Targets() []string {
+	ips := make([]string, len(o.nodes))
+	for i, n := range o.nodes {
+		ips[i] = n.Address
+	}
+	return ips
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"path/filepath"
 	"strings"
 	"time"
@@ -31,6 +32,7 @@ type kubeletBootOp struct {
 
 	cluster      string
 	params       cke.KubeletParams
+	featureGates map[string]bool
 	nodeStatuses map[string]*cke.NodeStatus
 
 	step  int
@@ -38,13 +40,14 @@ type kubeletBootOp struct {
 }
 
 // KubeletBootOp returns an Operator to boot kubelet.
-func KubeletBootOp(nodes, registeredNodes []*cke.Node, apiServer *cke.Node, cluster string, params cke.KubeletParams, ns map[string]*cke.NodeStatus) cke.Operator {
+func KubeletBootOp(nodes, registeredNodes []*cke.Node, apiServer *cke.Node, cluster string, params cke.KubeletParams, featureGates map[string]bool, ns map[string]*cke.NodeStatus) cke.Operator {
 	return &kubeletBootOp{
 		nodes:           nodes,
 		registeredNodes: registeredNodes,
 		apiServer:       apiServer,
 		cluster:         cluster,
 		params:          params,
+		featureGates:    featureGates,
 		nodeStatuses:    ns,
 		files:           common.NewFilesBuilder(nodes),
 	}
@@ -79,7 +82,7 @@ func (o *kubeletBootOp) NextCommand() cke.Commander {
 		return common.MakeDirsCommand(o.nodes, dirs)
 	case 3:
 		o.step++
-		return prepareKubeletFilesCommand{o.cluster, o.params, o.nodeStatuses, o.files}
+		return prepareKubeletFilesCommand{o.cluster, o.params, o.featureGates, o.nodeStatuses, o.files}
 	case 4:
 		o.step++
 		return o.files
@@ -168,6 +171,7 @@ func (c emptyDirCommand) Command() cke.Command {
 type prepareKubeletFilesCommand struct {
 	cluster      string
 	params       cke.KubeletParams
+	featureGates map[string]bool
 	nodeStatuses map[string]*cke.NodeStatus
 	files        *common.FilesBuilder
 }
@@ -192,7 +196,7 @@ func (c prepareKubeletFilesCommand) Run(ctx context.Context, inf cke.Infrastruct
 		if ns != nil {
 			running = ns.Kubelet.Config
 		}
-		cfg := GenerateKubeletConfiguration(c.params, n.Address, running)
+		cfg := GenerateKubeletConfiguration(c.params, c.featureGates, n.Address, running)
 		return encodeToYAML(cfg)
 	}
 	err := c.files.AddFile(ctx, kubeletConfigPath, g)
@@ -214,8 +218,9 @@ func (c prepareKubeletFilesCommand) Run(ctx context.Context, inf cke.Infrastruct
 		return err
 	}
 
+	ttl := c.params.GetCertTTL()
 	f := func(ctx context.Context, n *cke.Node) (cert, key []byte, err error) {
-		c, k, e := cke.KubernetesCA{}.IssueForKubelet(ctx, inf, n)
+		c, k, e := cke.KubernetesCA{}.IssueForKubelet(ctx, inf, n, ttl)
 		if e != nil {
 			return nil, nil, e
 		}
@@ -383,6 +388,10 @@ func KubeletServiceParams(n *cke.Node, params cke.KubeletParams) cke.ServicePara
 	if len(params.CRIEndpoint) != 0 {
 		args = append(args, "--container-runtime-endpoint="+params.CRIEndpoint)
 	}
+	// kubelet chooses an IPv4 address for the Node unless specified.
+	if ip := net.ParseIP(n.Address); ip != nil && ip.To4() == nil {
+		args = append(args, "--node-ip="+n.Address)
+	}
 	return cke.ServiceParams{
 		ExtraArguments: args,
 		ExtraBinds: []cke.Mount{
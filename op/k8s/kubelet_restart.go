@@ -15,6 +15,7 @@ type kubeletRestartOp struct {
 
 	cluster      string
 	params       cke.KubeletParams
+	featureGates map[string]bool
 	nodeStatuses map[string]*cke.NodeStatus
 
 	step  int
@@ -22,11 +23,12 @@ type kubeletRestartOp struct {
 }
 
 // KubeletRestartOp returns an Operator to restart kubelet
-func KubeletRestartOp(nodes []*cke.Node, cluster string, params cke.KubeletParams, ns map[string]*cke.NodeStatus) cke.Operator {
+func KubeletRestartOp(nodes []*cke.Node, cluster string, params cke.KubeletParams, featureGates map[string]bool, ns map[string]*cke.NodeStatus) cke.Operator {
 	return &kubeletRestartOp{
 		nodes:        nodes,
 		cluster:      cluster,
 		params:       params,
+		featureGates: featureGates,
 		nodeStatuses: ns,
 		files:        common.NewFilesBuilder(nodes),
 	}
@@ -43,7 +45,7 @@ func (o *kubeletRestartOp) NextCommand() cke.Commander {
 		return common.ImagePullCommand(o.nodes, cke.KubernetesImage)
 	case 1:
 		o.step++
-		return prepareKubeletConfigCommand{o.cluster, o.params, o.nodeStatuses, o.files}
+		return prepareKubeletConfigCommand{o.cluster, o.params, o.featureGates, o.nodeStatuses, o.files}
 	case 2:
 		o.step++
 		return o.files
@@ -82,6 +84,7 @@ func (o *kubeletRestartOp) Targets() []string {
 type prepareKubeletConfigCommand struct {
 	cluster      string
 	params       cke.KubeletParams
+	featureGates map[string]bool
 	nodeStatuses map[string]*cke.NodeStatus
 	files        *common.FilesBuilder
 }
@@ -93,7 +96,7 @@ func (c prepareKubeletConfigCommand) Run(ctx context.Context, inf cke.Infrastruc
 		if ns != nil {
 			running = ns.Kubelet.Config
 		}
-		cfg := GenerateKubeletConfiguration(c.params, n.Address, running)
+		cfg := GenerateKubeletConfiguration(c.params, c.featureGates, n.Address, running)
 		return encodeToYAML(cfg)
 	}
 	err := c.files.AddFile(ctx, kubeletConfigPath, g)
@@ -101,8 +104,23 @@ func (c prepareKubeletConfigCommand) Run(ctx context.Context, inf cke.Infrastruc
 		return err
 	}
 
+	caPath := op.K8sPKIPath("ca.crt")
+	ca, err := inf.Storage().GetCACertificate(ctx, cke.CAKubernetes)
+	if err != nil {
+		return err
+	}
+	caData := []byte(ca)
+	g = func(ctx context.Context, n *cke.Node) ([]byte, error) {
+		return caData, nil
+	}
+	err = c.files.AddFile(ctx, caPath, g)
+	if err != nil {
+		return err
+	}
+
+	ttl := c.params.GetCertTTL()
 	f := func(ctx context.Context, n *cke.Node) (cert, key []byte, err error) {
-		c, k, e := cke.KubernetesCA{}.IssueForKubelet(ctx, inf, n)
+		c, k, e := cke.KubernetesCA{}.IssueForKubelet(ctx, inf, n, ttl)
 		if e != nil {
 			return nil, nil, e
 		}
@@ -113,7 +131,6 @@ func (c prepareKubeletConfigCommand) Run(ctx context.Context, inf cke.Infrastruc
 		return err
 	}
 
-	caPath := op.K8sPKIPath("ca.crt")
 	tlsCertPath := op.K8sPKIPath("kubelet.crt")
 	tlsKeyPath := op.K8sPKIPath("kubelet.key")
 	g = func(ctx context.Context, n *cke.Node) ([]byte, error) {
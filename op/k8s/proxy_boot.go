@@ -7,25 +7,28 @@ import (
 	"github.com/cybozu-go/cke/op"
 	"github.com/cybozu-go/cke/op/common"
 	"k8s.io/client-go/tools/clientcmd"
+	proxyv1alpha1 "k8s.io/kube-proxy/config/v1alpha1"
 )
 
 type kubeProxyBootOp struct {
 	nodes []*cke.Node
 
-	cluster string
-	params  cke.ProxyParams
+	cluster      string
+	params       cke.ProxyParams
+	featureGates map[string]bool
 
 	step  int
 	files *common.FilesBuilder
 }
 
 // KubeProxyBootOp returns an Operator to boot kube-proxy.
-func KubeProxyBootOp(nodes []*cke.Node, cluster string, params cke.ProxyParams) cke.Operator {
+func KubeProxyBootOp(nodes []*cke.Node, cluster string, params cke.ProxyParams, featureGates map[string]bool) cke.Operator {
 	return &kubeProxyBootOp{
-		nodes:   nodes,
-		cluster: cluster,
-		params:  params,
-		files:   common.NewFilesBuilder(nodes),
+		nodes:        nodes,
+		cluster:      cluster,
+		params:       params,
+		featureGates: featureGates,
+		files:        common.NewFilesBuilder(nodes),
 	}
 }
 
@@ -40,7 +43,7 @@ func (o *kubeProxyBootOp) NextCommand() cke.Commander {
 		return common.ImagePullCommand(o.nodes, cke.KubernetesImage)
 	case 1:
 		o.step++
-		return prepareProxyFilesCommand{o.cluster, o.files}
+		return prepareProxyFilesCommand{o.cluster, o.params, o.featureGates, o.files}
 	case 2:
 		o.step++
 		return o.files
@@ -50,14 +53,9 @@ func (o *kubeProxyBootOp) NextCommand() cke.Commander {
 			"--tmpfs=/run",
 			"--privileged",
 		}
-		paramsMap := make(map[string]cke.ServiceParams)
-		for _, n := range o.nodes {
-			params := ProxyParams(n, string(o.params.GetMode()))
-			paramsMap[n.Address] = params
-		}
 		return common.RunContainerCommand(o.nodes, op.KubeProxyContainerName, cke.KubernetesImage,
 			common.WithOpts(opts),
-			common.WithParamsMap(paramsMap),
+			common.WithParams(ProxyParams()),
 			common.WithExtra(o.params.ServiceParams))
 	default:
 		return nil
@@ -73,12 +71,13 @@ func (o *kubeProxyBootOp) Targets() []string {
 }
 
 type prepareProxyFilesCommand struct {
-	cluster string
-	files   *common.FilesBuilder
+	cluster      string
+	params       cke.ProxyParams
+	featureGates map[string]bool
+	files        *common.FilesBuilder
 }
 
 func (c prepareProxyFilesCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
-	const kubeconfigPath = "/etc/kubernetes/proxy/kubeconfig"
 	storage := inf.Storage()
 
 	ca, err := storage.GetCACertificate(ctx, "kubernetes")
@@ -86,14 +85,22 @@ func (c prepareProxyFilesCommand) Run(ctx context.Context, inf cke.Infrastructur
 		return err
 	}
 	g := func(ctx context.Context, n *cke.Node) ([]byte, error) {
-		crt, key, err := cke.KubernetesCA{}.IssueForProxy(ctx, inf)
+		crt, key, err := cke.KubernetesCA{}.IssueForProxy(ctx, inf, c.params.GetCertTTL())
 		if err != nil {
 			return nil, err
 		}
 		cfg := proxyKubeconfig(c.cluster, ca, crt, key)
 		return clientcmd.Write(*cfg)
 	}
-	return c.files.AddFile(ctx, kubeconfigPath, g)
+	err = c.files.AddFile(ctx, op.ProxyKubeConfigPath, g)
+	if err != nil {
+		return err
+	}
+
+	return c.files.AddFile(ctx, op.ProxyConfigPath, func(ctx context.Context, n *cke.Node) ([]byte, error) {
+		cfg := GenerateProxyConfiguration(c.params, c.featureGates, n)
+		return encodeConfigurationToYAML(cfg, proxyv1alpha1.SchemeGroupVersion.WithKind("KubeProxyConfiguration"))
+	})
 }
 
 func (c prepareProxyFilesCommand) Command() cke.Command {
@@ -103,12 +110,10 @@ func (c prepareProxyFilesCommand) Command() cke.Command {
 }
 
 // ProxyParams returns parameters for kube-proxy.
-func ProxyParams(n *cke.Node, mode string) cke.ServiceParams {
+func ProxyParams() cke.ServiceParams {
 	args := []string{
 		"kube-proxy",
-		"--proxy-mode=" + mode,
-		"--hostname-override=" + n.Nodename(),
-		"--kubeconfig=/etc/kubernetes/proxy/kubeconfig",
+		"--config=" + op.ProxyConfigPath,
 	}
 	return cke.ServiceParams{
 		ExtraArguments: args,
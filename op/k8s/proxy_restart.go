@@ -9,20 +9,22 @@ import (
 type kubeProxyRestartOp struct {
 	nodes []*cke.Node
 
-	cluster string
-	params  cke.ProxyParams
+	cluster      string
+	params       cke.ProxyParams
+	featureGates map[string]bool
 
 	step  int
 	files *common.FilesBuilder
 }
 
 // KubeProxyRestartOp returns an Operator to restart kube-proxy.
-func KubeProxyRestartOp(nodes []*cke.Node, cluster string, params cke.ProxyParams) cke.Operator {
+func KubeProxyRestartOp(nodes []*cke.Node, cluster string, params cke.ProxyParams, featureGates map[string]bool) cke.Operator {
 	return &kubeProxyRestartOp{
-		nodes:   nodes,
-		cluster: cluster,
-		params:  params,
-		files:   common.NewFilesBuilder(nodes),
+		nodes:        nodes,
+		cluster:      cluster,
+		params:       params,
+		featureGates: featureGates,
+		files:        common.NewFilesBuilder(nodes),
 	}
 }
 
@@ -37,7 +39,7 @@ func (o *kubeProxyRestartOp) NextCommand() cke.Commander {
 		return common.ImagePullCommand(o.nodes, cke.KubernetesImage)
 	case 1:
 		o.step++
-		return prepareProxyFilesCommand{o.cluster, o.files}
+		return prepareProxyFilesCommand{o.cluster, o.params, o.featureGates, o.files}
 	case 2:
 		o.step++
 		return o.files
@@ -47,14 +49,9 @@ func (o *kubeProxyRestartOp) NextCommand() cke.Commander {
 			"--tmpfs=/run",
 			"--privileged",
 		}
-		paramsMap := make(map[string]cke.ServiceParams)
-		for _, n := range o.nodes {
-			params := ProxyParams(n, string(o.params.GetMode()))
-			paramsMap[n.Address] = params
-		}
 		return common.RunContainerCommand(o.nodes, op.KubeProxyContainerName, cke.KubernetesImage,
 			common.WithOpts(opts),
-			common.WithParamsMap(paramsMap),
+			common.WithParams(ProxyParams()),
 			common.WithExtra(o.params.ServiceParams),
 			common.WithRestart())
 	default:
@@ -0,0 +1,220 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/log"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type serviceAccountKeyRecordOp struct {
+	rotation *cke.ServiceAccountKeyRotation
+	finished bool
+}
+
+// ServiceAccountKeyRecordOp returns an Operator to record the progress of service account key rotation.
+func ServiceAccountKeyRecordOp(rotation *cke.ServiceAccountKeyRotation) cke.Operator {
+	return &serviceAccountKeyRecordOp{
+		rotation: rotation,
+	}
+}
+
+func (o *serviceAccountKeyRecordOp) Name() string {
+	return "sa-key-record"
+}
+
+func (o *serviceAccountKeyRecordOp) NextCommand() cke.Commander {
+	if o.finished {
+		return nil
+	}
+
+	o.finished = true
+	return recordServiceAccountKeyCommand{o.rotation}
+}
+
+func (o *serviceAccountKeyRecordOp) Targets() []string {
+	return nil
+}
+
+type serviceAccountKeySwitchOp struct {
+	rotation *cke.ServiceAccountKeyRotation
+	step     int
+}
+
+// ServiceAccountKeySwitchOp returns an Operator to replace the key to sign
+// service account tokens with the new key.  The rotation proceeds to the stage
+// to restart controller managers.
+func ServiceAccountKeySwitchOp(rotation *cke.ServiceAccountKeyRotation) cke.Operator {
+	return &serviceAccountKeySwitchOp{
+		rotation: rotation,
+	}
+}
+
+func (o *serviceAccountKeySwitchOp) Name() string {
+	return "sa-key-switch"
+}
+
+func (o *serviceAccountKeySwitchOp) NextCommand() cke.Commander {
+	switch o.step {
+	case 0:
+		o.step++
+		return switchServiceAccountKeyCommand{o.rotation}
+	case 1:
+		o.step++
+		r := o.rotation.WithStage(cke.ServiceAccountKeyStageSwitch)
+		// The new key is stored as the current key.
+		r.NewKey = ""
+		return recordServiceAccountKeyCommand{r}
+	}
+	return nil
+}
+
+func (o *serviceAccountKeySwitchOp) Targets() []string {
+	return nil
+}
+
+type serviceAccountKeyFinishOp struct {
+	finished bool
+}
+
+// ServiceAccountKeyFinishOp returns an Operator to complete service account key rotation.
+func ServiceAccountKeyFinishOp() cke.Operator {
+	return &serviceAccountKeyFinishOp{}
+}
+
+func (o *serviceAccountKeyFinishOp) Name() string {
+	return "sa-key-finish"
+}
+
+func (o *serviceAccountKeyFinishOp) NextCommand() cke.Commander {
+	if o.finished {
+		return nil
+	}
+
+	o.finished = true
+	return finishServiceAccountKeyCommand{}
+}
+
+func (o *serviceAccountKeyFinishOp) Targets() []string {
+	return nil
+}
+
+type serviceAccountTokenRegenerateOp struct {
+	apiserver *cke.Node
+	tokens    []types.NamespacedName
+	finished  bool
+}
+
+// ServiceAccountTokenRegenerateOp returns an Operator to regenerate
+// Secrets of service account tokens signed with the old key.
+func ServiceAccountTokenRegenerateOp(apiserver *cke.Node, tokens []types.NamespacedName) cke.Operator {
+	return &serviceAccountTokenRegenerateOp{
+		apiserver: apiserver,
+		tokens:    tokens,
+	}
+}
+
+func (o *serviceAccountTokenRegenerateOp) Name() string {
+	return "sa-token-regenerate"
+}
+
+func (o *serviceAccountTokenRegenerateOp) NextCommand() cke.Commander {
+	if o.finished {
+		return nil
+	}
+
+	o.finished = true
+	return regenerateServiceAccountTokensCommand{o.apiserver, o.tokens}
+}
+
+func (o *serviceAccountTokenRegenerateOp) Targets() []string {
+	return []string{
+		o.apiserver.Address,
+	}
+}
+
+type recordServiceAccountKeyCommand struct {
+	rotation *cke.ServiceAccountKeyRotation
+}
+
+func (c recordServiceAccountKeyCommand) Run(ctx context.Context, inf cke.Infrastructure, leaderKey string) error {
+	return inf.Storage().UpdateServiceAccountKeyRotation(ctx, leaderKey, c.rotation)
+}
+
+func (c recordServiceAccountKeyCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "record-sa-key-rotation",
+		Target: string(c.rotation.Stage),
+	}
+}
+
+type switchServiceAccountKeyCommand struct {
+	rotation *cke.ServiceAccountKeyRotation
+}
+
+func (c switchServiceAccountKeyCommand) Run(ctx context.Context, inf cke.Infrastructure, leaderKey string) error {
+	return inf.Storage().PutServiceAccountData(ctx, leaderKey, c.rotation.NewCert, c.rotation.NewKey)
+}
+
+func (c switchServiceAccountKeyCommand) Command() cke.Command {
+	return cke.Command{
+		Name: "switch-sa-key",
+	}
+}
+
+type finishServiceAccountKeyCommand struct{}
+
+func (c finishServiceAccountKeyCommand) Run(ctx context.Context, inf cke.Infrastructure, leaderKey string) error {
+	err := inf.Storage().DeleteServiceAccountKeyRotation(ctx, leaderKey)
+	if err != nil {
+		return err
+	}
+
+	log.Info("service account key rotation completed", nil)
+	return nil
+}
+
+func (c finishServiceAccountKeyCommand) Command() cke.Command {
+	return cke.Command{
+		Name: "finish-sa-key-rotation",
+	}
+}
+
+// regenerateServiceAccountTokensCommand removes tokens from Secrets.
+// The token controller of kube-controller-manager fills them again with
+// tokens signed with the new key.
+type regenerateServiceAccountTokensCommand struct {
+	apiserver *cke.Node
+	tokens    []types.NamespacedName
+}
+
+func (c regenerateServiceAccountTokensCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	cs, err := inf.K8sClient(ctx, c.apiserver)
+	if err != nil {
+		return err
+	}
+
+	patch := []byte(`{"data":{"token":null}}`)
+	for _, t := range c.tokens {
+		_, err := cs.CoreV1().Secrets(t.Namespace).Patch(ctx, t.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		if k8serr.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to regenerate token %s: %w", t.String(), err)
+		}
+	}
+	return nil
+}
+
+func (c regenerateServiceAccountTokensCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "regenerate-sa-tokens",
+		Target: strconv.Itoa(len(c.tokens)),
+	}
+}
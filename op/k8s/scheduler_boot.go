@@ -12,20 +12,22 @@ import (
 type schedulerBootOp struct {
 	nodes []*cke.Node
 
-	cluster string
-	params  cke.SchedulerParams
+	cluster      string
+	params       cke.SchedulerParams
+	featureGates map[string]bool
 
 	step  int
 	files *common.FilesBuilder
 }
 
 // SchedulerBootOp returns an Operator to bootstrap kube-scheduler
-func SchedulerBootOp(nodes []*cke.Node, cluster string, params cke.SchedulerParams) cke.Operator {
+func SchedulerBootOp(nodes []*cke.Node, cluster string, params cke.SchedulerParams, featureGates map[string]bool) cke.Operator {
 	return &schedulerBootOp{
-		nodes:   nodes,
-		cluster: cluster,
-		params:  params,
-		files:   common.NewFilesBuilder(nodes),
+		nodes:        nodes,
+		cluster:      cluster,
+		params:       params,
+		featureGates: featureGates,
+		files:        common.NewFilesBuilder(nodes),
 	}
 }
 
@@ -47,7 +49,7 @@ func (o *schedulerBootOp) NextCommand() cke.Commander {
 	case 3:
 		o.step++
 		return common.RunContainerCommand(o.nodes, op.KubeSchedulerContainerName, cke.KubernetesImage,
-			common.WithParams(SchedulerParams()),
+			common.WithParams(SchedulerParams(o.featureGates)),
 			common.WithExtra(o.params.ServiceParams))
 	default:
 		return nil
@@ -76,7 +78,7 @@ func (c prepareSchedulerFilesCommand) Run(ctx context.Context, inf cke.Infrastru
 		return err
 	}
 	g := func(ctx context.Context, n *cke.Node) ([]byte, error) {
-		crt, key, err := cke.KubernetesCA{}.IssueForScheduler(ctx, inf)
+		crt, key, err := cke.KubernetesCA{}.IssueForScheduler(ctx, inf, c.params.GetCertTTL())
 		if err != nil {
 			return nil, err
 		}
@@ -101,7 +103,7 @@ func (c prepareSchedulerFilesCommand) Command() cke.Command {
 }
 
 // SchedulerParams returns parameters for kube-scheduler.
-func SchedulerParams() cke.ServiceParams {
+func SchedulerParams(featureGates map[string]bool) cke.ServiceParams {
 	args := []string{
 		"kube-scheduler",
 		"--config=" + op.SchedulerConfigPath,
@@ -110,6 +112,7 @@ func SchedulerParams() cke.ServiceParams {
 		"--tls-private-key-file=" + op.K8sPKIPath("apiserver.key"),
 		"--port=0",
 	}
+	args = append(args, featureGatesArgs(featureGates)...)
 	return cke.ServiceParams{
 		ExtraArguments: args,
 		ExtraBinds: []cke.Mount{
@@ -0,0 +1,106 @@
+package op
+
+import (
+	"context"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/log"
+)
+
+type k8sUpgradeRecordOp struct {
+	upgrade  *cke.KubernetesUpgrade
+	finished bool
+}
+
+// KubernetesUpgradeRecordOp returns an Operator to record the progress of Kubernetes upgrade.
+func KubernetesUpgradeRecordOp(upgrade *cke.KubernetesUpgrade) cke.Operator {
+	return &k8sUpgradeRecordOp{
+		upgrade: upgrade,
+	}
+}
+
+func (o *k8sUpgradeRecordOp) Name() string {
+	return "k8s-upgrade-record"
+}
+
+func (o *k8sUpgradeRecordOp) NextCommand() cke.Commander {
+	if o.finished {
+		return nil
+	}
+
+	o.finished = true
+	return recordK8sUpgradeCommand{o.upgrade}
+}
+
+func (o *k8sUpgradeRecordOp) Targets() []string {
+	return nil
+}
+
+type recordK8sUpgradeCommand struct {
+	upgrade *cke.KubernetesUpgrade
+}
+
+func (c recordK8sUpgradeCommand) Run(ctx context.Context, inf cke.Infrastructure, leaderKey string) error {
+	err := inf.Storage().PutKubernetesUpgrade(ctx, leaderKey, c.upgrade)
+	if err != nil {
+		return err
+	}
+
+	log.Info("kubernetes upgrade progressed", map[string]interface{}{
+		"from":  c.upgrade.From,
+		"to":    c.upgrade.To,
+		"stage": c.upgrade.Stage,
+	})
+	return nil
+}
+
+func (c recordK8sUpgradeCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "record-k8s-upgrade",
+		Target: string(c.upgrade.Stage),
+	}
+}
+
+type k8sUpgradeFinishOp struct {
+	finished bool
+}
+
+// KubernetesUpgradeFinishOp returns an Operator to clear the progress of completed Kubernetes upgrade.
+func KubernetesUpgradeFinishOp() cke.Operator {
+	return &k8sUpgradeFinishOp{}
+}
+
+func (o *k8sUpgradeFinishOp) Name() string {
+	return "k8s-upgrade-finish"
+}
+
+func (o *k8sUpgradeFinishOp) NextCommand() cke.Commander {
+	if o.finished {
+		return nil
+	}
+
+	o.finished = true
+	return finishK8sUpgradeCommand{}
+}
+
+func (o *k8sUpgradeFinishOp) Targets() []string {
+	return nil
+}
+
+type finishK8sUpgradeCommand struct{}
+
+func (c finishK8sUpgradeCommand) Run(ctx context.Context, inf cke.Infrastructure, leaderKey string) error {
+	err := inf.Storage().DeleteKubernetesUpgrade(ctx, leaderKey)
+	if err != nil {
+		return err
+	}
+
+	log.Info("kubernetes upgrade completed", nil)
+	return nil
+}
+
+func (c finishK8sUpgradeCommand) Command() cke.Command {
+	return cke.Command{
+		Name: "finish-k8s-upgrade",
+	}
+}
@@ -14,16 +14,18 @@ type createConfigMapOp struct {
 	clusterIP  string
 	domain     string
 	dnsServers []string
+	ipv6       bool
 	finished   bool
 }
 
 // CreateConfigMapOp returns an Operator to create ConfigMap for unbound daemonset.
-func CreateConfigMapOp(apiserver *cke.Node, clusterIP, domain string, dnsServers []string) cke.Operator {
+func CreateConfigMapOp(apiserver *cke.Node, clusterIP, domain string, dnsServers []string, ipv6 bool) cke.Operator {
 	return &createConfigMapOp{
 		apiserver:  apiserver,
 		clusterIP:  clusterIP,
 		domain:     domain,
 		dnsServers: dnsServers,
+		ipv6:       ipv6,
 	}
 }
 
@@ -36,7 +38,7 @@ func (o *createConfigMapOp) NextCommand() cke.Commander {
 		return nil
 	}
 	o.finished = true
-	return createConfigMapCommand{o.apiserver, o.clusterIP, o.domain, o.dnsServers}
+	return createConfigMapCommand{o.apiserver, o.clusterIP, o.domain, o.dnsServers, o.ipv6}
 }
 
 func (o *createConfigMapOp) Targets() []string {
@@ -50,6 +52,7 @@ type createConfigMapCommand struct {
 	clusterIP  string
 	domain     string
 	dnsServers []string
+	ipv6       bool
 }
 
 func (c createConfigMapCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
@@ -64,7 +67,7 @@ func (c createConfigMapCommand) Run(ctx context.Context, inf cke.Infrastructure,
 	switch {
 	case err == nil:
 	case errors.IsNotFound(err):
-		configMap := ConfigMap(c.clusterIP, c.domain, c.dnsServers)
+		configMap := ConfigMap(c.clusterIP, c.domain, c.dnsServers, c.ipv6)
 		_, err = configs.Create(ctx, configMap, metav1.CreateOptions{})
 		if err != nil {
 			return err
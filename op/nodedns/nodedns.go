@@ -13,14 +13,21 @@ type unboundConfigTemplate struct {
 	Domain    string
 	ClusterIP string
 	Upstreams []string
+	IPv6      bool
 }
 
 const unboundConfigTemplateText = `
 server:
   do-daemonize: no
   interface: 0.0.0.0
+{{- if .IPv6 }}
+  interface: ::0
+{{- end }}
   interface-automatic: yes
   access-control: 0.0.0.0/0 allow
+{{- if .IPv6 }}
+  access-control: ::0/0 allow
+{{- end }}
   chroot: ""
   username: ""
   directory: "/etc/unbound"
@@ -54,6 +61,9 @@ server:
   local-zone: "29.172.in-addr.arpa." transparent
   local-zone: "30.172.in-addr.arpa." transparent
   local-zone: "31.172.in-addr.arpa." transparent
+{{- if .IPv6 }}
+  local-zone: "d.f.ip6.arpa." transparent
+{{- end }}
 remote-control:
   control-enable: yes
   control-interface: 127.0.0.1
@@ -76,12 +86,15 @@ forward-zone:
 {{- end }}
 `
 
-// ConfigMap returns ConfigMap for unbound daemonset
-func ConfigMap(clusterIP, domain string, dnsServers []string) *corev1.ConfigMap {
+// ConfigMap returns ConfigMap for unbound daemonset.
+// If ipv6 is true, unbound listens on IPv6 addresses and resolves
+// reverse zones of IPv6 unique local addresses.
+func ConfigMap(clusterIP, domain string, dnsServers []string, ipv6 bool) *corev1.ConfigMap {
 	var confTempl unboundConfigTemplate
 	confTempl.Domain = domain
 	confTempl.ClusterIP = clusterIP
 	confTempl.Upstreams = dnsServers
+	confTempl.IPv6 = ipv6
 
 	tmpl := template.Must(template.New("").Parse(unboundConfigTemplateText))
 	unboundConf := new(bytes.Buffer)
@@ -69,3 +69,61 @@ func (o *resourceApplyOp) Command() cke.Command {
 		Target: o.resource.String(),
 	}
 }
+
+type resourceDeleteOp struct {
+	apiserver *cke.Node
+	resource  cke.ResourceDefinition
+
+	finished bool
+}
+
+// ResourceDeleteOp deletes a Kubernetes object.
+func ResourceDeleteOp(apiServer *cke.Node, resource cke.ResourceDefinition) cke.Operator {
+	return &resourceDeleteOp{
+		apiserver: apiServer,
+		resource:  resource,
+	}
+}
+
+func (o *resourceDeleteOp) Name() string {
+	return "resource-delete"
+}
+
+func (o *resourceDeleteOp) NextCommand() cke.Commander {
+	if o.finished {
+		return nil
+	}
+	o.finished = true
+	return o
+}
+
+func (o *resourceDeleteOp) Targets() []string {
+	return []string{
+		o.apiserver.Address,
+	}
+}
+
+func (o *resourceDeleteOp) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	cfg, err := inf.K8sConfig(ctx, o.apiserver)
+	if err != nil {
+		return err
+	}
+	dc, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(dc))
+
+	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	return cke.DeleteResource(ctx, dyn, mapper, o.resource.Definition)
+}
+
+func (o *resourceDeleteOp) Command() cke.Command {
+	return cke.Command{
+		Name:   "delete-resource",
+		Target: o.resource.String(),
+	}
+}
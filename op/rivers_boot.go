@@ -2,6 +2,8 @@ package op
 
 import (
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 
 	"github.com/cybozu-go/cke"
@@ -53,7 +55,7 @@ func (o *riversBootOp) NextCommand() cke.Commander {
 func RiversParams(upstreams []*cke.Node, upstreamPort, listenPort int) cke.ServiceParams {
 	var ups []string
 	for _, n := range upstreams {
-		ups = append(ups, fmt.Sprintf("%s:%d", n.Address, upstreamPort))
+		ups = append(ups, net.JoinHostPort(n.Address, strconv.Itoa(upstreamPort)))
 	}
 	args := []string{
 		"rivers",
@@ -1,32 +1,42 @@
 package op
 
 import (
+	"bufio"
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
 	"github.com/coreos/etcd/etcdserver/etcdserverpb"
 	"github.com/cybozu-go/cke"
 	"github.com/cybozu-go/cke/static"
 	"github.com/cybozu-go/log"
+	corev1 "k8s.io/api/core/v1"
 	k8serr "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/restmapper"
+	kubeproxyv1alpha1 "k8s.io/kube-proxy/config/v1alpha1"
 	schedulerv1beta1 "k8s.io/kube-scheduler/config/v1beta1"
 	kubeletv1beta1 "k8s.io/kubelet/config/v1beta1"
+	sigsyaml "sigs.k8s.io/yaml"
 )
 
 var decUnstructured = yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
@@ -45,6 +55,7 @@ func GetNodeStatus(ctx context.Context, inf cke.Infrastructure, node *cke.Node,
 		EtcdContainerName,
 		RiversContainerName,
 		EtcdRiversContainerName,
+		KMSPluginContainerName,
 		KubeAPIServerContainerName,
 		KubeControllerManagerContainerName,
 		KubeSchedulerContainerName,
@@ -69,12 +80,19 @@ func GetNodeStatus(ctx context.Context, inf cke.Infrastructure, node *cke.Node,
 		ServiceStatus: ss[EtcdContainerName],
 		HasData:       etcdVolumeExists && isAddedmember,
 	}
+	if status.Etcd.Running {
+		status.Etcd.CertExpiry = getCertExpiry(agent, node, EtcdPKIPath("server.crt"), false)
+		status.Etcd.PeerCertExpiry = getCertExpiry(agent, node, EtcdPKIPath("peer.crt"), false)
+	}
 	status.Rivers = ss[RiversContainerName]
 	status.EtcdRivers = ss[EtcdRiversContainerName]
+	status.KMSPlugin = ss[KMSPluginContainerName]
 
-	status.APIServer = cke.KubeComponentStatus{
-		ServiceStatus: ss[KubeAPIServerContainerName],
-		IsHealthy:     false,
+	status.APIServer = cke.APIServerStatus{
+		KubeComponentStatus: cke.KubeComponentStatus{
+			ServiceStatus: ss[KubeAPIServerContainerName],
+			IsHealthy:     false,
+		},
 	}
 	if status.APIServer.Running {
 		status.APIServer.IsHealthy, err = checkAPIServerHealth(ctx, inf, node)
@@ -84,6 +102,8 @@ func GetNodeStatus(ctx context.Context, inf cke.Infrastructure, node *cke.Node,
 				"node":      node.Address,
 			})
 		}
+		status.APIServer.CertExpiry = getCertExpiry(agent, node, K8sPKIPath("apiserver.crt"), false)
+		status.APIServer.EtcdClientCertExpiry = getCertExpiry(agent, node, K8sPKIPath("apiserver-etcd-client.crt"), false)
 	}
 
 	status.ControllerManager = cke.KubeComponentStatus{
@@ -98,6 +118,7 @@ func GetNodeStatus(ctx context.Context, inf cke.Infrastructure, node *cke.Node,
 				"node":      node.Address,
 			})
 		}
+		status.ControllerManager.CertExpiry = getCertExpiry(agent, node, ControllerManagerKubeConfigPath, true)
 	}
 
 	status.Scheduler = cke.SchedulerStatus{
@@ -131,15 +152,31 @@ func GetNodeStatus(ctx context.Context, inf cke.Infrastructure, node *cke.Node,
 			}
 			status.Scheduler.Config = config
 		}
+		status.Scheduler.CertExpiry = getCertExpiry(agent, node, SchedulerKubeConfigPath, true)
 	}
 
 	// TODO: due to the following bug, health status cannot be checked for proxy.
 	// https://github.com/kubernetes/kubernetes/issues/65118
-	status.Proxy = cke.KubeComponentStatus{
+	status.Proxy = cke.ProxyStatus{
 		ServiceStatus: ss[KubeProxyContainerName],
 		IsHealthy:     false,
 	}
 	status.Proxy.IsHealthy = status.Proxy.Running
+	if status.Proxy.Running {
+		cfgData, _, err := agent.Run(fmt.Sprintf("cat %s", ProxyConfigPath))
+		if err == nil {
+			var v kubeproxyv1alpha1.KubeProxyConfiguration
+			_, _, err = decUnstructured.Decode(cfgData, nil, &v)
+			if err == nil {
+				// Nullify TypeMeta for later comparison using reflect.DeepEqual
+				if v.APIVersion == kubeproxyv1alpha1.SchemeGroupVersion.String() {
+					v.TypeMeta = metav1.TypeMeta{}
+				}
+				status.Proxy.Config = &v
+			}
+		}
+		status.Proxy.CertExpiry = getCertExpiry(agent, node, ProxyKubeConfigPath, true)
+	}
 
 	status.Kubelet = cke.KubeletStatus{
 		ServiceStatus: ss[KubeletContainerName],
@@ -166,19 +203,89 @@ func GetNodeStatus(ctx context.Context, inf cke.Infrastructure, node *cke.Node,
 				status.Kubelet.Config = &v
 			}
 		}
+		status.Kubelet.CertExpiry = getCertExpiry(agent, node, K8sPKIPath("kubelet.crt"), false)
 	}
 
 	return status, nil
 }
 
+// getCertExpiry returns the expiry date of the certificate in a PEM file or
+// the client certificate in a kubeconfig file.
+// It returns zero time if the expiry cannot be determined.
+func getCertExpiry(agent cke.Agent, node *cke.Node, path string, isKubeconfig bool) time.Time {
+	data, _, err := agent.Run("cat " + path)
+	if err == nil {
+		if isKubeconfig {
+			data, err = kubeconfigClientCertificate(data)
+		}
+	}
+	var expiry time.Time
+	if err == nil {
+		expiry, err = cke.CertificateExpiry(data)
+	}
+	if err != nil {
+		// This runs in every status loop, so log the failure only at debug level.
+		// Zero expiry means unknown and never triggers renewal.
+		log.Debug("failed to get certificate expiry", map[string]interface{}{
+			log.FnError: err,
+			"node":      node.Address,
+			"path":      path,
+		})
+		return time.Time{}
+	}
+	return expiry
+}
+
+// secretCertExpiry returns the expiry date of the TLS certificate in a Secret.
+// It returns zero time if the expiry cannot be determined.
+func secretCertExpiry(obj *unstructured.Unstructured) time.Time {
+	data, _, err := unstructured.NestedString(obj.Object, "data", corev1.TLSCertKey)
+	if err != nil {
+		return time.Time{}
+	}
+	crt, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return time.Time{}
+	}
+	expiry, err := cke.CertificateExpiry(crt)
+	if err != nil {
+		log.Debug("failed to get certificate expiry", map[string]interface{}{
+			log.FnError: err,
+			"namespace": obj.GetNamespace(),
+			"name":      obj.GetName(),
+		})
+		return time.Time{}
+	}
+	return expiry
+}
+
+// kubeconfigClientCertificate returns the PEM-encoded client certificate
+// of the first user in a kubeconfig.
+func kubeconfigClientCertificate(data []byte) ([]byte, error) {
+	var cfg struct {
+		Users []struct {
+			User struct {
+				ClientCertificateData []byte `json:"client-certificate-data"`
+			} `json:"user"`
+		} `json:"users"`
+	}
+	if err := sigsyaml.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Users) == 0 || len(cfg.Users[0].User.ClientCertificateData) == 0 {
+		return nil, errors.New("no client certificate in kubeconfig")
+	}
+	return cfg.Users[0].User.ClientCertificateData, nil
+}
+
 // GetEtcdClusterStatus returns EtcdClusterStatus
 func GetEtcdClusterStatus(ctx context.Context, inf cke.Infrastructure, nodes []*cke.Node) (cke.EtcdClusterStatus, error) {
 	clusterStatus := cke.EtcdClusterStatus{}
 
 	var endpoints []string
 	for _, n := range nodes {
-		if n.ControlPlane {
-			endpoints = append(endpoints, fmt.Sprintf("https://%s:2379", n.Address))
+		if n.IsEtcdMember() {
+			endpoints = append(endpoints, "https://"+net.JoinHostPort(n.Address, "2379"))
 		}
 	}
 
@@ -193,23 +300,128 @@ func GetEtcdClusterStatus(ctx context.Context, inf cke.Infrastructure, nodes []*
 		return clusterStatus, err
 	}
 
+	learners, err := EtcdLearners(ctx, cli)
+	if err != nil {
+		return clusterStatus, err
+	}
+	clusterStatus.Learners = make(map[string]bool)
+	for name, m := range clusterStatus.Members {
+		if learners[m.ID] {
+			clusterStatus.Learners[name] = true
+		}
+	}
+
+	clusterStatus.Alarms, err = getEtcdAlarms(ctx, cli)
+	if err != nil {
+		return clusterStatus, err
+	}
+
 	ct, cancel := context.WithTimeout(ctx, TimeoutDuration)
 	defer cancel()
 	resp, err := cli.Grant(ct, 10)
+	if err == rpctypes.ErrNoSpace {
+		// The cluster accepts only read and delete requests until the alarm is disarmed.
+		// Members are still checked so that the recovery can tell they respond.
+		gresp, err := cli.Get(ct, "health")
+		if err != nil {
+			return clusterStatus, nil
+		}
+		clusterStatus.InSyncMembers = getEtcdInSyncMembers(ctx, inf, clusterStatus, gresp.Header.Revision)
+		return clusterStatus, nil
+	}
 	if err != nil {
 		return clusterStatus, err
 	}
 
 	clusterStatus.IsHealthy = resp.ID != clientv3.NoLease
+	clusterStatus.InSyncMembers = getEtcdInSyncMembers(ctx, inf, clusterStatus, resp.Revision)
 
-	clusterStatus.InSyncMembers = make(map[string]bool)
+	clusterStatus.DBSize = make(map[string]int64)
+	clusterStatus.DBSizeInUse = make(map[string]int64)
 	for name := range clusterStatus.Members {
-		clusterStatus.InSyncMembers[name] = getEtcdMemberInSync(ctx, inf, name, resp.Revision)
+		size, inUse, err := getEtcdMemberDBSize(ctx, inf, cli, name)
+		if err != nil {
+			log.Warn("failed to get etcd database size", map[string]interface{}{
+				log.FnError: err,
+				"member":    name,
+			})
+			continue
+		}
+		clusterStatus.DBSize[name] = size
+		clusterStatus.DBSizeInUse[name] = inUse
 	}
 
 	return clusterStatus, nil
 }
 
+func getEtcdAlarms(ctx context.Context, cli *clientv3.Client) ([]*etcdserverpb.AlarmMember, error) {
+	ct, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+	resp, err := cli.AlarmList(ct)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Alarms, nil
+}
+
+// etcdDBSizeInUseMetric is the name of the metric for the logical size of the database.
+// etcd 3.3 does not return it in the status API.
+const etcdDBSizeInUseMetric = "etcd_mvcc_db_total_size_in_use_in_bytes"
+
+func getEtcdMemberDBSize(ctx context.Context, inf cke.Infrastructure, cli *clientv3.Client, address string) (int64, int64, error) {
+	endpoint := "https://" + net.JoinHostPort(address, "2379")
+
+	ct, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+	st, err := cli.Status(ct, endpoint)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	client, err := inf.EtcdHTTPSClient(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	req, err := http.NewRequest("GET", endpoint+"/metrics", nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	req = req.WithContext(ct)
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, 0, fmt.Errorf("GET %s/metrics: %s", endpoint, resp.Status)
+	}
+
+	inUse, err := parseEtcdDBSizeInUse(resp.Body)
+	if err != nil {
+		return 0, 0, err
+	}
+	return st.DbSize, inUse, nil
+}
+
+func parseEtcdDBSizeInUse(r io.Reader) (int64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[0] != etcdDBSizeInUseMetric {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return 0, err
+		}
+		return int64(v), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, errors.New(etcdDBSizeInUseMetric + " is not found")
+}
+
 func getEtcdMembers(ctx context.Context, inf cke.Infrastructure, cli *clientv3.Client) (map[string]*etcdserverpb.Member, error) {
 	ct, cancel := context.WithTimeout(ctx, TimeoutDuration)
 	defer cancel()
@@ -249,8 +461,16 @@ func GuessMemberName(m *etcdserverpb.Member) (string, error) {
 	return h, nil
 }
 
-func getEtcdMemberInSync(ctx context.Context, inf cke.Infrastructure, address string, clusterRev int64) bool {
-	endpoints := []string{fmt.Sprintf("https://%s:2379", address)}
+func getEtcdInSyncMembers(ctx context.Context, inf cke.Infrastructure, st cke.EtcdClusterStatus, clusterRev int64) map[string]bool {
+	inSync := make(map[string]bool)
+	for name := range st.Members {
+		inSync[name] = getEtcdMemberInSync(ctx, inf, name, clusterRev, st.Learners[name])
+	}
+	return inSync
+}
+
+func getEtcdMemberInSync(ctx context.Context, inf cke.Infrastructure, address string, clusterRev int64, learner bool) bool {
+	endpoints := []string{"https://" + net.JoinHostPort(address, "2379")}
 	cli, err := inf.NewEtcdClient(ctx, endpoints)
 	if err != nil {
 		return false
@@ -259,7 +479,12 @@ func getEtcdMemberInSync(ctx context.Context, inf cke.Infrastructure, address st
 
 	ct, cancel := context.WithTimeout(ctx, TimeoutDuration)
 	defer cancel()
-	resp, err := cli.Get(ct, "health")
+	var opts []clientv3.OpOption
+	if learner {
+		// learners serve only serializable requests.
+		opts = append(opts, clientv3.WithSerializable())
+	}
+	resp, err := cli.Get(ct, "health", opts...)
 	if err != nil {
 		return false
 	}
@@ -348,7 +573,15 @@ func GetKubernetesClusterStatus(ctx context.Context, inf cke.Infrastructure, n *
 	if err != nil {
 		return cke.KubernetesClusterStatus{}, err
 	}
-	resources = append(resources, static.Resources...)
+	resources = append(resources, static.ResourcesFor(cluster)...)
+
+	// statuses of obsolete resources are needed to remove them.
+	// They may not be served by API server any longer.
+	obsolete := make(map[string]bool)
+	for _, res := range static.ObsoleteResourcesFor(cluster) {
+		obsolete[res.Key] = true
+		resources = append(resources, res)
+	}
 
 	cfg, err := inf.K8sConfig(ctx, n)
 	if err != nil {
@@ -374,6 +607,9 @@ func GetKubernetesClusterStatus(ctx context.Context, inf cke.Infrastructure, n *
 		}
 
 		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if obsolete[res.Key] && meta.IsNoMatchError(err) {
+			continue
+		}
 		if err != nil {
 			return cke.KubernetesClusterStatus{}, fmt.Errorf("failed to find rest mapping for %s: %w", gvk.String(), err)
 		}
@@ -397,11 +633,63 @@ func GetKubernetesClusterStatus(ctx context.Context, inf cke.Infrastructure, n *
 			return cke.KubernetesClusterStatus{}, err
 		}
 		s.SetResourceStatus(res.Key, obj.GetAnnotations(), len(obj.GetManagedFields()) != 0)
+		if obj.GetKind() == cke.KindSecret && obj.GetAnnotations()[cke.AnnotationResourceIssueCert] != "" {
+			rs := s.ResourceStatuses[res.Key]
+			rs.CertExpiry = secretCertExpiry(obj)
+			s.ResourceStatuses[res.Key] = rs
+		}
+	}
+
+	for _, r := range cluster.Options.APIServer.Encryption.GetResources() {
+		_, err := mapper.ResourceFor(schema.ParseGroupResource(r).WithVersion(""))
+		switch {
+		case err == nil:
+		case meta.IsNoMatchError(err):
+			s.UnknownEncryptionResources = append(s.UnknownEncryptionResources, r)
+		default:
+			return cke.KubernetesClusterStatus{}, err
+		}
 	}
 
 	return s, nil
 }
 
+// GetOldServiceAccountTokens returns Secrets of service account tokens signed with the key of oldCert.
+func GetOldServiceAccountTokens(ctx context.Context, inf cke.Infrastructure, n *cke.Node, oldCert string) ([]types.NamespacedName, error) {
+	clientset, err := inf.K8sClient(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err := clientset.CoreV1().Secrets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: "type=" + string(corev1.SecretTypeServiceAccountToken),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []types.NamespacedName
+	for _, s := range secrets.Items {
+		token := s.Data[corev1.ServiceAccountTokenKey]
+		if len(token) == 0 {
+			continue
+		}
+		signed, err := cke.ServiceAccountTokenSignedBy(string(token), oldCert)
+		if err != nil {
+			log.Warn("failed to verify service account token", map[string]interface{}{
+				log.FnError: err,
+				"namespace": s.Namespace,
+				"name":      s.Name,
+			})
+			continue
+		}
+		if signed {
+			tokens = append(tokens, types.NamespacedName{Namespace: s.Namespace, Name: s.Name})
+		}
+	}
+	return tokens, nil
+}
+
 func getClusterDNSStatus(ctx context.Context, inf cke.Infrastructure, n *cke.Node) (cke.ClusterDNSStatus, error) {
 	clientset, err := inf.K8sClient(ctx, n)
 	if err != nil {
@@ -453,7 +741,7 @@ func getNodeDNSStatus(ctx context.Context, inf cke.Infrastructure, n *cke.Node)
 
 // CheckKubeletHealthz checks that Kubelet is healthy
 func CheckKubeletHealthz(ctx context.Context, inf cke.Infrastructure, addr string, port uint16) (bool, error) {
-	healthzURL := "http://" + addr + ":" + strconv.FormatUint(uint64(port), 10) + "/healthz"
+	healthzURL := "http://" + net.JoinHostPort(addr, strconv.FormatUint(uint64(port), 10)) + "/healthz"
 	req, err := http.NewRequest("GET", healthzURL, nil)
 	if err != nil {
 		return false, err
@@ -474,7 +762,7 @@ func CheckKubeletHealthz(ctx context.Context, inf cke.Infrastructure, addr strin
 }
 
 func checkSecureHealthz(ctx context.Context, inf cke.Infrastructure, addr string, port uint16) (bool, error) {
-	healthzURL := "https://" + addr + ":" + strconv.FormatUint(uint64(port), 10) + "/healthz"
+	healthzURL := "https://" + net.JoinHostPort(addr, strconv.FormatUint(uint64(port), 10)) + "/healthz"
 	req, err := http.NewRequest("GET", healthzURL, nil)
 	if err != nil {
 		return false, err
@@ -1,6 +1,9 @@
 package op
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestContainCommandOption(t *testing.T) {
 	type args struct {
@@ -41,3 +44,68 @@ func TestContainCommandOption(t *testing.T) {
 		})
 	}
 }
+
+func TestParseEtcdDBSizeInUse(t *testing.T) {
+	metrics := `# HELP etcd_mvcc_db_total_size_in_bytes Total size of the underlying database physically allocated in bytes.
+# TYPE etcd_mvcc_db_total_size_in_bytes gauge
+etcd_mvcc_db_total_size_in_bytes 1.2288e+07
+# HELP etcd_mvcc_db_total_size_in_use_in_bytes Total size of the underlying database logically in use in bytes.
+# TYPE etcd_mvcc_db_total_size_in_use_in_bytes gauge
+etcd_mvcc_db_total_size_in_use_in_bytes 4.096e+06
+`
+	inUse, err := parseEtcdDBSizeInUse(strings.NewReader(metrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inUse != 4096000 {
+		t.Error("unexpected size:", inUse)
+	}
+
+	_, err = parseEtcdDBSizeInUse(strings.NewReader("etcd_mvcc_db_total_size_in_bytes 1.2288e+07\n"))
+	if err == nil {
+		t.Error("parseEtcdDBSizeInUse should fail without the metric")
+	}
+}
+
+func TestEtcdVersionAtLeast(t *testing.T) {
+	cases := []struct {
+		version string
+		want    bool
+	}{
+		{"3.3.25", false},
+		{"3.4.0", true},
+		{"3.5.4", true},
+		{"4.0.0", true},
+		{"2.9.0", false},
+		{"", false},
+		{"invalid", false},
+	}
+	for _, c := range cases {
+		if got := etcdVersionAtLeast(c.version, 3, 4); got != c.want {
+			t.Errorf("etcdVersionAtLeast(%q, 3, 4) = %v, want %v", c.version, got, c.want)
+		}
+	}
+}
+
+func TestKubeconfigClientCertificate(t *testing.T) {
+	data := []byte(`apiVersion: v1
+kind: Config
+users:
+- name: admin
+  user:
+    client-certificate-data: Zm9v
+    client-key-data: YmFy
+`)
+	crt, err := kubeconfigClientCertificate(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(crt) != "foo" {
+		t.Error("unexpected certificate:", string(crt))
+	}
+
+	_, err = kubeconfigClientCertificate([]byte("apiVersion: v1\nkind: Config\n"))
+	if err == nil {
+		t.Error("kubeconfig without users should be rejected")
+	}
+}
@@ -63,6 +63,30 @@ func EtcdStopOp(nodes []*cke.Node) cke.Operator {
 	}
 }
 
+// KMSPluginStopOp returns an Operator to stop the KMS plugin
+func KMSPluginStopOp(nodes []*cke.Node) cke.Operator {
+	return &containerStopOp{
+		nodes: nodes,
+		name:  KMSPluginContainerName,
+	}
+}
+
+// KubeletStopOp returns an Operator to stop kubelet
+func KubeletStopOp(nodes []*cke.Node) cke.Operator {
+	return &containerStopOp{
+		nodes: nodes,
+		name:  KubeletContainerName,
+	}
+}
+
+// KubeProxyStopOp returns an Operator to stop kube-proxy
+func KubeProxyStopOp(nodes []*cke.Node) cke.Operator {
+	return &containerStopOp{
+		nodes: nodes,
+		name:  KubeProxyContainerName,
+	}
+}
+
 // EtcdRiversStopOp returns an Operator to stop etcd-rivers
 func EtcdRiversStopOp(nodes []*cke.Node) cke.Operator {
 	return &containerStopOp{
@@ -7,20 +7,29 @@ type OperationPhase string
 
 // Processing statuses of CKE server.
 const (
-	PhaseUpgradeAborted  = OperationPhase("upgrade-aborted")
-	PhaseUpgrade         = OperationPhase("upgrade")
-	PhaseRivers          = OperationPhase("rivers")
-	PhaseEtcdBootAborted = OperationPhase("etcd-boot-aborted")
-	PhaseEtcdBoot        = OperationPhase("etcd-boot")
-	PhaseEtcdStart       = OperationPhase("etcd-start")
-	PhaseEtcdWait        = OperationPhase("etcd-wait")
-	PhaseK8sStart        = OperationPhase("k8s-start")
-	PhaseEtcdMaintain    = OperationPhase("etcd-maintain")
-	PhaseK8sMaintain     = OperationPhase("k8s-maintain")
-	PhaseStopCP          = OperationPhase("stop-control-plane")
-	PhaseUncordonNodes   = OperationPhase("uncordon-nodes")
-	PhaseRebootNodes     = OperationPhase("reboot-nodes")
-	PhaseCompleted       = OperationPhase("completed")
+	PhaseUpgradeAborted     = OperationPhase("upgrade-aborted")
+	PhaseUpgrade            = OperationPhase("upgrade")
+	PhaseRivers             = OperationPhase("rivers")
+	PhaseEtcdRestoreAborted = OperationPhase("etcd-restore-aborted")
+	PhaseEtcdRestore        = OperationPhase("etcd-restore")
+	PhaseEtcdBootAborted    = OperationPhase("etcd-boot-aborted")
+	PhaseEtcdBoot           = OperationPhase("etcd-boot")
+	PhaseEtcdStart          = OperationPhase("etcd-start")
+	PhaseEtcdWait           = OperationPhase("etcd-wait")
+	PhaseK8sUpgradeAborted  = OperationPhase("k8s-upgrade-aborted")
+	PhaseK8sUpgrade         = OperationPhase("k8s-upgrade")
+	PhaseK8sStart           = OperationPhase("k8s-start")
+	PhaseEtcdMaintain       = OperationPhase("etcd-maintain")
+	PhaseEncryptionKey      = OperationPhase("encryption-key-rotation")
+	PhaseEncryptionRewrite  = OperationPhase("encryption-rewrite")
+	PhaseCARotation         = OperationPhase("ca-rotation")
+	PhaseServiceAccountKey  = OperationPhase("service-account-key-rotation")
+	PhaseK8sMaintain        = OperationPhase("k8s-maintain")
+	PhaseStopCP             = OperationPhase("stop-control-plane")
+	PhaseUncordonNodes      = OperationPhase("uncordon-nodes")
+	PhaseEtcdBackup         = OperationPhase("etcd-backup")
+	PhaseRebootNodes        = OperationPhase("reboot-nodes")
+	PhaseCompleted          = OperationPhase("completed")
 )
 
 // AllOperationPhases contains all kinds of OperationPhases.
@@ -28,15 +37,24 @@ var AllOperationPhases = []OperationPhase{
 	PhaseUpgradeAborted,
 	PhaseUpgrade,
 	PhaseRivers,
+	PhaseEtcdRestoreAborted,
+	PhaseEtcdRestore,
 	PhaseEtcdBootAborted,
 	PhaseEtcdBoot,
 	PhaseEtcdStart,
 	PhaseEtcdWait,
+	PhaseK8sUpgradeAborted,
+	PhaseK8sUpgrade,
 	PhaseK8sStart,
 	PhaseEtcdMaintain,
+	PhaseEncryptionKey,
+	PhaseEncryptionRewrite,
+	PhaseCARotation,
+	PhaseServiceAccountKey,
 	PhaseK8sMaintain,
 	PhaseStopCP,
 	PhaseUncordonNodes,
+	PhaseEtcdBackup,
 	PhaseRebootNodes,
 	PhaseCompleted,
 }
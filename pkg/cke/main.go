@@ -27,12 +27,12 @@ var (
 	flgDebugSabakan    = pflag.Bool("debug-sabakan", false, "debug sabakan integration")
 )
 
-func loadConfig(p string) (*etcdutil.Config, error) {
+func loadConfig(p string) (*cke.Config, error) {
 	b, err := ioutil.ReadFile(p)
 	if err != nil {
 		return nil, err
 	}
-	cfg := cke.NewEtcdConfig()
+	cfg := cke.NewConfig()
 	err = yaml.Unmarshal(b, cfg)
 	if err != nil {
 		return nil, err
@@ -77,12 +77,22 @@ func main() {
 		log.ErrorExit(err)
 	}
 
-	etcd, err := etcdutil.NewClient(cfg)
+	etcd, err := etcdutil.NewClient(cfg.Config)
 	if err != nil {
 		log.ErrorExit(err)
 	}
 	defer etcd.Close()
 
+	if cfg.SecretBackend.GetType() == cke.SecretBackendLocal {
+		b, err := cke.NewSecretBackend(cfg.SecretBackend, etcd, nil)
+		if err != nil {
+			log.ErrorExit(err)
+		}
+		cke.SetSecretBackend(b)
+	} else if err := cfg.SecretBackend.Validate(); err != nil {
+		log.ErrorExit(err)
+	}
+
 	addon := sabakan.NewIntegrator(etcd)
 	if *flgDebugSabakan {
 		debugSabakan(addon)
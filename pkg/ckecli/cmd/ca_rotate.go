@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
+	vault "github.com/hashicorp/vault/api"
+	"github.com/spf13/cobra"
+)
+
+// caRotateCmd represents the "ca rotate" command
+var caRotateCmd = &cobra.Command{
+	Use:   "rotate NAME",
+	Short: "rotate a CA",
+	Long: `Generate a new CA certificate in Vault and request CKE to rotate the CA.
+
+NAME is one of:
+    server
+    etcd-peer
+    etcd-client
+    kubernetes
+    kubernetes-aggregation
+    kubernetes-webhook
+
+CKE distributes the bundle of the old and new CA certificates, reissues
+certificates from the new CA, and removes the old CA.
+This requires Vault 1.11 or later.
+
+The rotation is recorded before the new CA is generated.  If this command
+is interrupted, run it again with the same NAME to resume.
+
+Certificates issued by ckecli are not reissued and become invalid when
+the old CA is removed.`,
+
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("wrong number of arguments")
+		}
+
+		if caParamsOf(args[0]) == nil {
+			return errors.New("wrong CA name: " + args[0])
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vc, err := inf.Vault()
+		if err != nil {
+			return err
+		}
+
+		if msg := caRotationWarning(args[0]); msg != "" {
+			fmt.Fprintln(os.Stderr, "warning:", msg)
+		}
+
+		well.Go(func(ctx context.Context) error {
+			return rotateCA(ctx, vc, *caParamsOf(args[0]))
+		})
+		well.Stop()
+		err = well.Wait()
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("succeeded")
+		return nil
+	},
+}
+
+func init() {
+	caCmd.AddCommand(caRotateCmd)
+}
+
+func caParamsOf(name string) *caParams {
+	for _, ca := range cas {
+		if ca.key == name {
+			ca := ca
+			return &ca
+		}
+	}
+	return nil
+}
+
+// caRotationWarning returns a message about certificates issued by ckecli
+// that become invalid when the old CA is removed.
+func caRotationWarning(name string) string {
+	switch name {
+	case cke.CAEtcdClient:
+		return "certificates issued by \"ckecli etcd issue\" and \"ckecli etcd root-issue\" become invalid when the old CA is dropped"
+	case cke.CAKubernetes:
+		return "certificates issued by \"ckecli kubernetes issue\" become invalid when the old CA is dropped"
+	}
+	return ""
+}
+
+func rotateCA(ctx context.Context, vc *vault.Client, ca caParams) error {
+	r, err := storage.GetCARotation(ctx)
+	switch err {
+	case nil:
+		if r.CA != ca.key || r.Stage != cke.CARotationStagePrepare {
+			return cke.ErrRotationInProgress
+		}
+	case cke.ErrNotFound:
+		r, err = startCARotation(ctx, vc, ca)
+		if err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	newCert, newIssuer, err := generateIssuer(vc, ca, r.NewIssuer)
+	if err != nil {
+		return err
+	}
+
+	next := *r
+	next.Stage = cke.CARotationStageBundle
+	next.NewCert = newCert
+	next.NewIssuer = newIssuer
+	return storage.ProceedCARotation(ctx, r, &next)
+}
+
+// startCARotation claims the rotation in etcd before generating the new CA in Vault.
+func startCARotation(ctx context.Context, vc *vault.Client, ca caParams) (*cke.CARotation, error) {
+	oldCert, err := storage.GetCACertificate(ctx, ca.key)
+	if err != nil {
+		return nil, err
+	}
+	oldIssuer, err := cke.DefaultIssuer(vc, ca.key)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	r := &cke.CARotation{
+		CA:        ca.key,
+		Stage:     cke.CARotationStagePrepare,
+		OldCert:   oldCert,
+		OldIssuer: oldIssuer,
+		NewIssuer: ca.key + "-" + now.Format("20060102150405"),
+		StartedAt: now,
+	}
+	err = storage.StartCARotation(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// generateIssuer generates a new CA as the issuer named name.
+// If the issuer already exists, this returns it.
+func generateIssuer(vc *vault.Client, ca caParams, name string) (cert, id string, err error) {
+	pki := cke.VaultPKIKey(ca.key)
+	secret, err := vc.Logical().Read(path.Join(pki, "issuer", name))
+	if err != nil {
+		return "", "", err
+	}
+	if secret == nil {
+		secret, err = vc.Logical().Write(path.Join(pki, "root/rotate/internal"), map[string]interface{}{
+			"common_name": ca.commonName,
+			"ttl":         ttl100Year,
+			"format":      "pem",
+			"issuer_name": name,
+		})
+		if err != nil {
+			return "", "", err
+		}
+	}
+	if secret == nil {
+		return "", "", errors.New("failed to generate new CA: " + ca.key)
+	}
+	cert, ok := secret.Data["certificate"].(string)
+	if !ok {
+		return "", "", fmt.Errorf("failed to generate new CA: %#v", secret.Warnings)
+	}
+	id, ok = secret.Data["issuer_id"].(string)
+	if !ok {
+		return "", "", fmt.Errorf("no issuer ID for the new CA: %#v", secret.Warnings)
+	}
+	return cert, id, nil
+}
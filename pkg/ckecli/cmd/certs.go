@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var certsCmd = &cobra.Command{
+	Use:   "certs",
+	Short: "certs subcommand",
+	Long:  `certs subcommand`,
+}
+
+func init() {
+	rootCmd.AddCommand(certsCmd)
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+var certsIssuedCmd = &cobra.Command{
+	Use:   "issued",
+	Short: "list client certificates issued for users",
+	Long: `List client certificates issued for users by ckecli.
+
+The output is a list of IssuedCertificate formatted in JSON.
+Entries are sorted by the serial number.  Expired certificates are
+removed from the list periodically by CKE.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			certs, err := storage.GetIssuedCertificates(ctx)
+			if err != nil {
+				return err
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "    ")
+			return enc.Encode(certs)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	certsCmd.AddCommand(certsIssuedCmd)
+}
+
+// recordIssuedCertificate records a client certificate issued for a user.
+func recordIssuedCertificate(ctx context.Context, kind, userName string, groups []string, ttl, credentialID, cert string) (*cke.IssuedCertificate, error) {
+	c, err := cke.NewIssuedCertificate(kind, userName, groups, ttl, credentialID, cert)
+	if err != nil {
+		return nil, err
+	}
+	err = storage.PutIssuedCertificate(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+var certsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list certificates issued by CKE",
+	Long: `List certificates issued by CKE and their expiry dates.
+
+The output is a list of CertificateStatus formatted in JSON.
+Entries are sorted from the earliest expiry to the latest.
+
+The list is updated by the CKE leader only when it changes, so it may be
+absent before the leader completes its first loop.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			certs, err := storage.GetCertificateStatuses(ctx)
+			if err == cke.ErrNotFound {
+				return errors.New("no certificate inventory")
+			}
+			if err != nil {
+				return err
+			}
+
+			if certs == nil {
+				certs = []cke.CertificateStatus{}
+			}
+			sort.SliceStable(certs, func(i, j int) bool {
+				return certs[i].Expiry.Before(certs[j].Expiry)
+			})
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "    ")
+			return enc.Encode(certs)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	certsCmd.AddCommand(certsListCmd)
+}
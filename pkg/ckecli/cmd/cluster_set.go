@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
+	"os"
 
 	"github.com/cybozu-go/cke"
 	"github.com/cybozu-go/well"
@@ -34,6 +36,13 @@ The file must be either YAML or JSON.`,
 		if err != nil {
 			return err
 		}
+		err = cke.ValidateSecretBackend(inf.Secrets(), cfg)
+		if err != nil {
+			return err
+		}
+		for _, msg := range cfg.FeatureGateConflicts() {
+			fmt.Fprintln(os.Stderr, "warning:", msg)
+		}
 
 		well.Go(func(ctx context.Context) error {
 			constraints, err := storage.GetConstraints(ctx)
@@ -50,6 +59,18 @@ The file must be either YAML or JSON.`,
 				return err
 			}
 
+			vaultCfg, err := storage.GetVaultConfig(ctx)
+			switch err {
+			case nil:
+				err = vaultCfg.ValidateForCluster(cfg)
+				if err != nil {
+					return err
+				}
+			case cke.ErrNotFound:
+			default:
+				return err
+			}
+
 			return storage.PutCluster(ctx, cfg)
 		})
 		well.Stop()
@@ -20,8 +20,10 @@ var constraintsSetCmd = &cobra.Command{
 
 NAME is one of:
     control-plane-count
+    etcd-count
     minimum-workers
     maximum-workers
+    node-upgrade-batch-size
 
 VALUE is an integer.`,
 
@@ -40,6 +42,10 @@ VALUE is an integer.`,
 			cstrSet = func(cstr *cke.Constraints) {
 				cstr.ControlPlaneCount = val
 			}
+		case "etcd-count":
+			cstrSet = func(cstr *cke.Constraints) {
+				cstr.EtcdCount = val
+			}
 		case "minimum-workers":
 			cstrSet = func(cstr *cke.Constraints) {
 				cstr.MinimumWorkers = val
@@ -48,6 +54,10 @@ VALUE is an integer.`,
 			cstrSet = func(cstr *cke.Constraints) {
 				cstr.MaximumWorkers = val
 			}
+		case "node-upgrade-batch-size":
+			cstrSet = func(cstr *cke.Constraints) {
+				cstr.NodeUpgradeBatchSize = val
+			}
 		default:
 			return errors.New("no such constraint: " + args[0])
 		}
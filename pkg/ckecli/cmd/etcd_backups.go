@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var etcdBackupsCmd = &cobra.Command{
+	Use:   "backups",
+	Short: "backups subcommand",
+	Long:  `backups subcommand`,
+}
+
+func init() {
+	etcdCmd.AddCommand(etcdBackupsCmd)
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+var etcdBackupsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list etcd backups taken by CKE",
+	Long: `List etcd backups taken by CKE.
+
+The output is a list of EtcdBackupEntry formatted in JSON.
+Entries are sorted from the oldest to the newest.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			entries, err := storage.GetEtcdBackupEntries(ctx)
+			if err != nil {
+				return err
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "    ")
+			return enc.Encode(entries)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	etcdBackupsCmd.AddCommand(etcdBackupsListCmd)
+}
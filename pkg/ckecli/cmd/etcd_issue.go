@@ -43,7 +43,11 @@ NAME is the username of etcd user to be authenticated.`,
 		}
 
 		well.Go(func(ctx context.Context) error {
-			cert, key, err := cke.IssueEtcdClientCertificate(inf, username, etcdIssueOpts.TTL)
+			cert, key, err := cke.IssueEtcdClientCertificate(ctx, inf, username, etcdIssueOpts.TTL)
+			if err != nil {
+				return err
+			}
+			_, err = recordIssuedCertificate(ctx, cke.IssuedCertEtcd, username, nil, etcdIssueOpts.TTL, "", cert)
 			if err != nil {
 				return err
 			}
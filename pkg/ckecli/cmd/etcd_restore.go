@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+var etcdRestoreOpts struct {
+	target string
+	force  bool
+}
+
+var etcdRestoreCmd = &cobra.Command{
+	Use:   "restore SNAPSHOT",
+	Short: "restore CKE-managed etcd from a backup",
+	Long: `Restore CKE-managed etcd from a backup.
+
+SNAPSHOT is the name of a backup such as etcd-YYYYMMDD-hhmmss.backup
+stored in the targets of etcd_backup in the cluster configuration.
+Use "ckecli etcd backups list" to list them.
+
+This command only marks the cluster for restore.  The leader of CKE
+then stops kube-apiserver, restores all etcd members from SNAPSHOT,
+and restarts etcd and the control plane.
+
+All data written to etcd after SNAPSHOT was taken will be lost.
+
+If a restore is already requested, this command fails unless --force
+is given.  --force replaces the request in progress.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if _, err := cke.ParseEtcdBackupName(name); err != nil {
+			return err
+		}
+
+		well.Go(func(ctx context.Context) error {
+			cluster, err := storage.GetCluster(ctx)
+			if err != nil {
+				return err
+			}
+			if len(cluster.EtcdBackup.Targets) == 0 {
+				return errors.New("no etcd backup targets are configured")
+			}
+			if len(etcdRestoreOpts.target) > 0 {
+				found := false
+				for _, t := range cluster.EtcdBackup.Targets {
+					if t.Name == etcdRestoreOpts.target {
+						found = true
+						break
+					}
+				}
+				if !found {
+					return errors.New("no such etcd backup target: " + etcdRestoreOpts.target)
+				}
+			}
+
+			err = storage.PutEtcdRestoreRequest(ctx, &cke.EtcdRestoreRequest{
+				Snapshot:    name,
+				Target:      etcdRestoreOpts.target,
+				RequestedAt: time.Now().UTC(),
+			}, etcdRestoreOpts.force)
+			if err == cke.ErrRestoreInProgress {
+				return errors.New("another restore is requested; use --force to replace it")
+			}
+			return err
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	etcdRestoreCmd.Flags().StringVar(&etcdRestoreOpts.target, "target", "", "the name of the backup target to read SNAPSHOT from")
+	etcdRestoreCmd.Flags().BoolVar(&etcdRestoreOpts.force, "force", false, "replace the restore request in progress")
+	etcdCmd.AddCommand(etcdRestoreCmd)
+}
@@ -38,6 +38,10 @@ var etcdRootIssueCmd = &cobra.Command{
 			if err != nil {
 				return err
 			}
+			_, err = recordIssuedCertificate(ctx, cke.IssuedCertEtcd, "root", nil, "1h", "", cert)
+			if err != nil {
+				return err
+			}
 
 			cacert, err := storage.GetCACertificate(ctx, cke.CAServer)
 			if err != nil {
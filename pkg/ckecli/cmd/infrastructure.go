@@ -3,7 +3,7 @@ package cmd
 import (
 	"context"
 	"errors"
-	"fmt"
+	"net"
 	"net/http"
 	"time"
 
@@ -22,8 +22,9 @@ var httpClient = &well.HTTPClient{
 
 // cliInfrastructure implements cke.Infrastructure for CLI usage.
 type cliInfrastructure struct {
-	vc   *vault.Client
-	etcd *clientv3.Client
+	vc      *vault.Client
+	secrets cke.SecretBackend
+	etcd    *clientv3.Client
 }
 
 func (i *cliInfrastructure) Close() {
@@ -40,6 +41,9 @@ func (i *cliInfrastructure) Vault() (*vault.Client, error) {
 	if i.vc != nil {
 		return i.vc, nil
 	}
+	if cke.IsLocalSecretBackend(i.secrets) {
+		return nil, cke.ErrLocalSecretBackend
+	}
 
 	cfg, err := storage.GetVaultConfig(context.Background())
 	if err != nil {
@@ -55,6 +59,10 @@ func (i *cliInfrastructure) Vault() (*vault.Client, error) {
 	return vc, nil
 }
 
+func (i *cliInfrastructure) Secrets() cke.SecretBackend {
+	return i.secrets
+}
+
 // The second argument is not used.
 func (i *cliInfrastructure) NewEtcdClient(ctx context.Context, _ []string) (*clientv3.Client, error) {
 	if i.etcd != nil {
@@ -68,12 +76,12 @@ func (i *cliInfrastructure) NewEtcdClient(ctx context.Context, _ []string) (*cli
 
 	endpoints := []string{}
 	for _, n := range cluster.Nodes {
-		if n.ControlPlane {
-			endpoints = append(endpoints, fmt.Sprintf("https://%s:2379", n.Address))
+		if n.IsEtcdMember() {
+			endpoints = append(endpoints, "https://"+net.JoinHostPort(n.Address, "2379"))
 		}
 	}
 	if len(endpoints) == 0 {
-		return nil, errors.New("no control plane")
+		return nil, errors.New("no etcd nodes")
 	}
 
 	serverCA, err := storage.GetCACertificate(ctx, cke.CAServer)
@@ -101,12 +109,16 @@ func (i *cliInfrastructure) NewEtcdClient(ctx context.Context, _ []string) (*cli
 	return etcd, nil
 }
 
+func (i *cliInfrastructure) EtcdHTTPSClient(ctx context.Context) (*well.HTTPClient, error) {
+	panic("not implemented")
+}
+
 func (i *cliInfrastructure) K8sConfig(ctx context.Context, n *cke.Node) (*rest.Config, error) {
 	panic("not implemented")
 }
 
 func (i *cliInfrastructure) K8sClient(ctx context.Context, n *cke.Node) (*kubernetes.Clientset, error) {
-	c, k, err := cke.KubernetesCA{}.IssueUserCert(ctx, i, cke.RoleAdmin, cke.AdminGroup, "1h")
+	c, k, err := cke.KubernetesCA{}.IssueUserCert(ctx, i, cke.RoleAdmin, []string{cke.AdminGroup}, "", "1h")
 	if err != nil {
 		return nil, err
 	}
@@ -120,7 +132,7 @@ func (i *cliInfrastructure) K8sClient(ctx context.Context, n *cke.Node) (*kubern
 		CAData:   []byte(ca),
 	}
 	cfg := &rest.Config{
-		Host:            "https://" + n.Address + ":6443",
+		Host:            "https://" + net.JoinHostPort(n.Address, "6443"),
 		TLSClientConfig: tlsCfg,
 		Timeout:         5 * time.Second,
 	}
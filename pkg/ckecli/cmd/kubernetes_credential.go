@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientauthv1beta1 "k8s.io/client-go/pkg/apis/clientauthentication/v1beta1"
+)
+
+const (
+	// defaultCredentialTTL is the default and maximum TTL of certificates
+	// issued by "ckecli kubernetes credential".
+	defaultCredentialTTL = time.Hour
+
+	// credentialRefreshMargin is the margin to issue a new certificate before
+	// the cached certificate expires.
+	credentialRefreshMargin = 5 * time.Minute
+)
+
+var kubernetesCredentialOpts struct {
+	UserName string
+	TTL      time.Duration
+}
+
+// kubernetesCredentialCmd represents the "kubernetes credential" command
+var kubernetesCredentialCmd = &cobra.Command{
+	Use:   "credential",
+	Short: "obtain a short-lived client certificate as a client-go credential plugin",
+	Long: `Obtain a short-lived client certificate for k8s user and output it
+as ExecCredential of client.authentication.k8s.io/v1beta1.
+
+This is intended to be called from kubectl with kubeconfig generated
+by "ckecli kubernetes issue --exec".
+
+The groups of the certificate are looked up from the mapping stored in CKE.
+Certificates are cached in the user's cache directory and reused until
+shortly before they expire, unless they have been revoked or the groups
+of the user have been changed.`,
+
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ttl := kubernetesCredentialOpts.TTL
+		if ttl <= 0 || ttl > defaultCredentialTTL {
+			return fmt.Errorf("ttl must be positive and no longer than %s", defaultCredentialTTL)
+		}
+		userName := kubernetesCredentialOpts.UserName
+
+		well.Go(func(ctx context.Context) error {
+			cluster, err := storage.GetCluster(ctx)
+			if err != nil {
+				return err
+			}
+
+			groups, err := storage.GetUserGroups(ctx, userName)
+			if err == cke.ErrNotFound {
+				return fmt.Errorf("no groups are mapped to user %s", userName)
+			}
+			if err != nil {
+				return err
+			}
+
+			cachePath, err := credentialCachePath(cluster.Name, userName)
+			if err != nil {
+				return err
+			}
+			if cred := readCachedCredential(cachePath, time.Now()); cred != nil {
+				ok, err := checkCachedCredential(ctx, cred, groups)
+				if err != nil {
+					return err
+				}
+				if ok {
+					return json.NewEncoder(os.Stdout).Encode(cred)
+				}
+			}
+
+			cert, key, rec, err := issueUserCertificate(ctx, userName, groups, ttl.String())
+			if err != nil {
+				return err
+			}
+
+			cred := newExecCredential(cert, key, rec.Expiry)
+			err = writeCachedCredential(cachePath, cred)
+			if err != nil {
+				return err
+			}
+			return json.NewEncoder(os.Stdout).Encode(cred)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	fs := kubernetesCredentialCmd.Flags()
+	fs.StringVarP(&kubernetesCredentialOpts.UserName, "user", "u", cke.RoleAdmin, "User name of the certificate")
+	fs.DurationVar(&kubernetesCredentialOpts.TTL, "ttl", defaultCredentialTTL, "TTL of the certificate")
+	kubernetesCmd.AddCommand(kubernetesCredentialCmd)
+}
+
+func newExecCredential(cert, key string, expiry time.Time) *clientauthv1beta1.ExecCredential {
+	exp := metav1.NewTime(expiry)
+	return &clientauthv1beta1.ExecCredential{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: clientauthv1beta1.SchemeGroupVersion.String(),
+			Kind:       "ExecCredential",
+		},
+		Status: &clientauthv1beta1.ExecCredentialStatus{
+			ExpirationTimestamp:   &exp,
+			ClientCertificateData: cert,
+			ClientKeyData:         key,
+		},
+	}
+}
+
+// credentialCachePath returns the path of the cache file for the user of the cluster.
+func credentialCachePath(cluster, userName string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	name := url.PathEscape(cluster) + "_" + url.PathEscape(userName) + ".json"
+	return filepath.Join(dir, "ckecli", "credentials", name), nil
+}
+
+// readCachedCredential returns the cached credential if it is valid long enough.
+// Otherwise, this returns nil.
+func readCachedCredential(p string, now time.Time) *clientauthv1beta1.ExecCredential {
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil
+	}
+
+	cred := new(clientauthv1beta1.ExecCredential)
+	if err := json.Unmarshal(data, cred); err != nil {
+		return nil
+	}
+	if cred.Status == nil || cred.Status.ExpirationTimestamp == nil {
+		return nil
+	}
+	if !now.Add(credentialRefreshMargin).Before(cred.Status.ExpirationTimestamp.Time) {
+		return nil
+	}
+	return cred
+}
+
+// checkCachedCredential returns true if the certificate of the cached credential
+// can be reused for the current groups of the user.
+func checkCachedCredential(ctx context.Context, cred *clientauthv1beta1.ExecCredential, groups []string) (bool, error) {
+	block, _ := pem.Decode([]byte(cred.Status.ClientCertificateData))
+	if block == nil {
+		return false, nil
+	}
+	c, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false, nil
+	}
+
+	rec, err := storage.GetIssuedCertificate(ctx, cke.FormatSerial(c.SerialNumber.Bytes()))
+	if err == cke.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return isReusableCertificate(rec, groups), nil
+}
+
+// isReusableCertificate returns true if the certificate has not been revoked
+// and has been issued for the same set of groups.
+func isReusableCertificate(rec *cke.IssuedCertificate, groups []string) bool {
+	if rec.IsRevoked() {
+		return false
+	}
+	if len(rec.Groups) != len(groups) {
+		return false
+	}
+	g1 := append([]string(nil), rec.Groups...)
+	g2 := append([]string(nil), groups...)
+	sort.Strings(g1)
+	sort.Strings(g2)
+	for i := range g1 {
+		if g1[i] != g2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func writeCachedCredential(p string, cred *clientauthv1beta1.ExecCredential) error {
+	data, err := json.Marshal(cred)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(p), 0700)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(p), ".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
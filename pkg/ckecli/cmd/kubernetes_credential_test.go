@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/cke"
+)
+
+func TestCachedCredential(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ckecli-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, "credentials", "cluster_admin.json")
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if cred := readCachedCredential(p, now); cred != nil {
+		t.Error("credential should not be cached:", cred)
+	}
+
+	err = writeCachedCredential(p, newExecCredential("cert", "key", now.Add(time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Error("cache file is readable by others:", fi.Mode())
+	}
+
+	cred := readCachedCredential(p, now)
+	if cred == nil {
+		t.Fatal("cached credential is not found")
+	}
+	if cred.Status.ClientCertificateData != "cert" || cred.Status.ClientKeyData != "key" {
+		t.Error("unexpected cached credential:", cred.Status)
+	}
+
+	if cred := readCachedCredential(p, now.Add(time.Hour-credentialRefreshMargin)); cred != nil {
+		t.Error("credential about to expire should not be used:", cred)
+	}
+}
+
+func TestIsReusableCertificate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		rec      *cke.IssuedCertificate
+		groups   []string
+		expected bool
+	}{
+		{
+			name:     "same groups",
+			rec:      &cke.IssuedCertificate{Groups: []string{"dev", "ops"}},
+			groups:   []string{"ops", "dev"},
+			expected: true,
+		},
+		{
+			name:     "revoked",
+			rec:      &cke.IssuedCertificate{Groups: []string{"dev"}, RevokedAt: time.Now()},
+			groups:   []string{"dev"},
+			expected: false,
+		},
+		{
+			name:     "group removed",
+			rec:      &cke.IssuedCertificate{Groups: []string{"dev", "system:masters"}},
+			groups:   []string{"dev"},
+			expected: false,
+		},
+		{
+			name:     "group changed",
+			rec:      &cke.IssuedCertificate{Groups: []string{"dev"}},
+			groups:   []string{"ops"},
+			expected: false,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := isReusableCertificate(tt.rec, tt.groups); actual != tt.expected {
+				t.Errorf("expected %v, actual %v", tt.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// kubernetesGroupsCmd represents the "kubernetes groups" command
+var kubernetesGroupsCmd = &cobra.Command{
+	Use:   "groups",
+	Short: "manage the groups of k8s users",
+	Long: `Manage the mapping from k8s users to groups.
+
+The mapping is used to issue certificates by "ckecli kubernetes credential".`,
+}
+
+func init() {
+	kubernetesCmd.AddCommand(kubernetesGroupsCmd)
+}
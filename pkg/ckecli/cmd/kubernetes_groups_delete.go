@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+// kubernetesGroupsDeleteCmd represents the "kubernetes groups delete" command
+var kubernetesGroupsDeleteCmd = &cobra.Command{
+	Use:   "delete USER",
+	Short: "delete the groups of k8s user",
+	Long: `Delete the groups of k8s user.
+
+Certificates already issued for the user are not affected.`,
+
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			return storage.DeleteUserGroups(ctx, args[0])
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	kubernetesGroupsCmd.AddCommand(kubernetesGroupsDeleteCmd)
+}
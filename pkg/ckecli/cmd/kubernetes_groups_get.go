@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+// kubernetesGroupsGetCmd represents the "kubernetes groups get" command
+var kubernetesGroupsGetCmd = &cobra.Command{
+	Use:   "get [USER]",
+	Short: "get the groups of k8s users",
+	Long: `Get the groups of k8s user as a JSON array.
+
+If USER is not given, this outputs the groups of all users as a JSON object
+keyed by the user name.`,
+
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			var data interface{}
+			var err error
+			if len(args) == 1 {
+				data, err = storage.GetUserGroups(ctx, args[0])
+			} else {
+				data, err = storage.GetAllUserGroups(ctx)
+			}
+			if err != nil {
+				return err
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "    ")
+			return enc.Encode(data)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	kubernetesGroupsCmd.AddCommand(kubernetesGroupsGetCmd)
+}
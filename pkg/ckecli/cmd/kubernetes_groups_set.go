@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+// kubernetesGroupsSetCmd represents the "kubernetes groups set" command
+var kubernetesGroupsSetCmd = &cobra.Command{
+	Use:   "set USER GROUP...",
+	Short: "set the groups of k8s user",
+	Long:  `Set the groups of k8s user, replacing the current ones.`,
+
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			return storage.PutUserGroups(ctx, args[0], args[1:])
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	kubernetesGroupsCmd.AddCommand(kubernetesGroupsSetCmd)
+}
@@ -4,26 +4,56 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
+	"path/filepath"
+	"time"
 
 	"github.com/cybozu-go/cke"
 	"github.com/cybozu-go/well"
 	"github.com/spf13/cobra"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
 )
 
 var kubernetesIssueOpts struct {
-	TTL       string
-	GroupName string
-	UserName  string
+	TTL              string
+	GroupName        string
+	UserName         string
+	OIDC             bool
+	OIDCClientSecret string
+	Exec             bool
+	ExecConfig       string
 }
 
 // kubernetesIssueCmd represents the "kubernetes issue" command
 var kubernetesIssueCmd = &cobra.Command{
 	Use:   "issue",
 	Short: "issue client certificates for k8s user",
-	Long:  `Issue TLS client certificates for k8s user.`,
+	Long: `Issue TLS client certificates for k8s user.
+
+If --oidc is specified, this generates kubeconfig to authenticate
+with OpenID Connect instead of a client certificate.
+
+If --exec is specified, this generates kubeconfig to obtain short-lived
+client certificates by "ckecli kubernetes credential" on demand.
+The groups of the user are looked up from the mapping stored in CKE.
+The kubeconfig runs ckecli with the config file given by --exec-config,
+or the config file of this command by default.  As the config file gives
+access to CKE's etcd and Vault, the kubeconfig works only for users who
+are allowed to read a ckecli config file.
+
+Certificates of system:masters group, the default of --group, cannot be
+revoked by "ckecli kubernetes revoke".  Use another group bound to
+cluster-admin role to issue revocable certificates.`,
 
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if kubernetesIssueOpts.OIDC && kubernetesIssueOpts.Exec {
+			return errors.New("--oidc and --exec are mutually exclusive")
+		}
+		if kubernetesIssueOpts.ExecConfig != "" && !kubernetesIssueOpts.Exec {
+			return errors.New("--exec-config requires --exec")
+		}
+
 		well.Go(func(ctx context.Context) error {
 			cluster, err := storage.GetCluster(ctx)
 			if err != nil {
@@ -34,34 +64,107 @@ var kubernetesIssueCmd = &cobra.Command{
 				return errors.New("no control plane")
 			}
 
-			server := "https://" + cpNodes[0].Address + ":6443"
+			server := "https://" + net.JoinHostPort(cpNodes[0].Address, "6443")
 
 			cacert, err := storage.GetCACertificate(ctx, cke.CAKubernetes)
 			if err != nil {
 				return err
 			}
 
-			cert, key, err := cke.KubernetesCA{}.IssueUserCert(ctx, inf, kubernetesIssueOpts.UserName, kubernetesIssueOpts.GroupName, kubernetesIssueOpts.TTL)
-			if err != nil {
-				return err
+			if kubernetesIssueOpts.OIDC {
+				oidc := cluster.Options.APIServer.OIDC
+				if oidc == nil {
+					return errors.New("OIDC is not configured for kube-apiserver")
+				}
+				cfg := cke.OIDCKubeconfig(cluster.Name, "oidc", cacert, server, oidc, kubernetesIssueOpts.OIDCClientSecret)
+				return writeKubeconfig(cfg)
 			}
-			cfg := cke.UserKubeconfig(cluster.Name, kubernetesIssueOpts.UserName, cacert, cert, key, server)
-			src, err := clientcmd.Write(*cfg)
+
+			if kubernetesIssueOpts.Exec {
+				_, err := storage.GetUserGroups(ctx, kubernetesIssueOpts.UserName)
+				if err == cke.ErrNotFound {
+					return fmt.Errorf("no groups are mapped to user %s", kubernetesIssueOpts.UserName)
+				}
+				if err != nil {
+					return err
+				}
+
+				ttl := defaultCredentialTTL
+				if cmd.Flags().Changed("ttl") {
+					ttl, err = time.ParseDuration(kubernetesIssueOpts.TTL)
+					if err != nil {
+						return err
+					}
+					if ttl <= 0 || ttl > defaultCredentialTTL {
+						return fmt.Errorf("ttl must be positive and no longer than %s", defaultCredentialTTL)
+					}
+				}
+				execConfig := cfgFile
+				if kubernetesIssueOpts.ExecConfig != "" {
+					execConfig = kubernetesIssueOpts.ExecConfig
+				}
+				config, err := filepath.Abs(execConfig)
+				if err != nil {
+					return err
+				}
+				args := []string{
+					"--config=" + config,
+					"kubernetes", "credential",
+					"--user=" + kubernetesIssueOpts.UserName,
+					"--ttl=" + ttl.String(),
+				}
+				cfg := cke.ExecKubeconfig(cluster.Name, kubernetesIssueOpts.UserName, cacert, server, "ckecli", args)
+				return writeKubeconfig(cfg)
+			}
+
+			cert, key, _, err := issueUserCertificate(ctx, kubernetesIssueOpts.UserName, []string{kubernetesIssueOpts.GroupName}, kubernetesIssueOpts.TTL)
 			if err != nil {
 				return err
 			}
-			_, err = fmt.Println(string(src))
-			return err
+			cfg := cke.UserKubeconfig(cluster.Name, kubernetesIssueOpts.UserName, cacert, cert, key, server)
+			return writeKubeconfig(cfg)
 		})
 		well.Stop()
 		return well.Wait()
 	},
 }
 
+// issueUserCertificate issues a client certificate for a Kubernetes user and records it.
+// The certificate is given a credential ID as a group to deny requests with
+// the certificate after revocation.
+func issueUserCertificate(ctx context.Context, userName string, groups []string, ttl string) (cert, key string, rec *cke.IssuedCertificate, err error) {
+	credentialID, err := cke.NewCredentialID()
+	if err != nil {
+		return "", "", nil, err
+	}
+	cert, key, err = cke.KubernetesCA{}.IssueUserCert(ctx, inf, userName, groups, credentialID, ttl)
+	if err != nil {
+		return "", "", nil, err
+	}
+	rec, err = recordIssuedCertificate(ctx, cke.IssuedCertKubernetes, userName, groups, ttl, credentialID, cert)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return cert, key, rec, nil
+}
+
+func writeKubeconfig(cfg *api.Config) error {
+	src, err := clientcmd.Write(*cfg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Println(string(src))
+	return err
+}
+
 func init() {
 	fs := kubernetesIssueCmd.Flags()
 	fs.StringVar(&kubernetesIssueOpts.TTL, "ttl", "2h", "TTL of the certificate")
 	fs.StringVarP(&kubernetesIssueOpts.GroupName, "group", "g", cke.AdminGroup, "Group name of the issuing config")
 	fs.StringVarP(&kubernetesIssueOpts.UserName, "user", "u", cke.RoleAdmin, "User name of the issuing config")
+	fs.BoolVar(&kubernetesIssueOpts.OIDC, "oidc", false, "Issue kubeconfig for OpenID Connect authentication")
+	fs.StringVar(&kubernetesIssueOpts.OIDCClientSecret, "oidc-client-secret", "", "OIDC client secret, if required by the issuer")
+	fs.BoolVar(&kubernetesIssueOpts.Exec, "exec", false, "Issue kubeconfig to obtain short-lived certificates by ckecli")
+	fs.StringVar(&kubernetesIssueOpts.ExecConfig, "exec-config", "", "ckecli config file used by kubeconfig issued with --exec")
 	kubernetesCmd.AddCommand(kubernetesIssueCmd)
 }
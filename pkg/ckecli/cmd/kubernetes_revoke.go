@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+// kubernetesRevokeCmd represents the "kubernetes revoke" command
+var kubernetesRevokeCmd = &cobra.Command{
+	Use:   "revoke SERIAL",
+	Short: "revoke a client certificate for k8s user",
+	Long: `Revoke a client certificate issued by "ckecli kubernetes issue".
+
+SERIAL is the serial number of the certificate listed by "ckecli certs issued".
+
+The certificate is revoked in the secret backend and added to the denylist of CKE.
+API servers deny requests with the certificate if revocation_webhook
+is configured for kube-apiserver.
+
+Certificates of system:masters group cannot be revoked because API servers
+authorize them without asking CKE.  Rotate the kubernetes CA by
+"ckecli ca rotate kubernetes" to invalidate them.`,
+
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		serial, err := cke.NormalizeSerial(args[0])
+		if err != nil {
+			return err
+		}
+
+		well.Go(func(ctx context.Context) error {
+			c, err := storage.GetIssuedCertificate(ctx, serial)
+			if err == cke.ErrNotFound {
+				return errors.New("no such certificate: " + serial)
+			}
+			if err != nil {
+				return err
+			}
+			if c.Kind != cke.IssuedCertKubernetes {
+				return fmt.Errorf("not a certificate for k8s user: %s", serial)
+			}
+			if !c.IsRevocable() {
+				return fmt.Errorf("certificate of %s group cannot be revoked: %s; rotate the kubernetes CA instead", cke.AdminGroup, serial)
+			}
+
+			err = inf.Secrets().RevokeCertificate(ctx, cke.CAKubernetes, serial)
+			if err != nil {
+				return err
+			}
+			return storage.RevokeIssuedCertificate(ctx, c, time.Now().UTC())
+		})
+		well.Stop()
+		err = well.Wait()
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("revoked")
+		return nil
+	},
+}
+
+func init() {
+	kubernetesCmd.AddCommand(kubernetesRevokeCmd)
+}
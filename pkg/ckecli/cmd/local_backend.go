@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// localBackendCmd represents the local-backend command
+var localBackendCmd = &cobra.Command{
+	Use:   "local-backend",
+	Short: "local-backend subcommand",
+	Long:  `local-backend subcommand`,
+}
+
+func init() {
+	rootCmd.AddCommand(localBackendCmd)
+}
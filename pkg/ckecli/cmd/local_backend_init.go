@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+// localBackendInitCmd represents the "local-backend init" command
+var localBackendInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "initialize the local secret backend",
+	Long: `Initialize the local secret backend configured in the config file.
+
+This command generates CAs and an encryption key for Kubernetes Secrets
+if they do not exist.  SSH private keys need to be stored separately
+by "ckecli vault ssh-privkey".`,
+
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(initLocalBackend)
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	localBackendCmd.AddCommand(localBackendInitCmd)
+}
+
+func initLocalBackend(ctx context.Context) error {
+	secrets := inf.Secrets()
+
+	for _, ca := range cas {
+		_, err := storage.GetCACertificate(ctx, ca.key)
+		switch err {
+		case nil:
+			continue
+		case cke.ErrNotFound:
+		default:
+			return err
+		}
+
+		crt, err := cke.GenerateLocalCA(ctx, secrets, ca.key, ca.commonName)
+		if err != nil {
+			return err
+		}
+		err = storage.PutCACertificate(ctx, ca.key, crt)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("issued root certificate for %s\n", ca.key)
+	}
+
+	enckeys, err := secrets.ReadSecret(ctx, cke.K8sSecret)
+	if err != nil {
+		return err
+	}
+	if enckeys != nil {
+		return nil
+	}
+	return rotateK8sEncryptionKey(ctx, secrets)
+}
@@ -62,7 +62,7 @@ OUTER:
 	for _, rebootNode := range nodes {
 		for _, clusterNode := range cluster.Nodes {
 			if rebootNode == clusterNode.Address {
-				if clusterNode.ControlPlane {
+				if clusterNode.ControlPlane || clusterNode.IsEtcdMember() {
 					numCPs++
 				}
 				continue OUTER
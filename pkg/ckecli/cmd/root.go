@@ -19,13 +19,13 @@ var (
 	inf        = &cliInfrastructure{}
 )
 
-func loadConfig(p string) (*etcdutil.Config, error) {
+func loadConfig(p string) (*cke.Config, error) {
 	b, err := ioutil.ReadFile(p)
 	if err != nil {
 		return nil, err
 	}
 
-	cfg := cke.NewEtcdConfig()
+	cfg := cke.NewConfig()
 	err = yaml.Unmarshal(b, cfg)
 	if err != nil {
 		return nil, err
@@ -58,13 +58,19 @@ with etcd.  CKE server watches etcd to receive any updates.`,
 			return err
 		}
 
-		etcd, err := etcdutil.NewClient(cfg)
+		etcd, err := etcdutil.NewClient(cfg.Config)
 		if err != nil {
 			return err
 		}
 		etcdClient = etcd
 
 		storage = cke.Storage{Client: etcd}
+
+		secrets, err := cke.NewSecretBackend(cfg.SecretBackend, etcd, inf.Vault)
+		if err != nil {
+			return err
+		}
+		inf.secrets = secrets
 		return nil
 	},
 	PersistentPostRun: func(cmd *cobra.Command, args []string) {
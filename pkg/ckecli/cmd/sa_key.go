@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var saKeyCmd = &cobra.Command{
+	Use:   "sa-key",
+	Short: "sa-key subcommand",
+	Long:  `sa-key subcommand`,
+}
+
+func init() {
+	rootCmd.AddCommand(saKeyCmd)
+}
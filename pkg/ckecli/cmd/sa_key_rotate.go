@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+var saKeyRotateOpts struct {
+	GracePeriod time.Duration
+}
+
+var saKeyRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "rotate the key to sign service account tokens",
+	Long: `Issue a new key to sign service account tokens and request CKE to
+rotate the current key.
+
+CKE adds the new key to API servers to verify tokens, makes controller
+managers sign tokens with the new key, and removes the old key from API
+servers after the grace period.`,
+
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if saKeyRotateOpts.GracePeriod < 0 {
+			return errors.New("grace period must not be negative")
+		}
+
+		well.Go(func(ctx context.Context) error {
+			return rotateServiceAccountKey(ctx, saKeyRotateOpts.GracePeriod)
+		})
+		well.Stop()
+		err := well.Wait()
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("succeeded")
+		return nil
+	},
+}
+
+func init() {
+	fs := saKeyRotateCmd.Flags()
+	fs.DurationVar(&saKeyRotateOpts.GracePeriod, "grace-period", cke.DefaultServiceAccountKeyGracePeriod, "period to keep the old key after the switch")
+	saKeyCmd.AddCommand(saKeyRotateCmd)
+}
+
+func rotateServiceAccountKey(ctx context.Context, gracePeriod time.Duration) error {
+	_, err := storage.GetServiceAccountKeyRotation(ctx)
+	switch err {
+	case nil:
+		return cke.ErrRotationInProgress
+	case cke.ErrNotFound:
+	default:
+		return err
+	}
+
+	oldCert, err := storage.GetServiceAccountCert(ctx)
+	if err != nil {
+		return err
+	}
+
+	crt, key, err := cke.KubernetesCA{}.IssueForServiceAccount(ctx, inf)
+	if err != nil {
+		return err
+	}
+
+	return storage.StartServiceAccountKeyRotation(ctx, &cke.ServiceAccountKeyRotation{
+		Stage:       cke.ServiceAccountKeyStageAdd,
+		OldCert:     oldCert,
+		NewCert:     crt,
+		NewKey:      key,
+		GracePeriod: gracePeriod.String(),
+		StartedAt:   time.Now().UTC(),
+	})
+}
@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"context"
+	"fmt"
+	"os"
 
 	"github.com/cybozu-go/cke"
 	"github.com/cybozu-go/cke/sabakan"
@@ -37,6 +39,9 @@ just one control-plane node and one non contorl-plane node.`,
 		if err != nil {
 			return err
 		}
+		for _, msg := range tmpl.FeatureGateConflicts() {
+			fmt.Fprintln(os.Stderr, "warning:", msg)
+		}
 
 		well.Go(func(ctx context.Context) error {
 			return storage.SetSabakanTemplate(ctx, tmpl)
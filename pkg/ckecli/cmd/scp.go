@@ -33,7 +33,7 @@ func scp(ctx context.Context, args []string) error {
 	if err != nil {
 		return err
 	}
-	fifo, err := sshPrivateKey(node)
+	fifo, err := sshPrivateKey(ctx, node)
 	if err != nil {
 		return err
 	}
@@ -46,7 +46,7 @@ func writeToFifo(fifo string, data string) {
 	}
 }
 
-func sshPrivateKey(nodeName string) (string, error) {
+func sshPrivateKey(ctx context.Context, nodeName string) (string, error) {
 	usr, err := user.Current()
 	if err != nil {
 		return "", err
@@ -61,18 +61,13 @@ func sshPrivateKey(nodeName string) (string, error) {
 		return "", err
 	}
 
-	vc, err := inf.Vault()
+	privKeys, err := inf.Secrets().ReadSecret(ctx, cke.SSHSecret)
 	if err != nil {
 		return "", err
 	}
-	secret, err := vc.Logical().Read(cke.SSHSecret)
-	if err != nil {
-		return "", err
-	}
-	if secret == nil {
+	if privKeys == nil {
 		return "", errors.New("no ssh private keys")
 	}
-	privKeys := secret.Data
 
 	mykey, ok := privKeys[nodeName]
 	if !ok {
@@ -94,7 +89,7 @@ func sshPrivateKey(nodeName string) (string, error) {
 
 func ssh(ctx context.Context, args []string) error {
 	node := detectSSHNode(args[0])
-	fifo, err := sshPrivateKey(node)
+	fifo, err := sshPrivateKey(ctx, node)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,393 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+	cryptossh "golang.org/x/crypto/ssh"
+)
+
+const sshKeyBits = 4096
+
+// sshRotateKeyCmd represents the "ssh rotate-key" command
+var sshRotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "rotate the SSH private key to login to nodes",
+	Long: `Rotate the SSH private key to login to nodes.
+
+This command generates a new key pair and rotates the key in the following stages:
+
+1. install: Install the new public key on all reachable nodes with the current keys.
+2. verify: Verify login with the new key, then replace the default key
+   in the secret backend with the new key.
+3. remove: Remove the old public keys from the nodes.
+
+Nodes unreachable in the install or verify stage keep using their current keys.
+
+The progress is recorded in etcd.  If this command fails, run it
+again to resume the rotation.`,
+
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(rotateSSHKey)
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	sshCmd.AddCommand(sshRotateKeyCmd)
+}
+
+func rotateSSHKey(ctx context.Context) error {
+	cluster, err := storage.GetCluster(ctx)
+	if err != nil {
+		return err
+	}
+	nodes := make(map[string]*cke.Node)
+	for _, n := range cluster.Nodes {
+		nodes[n.Address] = n
+	}
+	secrets := inf.Secrets()
+
+	r, err := storage.GetSSHKeyRotation(ctx)
+	switch err {
+	case nil:
+		fmt.Printf("resuming the rotation in %s stage\n", r.Stage)
+	case cke.ErrNotFound:
+		// Claim the rotation before writing the new key so that
+		// concurrent runs do not overwrite the key of each other.
+		r = &cke.SSHKeyRotation{
+			Stage:     cke.SSHKeyStageInstall,
+			StartedAt: time.Now().UTC(),
+		}
+		err = storage.StartSSHKeyRotation(ctx, r)
+		if err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	if len(r.NewPublicKey) == 0 {
+		r, err = generateNextSSHKey(ctx, secrets, r)
+		if err != nil {
+			return err
+		}
+	}
+
+	newKey, err := readNextSSHKey(ctx, secrets, r)
+	if err != nil {
+		return err
+	}
+
+	if r.Stage == cke.SSHKeyStageInstall {
+		r, err = installSSHKey(ctx, cluster.Nodes, secrets, r)
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.Stage == cke.SSHKeyStageVerify {
+		r, err = verifySSHKey(ctx, nodes, newKey, r)
+		if err != nil {
+			return err
+		}
+		r, err = swapSSHKey(ctx, cluster.Nodes, secrets, newKey, r)
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.Stage == cke.SSHKeyStageRemove {
+		err = removeOldSSHKeys(ctx, nodes, newKey, r)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = storage.DeleteSSHKeyRotation(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Println("rotated")
+	return nil
+}
+
+// generateNextSSHKey generates a new key pair, stores the private key in
+// SSHNextSecret, and records the public key in r.  The key is generated
+// again when resumed because it has not been installed on any nodes yet.
+func generateNextSSHKey(ctx context.Context, secrets cke.SecretBackend, r *cke.SSHKeyRotation) (*cke.SSHKeyRotation, error) {
+	priv, err := rsa.GenerateKey(rand.Reader, sshKeyBits)
+	if err != nil {
+		return nil, err
+	}
+	privkey := string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(priv),
+	}))
+	pubkey, err := sshAuthorizedKey(privkey)
+	if err != nil {
+		return nil, err
+	}
+
+	err = secrets.WriteSecret(ctx, cke.SSHNextSecret, map[string]interface{}{"": privkey})
+	if err != nil {
+		return nil, err
+	}
+
+	nr := *r
+	nr.NewPublicKey = pubkey
+	err = storage.UpdateSSHKeyRotation(ctx, &nr)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("generated a new SSH key:", pubkey)
+	return &nr, nil
+}
+
+func readNextSSHKey(ctx context.Context, secrets cke.SecretBackend, r *cke.SSHKeyRotation) (string, error) {
+	data, err := secrets.ReadSecret(ctx, cke.SSHNextSecret)
+	if err != nil {
+		return "", err
+	}
+	newKey, _ := data[""].(string)
+	if len(newKey) == 0 {
+		return "", errors.New("no new SSH private key in " + cke.SSHNextSecret)
+	}
+
+	pubkey, err := sshAuthorizedKey(newKey)
+	if err != nil {
+		return "", err
+	}
+	if pubkey != r.NewPublicKey {
+		return "", errors.New("new SSH private key does not match the rotation in progress")
+	}
+	return newKey, nil
+}
+
+func installSSHKey(ctx context.Context, nodes []*cke.Node, secrets cke.SecretBackend, r *cke.SSHKeyRotation) (*cke.SSHKeyRotation, error) {
+	privkeys, err := secrets.ReadSecret(ctx, cke.SSHSecret)
+	if err != nil {
+		return nil, err
+	}
+	if privkeys == nil {
+		return nil, errors.New("no ssh private keys")
+	}
+
+	for _, n := range nodes {
+		if r.IsDone(n.Address) {
+			continue
+		}
+
+		oldKey := nodeSSHKey(privkeys, n.Address)
+		if len(oldKey) == 0 {
+			fmt.Printf("%s: skipped: no ssh private key\n", n.Address)
+			continue
+		}
+		oldPubkey, err := sshAuthorizedKey(oldKey)
+		if err != nil {
+			return nil, err
+		}
+
+		err = runOnNode(n, oldKey, installAuthorizedKeyCommand(r.NewPublicKey))
+		if err != nil {
+			fmt.Printf("%s: skipped: %v\n", n.Address, err)
+			continue
+		}
+
+		r = r.WithInstalled(n.Address, oldPubkey)
+		err = storage.UpdateSSHKeyRotation(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("%s: installed the new key\n", n.Address)
+	}
+
+	if len(r.Installed) == 0 {
+		return nil, errors.New("no nodes are reachable")
+	}
+
+	r = r.WithStage(cke.SSHKeyStageVerify)
+	err = storage.UpdateSSHKeyRotation(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// verifySSHKey verifies login with the new key on the nodes where it has been installed.
+// Nodes that cannot be logged in are treated as if the key were not installed,
+// so they keep using their current keys.
+func verifySSHKey(ctx context.Context, nodes map[string]*cke.Node, newKey string, r *cke.SSHKeyRotation) (*cke.SSHKeyRotation, error) {
+	for _, addr := range append([]string(nil), r.Installed...) {
+		if r.IsDone(addr) {
+			continue
+		}
+
+		// Nodes removed from the cluster need not be verified.
+		if n, ok := nodes[addr]; ok {
+			err := runOnNode(n, newKey, "true")
+			if err != nil {
+				fmt.Printf("%s: skipped: failed to login with the new key: %v\n", addr, err)
+				r = r.WithUninstalled(addr)
+			} else {
+				fmt.Printf("%s: verified the new key\n", addr)
+			}
+		}
+
+		r = r.WithDone(addr)
+		err := storage.UpdateSSHKeyRotation(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(r.Installed) == 0 {
+		r = r.WithStage(cke.SSHKeyStageInstall)
+		err := storage.UpdateSSHKeyRotation(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		return nil, errors.New("no nodes can be logged in with the new key; run this command again to retry")
+	}
+	return r, nil
+}
+
+func swapSSHKey(ctx context.Context, nodes []*cke.Node, secrets cke.SecretBackend, newKey string, r *cke.SSHKeyRotation) (*cke.SSHKeyRotation, error) {
+	privkeys, err := secrets.ReadSecret(ctx, cke.SSHSecret)
+	if err != nil {
+		return nil, err
+	}
+	if privkeys == nil {
+		return nil, errors.New("no ssh private keys")
+	}
+
+	// The secret may have been swapped before the progress was recorded.
+	if privkeys[""] != newKey {
+		err = secrets.WriteSecret(ctx, cke.SSHSecret, swappedSSHKeys(privkeys, newKey, nodes, r))
+		if err != nil {
+			return nil, err
+		}
+	}
+	fmt.Println("replaced the SSH private key in the secret backend")
+
+	r = r.WithStage(cke.SSHKeyStageRemove)
+	err = storage.UpdateSSHKeyRotation(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// swappedSSHKeys returns SSH private keys whose default key is replaced with newKey.
+// Nodes where the new key is not installed keep using their current keys.
+func swappedSSHKeys(privkeys map[string]interface{}, newKey string, nodes []*cke.Node, r *cke.SSHKeyRotation) map[string]interface{} {
+	swapped := map[string]interface{}{"": newKey}
+	for addr, key := range privkeys {
+		if addr == "" || r.IsInstalled(addr) {
+			continue
+		}
+		swapped[addr] = key
+	}
+
+	oldKey, ok := privkeys[""]
+	if !ok {
+		return swapped
+	}
+	for _, n := range nodes {
+		if r.IsInstalled(n.Address) {
+			continue
+		}
+		if _, ok := swapped[n.Address]; !ok {
+			swapped[n.Address] = oldKey
+		}
+	}
+	return swapped
+}
+
+func removeOldSSHKeys(ctx context.Context, nodes map[string]*cke.Node, newKey string, r *cke.SSHKeyRotation) error {
+	var failed int
+	for _, addr := range r.Installed {
+		if r.IsDone(addr) {
+			continue
+		}
+
+		n, ok := nodes[addr]
+		oldPubkey := r.OldPublicKeys[addr]
+		if ok && len(oldPubkey) > 0 && oldPubkey != r.NewPublicKey {
+			err := runOnNode(n, newKey, removeAuthorizedKeyCommand(oldPubkey))
+			if err != nil {
+				fmt.Printf("%s: failed to remove the old key: %v\n", addr, err)
+				failed++
+				continue
+			}
+			fmt.Printf("%s: removed the old key\n", addr)
+		}
+
+		r = r.WithDone(addr)
+		err := storage.UpdateSSHKeyRotation(ctx, r)
+		if err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to remove the old keys from %d nodes; run this command again to retry", failed)
+	}
+	return nil
+}
+
+func nodeSSHKey(privkeys map[string]interface{}, address string) string {
+	key, ok := privkeys[address]
+	if !ok {
+		key = privkeys[""]
+	}
+	s, _ := key.(string)
+	return s
+}
+
+// sshAuthorizedKey returns the public key of privkey in authorized_keys format.
+func sshAuthorizedKey(privkey string) (string, error) {
+	signer, err := cryptossh.ParsePrivateKey([]byte(privkey))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(cryptossh.MarshalAuthorizedKey(signer.PublicKey()))), nil
+}
+
+func runOnNode(n *cke.Node, privkey, command string) error {
+	a, err := cke.SSHAgent(n, privkey)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	_, stderr, err := a.Run(command)
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, stderr)
+	}
+	return nil
+}
+
+// installAuthorizedKeyCommand returns a shell command to add pubkey to
+// authorized_keys unless it has been added.
+func installAuthorizedKeyCommand(pubkey string) string {
+	return fmt.Sprintf(`mkdir -p -m 700 ~/.ssh && f=~/.ssh/authorized_keys && touch "$f" && chmod 600 "$f" && `+
+		`{ grep -qF '%[1]s' "$f" || { if [ -s "$f" ] && [ -n "$(tail -c 1 "$f")" ]; then echo >> "$f"; fi; echo '%[1]s' >> "$f"; }; }`, pubkey)
+}
+
+// removeAuthorizedKeyCommand returns a shell command to remove pubkey from authorized_keys.
+func removeAuthorizedKeyCommand(pubkey string) string {
+	return fmt.Sprintf(`f=~/.ssh/authorized_keys && { grep -vF '%s' "$f" || true; } > "$f.cke-tmp" && cat "$f.cke-tmp" > "$f" && rm -f "$f.cke-tmp"`, pubkey)
+}
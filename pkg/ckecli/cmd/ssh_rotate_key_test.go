@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/cybozu-go/cke"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSwappedSSHKeys(t *testing.T) {
+	nodes := []*cke.Node{
+		{Address: "10.0.0.1"},
+		{Address: "10.0.0.2"},
+		{Address: "10.0.0.3"},
+		{Address: "10.0.0.4"},
+	}
+	privkeys := map[string]interface{}{
+		"":         "old",
+		"10.0.0.2": "old2",
+		"10.0.0.4": "old4",
+		"10.0.0.9": "old9",
+	}
+	r := &cke.SSHKeyRotation{Installed: []string{"10.0.0.1", "10.0.0.2"}}
+
+	expected := map[string]interface{}{
+		"":         "new",
+		"10.0.0.3": "old",
+		"10.0.0.4": "old4",
+		"10.0.0.9": "old9",
+	}
+	swapped := swappedSSHKeys(privkeys, "new", nodes, r)
+	if !cmp.Equal(swapped, expected) {
+		t.Error("unexpected keys:", cmp.Diff(swapped, expected))
+	}
+}
+
+func TestSwappedSSHKeysUninstalled(t *testing.T) {
+	nodes := []*cke.Node{
+		{Address: "10.0.0.1"},
+		{Address: "10.0.0.2"},
+		{Address: "10.0.0.3"},
+	}
+	privkeys := map[string]interface{}{
+		"":         "old",
+		"10.0.0.2": "old2",
+	}
+	r := (&cke.SSHKeyRotation{}).
+		WithInstalled("10.0.0.1", "pub").
+		WithInstalled("10.0.0.2", "pub2").
+		WithInstalled("10.0.0.3", "pub")
+
+	// 10.0.0.2 and 10.0.0.3 could not be logged in with the new key.
+	r = r.WithUninstalled("10.0.0.2").WithUninstalled("10.0.0.3")
+	if !cmp.Equal(r.Installed, []string{"10.0.0.1"}) {
+		t.Error("unexpected installed nodes:", r.Installed)
+	}
+	if _, ok := r.OldPublicKeys["10.0.0.2"]; ok {
+		t.Error("old public key of an uninstalled node should be removed")
+	}
+
+	expected := map[string]interface{}{
+		"":         "new",
+		"10.0.0.2": "old2",
+		"10.0.0.3": "old",
+	}
+	swapped := swappedSSHKeys(privkeys, "new", nodes, r)
+	if !cmp.Equal(swapped, expected) {
+		t.Error("unexpected keys:", cmp.Diff(swapped, expected))
+	}
+}
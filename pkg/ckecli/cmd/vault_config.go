@@ -19,10 +19,17 @@ and stores it in etcd.
 
 The parameters are given by a JSON object having these fields:
 
-    endpoint:  Vault URL.
-    ca-cert:   PEM encoded CA certificate to verify server certificate.
-    role-id:   AppRole ID to login to Vault.
-    secret-id: AppRole secret to login to Vault.
+    endpoint:    Vault URL.
+    ca-cert:     PEM encoded CA certificate to verify server certificate.
+    namespace:   Namespace of Vault Enterprise.
+    auth-method: One of approle (default), cert, token, or kubernetes.
+    auth-mount:  Path where the auth method is enabled.
+    role-id:     AppRole ID to login to Vault.
+    secret-id:   AppRole secret to login to Vault.
+
+Other fields for each auth method are described in docs/schema.md.
+Files for the auth method must exist on the hosts running CKE and ckecli.
+While the kms encryption provider is enabled, the auth method must be approle.
 
 If the argument is "-", the JSON is read from stdin.`,
 
@@ -49,6 +56,17 @@ If the argument is "-", the JSON is read from stdin.`,
 		}
 
 		well.Go(func(ctx context.Context) error {
+			cluster, err := storage.GetCluster(ctx)
+			switch err {
+			case nil:
+				err = cfg.ValidateForCluster(cluster)
+				if err != nil {
+					return err
+				}
+			case cke.ErrNotFound:
+			default:
+				return err
+			}
 			return storage.PutVaultConfig(ctx, cfg)
 		})
 		well.Stop()
@@ -1,35 +1,40 @@
 package cmd
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/cybozu-go/cke"
-	vault "github.com/hashicorp/vault/api"
+	"github.com/cybozu-go/well"
 	"github.com/spf13/cobra"
 	apiserverv1 "k8s.io/apiserver/pkg/apis/config/v1"
 )
 
 var vaultEncKeyCmd = &cobra.Command{
 	Use:   "enckey",
-	Short: "generate new encryption key for Kubernetes Secrets",
-	Long: `Generate or rotate encryption keys for Kubernetes Secrets.
+	Short: "generate new encryption key for Kubernetes resources",
+	Long: `Generate or rotate encryption keys for Kubernetes resources such as Secrets.
 
-WARNING: Key rotation is not fully implemented in this version!!
+If no key exists, this command generates a new key.
 
-This command generates new encryption keys for Kubernetes Secrets and
-rotate old keys.  The current key, if any, is retained to decrypt
-existing data.  Other old keys are removed.`,
+Otherwise, this command generates a new key and requests CKE to rotate
+the current key.  CKE adds the new key as a secondary key, promotes it
+to the primary key, rewrites all objects of the encrypted resources,
+and removes the old key.
+
+If a previous run failed before CKE starts the rotation, this resumes it.`,
 
 	RunE: func(cmd *cobra.Command, args []string) error {
-		vc, err := inf.Vault()
-		if err != nil {
-			return err
-		}
-		err = rotateK8sEncryptionKey(vc)
+		well.Go(func(ctx context.Context) error {
+			return rotateK8sEncryptionKey(ctx, inf.Secrets())
+		})
+		well.Stop()
+		err := well.Wait()
 		if err != nil {
 			return err
 		}
@@ -43,16 +48,12 @@ func init() {
 	vaultCmd.AddCommand(vaultEncKeyCmd)
 }
 
-func rotateK8sEncryptionKey(vc *vault.Client) error {
-	secret, err := vc.Logical().Read(cke.K8sSecret)
+func rotateK8sEncryptionKey(ctx context.Context, secrets cke.SecretBackend) error {
+	enckeys, err := secrets.ReadSecret(ctx, cke.K8sSecret)
 	if err != nil {
 		return err
 	}
-
-	var enckeys map[string]interface{}
-	if secret != nil && secret.Data != nil {
-		enckeys = secret.Data
-	} else {
+	if enckeys == nil {
 		enckeys = make(map[string]interface{})
 	}
 
@@ -64,28 +65,88 @@ func rotateK8sEncryptionKey(vc *vault.Client) error {
 		}
 	}
 
-	newKey, err := generateKey()
-	if err != nil {
+	// The rotation is recorded before the new key is stored so that
+	// concurrent runs do not overwrite each other's key.
+	r, err := storage.GetEncryptionKeyRotation(ctx)
+	switch err {
+	case nil:
+		if r.Stage != cke.EncryptionKeyStagePrepare {
+			return cke.ErrRotationInProgress
+		}
+		fmt.Println("resuming the rotation to", r.NewKey)
+	case cke.ErrNotFound:
+		if len(cfg.Keys) == 0 {
+			key, err := newEncryptionKey(time.Now().UTC().Format(time.RFC3339))
+			if err != nil {
+				return err
+			}
+			cfg.Keys = []apiserverv1.Key{key}
+			return writeEncryptionKeys(ctx, secrets, enckeys, cfg)
+		}
+
+		r = &cke.EncryptionKeyRotation{
+			Stage:     cke.EncryptionKeyStagePrepare,
+			OldKey:    cfg.Keys[0].Name,
+			NewKey:    time.Now().UTC().Format(time.RFC3339),
+			StartedAt: time.Now().UTC(),
+		}
+		err = storage.StartEncryptionKeyRotation(ctx, r)
+		if err != nil {
+			return err
+		}
+	default:
 		return err
 	}
-	keys := []apiserverv1.Key{
-		{
-			Name:   time.Now().UTC().Format(time.RFC3339),
-			Secret: base64.StdEncoding.EncodeToString(newKey),
-		},
+
+	var oldKey, newKey *apiserverv1.Key
+	for i := range cfg.Keys {
+		switch cfg.Keys[i].Name {
+		case r.OldKey:
+			oldKey = &cfg.Keys[i]
+		case r.NewKey:
+			// The key has been stored by the previous run.
+			newKey = &cfg.Keys[i]
+		}
 	}
-	if len(cfg.Keys) > 0 {
-		keys = append(keys, cfg.Keys[0])
+	if oldKey == nil {
+		return errors.New("no encryption key named " + r.OldKey)
 	}
-	cfg.Keys = keys
+	if newKey == nil {
+		key, err := newEncryptionKey(r.NewKey)
+		if err != nil {
+			return err
+		}
+		newKey = &key
+	}
+
+	// Retain the current key to decrypt existing data.  Other old keys are removed.
+	cfg.Keys = []apiserverv1.Key{*oldKey, *newKey}
+	err = writeEncryptionKeys(ctx, secrets, enckeys, cfg)
+	if err != nil {
+		return err
+	}
+
+	return storage.ProceedEncryptionKeyRotation(ctx, r, r.WithStage(cke.EncryptionKeyStageAdd))
+}
+
+func newEncryptionKey(name string) (apiserverv1.Key, error) {
+	key, err := generateKey()
+	if err != nil {
+		return apiserverv1.Key{}, err
+	}
+	return apiserverv1.Key{
+		Name:   name,
+		Secret: base64.StdEncoding.EncodeToString(key),
+	}, nil
+}
+
+func writeEncryptionKeys(ctx context.Context, secrets cke.SecretBackend, enckeys map[string]interface{}, cfg apiserverv1.AESConfiguration) error {
 	cfgData, err := json.Marshal(cfg)
 	if err != nil {
 		return err
 	}
 	enckeys["aescbc"] = string(cfgData)
-
-	_, err = vc.Logical().Write(cke.K8sSecret, enckeys)
-	return err
+	return secrets.WriteSecret(ctx, cke.K8sSecret, enckeys)
 }
 
 // generateKey generates key for aescbc
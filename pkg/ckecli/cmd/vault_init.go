@@ -58,6 +58,17 @@ path "cke/*"
 {
   capabilities = ["create", "read", "update", "delete", "list", "sudo"]
 }`
+
+	kmsPolicy = `
+path "cke/transit/encrypt/*"
+{
+  capabilities = ["update"]
+}
+
+path "cke/transit/decrypt/*"
+{
+  capabilities = ["update"]
+}`
 )
 
 func connectVault(ctx context.Context) (*vault.Client, error) {
@@ -126,6 +137,11 @@ func initVault(ctx context.Context) error {
 		return err
 	}
 
+	err = createTransit(ctx, vc)
+	if err != nil {
+		return err
+	}
+
 	err = vc.Sys().PutPolicy("cke", ckePolicy)
 	if err != nil {
 		return err
@@ -174,6 +190,11 @@ func initVault(ctx context.Context) error {
 		return err
 	}
 
+	err = createKMSAppRole(ctx, vc, cfg)
+	if err != nil {
+		return err
+	}
+
 	vc2, _, err := cke.VaultClient(cfg)
 	if err != nil {
 		return err
@@ -194,7 +215,56 @@ func initVault(ctx context.Context) error {
 		return nil
 	}
 
-	return rotateK8sEncryptionKey(vc2)
+	return rotateK8sEncryptionKey(ctx, cke.NewVaultSecretBackend(func() (*vault.Client, error) {
+		return vc2, nil
+	}))
+}
+
+// createKMSAppRole creates an AppRole for the KMS plugin that can only
+// encrypt and decrypt with the transit secrets engine.
+func createKMSAppRole(ctx context.Context, vc *vault.Client, cfg *cke.VaultConfig) error {
+	_, err := storage.GetKMSVaultConfig(ctx)
+	switch err {
+	case nil:
+		return nil
+	case cke.ErrNotFound:
+	default:
+		return err
+	}
+
+	err = vc.Sys().PutPolicy(cke.KMSVaultPolicy, kmsPolicy)
+	if err != nil {
+		return err
+	}
+
+	rolePath := "auth/approle/role/" + cke.KMSVaultPolicy
+	_, err = vc.Logical().Write(rolePath, map[string]interface{}{
+		"policies": cke.KMSVaultPolicy,
+		"period":   "1h",
+	})
+	if err != nil {
+		return err
+	}
+	secret, err := vc.Logical().Read(rolePath + "/role-id")
+	if err != nil {
+		return err
+	}
+	roleID := secret.Data["role_id"].(string)
+
+	secret, err = vc.Logical().Write(rolePath+"/secret-id", map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	secretID := secret.Data["secret_id"].(string)
+
+	fmt.Printf("created AppRole %s for the KMS plugin\n", cke.KMSVaultPolicy)
+	return storage.PutKMSVaultConfig(ctx, &cke.VaultConfig{
+		Endpoint:  cfg.Endpoint,
+		CACert:    cfg.CACert,
+		Namespace: cfg.Namespace,
+		RoleID:    roleID,
+		SecretID:  secretID,
+	})
 }
 
 func createPKI(ctx context.Context, vc *vault.Client, ca caParams) error {
@@ -278,6 +348,34 @@ func createKV(ctx context.Context, vc *vault.Client) error {
 	return nil
 }
 
+func createTransit(ctx context.Context, vc *vault.Client) error {
+	mounts, err := vc.Sys().ListMounts()
+	if err != nil {
+		return err
+	}
+	if _, ok := mounts[cke.TransitSecret]; ok {
+		return nil
+	}
+	if _, ok := mounts[cke.TransitSecret+"/"]; ok {
+		return nil
+	}
+
+	err = vc.Sys().Mount(cke.TransitSecret, &vault.MountInput{
+		Type: "transit",
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("mounted transit on %s\n", cke.TransitSecret)
+
+	_, err = vc.Logical().Write(path.Join(cke.TransitSecret, "keys", cke.DefaultKMSTransitKey), map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created transit key %s\n", cke.DefaultKMSTransitKey)
+	return nil
+}
+
 var vaultInitCfg struct {
 	caCertFile string
 	endpoint   string
@@ -295,7 +393,9 @@ Vault will be configured to:
     * have "ca-server", "ca-etcd-peer", "ca-etcd-client", "ca-kubernetes"
       PKI secrets under cke/.
     * creates AppRole for CKE.
+    * creates "cke-kms" policy and AppRole for the KMS plugin.
     * have initial encryption key for Kubernetes Secrets.
+    * have transit secrets engine under cke/transit for the KMS plugin.
 
 This command will ask username and password for Vault authentication
 when VAULT_TOKEN environment variable is not set.`,
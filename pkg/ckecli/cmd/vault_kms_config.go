@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+// vaultKMSConfigCmd represents the "vault kms-config" command
+var vaultKMSConfigCmd = &cobra.Command{
+	Use:   "kms-config FILE|-",
+	Short: "store parameters for the KMS plugin to connect Vault",
+	Long: `Load parameters for the KMS plugin to connect Vault from a FILE
+or stdin, and stores it in etcd.
+
+The parameters are given by a JSON object having the same fields as
+"ckecli vault config".  The auth method must be approle, and the role
+should be allowed only to encrypt and decrypt with cke/transit.
+The parameters are distributed to control plane nodes.
+
+If the argument is "-", the JSON is read from stdin.`,
+
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f := os.Stdin
+		if args[0] != "-" {
+			var err error
+			f, err = os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+		}
+
+		cfg := new(cke.VaultConfig)
+		err := json.NewDecoder(f).Decode(cfg)
+		if err != nil {
+			return err
+		}
+		err = cfg.ValidateForKMS()
+		if err != nil {
+			return err
+		}
+
+		well.Go(func(ctx context.Context) error {
+			return storage.PutKMSVaultConfig(ctx, cfg)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	vaultCmd.AddCommand(vaultKMSConfigCmd)
+}
@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 
 	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
 	"github.com/spf13/cobra"
 )
 
@@ -13,8 +15,8 @@ var vaultSSHPrivKeyHost string
 // vaultSSHPrivKeyCmd represents the "vault ssh-privkey" command
 var vaultSSHPrivKeyCmd = &cobra.Command{
 	Use:   "ssh-privkey FILE|-",
-	Short: "store SSH private key into Vault",
-	Long: `Store SSH private key for a host into Vault.
+	Short: "store SSH private key into the secret backend",
+	Long: `Store SSH private key for a host into the secret backend.
 
 If --host is not specified, the key will be used as the default key.
 
@@ -38,26 +40,29 @@ If FILE is -, the contents are read from stdin.`,
 			return err
 		}
 
-		vc, err := inf.Vault()
-		if err != nil {
-			return err
-		}
-
-		secret, err := vc.Logical().Read(cke.SSHSecret)
-		if err != nil {
-			return err
-		}
+		well.Go(func(ctx context.Context) error {
+			_, err := storage.GetSSHKeyRotation(ctx)
+			switch err {
+			case nil:
+				return cke.ErrRotationInProgress
+			case cke.ErrNotFound:
+			default:
+				return err
+			}
 
-		var privkeys map[string]interface{}
-		if secret != nil && secret.Data != nil {
-			privkeys = secret.Data
-		} else {
-			privkeys = make(map[string]interface{})
-		}
-		privkeys[vaultSSHPrivKeyHost] = string(data)
+			privkeys, err := inf.Secrets().ReadSecret(ctx, cke.SSHSecret)
+			if err != nil {
+				return err
+			}
+			if privkeys == nil {
+				privkeys = make(map[string]interface{})
+			}
+			privkeys[vaultSSHPrivKeyHost] = string(data)
 
-		_, err = vc.Logical().Write(cke.SSHSecret, privkeys)
-		return err
+			return inf.Secrets().WriteSecret(ctx, cke.SSHSecret, privkeys)
+		})
+		well.Stop()
+		return well.Wait()
 	},
 }
 
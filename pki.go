@@ -2,10 +2,12 @@ package cke
 
 import (
 	"context"
+	"errors"
 	"net"
 	"path"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/cybozu-go/log"
 	"github.com/cybozu-go/netutil"
@@ -116,7 +118,7 @@ func (e EtcdCA) IssueServerCert(ctx context.Context, inf Infrastructure, node *N
 		"cke-etcd.kube-system",
 		"cke-etcd.kube-system.svc",
 	}
-	return issueCertificate(inf, CAServer, RoleSystem, false,
+	return issueCertificate(ctx, inf, CAServer, RoleSystem, false,
 		map[string]interface{}{
 			"ttl":            "87600h",
 			"max_ttl":        "87600h",
@@ -132,7 +134,7 @@ func (e EtcdCA) IssueServerCert(ctx context.Context, inf Infrastructure, node *N
 
 // IssuePeerCert issues TLS certificates for mutual peer authentication.
 func (e EtcdCA) IssuePeerCert(ctx context.Context, inf Infrastructure, node *Node) (crt, key string, err error) {
-	return issueCertificate(inf, CAEtcdPeer, RoleSystem, false,
+	return issueCertificate(ctx, inf, CAEtcdPeer, RoleSystem, false,
 		map[string]interface{}{
 			"ttl":            "87600h",
 			"max_ttl":        "87600h",
@@ -147,7 +149,7 @@ func (e EtcdCA) IssuePeerCert(ctx context.Context, inf Infrastructure, node *Nod
 
 // IssueForAPIServer issues TLC client certificate for Kubernetes.
 func (e EtcdCA) IssueForAPIServer(ctx context.Context, inf Infrastructure, node *Node) (crt, key string, err error) {
-	return issueCertificate(inf, CAEtcdClient, RoleSystem, false,
+	return issueCertificate(ctx, inf, CAEtcdClient, RoleSystem, false,
 		map[string]interface{}{
 			"ttl":            "87600h",
 			"max_ttl":        "87600h",
@@ -162,7 +164,7 @@ func (e EtcdCA) IssueForAPIServer(ctx context.Context, inf Infrastructure, node
 
 // IssueRoot issues certificate for root user.
 func (e EtcdCA) IssueRoot(ctx context.Context, inf Infrastructure) (cert, key string, err error) {
-	return issueCertificate(inf, CAEtcdClient, RoleAdmin, false,
+	return issueCertificate(ctx, inf, CAEtcdClient, RoleAdmin, false,
 		map[string]interface{}{
 			"ttl":            "2h",
 			"max_ttl":        "24h",
@@ -177,8 +179,8 @@ func (e EtcdCA) IssueRoot(ctx context.Context, inf Infrastructure) (cert, key st
 }
 
 // IssueEtcdClientCertificate issues TLS client certificate for a user.
-func IssueEtcdClientCertificate(inf Infrastructure, username, ttl string) (cert, key string, err error) {
-	return issueCertificate(inf, CAEtcdClient, RoleSystem, false,
+func IssueEtcdClientCertificate(ctx context.Context, inf Infrastructure, username, ttl string) (cert, key string, err error) {
+	return issueCertificate(ctx, inf, CAEtcdClient, RoleSystem, false,
 		map[string]interface{}{
 			"ttl":            "87600h",
 			"max_ttl":        "87600h",
@@ -196,14 +198,29 @@ func IssueEtcdClientCertificate(inf Infrastructure, username, ttl string) (cert,
 type KubernetesCA struct{}
 
 // IssueUserCert issues client certificate for user.
-func (k KubernetesCA) IssueUserCert(ctx context.Context, inf Infrastructure, userName, groupName string, ttl string) (crt, key string, err error) {
-	return issueCertificate(inf, CAKubernetes, RoleAdmin, true,
+// As groups are given as the organization of the role, a role is
+// created for each certificate and deleted after issuing.
+//
+// If credentialID is not empty, the role is named after it and the certificate
+// is given a group with CredentialGroupPrefix so that it can be revoked.
+// Otherwise, a random ID is used only for the role.
+func (k KubernetesCA) IssueUserCert(ctx context.Context, inf Infrastructure, userName string, groups []string, credentialID, ttl string) (crt, key string, err error) {
+	id := credentialID
+	if id == "" {
+		id, err = NewCredentialID()
+		if err != nil {
+			return "", "", err
+		}
+	} else {
+		groups = append(append([]string(nil), groups...), CredentialGroupPrefix+credentialID)
+	}
+	return issueCertificate(ctx, inf, CAKubernetes, "user-"+id, true,
 		map[string]interface{}{
 			"ttl":               "2h",
 			"max_ttl":           "48h",
 			"enforce_hostnames": "false",
 			"allow_any_name":    "true",
-			"organization":      groupName,
+			"organization":      strings.Join(groups, ","),
 		},
 		map[string]interface{}{
 			"ttl":                  ttl,
@@ -213,20 +230,30 @@ func (k KubernetesCA) IssueUserCert(ctx context.Context, inf Infrastructure, use
 }
 
 // IssueForAPIServer issues TLS certificate for API servers.
-func (k KubernetesCA) IssueForAPIServer(ctx context.Context, inf Infrastructure, n *Node, serviceSubnet string) (crt, key string, err error) {
+//
+// serviceSubnet may be a comma-separated list of CIDRs for dual-stack clusters.
+// The certificate is valid for the addresses of kubernetes Service in all of them.
+func (k KubernetesCA) IssueForAPIServer(ctx context.Context, inf Infrastructure, n *Node, serviceSubnet string, ttl time.Duration) (crt, key string, err error) {
 	altNames := []string{
 		"localhost",
 		"kubernetes",
 		"kubernetes.default",
 		"kubernetes.default.svc",
 	}
-	ip, _, err := net.ParseCIDR(serviceSubnet)
+	subnets, err := ParseCIDRs(serviceSubnet)
 	if err != nil {
 		return "", "", err
 	}
-	kubeSvcAddr := netutil.IPAdd(ip, 1)
+	ipSANs := []string{"127.0.0.1"}
+	if ip := net.ParseIP(n.Address); ip != nil && isIPv6(ip) {
+		ipSANs = append(ipSANs, "::1")
+	}
+	ipSANs = append(ipSANs, n.Address)
+	for _, subnet := range subnets {
+		ipSANs = append(ipSANs, netutil.IPAdd(subnet.IP, 1).String())
+	}
 
-	return issueCertificate(inf, CAKubernetes, RoleSystem, false,
+	return issueCertificate(ctx, inf, CAKubernetes, RoleSystem, false,
 		map[string]interface{}{
 			"ttl":               "87600h",
 			"max_ttl":           "87600h",
@@ -235,15 +262,16 @@ func (k KubernetesCA) IssueForAPIServer(ctx context.Context, inf Infrastructure,
 		},
 		map[string]interface{}{
 			"common_name":          "kubernetes",
+			"ttl":                  ttl.String(),
 			"alt_names":            strings.Join(altNames, ","),
-			"ip_sans":              "127.0.0.1," + n.Address + "," + kubeSvcAddr.String(),
+			"ip_sans":              strings.Join(ipSANs, ","),
 			"exclude_cn_from_sans": "true",
 		})
 }
 
 // IssueForScheduler issues TLS certificate for kube-scheduler.
-func (k KubernetesCA) IssueForScheduler(ctx context.Context, inf Infrastructure) (crt, key string, err error) {
-	return issueCertificate(inf, CAKubernetes, RoleKubeScheduler, false,
+func (k KubernetesCA) IssueForScheduler(ctx context.Context, inf Infrastructure, ttl time.Duration) (crt, key string, err error) {
+	return issueCertificate(ctx, inf, CAKubernetes, RoleKubeScheduler, false,
 		map[string]interface{}{
 			"ttl":               "87600h",
 			"max_ttl":           "87600h",
@@ -253,13 +281,14 @@ func (k KubernetesCA) IssueForScheduler(ctx context.Context, inf Infrastructure)
 		},
 		map[string]interface{}{
 			"common_name":          "system:kube-scheduler",
+			"ttl":                  ttl.String(),
 			"exclude_cn_from_sans": "true",
 		})
 }
 
 // IssueForControllerManager issues TLS certificate for kube-controller-manager.
-func (k KubernetesCA) IssueForControllerManager(ctx context.Context, inf Infrastructure) (crt, key string, err error) {
-	return issueCertificate(inf, CAKubernetes, RoleKubeControllerManager, false,
+func (k KubernetesCA) IssueForControllerManager(ctx context.Context, inf Infrastructure, ttl time.Duration) (crt, key string, err error) {
+	return issueCertificate(ctx, inf, CAKubernetes, RoleKubeControllerManager, false,
 		map[string]interface{}{
 			"ttl":               "87600h",
 			"max_ttl":           "87600h",
@@ -269,19 +298,20 @@ func (k KubernetesCA) IssueForControllerManager(ctx context.Context, inf Infrast
 		},
 		map[string]interface{}{
 			"common_name":          "system:kube-controller-manager",
+			"ttl":                  ttl.String(),
 			"exclude_cn_from_sans": "true",
 		})
 }
 
 // IssueForKubelet issues TLS certificate for kubelet.
-func (k KubernetesCA) IssueForKubelet(ctx context.Context, inf Infrastructure, node *Node) (crt, key string, err error) {
+func (k KubernetesCA) IssueForKubelet(ctx context.Context, inf Infrastructure, node *Node, ttl time.Duration) (crt, key string, err error) {
 	nodename := node.Nodename()
 	altNames := "localhost"
 	if nodename != node.Address {
 		altNames = "localhost," + nodename
 	}
 
-	return issueCertificate(inf, CAKubernetes, RoleKubelet, false,
+	return issueCertificate(ctx, inf, CAKubernetes, RoleKubelet, false,
 		map[string]interface{}{
 			"ttl":               "87600h",
 			"max_ttl":           "87600h",
@@ -291,6 +321,7 @@ func (k KubernetesCA) IssueForKubelet(ctx context.Context, inf Infrastructure, n
 		},
 		map[string]interface{}{
 			"common_name":          "system:node:" + nodename,
+			"ttl":                  ttl.String(),
 			"alt_names":            altNames,
 			"ip_sans":              "127.0.0.1," + node.Address,
 			"exclude_cn_from_sans": "true",
@@ -298,8 +329,8 @@ func (k KubernetesCA) IssueForKubelet(ctx context.Context, inf Infrastructure, n
 }
 
 // IssueForProxy issues TLS certificate for kube-proxy.
-func (k KubernetesCA) IssueForProxy(ctx context.Context, inf Infrastructure) (crt, key string, err error) {
-	return issueCertificate(inf, CAKubernetes, RoleKubeProxy, false,
+func (k KubernetesCA) IssueForProxy(ctx context.Context, inf Infrastructure, ttl time.Duration) (crt, key string, err error) {
+	return issueCertificate(ctx, inf, CAKubernetes, RoleKubeProxy, false,
 		map[string]interface{}{
 			"ttl":               "87600h",
 			"max_ttl":           "87600h",
@@ -309,13 +340,14 @@ func (k KubernetesCA) IssueForProxy(ctx context.Context, inf Infrastructure) (cr
 		},
 		map[string]interface{}{
 			"common_name":          "system:kube-proxy",
+			"ttl":                  ttl.String(),
 			"exclude_cn_from_sans": "true",
 		})
 }
 
 // IssueForServiceAccount issues TLS certificate to sign service account tokens.
 func (k KubernetesCA) IssueForServiceAccount(ctx context.Context, inf Infrastructure) (crt, key string, err error) {
-	return issueCertificate(inf, CAKubernetes, RoleServiceAccount, false,
+	return issueCertificate(ctx, inf, CAKubernetes, RoleServiceAccount, false,
 		map[string]interface{}{
 			"ttl":            "87600h",
 			"max_ttl":        "87600h",
@@ -336,7 +368,7 @@ type AggregationCA struct{}
 
 // IssueClientCertificate issues TLS client certificate for API server
 func (a AggregationCA) IssueClientCertificate(ctx context.Context, inf Infrastructure) (cert, key string, err error) {
-	return issueCertificate(inf, CAKubernetesAggregation, RoleSystem, false,
+	return issueCertificate(ctx, inf, CAKubernetesAggregation, RoleSystem, false,
 		map[string]interface{}{
 			"ttl":            "87600h",
 			"max_ttl":        "87600h",
@@ -356,7 +388,7 @@ type WebhookCA struct{}
 // `namespace` and `name` specifies the namespace/name of a webhook Service.
 func (WebhookCA) IssueCertificate(ctx context.Context, inf Infrastructure, namespace, name string) (cert, key string, err error) {
 	altNames := []string{name, name + "." + namespace, name + "." + namespace + ".svc"}
-	return issueCertificate(inf, CAWebhook, RoleSystem, false,
+	return issueCertificate(ctx, inf, CAWebhook, RoleSystem, false,
 		map[string]interface{}{
 			"ttl":               "175200h",
 			"max_ttl":           "175200h",
@@ -372,28 +404,36 @@ func (WebhookCA) IssueCertificate(ctx context.Context, inf Infrastructure, names
 		})
 }
 
-func issueCertificate(inf Infrastructure, ca, role string, onetime bool, roleOpts, certOpts map[string]interface{}) (crt, key string, err error) {
-	pkiKey := VaultPKIKey(ca)
-	client, err := inf.Vault()
-	if err != nil {
-		return "", "", err
-	}
+func issueCertificate(ctx context.Context, inf Infrastructure, ca, role string, onetime bool, roleOpts, certOpts map[string]interface{}) (crt, key string, err error) {
+	return inf.Secrets().IssueCertificate(ctx, ca, role, onetime, roleOpts, certOpts)
+}
 
-	err = addRole(client, pkiKey, role, roleOpts)
+// DefaultIssuer returns the ID of the default issuer of a CA in Vault.
+func DefaultIssuer(client *vault.Client, ca string) (string, error) {
+	secret, err := client.Logical().Read(path.Join(VaultPKIKey(ca), "config/issuers"))
 	if err != nil {
-		return "", "", err
+		return "", err
 	}
-
-	secret, err := client.Logical().Write(path.Join(pkiKey, "issue", role), certOpts)
-	if err != nil {
-		return "", "", err
+	if secret == nil || secret.Data == nil {
+		return "", errors.New("no issuer config for " + ca)
 	}
-	crt = secret.Data["certificate"].(string)
-	if onetime {
-		if err := deleteRole(client, pkiKey, role); err != nil {
-			return "", "", err
-		}
+	issuer, ok := secret.Data["default"].(string)
+	if !ok || issuer == "" {
+		return "", errors.New("no default issuer for " + ca)
 	}
-	key = secret.Data["private_key"].(string)
-	return crt, key, err
+	return issuer, nil
+}
+
+// SetDefaultIssuer makes the issuer sign certificates issued by a CA in Vault.
+func SetDefaultIssuer(client *vault.Client, ca, issuer string) error {
+	_, err := client.Logical().Write(path.Join(VaultPKIKey(ca), "config/issuers"), map[string]interface{}{
+		"default": issuer,
+	})
+	return err
+}
+
+// DeleteIssuer removes the issuer and its certificate from a CA in Vault.
+func DeleteIssuer(client *vault.Client, ca, issuer string) error {
+	_, err := client.Logical().Delete(path.Join(VaultPKIKey(ca), "issuer", issuer))
+	return err
 }
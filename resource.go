@@ -12,6 +12,7 @@ import (
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -34,6 +35,7 @@ const (
 const (
 	KindDeployment                     = "Deployment"
 	KindMutatingWebhookConfiguration   = "MutatingWebhookConfiguration"
+	KindPodSecurityPolicy              = "PodSecurityPolicy"
 	KindSecret                         = "Secret"
 	KindValidatingWebhookConfiguration = "ValidatingWebhookConfiguration"
 )
@@ -102,6 +104,34 @@ func ApplyResource(ctx context.Context, dynclient dynamic.Interface, mapper meta
 	return err
 }
 
+// DeleteResource deletes the object described in data.
+// It is not an error if the object does not exist.
+func DeleteResource(ctx context.Context, dynclient dynamic.Interface, mapper meta.RESTMapper, data []byte) error {
+	obj := &unstructured.Unstructured{}
+	_, gvk, err := decUnstructured.Decode(data, nil, obj)
+	if err != nil {
+		return fmt.Errorf("failed to decode data into *Unstructured: %w", err)
+	}
+
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return fmt.Errorf("failed to find REST mapping for %s: %w", gvk.String(), err)
+	}
+
+	var dr dynamic.ResourceInterface
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		dr = dynclient.Resource(mapping.Resource).Namespace(obj.GetNamespace())
+	} else {
+		dr = dynclient.Resource(mapping.Resource)
+	}
+
+	err = dr.Delete(ctx, obj.GetName(), metav1.DeleteOptions{})
+	if k8serr.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
 func injectCA(ctx context.Context, st Storage, obj *unstructured.Unstructured, gvk *schema.GroupVersionKind) error {
 	cacert, err := st.GetCACertificate(ctx, CAWebhook)
 	if err != nil {
@@ -16,6 +16,9 @@ func ValidateTemplate(tmpl *cke.Cluster) error {
 	roles := make(map[string]bool)
 	var cpCount, ncpCount int
 	for _, n := range tmpl.Nodes {
+		if n.Etcd != nil {
+			return errors.New("etcd role cannot be specified in template")
+		}
 		if n.ControlPlane {
 			cpCount++
 			continue
@@ -0,0 +1,168 @@
+package cke
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/coreos/etcd/clientv3"
+	vault "github.com/hashicorp/vault/api"
+)
+
+// Types of SecretBackend.
+const (
+	SecretBackendVault = "vault"
+	SecretBackendLocal = "local"
+)
+
+// Storages of the local secret backend.
+const (
+	LocalSecretStorageEtcd = "etcd"
+	LocalSecretStorageFile = "file"
+)
+
+// SecretBackend is an interface to issue certificates by CAs and to read
+// and write secrets such as SSH private keys.
+type SecretBackend interface {
+	// IssueCertificate issues a certificate by the CA.
+	// roleOpts and certOpts are parameters for a role and for issuing
+	// a certificate of Vault PKI secrets engine.
+	IssueCertificate(ctx context.Context, ca, role string, onetime bool, roleOpts, certOpts map[string]interface{}) (crt, key string, err error)
+
+	// RevokeCertificate revokes a certificate issued by the CA.
+	// serial is the serial number in colon-separated hex.
+	RevokeCertificate(ctx context.Context, ca, serial string) error
+
+	// ReadSecret reads the secret at the path such as SSHSecret.
+	// If the secret does not exist, this returns nil.
+	ReadSecret(ctx context.Context, path string) (map[string]interface{}, error)
+
+	// WriteSecret replaces the secret at the path.
+	WriteSecret(ctx context.Context, path string, data map[string]interface{}) error
+}
+
+// ErrLocalSecretBackend is returned for features that require Vault
+// while the local secret backend is used.
+var ErrLocalSecretBackend = errors.New("not supported by the local secret backend")
+
+// IsLocalSecretBackend returns true if b is the local secret backend.
+func IsLocalSecretBackend(b SecretBackend) bool {
+	_, ok := b.(*localSecretBackend)
+	return ok
+}
+
+// LocalSecretBackendEnabled returns true if CKE server uses the local secret backend.
+func LocalSecretBackendEnabled() bool {
+	return IsLocalSecretBackend(getSecretBackend())
+}
+
+// ValidateSecretBackend validates the cluster configuration against b.
+// The KMS encryption provider needs the transit secrets engine of Vault.
+func ValidateSecretBackend(b SecretBackend, c *Cluster) error {
+	if IsLocalSecretBackend(b) && c.Options.APIServer.Encryption.GetProvider() == EncryptionProviderKMS {
+		return errors.New("kms encryption provider is " + ErrLocalSecretBackend.Error())
+	}
+	return nil
+}
+
+var secretBackend atomic.Value
+
+// SetSecretBackend sets the SecretBackend for CKE server.
+// If not set, the Vault client connected by ConnectVault is used.
+func SetSecretBackend(b SecretBackend) {
+	secretBackend.Store(b)
+}
+
+func getSecretBackend() SecretBackend {
+	v := secretBackend.Load()
+	if v == nil {
+		return NewVaultSecretBackend(getVaultClient)
+	}
+	return v.(SecretBackend)
+}
+
+// SecretBackendConfig is the configuration of SecretBackend in the config file.
+type SecretBackendConfig struct {
+	// Type is either "vault" or "local".  Default is "vault".
+	Type string `json:"type,omitempty"`
+
+	// Storage is where the local backend stores data, either "etcd" or "file".
+	// Default is "etcd".
+	Storage string `json:"storage,omitempty"`
+
+	// Dir is the directory to store data for "file" storage.
+	Dir string `json:"dir,omitempty"`
+
+	// KeyFile is the path of the file containing a base64-encoded 256-bit key
+	// to encrypt data of the local backend.
+	KeyFile string `json:"key-file,omitempty"`
+}
+
+// GetType returns the type of SecretBackend.
+func (c SecretBackendConfig) GetType() string {
+	if len(c.Type) == 0 {
+		return SecretBackendVault
+	}
+	return c.Type
+}
+
+// GetStorage returns the storage of the local backend.
+func (c SecretBackendConfig) GetStorage() string {
+	if len(c.Storage) == 0 {
+		return LocalSecretStorageEtcd
+	}
+	return c.Storage
+}
+
+// Validate validates the configuration.
+func (c SecretBackendConfig) Validate() error {
+	switch c.GetType() {
+	case SecretBackendVault:
+		if len(c.Storage) > 0 || len(c.Dir) > 0 || len(c.KeyFile) > 0 {
+			return errors.New("storage, dir, and key-file are only for local secret backend")
+		}
+		return nil
+	case SecretBackendLocal:
+	default:
+		return errors.New("unknown secret backend: " + c.Type)
+	}
+
+	if len(c.KeyFile) == 0 {
+		return errors.New("key-file is required for local secret backend")
+	}
+	switch c.GetStorage() {
+	case LocalSecretStorageEtcd:
+		if len(c.Dir) > 0 {
+			return errors.New("dir is only for file storage")
+		}
+	case LocalSecretStorageFile:
+		if !filepath.IsAbs(c.Dir) {
+			return errors.New("dir must be an absolute path for file storage")
+		}
+	default:
+		return errors.New("unknown storage of local secret backend: " + c.Storage)
+	}
+	return nil
+}
+
+// NewSecretBackend creates SecretBackend from the configuration.
+// etcd is used by the local backend with "etcd" storage.
+// vc returns the Vault client for the Vault backend.
+func NewSecretBackend(c SecretBackendConfig, etcd *clientv3.Client, vc func() (*vault.Client, error)) (SecretBackend, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	if c.GetType() == SecretBackendVault {
+		return NewVaultSecretBackend(vc), nil
+	}
+
+	var store localSecretStore
+	if c.GetStorage() == LocalSecretStorageFile {
+		store = fileSecretStore{dir: c.Dir}
+	} else {
+		store = etcdSecretStore{Storage{etcd}}
+	}
+	return newLocalSecretBackend(store, c.KeyFile)
+}
@@ -0,0 +1,431 @@
+package cke
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	localCATTL          = 876000 * time.Hour
+	localDefaultCertTTL = 87600 * time.Hour
+	localKeyBits        = 2048
+
+	// localBackdate is the duration to backdate certificates like Vault
+	// to tolerate clock skew.
+	localBackdate = 30 * time.Second
+
+	localDefaultKeyUsage = "DigitalSignature,KeyAgreement,KeyEncipherment"
+)
+
+var localKeyUsages = map[string]x509.KeyUsage{
+	"DigitalSignature":  x509.KeyUsageDigitalSignature,
+	"ContentCommitment": x509.KeyUsageContentCommitment,
+	"KeyEncipherment":   x509.KeyUsageKeyEncipherment,
+	"DataEncipherment":  x509.KeyUsageDataEncipherment,
+	"KeyAgreement":      x509.KeyUsageKeyAgreement,
+	"CertSign":          x509.KeyUsageCertSign,
+	"CRLSign":           x509.KeyUsageCRLSign,
+}
+
+// localSecretStore stores encrypted data of the local secret backend.
+type localSecretStore interface {
+	// get returns ErrNotFound if the data does not exist.
+	get(ctx context.Context, name string) ([]byte, error)
+	put(ctx context.Context, name string, data []byte) error
+}
+
+type etcdSecretStore struct {
+	storage Storage
+}
+
+func (s etcdSecretStore) get(ctx context.Context, name string) ([]byte, error) {
+	return s.storage.GetLocalSecret(ctx, name)
+}
+
+func (s etcdSecretStore) put(ctx context.Context, name string, data []byte) error {
+	return s.storage.PutLocalSecret(ctx, name, data)
+}
+
+type fileSecretStore struct {
+	dir string
+}
+
+func (s fileSecretStore) get(ctx context.Context, name string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (s fileSecretStore) put(ctx context.Context, name string, data []byte) error {
+	p := filepath.Join(s.dir, filepath.FromSlash(name))
+	err := os.MkdirAll(filepath.Dir(p), 0700)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(p), ".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// localCA is a key pair of a CA stored in the local secret backend.
+type localCA struct {
+	Certificate string `json:"certificate"`
+	PrivateKey  string `json:"private_key"`
+}
+
+// localSecretBackend is SecretBackend without Vault.
+// CAs and secrets are encrypted with AES-GCM and stored in localSecretStore.
+type localSecretBackend struct {
+	store localSecretStore
+	aead  cipher.AEAD
+}
+
+func newLocalSecretBackend(store localSecretStore, keyFile string) (SecretBackend, error) {
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("key-file must contain a base64-encoded 256-bit key")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &localSecretBackend{store: store, aead: aead}, nil
+}
+
+func localCAName(ca string) string {
+	return "ca/" + ca
+}
+
+func localSecretName(p string) string {
+	return "secret/" + p
+}
+
+// load decrypts the data and unmarshals it into v.
+// The name is authenticated together so that data cannot be swapped.
+func (b *localSecretBackend) load(ctx context.Context, name string, v interface{}) error {
+	data, err := b.store.get(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	ns := b.aead.NonceSize()
+	if len(data) < ns {
+		return errors.New("broken data in local secret backend: " + name)
+	}
+	plain, err := b.aead.Open(nil, data[:ns], data[ns:], []byte(name))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %s: %w", name, err)
+	}
+	return json.Unmarshal(plain, v)
+}
+
+func (b *localSecretBackend) save(ctx context.Context, name string, v interface{}) error {
+	plain, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, b.aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+	return b.store.put(ctx, name, b.aead.Seal(nonce, nonce, plain, []byte(name)))
+}
+
+func (b *localSecretBackend) IssueCertificate(ctx context.Context, ca, role string, onetime bool, roleOpts, certOpts map[string]interface{}) (crt, key string, err error) {
+	var lca localCA
+	err = b.load(ctx, localCAName(ca), &lca)
+	if err == ErrNotFound {
+		return "", "", errors.New("no CA in local secret backend: " + ca)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	caCert, caKey, err := parseLocalCA(&lca)
+	if err != nil {
+		return "", "", err
+	}
+
+	tmpl, err := localCertificateTemplate(roleOpts, certOpts, time.Now())
+	if err != nil {
+		return "", "", err
+	}
+	priv, err := rsa.GenerateKey(rand.Reader, localKeyBits)
+	if err != nil {
+		return "", "", err
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &priv.PublicKey, caKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	crt = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	key = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)}))
+	return crt, key, nil
+}
+
+// RevokeCertificate does nothing because the local secret backend does not
+// publish CRLs.  Revoked certificates are denied by the denylist of CKE.
+func (b *localSecretBackend) RevokeCertificate(ctx context.Context, ca, serial string) error {
+	return nil
+}
+
+func (b *localSecretBackend) ReadSecret(ctx context.Context, p string) (map[string]interface{}, error) {
+	var data map[string]interface{}
+	err := b.load(ctx, localSecretName(p), &data)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (b *localSecretBackend) WriteSecret(ctx context.Context, p string, data map[string]interface{}) error {
+	return b.save(ctx, localSecretName(p), data)
+}
+
+// GenerateLocalCA generates a self-signed CA in the local secret backend
+// and returns the CA certificate in PEM format.
+// If the CA already exists, this returns the existing certificate.
+func GenerateLocalCA(ctx context.Context, b SecretBackend, ca, commonName string) (string, error) {
+	lb, ok := b.(*localSecretBackend)
+	if !ok {
+		return "", errors.New("secret backend is not local")
+	}
+
+	var lca localCA
+	err := lb.load(ctx, localCAName(ca), &lca)
+	if err == nil {
+		return lca.Certificate, nil
+	}
+	if err != ErrNotFound {
+		return "", err
+	}
+
+	serial, err := newSerialNumber()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-localBackdate),
+		NotAfter:              now.Add(localCATTL),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	priv, err := rsa.GenerateKey(rand.Reader, localKeyBits)
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		return "", err
+	}
+
+	lca = localCA{
+		Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})),
+	}
+	err = lb.save(ctx, localCAName(ca), &lca)
+	if err != nil {
+		return "", err
+	}
+	return lca.Certificate, nil
+}
+
+func parseLocalCA(lca *localCA) (*x509.Certificate, crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(lca.Certificate))
+	if block == nil {
+		return nil, nil, errors.New("invalid CA certificate in local secret backend")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	block, _ = pem.Decode([]byte(lca.PrivateKey))
+	if block == nil {
+		return nil, nil, errors.New("invalid CA private key in local secret backend")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return cert, key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return cert, key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return cert, key, nil
+	case *ecdsa.PrivateKey:
+		return cert, key, nil
+	}
+	return nil, nil, errors.New("unsupported CA private key in local secret backend")
+}
+
+func newSerialNumber() (*big.Int, error) {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	// Keep the serial number positive and non-zero.
+	buf[0] = buf[0]&0x7f | 0x01
+	return new(big.Int).SetBytes(buf), nil
+}
+
+// localCertificateTemplate creates a certificate template from parameters
+// for a role and for issuing a certificate of Vault PKI secrets engine.
+func localCertificateTemplate(roleOpts, certOpts map[string]interface{}, now time.Time) (*x509.Certificate, error) {
+	opt := func(m map[string]interface{}, name string) string {
+		v, _ := m[name].(string)
+		return v
+	}
+
+	ttl := localDefaultCertTTL
+	if s := opt(roleOpts, "ttl"); len(s) > 0 {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, err
+		}
+		ttl = d
+	}
+	if s := opt(certOpts, "ttl"); len(s) > 0 {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, err
+		}
+		ttl = d
+	}
+	if s := opt(roleOpts, "max_ttl"); len(s) > 0 {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, err
+		}
+		if ttl > d {
+			ttl = d
+		}
+	}
+
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	cn := opt(certOpts, "common_name")
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   cn,
+			Organization: splitLocalList(opt(roleOpts, "organization")),
+		},
+		NotBefore:             now.Add(-localBackdate),
+		NotAfter:              now.Add(ttl),
+		BasicConstraintsValid: true,
+		DNSNames:              splitLocalList(opt(certOpts, "alt_names")),
+	}
+
+	for _, s := range splitLocalList(opt(certOpts, "ip_sans")) {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, errors.New("invalid IP address: " + s)
+		}
+		tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+	}
+	if len(cn) > 0 && opt(certOpts, "exclude_cn_from_sans") != "true" {
+		if ip := net.ParseIP(cn); ip != nil {
+			tmpl.IPAddresses = append([]net.IP{ip}, tmpl.IPAddresses...)
+		} else {
+			tmpl.DNSNames = append([]string{cn}, tmpl.DNSNames...)
+		}
+	}
+
+	usages := opt(roleOpts, "key_usage")
+	if len(usages) == 0 {
+		usages = localDefaultKeyUsage
+	}
+	for _, u := range splitLocalList(usages) {
+		ku, ok := localKeyUsages[u]
+		if !ok {
+			return nil, errors.New("unknown key usage: " + u)
+		}
+		tmpl.KeyUsage |= ku
+	}
+
+	if opt(roleOpts, "server_flag") != "false" {
+		tmpl.ExtKeyUsage = append(tmpl.ExtKeyUsage, x509.ExtKeyUsageServerAuth)
+	}
+	if opt(roleOpts, "client_flag") != "false" {
+		tmpl.ExtKeyUsage = append(tmpl.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
+	}
+	return tmpl, nil
+}
+
+func splitLocalList(s string) []string {
+	var l []string
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if len(v) > 0 {
+			l = append(l, v)
+		}
+	}
+	return l
+}
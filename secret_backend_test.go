@@ -0,0 +1,215 @@
+package cke
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSecretBackendConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name  string
+		cfg   SecretBackendConfig
+		valid bool
+	}{
+		{"default", SecretBackendConfig{}, true},
+		{"vault", SecretBackendConfig{Type: SecretBackendVault}, true},
+		{"vault with key-file", SecretBackendConfig{Type: SecretBackendVault, KeyFile: "/etc/cke/secret.key"}, false},
+		{"unknown type", SecretBackendConfig{Type: "foo"}, false},
+		{"local etcd", SecretBackendConfig{Type: SecretBackendLocal, KeyFile: "/etc/cke/secret.key"}, true},
+		{"local without key-file", SecretBackendConfig{Type: SecretBackendLocal}, false},
+		{"local etcd with dir", SecretBackendConfig{Type: SecretBackendLocal, KeyFile: "/etc/cke/secret.key", Dir: "/var/lib/cke"}, false},
+		{
+			"local file",
+			SecretBackendConfig{Type: SecretBackendLocal, Storage: LocalSecretStorageFile, KeyFile: "/etc/cke/secret.key", Dir: "/var/lib/cke"},
+			true,
+		},
+		{
+			"local file with relative dir",
+			SecretBackendConfig{Type: SecretBackendLocal, Storage: LocalSecretStorageFile, KeyFile: "/etc/cke/secret.key", Dir: "cke"},
+			false,
+		},
+		{"unknown storage", SecretBackendConfig{Type: SecretBackendLocal, Storage: "foo", KeyFile: "/etc/cke/secret.key"}, false},
+	}
+
+	for _, tc := range testCases {
+		err := tc.cfg.Validate()
+		if tc.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%s: should be invalid", tc.name)
+		}
+	}
+}
+
+func writeTestSecretKey(t *testing.T, p string) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(p, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalSecretBackend(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "secret.key")
+	writeTestSecretKey(t, keyFile)
+
+	cfg := SecretBackendConfig{
+		Type:    SecretBackendLocal,
+		Storage: LocalSecretStorageFile,
+		Dir:     filepath.Join(dir, "data"),
+		KeyFile: keyFile,
+	}
+	b, err := NewSecretBackend(cfg, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	caPEM, err := GenerateLocalCA(ctx, b, CAServer, "server CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPEM2, err := GenerateLocalCA(ctx, b, CAServer, "server CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caPEM != caPEM2 {
+		t.Error("existing CA should be returned")
+	}
+
+	_, _, err = b.IssueCertificate(ctx, CAKubernetes, "system", false, nil, map[string]interface{}{"common_name": "foo"})
+	if err == nil {
+		t.Error("issuing by a missing CA should fail")
+	}
+
+	roleOpts := map[string]interface{}{
+		"ttl":          "87600h",
+		"max_ttl":      "24h",
+		"organization": "system:masters",
+		"client_flag":  "false",
+	}
+	certOpts := map[string]interface{}{
+		"common_name": "server",
+		"alt_names":   "localhost,server.example.com",
+		"ip_sans":     "127.0.0.1,10.0.0.1",
+	}
+	crt, key, err := b.IssueCertificate(ctx, CAServer, "system", false, roleOpts, certOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode([]byte(crt))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ = pem.Decode([]byte(caPEM))
+	caCert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.CheckSignatureFrom(caCert); err != nil {
+		t.Error("certificate is not signed by the CA:", err)
+	}
+	if cert.Subject.CommonName != "server" {
+		t.Error("wrong common name:", cert.Subject.CommonName)
+	}
+	if len(cert.Subject.Organization) != 1 || cert.Subject.Organization[0] != "system:masters" {
+		t.Error("wrong organization:", cert.Subject.Organization)
+	}
+	if len(cert.DNSNames) != 3 || cert.DNSNames[0] != "server" {
+		t.Error("wrong DNS names:", cert.DNSNames)
+	}
+	if len(cert.IPAddresses) != 2 {
+		t.Error("wrong IP addresses:", cert.IPAddresses)
+	}
+	if d := cert.NotAfter.Sub(time.Now()); d > 24*time.Hour || d < 23*time.Hour {
+		t.Error("TTL should be capped by max_ttl:", cert.NotAfter)
+	}
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageServerAuth {
+		t.Error("wrong ext key usage:", cert.ExtKeyUsage)
+	}
+	if block, _ := pem.Decode([]byte(key)); block == nil {
+		t.Error("no private key")
+	}
+
+	sec, err := b.ReadSecret(ctx, SSHSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sec != nil {
+		t.Error("missing secret should be nil:", sec)
+	}
+	err = b.WriteSecret(ctx, SSHSecret, map[string]interface{}{"": "privkey"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec, err = b.ReadSecret(ctx, SSHSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sec[""] != "privkey" {
+		t.Error("wrong secret:", sec)
+	}
+
+	writeTestSecretKey(t, keyFile)
+	b2, err := NewSecretBackend(cfg, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b2.ReadSecret(ctx, SSHSecret)
+	if err == nil {
+		t.Error("decryption with a wrong key should fail")
+	}
+}
+
+func TestValidateSecretBackend(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "secret.key")
+	writeTestSecretKey(t, keyFile)
+
+	local, err := NewSecretBackend(SecretBackendConfig{Type: SecretBackendLocal, KeyFile: keyFile}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault := NewVaultSecretBackend(nil)
+
+	if !IsLocalSecretBackend(local) {
+		t.Error("local backend should be detected")
+	}
+	if IsLocalSecretBackend(vault) {
+		t.Error("vault backend should not be detected as local")
+	}
+
+	cluster := NewCluster()
+	if err := ValidateSecretBackend(local, cluster); err != nil {
+		t.Error("unexpected error:", err)
+	}
+
+	cluster.Options.APIServer.Encryption.Provider = EncryptionProviderKMS
+	if err := ValidateSecretBackend(vault, cluster); err != nil {
+		t.Error("unexpected error:", err)
+	}
+	if err := ValidateSecretBackend(local, cluster); err == nil {
+		t.Error("kms should be rejected with the local backend")
+	}
+}
@@ -0,0 +1,83 @@
+package cke
+
+import (
+	"context"
+	"path"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+type vaultSecretBackend struct {
+	client func() (*vault.Client, error)
+}
+
+// NewVaultSecretBackend creates SecretBackend using Vault.
+// client is called for each operation to get the current Vault client.
+func NewVaultSecretBackend(client func() (*vault.Client, error)) SecretBackend {
+	return vaultSecretBackend{client: client}
+}
+
+func (b vaultSecretBackend) IssueCertificate(ctx context.Context, ca, role string, onetime bool, roleOpts, certOpts map[string]interface{}) (crt, key string, err error) {
+	pkiKey := VaultPKIKey(ca)
+	client, err := b.client()
+	if err != nil {
+		return "", "", err
+	}
+
+	err = addRole(client, pkiKey, role, roleOpts)
+	if err != nil {
+		return "", "", err
+	}
+
+	secret, err := client.Logical().Write(path.Join(pkiKey, "issue", role), certOpts)
+	if onetime {
+		// the role is deleted even if issuing fails.
+		if err2 := deleteRole(client, pkiKey, role); err == nil && err2 != nil {
+			err = err2
+		}
+	}
+	if err != nil {
+		return "", "", err
+	}
+	crt = secret.Data["certificate"].(string)
+	key = secret.Data["private_key"].(string)
+	return crt, key, nil
+}
+
+func (b vaultSecretBackend) RevokeCertificate(ctx context.Context, ca, serial string) error {
+	client, err := b.client()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Logical().Write(path.Join(VaultPKIKey(ca), "revoke"), map[string]interface{}{
+		"serial_number": serial,
+	})
+	return err
+}
+
+func (b vaultSecretBackend) ReadSecret(ctx context.Context, p string) (map[string]interface{}, error) {
+	client, err := b.client()
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := client.Logical().Read(p)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, nil
+	}
+	return secret.Data, nil
+}
+
+func (b vaultSecretBackend) WriteSecret(ctx context.Context, p string, data map[string]interface{}) error {
+	client, err := b.client()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Logical().Write(p, data)
+	return err
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/log"
+	authorizationv1 "k8s.io/api/authorization/v1"
+)
+
+// maxAuthorizeRequestSize is the maximum size of SubjectAccessReview requests.
+const maxAuthorizeRequestSize = 1 << 20
+
+// handleAuthorize serves the authorization webhook for kube-apiserver.
+// It denies requests authenticated by revoked user certificates and
+// has no opinion on other requests.
+func (s Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	review := new(authorizationv1.SubjectAccessReview)
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAuthorizeRequestSize)).Decode(review)
+	if err != nil {
+		renderError(r.Context(), w, BadRequest(err.Error()))
+		return
+	}
+
+	ctxWithTimeout, cancel := context.WithTimeout(r.Context(), s.Timeout)
+	defer cancel()
+
+	status, err := s.authorize(ctxWithTimeout, review.Spec)
+	if err != nil {
+		renderError(r.Context(), w, InternalServerError(err))
+		return
+	}
+
+	renderJSON(w, authorizationv1.SubjectAccessReview{
+		TypeMeta: review.TypeMeta,
+		Status:   status,
+	}, http.StatusOK)
+}
+
+func (s Server) authorize(ctx context.Context, spec authorizationv1.SubjectAccessReviewSpec) (authorizationv1.SubjectAccessReviewStatus, error) {
+	storage := cke.Storage{Client: s.EtcdClient}
+	for _, g := range spec.Groups {
+		if !strings.HasPrefix(g, cke.CredentialGroupPrefix) {
+			continue
+		}
+
+		id := g[len(cke.CredentialGroupPrefix):]
+		revoked, err := storage.IsCredentialRevoked(ctx, id)
+		if err != nil {
+			return authorizationv1.SubjectAccessReviewStatus{}, err
+		}
+		if revoked {
+			log.Info("denied request with revoked certificate", map[string]interface{}{
+				"user":          spec.User,
+				"credential_id": id,
+			})
+			return authorizationv1.SubjectAccessReviewStatus{
+				Denied: true,
+				Reason: "the client certificate has been revoked",
+			}, nil
+		}
+	}
+
+	return authorizationv1.SubjectAccessReviewStatus{}, nil
+}
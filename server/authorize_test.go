@@ -0,0 +1,85 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/cke"
+	authorizationv1 "k8s.io/api/authorization/v1"
+)
+
+func TestAuthorize(t *testing.T) {
+	client := newEtcdClient(t)
+	defer client.Close()
+	storage := cke.Storage{Client: client}
+	ctx := context.Background()
+
+	revoked := &cke.IssuedCertificate{
+		Serial:       "01:02",
+		Kind:         cke.IssuedCertKubernetes,
+		User:         "alice",
+		CredentialID: "revoked",
+	}
+	err := storage.RevokeIssuedCertificate(ctx, revoked, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := Server{EtcdClient: client, Timeout: 5 * time.Second}
+
+	testCases := []struct {
+		name   string
+		groups []string
+		denied bool
+	}{
+		{"revoked", []string{"system:authenticated", cke.CredentialGroupPrefix + "revoked"}, true},
+		{"valid", []string{"system:authenticated", cke.CredentialGroupPrefix + "valid"}, false},
+		{"no credential", []string{"system:authenticated"}, false},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			review := authorizationv1.SubjectAccessReview{
+				Spec: authorizationv1.SubjectAccessReviewSpec{
+					User:   "alice",
+					Groups: tt.groups,
+				},
+			}
+			data, err := json.Marshal(review)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/authorize", bytes.NewReader(data)))
+			if w.Code != http.StatusOK {
+				t.Fatal("unexpected status code:", w.Code)
+			}
+
+			result := new(authorizationv1.SubjectAccessReview)
+			err = json.NewDecoder(w.Body).Decode(result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Status.Denied != tt.denied {
+				t.Error("unexpected result:", result.Status)
+			}
+			if result.Status.Allowed {
+				t.Error("authorizer must not allow requests:", result.Status)
+			}
+		})
+	}
+
+	t.Run("bad request", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/authorize", bytes.NewReader([]byte("{"))))
+		if w.Code != http.StatusBadRequest {
+			t.Error("unexpected status code:", w.Code)
+		}
+	})
+}
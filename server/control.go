@@ -236,6 +236,16 @@ func (c Controller) runOnce(ctx context.Context, leaderKey string, tick <-chan t
 	}
 	defer inf.Close()
 
+	err = cke.ValidateSecretBackend(inf.Secrets(), cluster)
+	if err != nil {
+		log.Error("invalid cluster configuration", map[string]interface{}{
+			log.FnError: err,
+		})
+		wait = true
+		// lint:ignore nilerr  Try again.
+		return nil
+	}
+
 	// prepare service account signing
 	_, err = storage.GetServiceAccountCert(ctx)
 	switch err {
@@ -263,6 +273,10 @@ func (c Controller) runOnce(ctx context.Context, leaderKey string, tick <-chan t
 		return nil
 	}
 
+	metrics.UpdateEtcdBackup(status.EtcdBackup.LastSuccess)
+
+	c.updateCertificateStatuses(ctx, inf, leaderKey, cluster, status)
+
 	constraints, err := inf.Storage().GetConstraints(ctx)
 	if err != nil {
 		return err
@@ -409,11 +423,42 @@ func runOp(ctx context.Context, op cke.Operator, leaderKey string, storage cke.S
 	return nil
 }
 
+// updateCertificateStatuses updates the certificate inventory and metrics.
+// Errors are only logged so that they never block operations.
+func (c Controller) updateCertificateStatuses(ctx context.Context, inf cke.Infrastructure, leaderKey string, cluster *cke.Cluster, status *cke.ClusterStatus) {
+	certs, err := getCertificateStatuses(ctx, inf, cluster, status)
+	if err != nil {
+		log.Warn("failed to get certificate statuses", map[string]interface{}{
+			log.FnError: err,
+		})
+		return
+	}
+	metrics.UpdateCertificateExpiry(certs)
+
+	err = inf.Storage().UpdateCertificateStatuses(ctx, leaderKey, certs)
+	if err != nil {
+		log.Warn("failed to store certificate statuses", map[string]interface{}{
+			log.FnError: err,
+		})
+	}
+}
+
 func (c Controller) runTidyExpiredCertificates(ctx context.Context) error {
 	storage := cke.Storage{
 		Client: c.session.Client(),
 	}
 
+	if err := storage.DeleteExpiredIssuedCertificates(ctx, time.Now()); err != nil {
+		log.Warn("failed to delete records of expired certificates", map[string]interface{}{
+			log.FnError: err,
+		})
+	}
+
+	// The local secret backend has no CRLs to tidy.
+	if cke.LocalSecretBackendEnabled() {
+		return nil
+	}
+
 	cfg, err := storage.GetVaultConfig(ctx)
 	if err != nil {
 		log.Warn("failed to get vault config. skip tidy", map[string]interface{}{
@@ -3,7 +3,9 @@ package server
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/cybozu-go/cke"
 	"github.com/cybozu-go/cke/op"
@@ -45,8 +47,71 @@ func (c Controller) GetClusterStatus(ctx context.Context, cluster *cke.Cluster,
 	cs.ConfigVersion = version
 	cs.NodeStatuses = statuses
 
+	restore, err := inf.Storage().GetEtcdRestoreRequest(ctx)
+	switch err {
+	case nil:
+		cs.EtcdRestore = restore
+	case cke.ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	upgrade, err := inf.Storage().GetKubernetesUpgrade(ctx)
+	switch err {
+	case nil:
+		cs.KubernetesUpgrade = upgrade
+	case cke.ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	rotation, err := inf.Storage().GetEncryptionKeyRotation(ctx)
+	switch err {
+	case nil:
+		cs.EncryptionKeyRotation = rotation
+	case cke.ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	caRotation, err := inf.Storage().GetCARotation(ctx)
+	switch err {
+	case nil:
+		cs.CARotation = caRotation
+	case cke.ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	saKeyRotation, err := inf.Storage().GetServiceAccountKeyRotation(ctx)
+	switch err {
+	case nil:
+		cs.ServiceAccountKeyRotation = saKeyRotation
+	case cke.ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	encrypted, err := inf.Storage().GetEncryptedResources(ctx)
+	switch err {
+	case nil:
+		cs.EncryptedResources = encrypted
+	case cke.ErrNotFound:
+		cs.EncryptedResources = cke.DefaultEncryptedResources()
+	default:
+		return nil, err
+	}
+
+	if cluster.EtcdBackup.Enabled {
+		bs, err := getEtcdBackupStatus(ctx, inf)
+		if err != nil {
+			return nil, err
+		}
+		cs.EtcdBackup = bs
+	}
+
 	var etcdRunning bool
-	for _, n := range cke.ControlPlanes(cluster.Nodes) {
+	for _, n := range cke.EtcdNodes(cluster.Nodes) {
 		ns := statuses[n.Address]
 		if ns.Etcd.HasData {
 			etcdRunning = true
@@ -88,5 +153,113 @@ func (c Controller) GetClusterStatus(ctx context.Context, cluster *cke.Cluster,
 	}
 	cs.Kubernetes = kcs
 
+	if r := cs.ServiceAccountKeyRotation; r != nil && r.Stage == cke.ServiceAccountKeyStageGrace {
+		tokens, err := op.GetOldServiceAccountTokens(ctx, inf, livingMaster, r.OldCert)
+		if err != nil {
+			log.Error("failed to get service account tokens", map[string]interface{}{
+				log.FnError: err,
+			})
+			return nil, err
+		}
+		cs.Kubernetes.OldServiceAccountTokens = tokens
+	}
+
 	return cs, nil
 }
+
+func getEtcdBackupStatus(ctx context.Context, inf cke.Infrastructure) (cke.EtcdBackupStatus, error) {
+	var bs cke.EtcdBackupStatus
+
+	lastTry, err := inf.Storage().GetEtcdBackupLastTry(ctx)
+	if err != nil {
+		return bs, err
+	}
+	bs.LastTry = lastTry
+
+	entries, err := inf.Storage().GetEtcdBackupEntries(ctx)
+	if err != nil {
+		return bs, err
+	}
+	if len(entries) > 0 {
+		bs.LastSuccess = entries[len(entries)-1].Timestamp
+	}
+	return bs, nil
+}
+
+func getCertificateStatuses(ctx context.Context, inf cke.Infrastructure, cluster *cke.Cluster, cs *cke.ClusterStatus) ([]cke.CertificateStatus, error) {
+	certs := nodeCertificateStatuses(cluster, cs)
+
+	add := func(component, ca, data string) {
+		expiry, err := cke.CertificateExpiry([]byte(data))
+		if err != nil {
+			log.Warn("failed to get certificate expiry", map[string]interface{}{
+				log.FnError: err,
+				"component": component,
+				"ca":        ca,
+			})
+			return
+		}
+		certs = append(certs, cke.CertificateStatus{Component: component, CA: ca, Expiry: expiry})
+	}
+
+	storage := inf.Storage()
+	saCert, err := storage.GetServiceAccountCert(ctx)
+	switch err {
+	case nil:
+		add(cke.CertComponentServiceAccount, cke.CAKubernetes, saCert)
+	case cke.ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	for _, ca := range cke.CAKeys {
+		caCert, err := storage.GetCACertificate(ctx, ca)
+		switch err {
+		case nil:
+			add(cke.CertComponentCA, ca, caCert)
+		case cke.ErrNotFound:
+		default:
+			return nil, err
+		}
+	}
+
+	return certs, nil
+}
+
+// nodeCertificateStatuses returns the expiry of certificates on nodes and in Secrets.
+// Certificates of unknown expiry are excluded.
+func nodeCertificateStatuses(cluster *cke.Cluster, cs *cke.ClusterStatus) []cke.CertificateStatus {
+	var certs []cke.CertificateStatus
+	add := func(node, component, ca string, expiry time.Time) {
+		if expiry.IsZero() {
+			return
+		}
+		certs = append(certs, cke.CertificateStatus{Node: node, Component: component, CA: ca, Expiry: expiry})
+	}
+
+	for _, n := range cluster.Nodes {
+		ns := cs.NodeStatuses[n.Address]
+		if ns == nil {
+			continue
+		}
+		add(n.Address, op.EtcdContainerName, cke.CAServer, ns.Etcd.CertExpiry)
+		add(n.Address, op.EtcdContainerName, cke.CAEtcdPeer, ns.Etcd.PeerCertExpiry)
+		add(n.Address, op.KubeAPIServerContainerName, cke.CAKubernetes, ns.APIServer.CertExpiry)
+		add(n.Address, op.KubeAPIServerContainerName, cke.CAEtcdClient, ns.APIServer.EtcdClientCertExpiry)
+		add(n.Address, op.KubeControllerManagerContainerName, cke.CAKubernetes, ns.ControllerManager.CertExpiry)
+		add(n.Address, op.KubeSchedulerContainerName, cke.CAKubernetes, ns.Scheduler.CertExpiry)
+		add(n.Address, op.KubeProxyContainerName, cke.CAKubernetes, ns.Proxy.CertExpiry)
+		add(n.Address, op.KubeletContainerName, cke.CAKubernetes, ns.Kubelet.CertExpiry)
+	}
+
+	keys := make([]string, 0, len(cs.Kubernetes.ResourceStatuses))
+	for key := range cs.Kubernetes.ResourceStatuses {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		add("", key, cke.CAWebhook, cs.Kubernetes.ResourceStatuses[key].CertExpiry)
+	}
+
+	return certs
+}
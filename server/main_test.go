@@ -0,0 +1,74 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/cybozu-go/etcdutil"
+	"github.com/cybozu-go/log"
+)
+
+const (
+	etcdClientURL = "http://localhost:14379"
+	etcdPeerURL   = "http://localhost:14380"
+)
+
+func testMain(m *testing.M) int {
+	circleci := os.Getenv("CIRCLECI") == "true"
+	if circleci {
+		code := m.Run()
+		os.Exit(code)
+	}
+
+	etcdPath, err := ioutil.TempDir("", "cke-server-test")
+	if err != nil {
+		log.ErrorExit(err)
+	}
+
+	cmd := exec.Command("etcd",
+		"--data-dir", etcdPath,
+		"--initial-cluster", "default="+etcdPeerURL,
+		"--listen-peer-urls", etcdPeerURL,
+		"--initial-advertise-peer-urls", etcdPeerURL,
+		"--listen-client-urls", etcdClientURL,
+		"--advertise-client-urls", etcdClientURL)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Start()
+	if err != nil {
+		log.ErrorExit(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		os.RemoveAll(etcdPath)
+	}()
+
+	return m.Run()
+}
+
+func TestMain(m *testing.M) {
+	os.Exit(testMain(m))
+}
+
+func newEtcdClient(t *testing.T) *clientv3.Client {
+	var clientURL string
+	circleci := os.Getenv("CIRCLECI") == "true"
+	if circleci {
+		clientURL = "http://localhost:2379"
+	} else {
+		clientURL = etcdClientURL
+	}
+
+	cfg := etcdutil.NewConfig(t.Name() + "/")
+	cfg.Endpoints = []string{clientURL}
+
+	etcd, err := etcdutil.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return etcd
+}
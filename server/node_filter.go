@@ -3,6 +3,7 @@ package server
 import (
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/coreos/etcd/etcdserver/etcdserverpb"
 	"github.com/cybozu-go/cke"
@@ -21,6 +22,9 @@ type NodeFilter struct {
 	nodeMap    map[string]*cke.Node
 	addressMap map[string]string
 	cp         []*cke.Node
+	etcd       []*cke.Node
+	k8s        []*cke.Node
+	now        time.Time
 }
 
 // NewNodeFilter creates and initializes NodeFilter.
@@ -28,6 +32,8 @@ func NewNodeFilter(cluster *cke.Cluster, status *cke.ClusterStatus) *NodeFilter
 	nodeMap := make(map[string]*cke.Node)
 	addressMap := make(map[string]string)
 	cp := make([]*cke.Node, 0, 5)
+	etcd := make([]*cke.Node, 0, 5)
+	k8s := make([]*cke.Node, 0, len(cluster.Nodes))
 
 	for _, n := range cluster.Nodes {
 		nodeMap[n.Address] = n
@@ -38,6 +44,12 @@ func NewNodeFilter(cluster *cke.Cluster, status *cke.ClusterStatus) *NodeFilter
 		if n.ControlPlane {
 			cp = append(cp, n)
 		}
+		if n.IsEtcdMember() {
+			etcd = append(etcd, n)
+		}
+		if n.IsKubernetesNode() {
+			k8s = append(k8s, n)
+		}
 	}
 
 	return &NodeFilter{
@@ -46,6 +58,9 @@ func NewNodeFilter(cluster *cke.Cluster, status *cke.ClusterStatus) *NodeFilter
 		nodeMap:    nodeMap,
 		addressMap: addressMap,
 		cp:         cp,
+		etcd:       etcd,
+		k8s:        k8s,
+		now:        time.Now(),
 	}
 }
 
@@ -64,6 +79,16 @@ func (nf *NodeFilter) ControlPlane() []*cke.Node {
 	return nf.cp
 }
 
+// EtcdNodes returns nodes that run etcd.
+func (nf *NodeFilter) EtcdNodes() []*cke.Node {
+	return nf.etcd
+}
+
+// KubernetesNodes returns nodes that run kubelet and kube-proxy.
+func (nf *NodeFilter) KubernetesNodes() []*cke.Node {
+	return nf.k8s
+}
+
 // RiversStoppedNodes returns nodes that are not running rivers.
 func (nf *NodeFilter) RiversStoppedNodes() (nodes []*cke.Node) {
 	for _, n := range nf.cluster.Nodes {
@@ -107,7 +132,7 @@ func (nf *NodeFilter) EtcdRiversStoppedNodes() (cps []*cke.Node) {
 
 // EtcdRiversOutdatedNodes returns nodes that are running rivers with outdated image or params.
 func (nf *NodeFilter) EtcdRiversOutdatedNodes() (cps []*cke.Node) {
-	currentBuiltIn := op.RiversParams(nf.cp, op.EtcdRiversUpstreamPort, op.EtcdRiversListenPort)
+	currentBuiltIn := op.RiversParams(nf.etcd, op.EtcdRiversUpstreamPort, op.EtcdRiversListenPort)
 	currentExtra := nf.cluster.Options.EtcdRivers
 
 	for _, n := range nf.ControlPlane() {
@@ -128,7 +153,7 @@ func (nf *NodeFilter) EtcdRiversOutdatedNodes() (cps []*cke.Node) {
 
 // EtcdBootstrapped returns true if etcd cluster has been bootstrapped.
 func (nf *NodeFilter) EtcdBootstrapped() bool {
-	for _, n := range nf.cp {
+	for _, n := range nf.etcd {
 		if nf.nodeStatus(n).Etcd.HasData {
 			return true
 		}
@@ -145,9 +170,61 @@ func (nf *NodeFilter) EtcdIsGood() bool {
 	return len(st.Members) == len(st.InSyncMembers)
 }
 
-// EtcdStoppedMembers returns control plane nodes that are not running etcd.
+// EtcdIsReachable returns true if all etcd nodes are connected via SSH
+// and all members respond and are in sync.  Unlike EtcdIsGood, this does
+// not require the cluster to accept writes, e.g. while NOSPACE alarm is raised.
+func (nf *NodeFilter) EtcdIsReachable() bool {
+	if len(nf.SSHNotConnectedNodes(nf.etcd, true, true)) > 0 {
+		return false
+	}
+	st := nf.status.Etcd
+	if len(st.Members) == 0 {
+		return false
+	}
+	for name := range st.Members {
+		if !st.InSyncMembers[name] {
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	// etcdDefragRatio is the ratio of unused space in the database of an etcd member
+	// to trigger defragmentation.
+	etcdDefragRatio = 0.5
+	// etcdDefragMinBytes is the minimum size of unused space to trigger defragmentation.
+	etcdDefragMinBytes = 100 << 20
+)
+
+// EtcdFragmentedMembers returns etcd nodes whose etcd database
+// is fragmented more than the threshold.
+func (nf *NodeFilter) EtcdFragmentedMembers() (nodes []*cke.Node) {
+	st := nf.status.Etcd
+	for _, n := range nf.etcd {
+		size, ok := st.DBSize[n.Address]
+		if !ok || size == 0 {
+			continue
+		}
+		inUse, ok := st.DBSizeInUse[n.Address]
+		if !ok {
+			continue
+		}
+		unused := size - inUse
+		if unused < etcdDefragMinBytes {
+			continue
+		}
+		if float64(unused)/float64(size) < etcdDefragRatio {
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// EtcdStoppedMembers returns etcd nodes that are not running etcd.
 func (nf *NodeFilter) EtcdStoppedMembers() (nodes []*cke.Node) {
-	for _, n := range nf.cp {
+	for _, n := range nf.etcd {
 		if _, ok := nf.status.Etcd.Members[n.Address]; !ok && nf.status.Etcd.IsHealthy {
 			continue
 		}
@@ -178,16 +255,16 @@ func (nf *NodeFilter) EtcdNonClusterMembers(healthy bool) (members []*etcdserver
 	return members
 }
 
-// EtcdNonCPMembers returns nodes and IDs of etcd members running on
-// non control plane nodes.  The order of ids matches the order of nodes.
-func (nf *NodeFilter) EtcdNonCPMembers(healthy bool) (nodes []*cke.Node, ids []uint64) {
+// EtcdNonEtcdNodeMembers returns nodes and IDs of etcd members running on
+// nodes that are not designated to run etcd.  The order of ids matches the order of nodes.
+func (nf *NodeFilter) EtcdNonEtcdNodeMembers(healthy bool) (nodes []*cke.Node, ids []uint64) {
 	st := nf.status.Etcd
 	for k, v := range st.Members {
 		n, ok := nf.nodeMap[k]
 		if !ok {
 			continue
 		}
-		if n.ControlPlane {
+		if n.IsEtcdMember() {
 			continue
 		}
 		if st.InSyncMembers[k] != healthy {
@@ -201,6 +278,7 @@ func (nf *NodeFilter) EtcdNonCPMembers(healthy bool) (nodes []*cke.Node, ids []u
 
 // EtcdUnstartedMembers returns nodes that are added to members but not really
 // joined to the etcd cluster.  Such members need to be re-added.
+// Learners that are not running are also returned.
 func (nf *NodeFilter) EtcdUnstartedMembers() (nodes []*cke.Node) {
 	st := nf.status.Etcd
 	for k, v := range st.Members {
@@ -208,10 +286,33 @@ func (nf *NodeFilter) EtcdUnstartedMembers() (nodes []*cke.Node) {
 		if !ok {
 			continue
 		}
-		if !n.ControlPlane {
+		if !n.IsEtcdMember() {
+			continue
+		}
+		if len(v.Name) > 0 && !(st.Learners[k] && !nf.nodeStatus(n).Etcd.Running) {
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// EtcdLearnerMembers returns etcd nodes that are running as learners.
+// This happens when CKE was interrupted before promoting added members.
+func (nf *NodeFilter) EtcdLearnerMembers() (nodes []*cke.Node) {
+	st := nf.status.Etcd
+	for k, v := range st.Members {
+		n, ok := nf.nodeMap[k]
+		if !ok {
+			continue
+		}
+		if !n.IsEtcdMember() {
 			continue
 		}
-		if len(v.Name) > 0 {
+		if !st.Learners[k] || len(v.Name) == 0 {
+			continue
+		}
+		if !nf.nodeStatus(n).Etcd.Running {
 			continue
 		}
 		nodes = append(nodes, n)
@@ -219,10 +320,10 @@ func (nf *NodeFilter) EtcdUnstartedMembers() (nodes []*cke.Node) {
 	return nodes
 }
 
-// EtcdNewMembers returns control plane nodes to be added to the etcd cluster.
+// EtcdNewMembers returns etcd nodes to be added to the etcd cluster.
 func (nf *NodeFilter) EtcdNewMembers() (nodes []*cke.Node) {
 	members := nf.status.Etcd.Members
-	for _, n := range nf.cp {
+	for _, n := range nf.etcd {
 		if _, ok := members[n.Address]; ok {
 			continue
 		}
@@ -263,7 +364,7 @@ func etcdEqualParams(running, current cke.ServiceParams) bool {
 func (nf *NodeFilter) EtcdOutdatedMembers() (nodes []*cke.Node) {
 	currentExtra := nf.cluster.Options.Etcd.ServiceParams
 
-	for _, n := range nf.cp {
+	for _, n := range nf.etcd {
 		st := nf.nodeStatus(n).Etcd
 		if !st.Running {
 			continue
@@ -281,6 +382,47 @@ func (nf *NodeFilter) EtcdOutdatedMembers() (nodes []*cke.Node) {
 	return nodes
 }
 
+// KMSPluginStoppedNodes returns control plane nodes that are not running the KMS plugin.
+// This returns nothing unless the KMS encryption provider is enabled.
+func (nf *NodeFilter) KMSPluginStoppedNodes() (nodes []*cke.Node) {
+	if nf.cluster.Options.APIServer.Encryption.GetProvider() != cke.EncryptionProviderKMS {
+		return nil
+	}
+
+	for _, n := range nf.cp {
+		if !nf.nodeStatus(n).KMSPlugin.Running {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// KMSPluginOutdatedNodes returns control plane nodes that are running the KMS plugin with outdated image or params.
+func (nf *NodeFilter) KMSPluginOutdatedNodes() (nodes []*cke.Node) {
+	encryption := nf.cluster.Options.APIServer.Encryption
+	if encryption.GetProvider() != cke.EncryptionProviderKMS {
+		return nil
+	}
+
+	currentBuiltIn := k8s.KMSPluginParams(encryption)
+	currentExtra := nf.cluster.Options.KMSPlugin
+
+	for _, n := range nf.cp {
+		st := nf.nodeStatus(n).KMSPlugin
+		switch {
+		case !st.Running:
+			// stopped nodes are excluded
+		case cke.ToolsImage.Name() != st.Image:
+			fallthrough
+		case !currentBuiltIn.Equal(st.BuiltInParams):
+			fallthrough
+		case !currentExtra.Equal(st.ExtraParams):
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
 // APIServerStoppedNodes returns control plane nodes that are not running API server.
 func (nf *NodeFilter) APIServerStoppedNodes() (nodes []*cke.Node) {
 	for _, n := range nf.cp {
@@ -297,14 +439,23 @@ func (nf *NodeFilter) APIServerOutdatedNodes() (nodes []*cke.Node) {
 
 	for _, n := range nf.cp {
 		st := nf.nodeStatus(n).APIServer
-		currentBuiltIn := k8s.APIServerParams(nf.ControlPlane(), n.Address, nf.cluster.ServiceSubnet,
-			currentExtra.AuditLogEnabled, currentExtra.AuditLogPolicy)
+		currentBuiltIn, err := k8s.APIServerParams(nf.ControlPlane(), n.Address, nf.cluster.ServiceSubnet, currentExtra, nf.cluster.FeatureGates, false)
+		// The additional service account key is added and removed node by node
+		// by service account key rotation, so both are considered up to date.
+		rotationBuiltIn, _ := k8s.APIServerParams(nf.ControlPlane(), n.Address, nf.cluster.ServiceSubnet, currentExtra, nf.cluster.FeatureGates, true)
 		switch {
 		case !st.Running:
 			// stopped nodes are excluded
+		case err != nil:
+			// restart to report the error from kube-apiserver-restart
+			log.Error("failed to build kube-apiserver params", map[string]interface{}{
+				"node":      n.Nodename(),
+				log.FnError: err,
+			})
+			nodes = append(nodes, n)
 		case cke.KubernetesImage.Name() != st.Image:
 			fallthrough
-		case !currentBuiltIn.Equal(st.BuiltInParams):
+		case !currentBuiltIn.Equal(st.BuiltInParams) && !rotationBuiltIn.Equal(st.BuiltInParams):
 			fallthrough
 		case !currentExtra.Equal(st.ExtraParams):
 			nodes = append(nodes, n)
@@ -325,7 +476,8 @@ func (nf *NodeFilter) ControllerManagerStoppedNodes() (nodes []*cke.Node) {
 
 // ControllerManagerOutdatedNodes returns nodes that are running controller manager with outdated image or params.
 func (nf *NodeFilter) ControllerManagerOutdatedNodes() (nodes []*cke.Node) {
-	currentBuiltIn := k8s.ControllerManagerParams(nf.cluster.Name, nf.cluster.ServiceSubnet)
+	currentConfig := k8s.GenerateControllerManagerConfiguration(nf.cluster.Options.ControllerManager)
+	currentBuiltIn := k8s.ControllerManagerParams(nf.cluster.Name, nf.cluster.ServiceSubnet, currentConfig, nf.cluster.FeatureGates)
 	currentExtra := nf.cluster.Options.ControllerManager
 
 	for _, n := range nf.cp {
@@ -337,7 +489,7 @@ func (nf *NodeFilter) ControllerManagerOutdatedNodes() (nodes []*cke.Node) {
 			fallthrough
 		case !currentBuiltIn.Equal(st.BuiltInParams):
 			fallthrough
-		case !currentExtra.Equal(st.ExtraParams):
+		case !currentExtra.ServiceParams.Equal(st.ExtraParams):
 			nodes = append(nodes, n)
 		}
 	}
@@ -355,7 +507,7 @@ func (nf *NodeFilter) SchedulerStoppedNodes() (nodes []*cke.Node) {
 }
 
 func (nf *NodeFilter) SchedulerOutdatedNodes(params cke.SchedulerParams) (nodes []*cke.Node) {
-	currentBuiltIn := k8s.SchedulerParams()
+	currentBuiltIn := k8s.SchedulerParams(nf.cluster.FeatureGates)
 	currentExtra := nf.cluster.Options.Scheduler
 	currentConfig := k8s.GenerateSchedulerConfiguration(params)
 
@@ -394,7 +546,7 @@ func (nf *NodeFilter) SchedulerOutdatedNodes(params cke.SchedulerParams) (nodes
 
 // KubeletStoppedNodes returns nodes that are not running kubelet.
 func (nf *NodeFilter) KubeletStoppedNodes() (nodes []*cke.Node) {
-	for _, n := range nf.cluster.Nodes {
+	for _, n := range nf.k8s {
 		if !nf.nodeStatus(n).Kubelet.Running {
 			nodes = append(nodes, n)
 		}
@@ -422,9 +574,9 @@ func (nf *NodeFilter) KubeletOutdatedNodes() (nodes []*cke.Node) {
 	currentOpts := nf.cluster.Options.Kubelet
 	currentExtra := nf.cluster.Options.Kubelet.ServiceParams
 
-	for _, n := range nf.cluster.Nodes {
+	for _, n := range nf.k8s {
 		st := nf.nodeStatus(n).Kubelet
-		currentConfig := k8s.GenerateKubeletConfiguration(currentOpts, n.Address, st.Config)
+		currentConfig := k8s.GenerateKubeletConfiguration(currentOpts, nf.cluster.FeatureGates, n.Address, st.Config)
 		currentBuiltIn := k8s.KubeletServiceParams(n, currentOpts)
 		runningConfig := st.Config
 
@@ -461,7 +613,7 @@ func (nf *NodeFilter) KubeletOutdatedNodes() (nodes []*cke.Node) {
 
 // KubeletUnrecognizedNodes returns nodes of which kubelet is still running but not recognized by k8s.
 func (nf *NodeFilter) KubeletUnrecognizedNodes() (nodes []*cke.Node) {
-	for _, n := range nf.cluster.Nodes {
+	for _, n := range nf.k8s {
 		if nf.nodeStatus(n).Kubelet.Running && !nf.existsNodeResource(n.Nodename()) {
 			nodes = append(nodes, n)
 		}
@@ -486,7 +638,8 @@ func (nf *NodeFilter) NonClusterNodes() (nodes []*corev1.Node) {
 		if !ok {
 			address = member.Name
 		}
-		if nf.InCluster(address) {
+		// Dedicated etcd nodes are not Kubernetes nodes.
+		if n, ok := nf.nodeMap[address]; ok && n.IsKubernetesNode() {
 			continue
 		}
 		member := member
@@ -546,7 +699,7 @@ func kubeletEqualParams(running, current cke.ServiceParams) bool {
 
 // ProxyStoppedNodes returns nodes that are not running kube-proxy.
 func (nf *NodeFilter) ProxyStoppedNodes() (nodes []*cke.Node) {
-	for _, n := range nf.cluster.Nodes {
+	for _, n := range nf.k8s {
 		if !nf.nodeStatus(n).Proxy.Running {
 			nodes = append(nodes, n)
 		}
@@ -556,11 +709,12 @@ func (nf *NodeFilter) ProxyStoppedNodes() (nodes []*cke.Node) {
 
 // ProxyOutdatedNodes returns nodes that are running kube-proxy with outdated image or params.
 func (nf *NodeFilter) ProxyOutdatedNodes() (nodes []*cke.Node) {
+	currentBuiltIn := k8s.ProxyParams()
 	currentExtra := nf.cluster.Options.Proxy
 
-	for _, n := range nf.cluster.Nodes {
+	for _, n := range nf.k8s {
 		st := nf.nodeStatus(n).Proxy
-		currentBuiltIn := k8s.ProxyParams(n, string(currentExtra.GetMode()))
+		currentConfig := k8s.GenerateProxyConfiguration(currentExtra, nf.cluster.FeatureGates, n)
 		switch {
 		case !st.Running:
 			// stopped nodes are excluded
@@ -568,7 +722,127 @@ func (nf *NodeFilter) ProxyOutdatedNodes() (nodes []*cke.Node) {
 			fallthrough
 		case !currentBuiltIn.Equal(st.BuiltInParams):
 			fallthrough
-		case !currentExtra.Equal(st.ExtraParams):
+		case !currentExtra.ServiceParams.Equal(st.ExtraParams):
+			fallthrough
+		case !reflect.DeepEqual(currentConfig, st.Config):
+			log.Debug("kube-proxy outdated", map[string]interface{}{
+				"node":   n.Nodename(),
+				"config": currentConfig,
+				"diff":   cmp.Diff(currentConfig, st.Config),
+			})
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// APIServerCertRenewalNodes returns nodes that are running API server with a certificate to be renewed.
+func (nf *NodeFilter) APIServerCertRenewalNodes() []*cke.Node {
+	return nf.certRenewalNodes(nf.cp, nf.cluster.Options.APIServer.CertificateParams, func(st *cke.NodeStatus) (bool, time.Time) {
+		return st.APIServer.Running, st.APIServer.CertExpiry
+	})
+}
+
+// ControllerManagerCertRenewalNodes returns nodes that are running controller manager with a certificate to be renewed.
+func (nf *NodeFilter) ControllerManagerCertRenewalNodes() []*cke.Node {
+	return nf.certRenewalNodes(nf.cp, nf.cluster.Options.ControllerManager.CertificateParams, func(st *cke.NodeStatus) (bool, time.Time) {
+		return st.ControllerManager.Running, st.ControllerManager.CertExpiry
+	})
+}
+
+// SchedulerCertRenewalNodes returns nodes that are running kube-scheduler with a certificate to be renewed.
+func (nf *NodeFilter) SchedulerCertRenewalNodes() []*cke.Node {
+	return nf.certRenewalNodes(nf.cp, nf.cluster.Options.Scheduler.CertificateParams, func(st *cke.NodeStatus) (bool, time.Time) {
+		return st.Scheduler.Running, st.Scheduler.CertExpiry
+	})
+}
+
+// KubeletCertRenewalNodes returns nodes that are running kubelet with a certificate to be renewed.
+func (nf *NodeFilter) KubeletCertRenewalNodes() []*cke.Node {
+	return nf.certRenewalNodes(nf.k8s, nf.cluster.Options.Kubelet.CertificateParams, func(st *cke.NodeStatus) (bool, time.Time) {
+		return st.Kubelet.Running, st.Kubelet.CertExpiry
+	})
+}
+
+// ProxyCertRenewalNodes returns nodes that are running kube-proxy with a certificate to be renewed.
+func (nf *NodeFilter) ProxyCertRenewalNodes() []*cke.Node {
+	return nf.certRenewalNodes(nf.k8s, nf.cluster.Options.Proxy.CertificateParams, func(st *cke.NodeStatus) (bool, time.Time) {
+		return st.Proxy.Running, st.Proxy.CertExpiry
+	})
+}
+
+// certRenewalNodes returns nodes running a component of which certificate needs renewal.
+// certStatus returns whether the component is running and the expiry of its certificate.
+func (nf *NodeFilter) certRenewalNodes(candidates []*cke.Node, params cke.CertificateParams, certStatus func(*cke.NodeStatus) (bool, time.Time)) (nodes []*cke.Node) {
+	for _, n := range candidates {
+		running, expiry := certStatus(nf.nodeStatus(n))
+		if running && params.NeedsRenewal(expiry, nf.now) {
+			log.Debug("certificate needs renewal", map[string]interface{}{
+				"node":        n.Nodename(),
+				"cert_expiry": expiry,
+			})
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// RunningKubernetesImages returns the images of running Kubernetes components.
+// controlPlanes are images of kube-apiserver, kube-controller-manager, and kube-scheduler.
+// nodes are images of kubelet and kube-proxy.
+func (nf *NodeFilter) RunningKubernetesImages() (controlPlanes, nodes []string) {
+	add := func(images []string, running bool, image string) []string {
+		if !running {
+			return images
+		}
+		return append(images, image)
+	}
+
+	for _, n := range nf.cp {
+		st := nf.nodeStatus(n)
+		controlPlanes = add(controlPlanes, st.APIServer.Running, st.APIServer.Image)
+		controlPlanes = add(controlPlanes, st.ControllerManager.Running, st.ControllerManager.Image)
+		controlPlanes = add(controlPlanes, st.Scheduler.Running, st.Scheduler.Image)
+	}
+	for _, n := range nf.k8s {
+		st := nf.nodeStatus(n)
+		nodes = add(nodes, st.Kubelet.Running, st.Kubelet.Image)
+		nodes = add(nodes, st.Proxy.Running, st.Proxy.Image)
+	}
+	return controlPlanes, nodes
+}
+
+// UnhealthyRunningAPIServerNodes returns nodes which run API servers that are not healthy.
+func (nf *NodeFilter) UnhealthyRunningAPIServerNodes() (nodes []*cke.Node) {
+	for _, n := range nf.ControlPlane() {
+		st := nf.nodeStatus(n).APIServer
+		if st.Running && !st.IsHealthy {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// UpgradedNotReadyNodes returns nodes running the current version of kubelet
+// whose Node resources are not ready.
+func (nf *NodeFilter) UpgradedNotReadyNodes() (nodes []*cke.Node) {
+	ready := make(map[string]bool)
+	for _, kn := range nf.status.Kubernetes.Nodes {
+		ready[kn.Name] = false
+		for _, cond := range kn.Status.Conditions {
+			if cond.Type == corev1.NodeReady && cond.Status == corev1.ConditionTrue {
+				ready[kn.Name] = true
+				break
+			}
+		}
+	}
+
+	for _, n := range nf.k8s {
+		st := nf.nodeStatus(n).Kubelet
+		if !st.Running || st.Image != cke.KubernetesImage.Name() {
+			continue
+		}
+		if r, ok := ready[n.Nodename()]; ok && !r {
 			nodes = append(nodes, n)
 		}
 	}
@@ -632,7 +906,7 @@ func (nf *NodeFilter) OutdatedAttrsNodes() (nodes []*corev1.Node) {
 		curNodes[cn.Name] = cn.DeepCopy()
 	}
 
-	for _, n := range nf.cluster.Nodes {
+	for _, n := range nf.k8s {
 		current, ok := curNodes[n.Nodename()]
 		if !ok {
 			log.Warn("missing Kubernetes Node resource", map[string]interface{}{
@@ -806,12 +1080,14 @@ func (nf *NodeFilter) CordonedNodes() (nodes []*corev1.Node) {
 }
 
 // SSHNotConnectedNodes returns nodes that are not connected via SSH out of targets.
+// Etcd nodes are treated as control plane nodes.
 func (nf *NodeFilter) SSHNotConnectedNodes(targets []*cke.Node, includeControlPlane, includeWorker bool) (nodes []*cke.Node) {
 	for _, n := range targets {
-		if n.ControlPlane && !includeControlPlane {
+		cp := n.ControlPlane || n.IsEtcdMember()
+		if cp && !includeControlPlane {
 			continue
 		}
-		if !n.ControlPlane && !includeWorker {
+		if !cp && !includeWorker {
 			continue
 		}
 		if nf.status.NodeStatuses[n.Address].SSHConnected {
@@ -823,13 +1099,15 @@ func (nf *NodeFilter) SSHNotConnectedNodes(targets []*cke.Node, includeControlPl
 	return nodes
 }
 
-// SSHConnectedNodes returns nodes that are connected via SSH out of targets
+// SSHConnectedNodes returns nodes that are connected via SSH out of targets.
+// Etcd nodes are treated as control plane nodes.
 func (nf *NodeFilter) SSHConnectedNodes(targets []*cke.Node, includeControlPlane, includeWorker bool) (nodes []*cke.Node) {
 	for _, n := range targets {
-		if n.ControlPlane && !includeControlPlane {
+		cp := n.ControlPlane || n.IsEtcdMember()
+		if cp && !includeControlPlane {
 			continue
 		}
-		if !n.ControlPlane && !includeWorker {
+		if !cp && !includeWorker {
 			continue
 		}
 		if !nf.status.NodeStatuses[n.Address].SSHConnected {
@@ -29,6 +29,8 @@ func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		s.handleVersion(w, r)
 	} else if r.Method == http.MethodGet && r.URL.Path == "/health" {
 		s.handleHealth(w, r)
+	} else if r.Method == http.MethodPost && r.URL.Path == "/authorize" {
+		s.handleAuthorize(w, r)
 	} else {
 		renderError(r.Context(), w, APIErrNotFound)
 	}
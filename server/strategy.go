@@ -1,6 +1,10 @@
 package server
 
 import (
+	"errors"
+	"strings"
+	"time"
+
 	"github.com/cybozu-go/cke"
 	"github.com/cybozu-go/cke/op"
 	"github.com/cybozu-go/cke/op/clusterdns"
@@ -25,7 +29,7 @@ func DecideOps(c *cke.Cluster, cs *cke.ClusterStatus, constraints *cke.Constrain
 			log.Warn("cannot upgrade for unreachable nodes", nil)
 			return nil, cke.PhaseUpgradeAborted
 		}
-		return []cke.Operator{op.UpgradeOp(cs.ConfigVersion, nf.ControlPlane())}, cke.PhaseUpgrade
+		return []cke.Operator{op.UpgradeOp(cs.ConfigVersion, nf.EtcdNodes())}, cke.PhaseUpgrade
 	}
 
 	// 1. Run or restart rivers.  This guarantees:
@@ -35,54 +39,117 @@ func DecideOps(c *cke.Cluster, cs *cke.ClusterStatus, constraints *cke.Constrain
 		return ops, cke.PhaseRivers
 	}
 
-	// 2. Bootstrap etcd cluster, if not yet.
+	// 2. Restore etcd cluster from a backup, if requested.
+	if cs.EtcdRestore != nil {
+		// Etcd restore operations run only when all CPs are SSH reachable
+		if len(nf.SSHNotConnectedNodes(nf.cluster.Nodes, true, false)) > 0 {
+			log.Warn("cannot restore etcd for unreachable nodes", nil)
+			return nil, cke.PhaseEtcdRestoreAborted
+		}
+		return []cke.Operator{etcd.RestoreOp(nf.EtcdNodes(), nf.ControlPlane(), c.Options.Etcd, c.EtcdBackup, cs.EtcdRestore)}, cke.PhaseEtcdRestore
+	}
+
+	// 3. Bootstrap etcd cluster, if not yet.
 	if !nf.EtcdBootstrapped() {
 		// Etcd boot operations run only when all CPs are SSH reachable
 		if len(nf.SSHNotConnectedNodes(nf.cluster.Nodes, true, false)) > 0 {
 			log.Warn("cannot bootstrap etcd for unreachable nodes", nil)
 			return nil, cke.PhaseEtcdBootAborted
 		}
-		return []cke.Operator{etcd.BootOp(nf.ControlPlane(), c.Options.Etcd)}, cke.PhaseEtcdBoot
+		return []cke.Operator{etcd.BootOp(nf.EtcdNodes(), c.Options.Etcd)}, cke.PhaseEtcdBoot
 	}
 
-	// 3. Start etcd containers.
+	// 4. Start etcd containers.
 	if nodes := nf.SSHConnectedNodes(nf.EtcdStoppedMembers(), true, false); len(nodes) > 0 {
 		return []cke.Operator{etcd.StartOp(nodes, c.Options.Etcd)}, cke.PhaseEtcdStart
 	}
 
-	// 4. Wait for etcd cluster to become ready
+	// 5. Recover etcd cluster from NOSPACE alarm, only when all members are reachable.
+	// Defragmentation and disarming would fail for unreachable members.
+	if cs.Etcd.HasNoSpaceAlarm() {
+		if nf.EtcdIsReachable() {
+			return []cke.Operator{etcd.RecoverNoSpaceOp(nf.EtcdNodes())}, cke.PhaseEtcdMaintain
+		}
+		log.Warn("cannot recover etcd from NOSPACE alarm for unreachable members", nil)
+	}
+
+	// 6. Wait for etcd cluster to become ready
 	if !cs.Etcd.IsHealthy {
-		return []cke.Operator{etcd.WaitClusterOp(nf.ControlPlane())}, cke.PhaseEtcdWait
+		return []cke.Operator{etcd.WaitClusterOp(nf.EtcdNodes())}, cke.PhaseEtcdWait
 	}
 
-	// 5. Run or restart kubernetes components.
-	if ops := k8sOps(c, nf, cs); len(ops) > 0 {
+	// 7. Upgrade Kubernetes components in the order of the version skew policy.
+	// If the upgrade cannot proceed, stopped components and etcd are repaired
+	// in 8 and 9 so that the upgrade can be resumed.
+	upgradeOps, upgradePhase := k8sUpgradeOps(c, cs, constraints, nf)
+	if len(upgradeOps) > 0 {
+		return upgradeOps, upgradePhase
+	}
+	// Outdated components are left to k8sUpgradeOps while the upgrade is pending,
+	// even if it cannot be started.  Only a recorded upgrade blocks other operations.
+	pending := len(upgradePhase) > 0
+	upgrading := cs.KubernetesUpgrade != nil
+
+	// 8. Run or restart kubernetes components.
+	if ops := k8sOps(c, nf, cs, pending); len(ops) > 0 {
 		return ops, cke.PhaseK8sStart
 	}
 
-	// 6. Maintain etcd cluster, only when all CPs are SSH reachable.
+	// 9. Maintain etcd cluster, only when all CPs are SSH reachable.
 	if len(nf.SSHNotConnectedNodes(nf.cluster.Nodes, true, false)) == 0 {
 		if o := etcdMaintOp(c, nf); o != nil {
 			return []cke.Operator{o}, cke.PhaseEtcdMaintain
 		}
 	}
 
-	// 7. Maintain k8s resources.
+	// Other operations wait for the upgrade to proceed.
+	if upgrading {
+		return nil, upgradePhase
+	}
+
+	// 10. Rotate the encryption key for encrypted resources, if requested.
+	// Rotations restart Kubernetes components, so they are deferred while
+	// the upgrade is pending.
+	if ops := encryptionKeyOps(c, cs, nf); len(ops) > 0 && !pending {
+		return ops, cke.PhaseEncryptionKey
+	}
+
+	// 11. Rewrite objects of resources whose encryption has been changed.
+	if ops := encryptionRewriteOps(c, cs, nf); len(ops) > 0 {
+		return ops, cke.PhaseEncryptionRewrite
+	}
+
+	// 12. Rotate a CA, if requested.
+	if ops := caRotationOps(c, cs, resources, nf); len(ops) > 0 && !pending {
+		return ops, cke.PhaseCARotation
+	}
+
+	// 13. Rotate the key to sign service account tokens, if requested.
+	if ops := serviceAccountKeyOps(c, cs, nf, time.Now()); len(ops) > 0 && !pending {
+		return ops, cke.PhaseServiceAccountKey
+	}
+
+	// 14. Maintain k8s resources.
 	if ops := k8sMaintOps(c, cs, resources, nf); len(ops) > 0 {
 		return ops, cke.PhaseK8sMaintain
 	}
 
-	// 8. Stop and delete control plane services running on non control plane nodes.
+	// 15. Stop and delete control plane services running on non control plane nodes.
 	if ops := cleanOps(c, nf); len(ops) > 0 {
 		return ops, cke.PhaseStopCP
 	}
 
-	// 9. Uncordon nodes if nodes are cordoned by CKE.
+	// 16. Uncordon nodes if nodes are cordoned by CKE.
 	if o := rebootUncordonOp(nf); o != nil {
 		return []cke.Operator{o}, cke.PhaseUncordonNodes
 	}
 
-	// 10. Reboot nodes if reboot request has been arrived to the reboot queue, and the number of unreachable nodes is less than a threshold.
+	// 17. Take an etcd backup if the last one is older than the interval.
+	if o := etcdBackupOp(c, cs, nf, time.Now()); o != nil {
+		return []cke.Operator{o}, cke.PhaseEtcdBackup
+	}
+
+	// 18. Reboot nodes if reboot request has been arrived to the reboot queue, and the number of unreachable nodes is less than a threshold.
 	if ops := rebootOps(c, reboot, nf); len(ops) > 0 {
 		if len(nf.SSHNotConnectedNodes(nf.cluster.Nodes, true, true)) > constraints.RebootMaximumUnreachable {
 			log.Warn("cannot reboot nodes because too many nodes are unreachable", nil)
@@ -95,9 +162,38 @@ func DecideOps(c *cke.Cluster, cs *cke.ClusterStatus, constraints *cke.Constrain
 		return ops, cke.PhaseRebootNodes
 	}
 
+	// Report that the upgrade could not be started.
+	if pending {
+		return nil, upgradePhase
+	}
 	return nil, cke.PhaseCompleted
 }
 
+// etcdBackupRetryInterval is the minimum interval between failed backup attempts.
+const etcdBackupRetryInterval = 10 * time.Minute
+
+func etcdBackupOp(c *cke.Cluster, cs *cke.ClusterStatus, nf *NodeFilter, now time.Time) cke.Operator {
+	if !c.EtcdBackup.Enabled {
+		return nil
+	}
+	if !nf.EtcdIsGood() {
+		return nil
+	}
+
+	interval := c.EtcdBackup.GetInterval()
+	if now.Sub(cs.EtcdBackup.LastSuccess) < interval {
+		return nil
+	}
+	retry := etcdBackupRetryInterval
+	if interval < retry {
+		retry = interval
+	}
+	if now.Sub(cs.EtcdBackup.LastTry) < retry {
+		return nil
+	}
+	return etcd.BackupOp(nf.EtcdNodes(), c.EtcdBackup)
+}
+
 func riversOps(c *cke.Cluster, nf *NodeFilter) (ops []cke.Operator) {
 	if nodes := nf.SSHConnectedNodes(nf.RiversStoppedNodes(), true, true); len(nodes) > 0 {
 		ops = append(ops, op.RiversBootOp(nodes, nf.ControlPlane(), c.Options.Rivers, op.RiversContainerName, op.RiversUpstreamPort, op.RiversListenPort))
@@ -106,68 +202,630 @@ func riversOps(c *cke.Cluster, nf *NodeFilter) (ops []cke.Operator) {
 		ops = append(ops, op.RiversRestartOp(nodes, nf.ControlPlane(), c.Options.Rivers, op.RiversContainerName, op.RiversUpstreamPort, op.RiversListenPort))
 	}
 	if nodes := nf.SSHConnectedNodes(nf.EtcdRiversStoppedNodes(), true, false); len(nodes) > 0 {
-		ops = append(ops, op.RiversBootOp(nodes, nf.ControlPlane(), c.Options.EtcdRivers, op.EtcdRiversContainerName, op.EtcdRiversUpstreamPort, op.EtcdRiversListenPort))
+		ops = append(ops, op.RiversBootOp(nodes, nf.EtcdNodes(), c.Options.EtcdRivers, op.EtcdRiversContainerName, op.EtcdRiversUpstreamPort, op.EtcdRiversListenPort))
 	}
 	if nodes := nf.SSHConnectedNodes(nf.EtcdRiversOutdatedNodes(), true, false); len(nodes) > 0 {
-		ops = append(ops, op.RiversRestartOp(nodes, nf.ControlPlane(), c.Options.EtcdRivers, op.EtcdRiversContainerName, op.EtcdRiversUpstreamPort, op.EtcdRiversListenPort))
+		ops = append(ops, op.RiversRestartOp(nodes, nf.EtcdNodes(), c.Options.EtcdRivers, op.EtcdRiversContainerName, op.EtcdRiversUpstreamPort, op.EtcdRiversListenPort))
 	}
 	return ops
 }
 
-func k8sOps(c *cke.Cluster, nf *NodeFilter, cs *cke.ClusterStatus) (ops []cke.Operator) {
+// k8sOps returns operations to run or restart Kubernetes components.
+//
+// While an upgrade is pending or in progress, outdated components are left to
+// k8sUpgradeOps.  While an upgrade is in progress, stopped components are booted
+// with the new version only if the upgrade has reached their stage, so as not to
+// violate the version skew policy.
+func k8sOps(c *cke.Cluster, nf *NodeFilter, cs *cke.ClusterStatus, upgrading bool) (ops []cke.Operator) {
+	bootControllers, bootNodes := true, true
+	if u := cs.KubernetesUpgrade; u != nil {
+		bootControllers = u.Stage == cke.UpgradeStageControllers || u.Stage == cke.UpgradeStageNodes
+		bootNodes = u.Stage == cke.UpgradeStageNodes
+	}
+
 	// For cp nodes
-	if nodes := nf.SSHConnectedNodes(nf.APIServerStoppedNodes(), true, false); len(nodes) > 0 {
-		ops = append(ops, k8s.APIServerRestartOp(nodes, nf.ControlPlane(), c.ServiceSubnet, c.Options.APIServer))
+	// The KMS plugin must be running before API servers that use it.
+	if nodes := nf.SSHConnectedNodes(nf.KMSPluginStoppedNodes(), true, false); len(nodes) > 0 {
+		ops = append(ops, k8s.KMSPluginBootOp(nodes, c.Options.APIServer.Encryption, c.Options.KMSPlugin))
 	}
-	if nodes := nf.SSHConnectedNodes(nf.APIServerOutdatedNodes(), true, false); len(nodes) > 0 {
-		ops = append(ops, k8s.APIServerRestartOp(nodes, nf.ControlPlane(), c.ServiceSubnet, c.Options.APIServer))
+	if nodes := nf.SSHConnectedNodes(nf.KMSPluginOutdatedNodes(), true, false); len(nodes) > 0 {
+		ops = append(ops, k8s.KMSPluginRestartOp(nodes, c.Options.APIServer.Encryption, c.Options.KMSPlugin))
 	}
-	if nodes := nf.SSHConnectedNodes(nf.ControllerManagerStoppedNodes(), true, false); len(nodes) > 0 {
-		ops = append(ops, k8s.ControllerManagerBootOp(nodes, c.Name, c.ServiceSubnet, c.Options.ControllerManager))
+	if nodes := nf.SSHConnectedNodes(nf.APIServerStoppedNodes(), true, false); len(nodes) > 0 {
+		ops = append(ops, k8s.APIServerRestartOp(nodes, nf.ControlPlane(), c.ServiceSubnet, c.Options.APIServer, c.FeatureGates))
+	}
+	if nodes := restartNodes(nf.SSHConnectedNodes(nf.APIServerOutdatedNodes(), true, false),
+		nf.SSHConnectedNodes(nf.APIServerCertRenewalNodes(), true, false)); len(nodes) > 0 && !upgrading {
+		if err := encryptionConfigError(c, cs); err != nil {
+			log.Error("kube-apiserver is not restarted due to invalid encryption parameters", map[string]interface{}{
+				log.FnError: err,
+			})
+		} else {
+			ops = append(ops, k8s.APIServerRestartOp(nodes, nf.ControlPlane(), c.ServiceSubnet, c.Options.APIServer, c.FeatureGates))
+		}
 	}
-	if nodes := nf.SSHConnectedNodes(nf.ControllerManagerOutdatedNodes(), true, false); len(nodes) > 0 {
-		ops = append(ops, k8s.ControllerManagerRestartOp(nodes, c.Name, c.ServiceSubnet, c.Options.ControllerManager))
+	if nodes := nf.SSHConnectedNodes(nf.ControllerManagerStoppedNodes(), true, false); len(nodes) > 0 && bootControllers {
+		ops = append(ops, k8s.ControllerManagerBootOp(nodes, c.Name, c.ServiceSubnet, c.Options.ControllerManager, c.FeatureGates))
 	}
-	if nodes := nf.SSHConnectedNodes(nf.SchedulerStoppedNodes(), true, false); len(nodes) > 0 {
-		ops = append(ops, k8s.SchedulerBootOp(nodes, c.Name, c.Options.Scheduler))
+	if nodes := restartNodes(nf.SSHConnectedNodes(nf.ControllerManagerOutdatedNodes(), true, false),
+		nf.SSHConnectedNodes(nf.ControllerManagerCertRenewalNodes(), true, false)); len(nodes) > 0 && !upgrading {
+		ops = append(ops, k8s.ControllerManagerRestartOp(nodes, c.Name, c.ServiceSubnet, c.Options.ControllerManager, c.FeatureGates))
 	}
-	if nodes := nf.SSHConnectedNodes(nf.SchedulerOutdatedNodes(c.Options.Scheduler), true, false); len(nodes) > 0 {
-		ops = append(ops, k8s.SchedulerRestartOp(nodes, c.Name, c.Options.Scheduler))
+	if nodes := nf.SSHConnectedNodes(nf.SchedulerStoppedNodes(), true, false); len(nodes) > 0 && bootControllers {
+		ops = append(ops, k8s.SchedulerBootOp(nodes, c.Name, c.Options.Scheduler, c.FeatureGates))
+	}
+	if nodes := restartNodes(nf.SSHConnectedNodes(nf.SchedulerOutdatedNodes(c.Options.Scheduler), true, false),
+		nf.SSHConnectedNodes(nf.SchedulerCertRenewalNodes(), true, false)); len(nodes) > 0 && !upgrading {
+		ops = append(ops, k8s.SchedulerRestartOp(nodes, c.Name, c.Options.Scheduler, c.FeatureGates))
 	}
 
 	// For all nodes
 	apiServer := nf.HealthyAPIServer()
-	if nodes := nf.SSHConnectedNodes(nf.KubeletUnrecognizedNodes(), true, true); len(nodes) > 0 {
-		ops = append(ops, k8s.KubeletRestartOp(nodes, c.Name, c.Options.Kubelet, cs.NodeStatuses))
+	if nodes := nf.SSHConnectedNodes(nf.KubeletUnrecognizedNodes(), true, true); len(nodes) > 0 && bootNodes {
+		ops = append(ops, k8s.KubeletRestartOp(nodes, c.Name, c.Options.Kubelet, c.FeatureGates, cs.NodeStatuses))
 	}
-	if nodes := nf.SSHConnectedNodes(nf.KubeletStoppedNodes(), true, true); len(nodes) > 0 {
+	if nodes := nf.SSHConnectedNodes(nf.KubeletStoppedNodes(), true, true); len(nodes) > 0 && bootNodes {
 		ops = append(ops, k8s.KubeletBootOp(nodes, nf.KubeletStoppedRegisteredNodes(),
-			apiServer, c.Name, c.Options.Kubelet, cs.NodeStatuses))
+			apiServer, c.Name, c.Options.Kubelet, c.FeatureGates, cs.NodeStatuses))
 	}
-	if nodes := nf.SSHConnectedNodes(nf.KubeletOutdatedNodes(), true, true); len(nodes) > 0 {
-		ops = append(ops, k8s.KubeletRestartOp(nodes, c.Name, c.Options.Kubelet, cs.NodeStatuses))
+	if nodes := restartNodes(nf.SSHConnectedNodes(nf.KubeletOutdatedNodes(), true, true),
+		nf.SSHConnectedNodes(nf.KubeletCertRenewalNodes(), true, true)); len(nodes) > 0 && !upgrading {
+		ops = append(ops, k8s.KubeletRestartOp(nodes, c.Name, c.Options.Kubelet, c.FeatureGates, cs.NodeStatuses))
 	}
-	if nodes := nf.SSHConnectedNodes(nf.ProxyStoppedNodes(), true, true); len(nodes) > 0 {
-		ops = append(ops, k8s.KubeProxyBootOp(nodes, c.Name, c.Options.Proxy))
+	if nodes := nf.SSHConnectedNodes(nf.ProxyStoppedNodes(), true, true); len(nodes) > 0 && bootNodes {
+		ops = append(ops, k8s.KubeProxyBootOp(nodes, c.Name, c.Options.Proxy, c.FeatureGates))
 	}
-	if nodes := nf.SSHConnectedNodes(nf.ProxyOutdatedNodes(), true, true); len(nodes) > 0 {
-		ops = append(ops, k8s.KubeProxyRestartOp(nodes, c.Name, c.Options.Proxy))
+	if nodes := restartNodes(nf.SSHConnectedNodes(nf.ProxyOutdatedNodes(), true, true),
+		nf.SSHConnectedNodes(nf.ProxyCertRenewalNodes(), true, true)); len(nodes) > 0 && !upgrading {
+		ops = append(ops, k8s.KubeProxyRestartOp(nodes, c.Name, c.Options.Proxy, c.FeatureGates))
 	}
 	return ops
 }
 
+// restartNodes returns the nodes to restart a component.
+//
+// Outdated components are restarted all at once.  Otherwise, components
+// with certificates to be renewed are restarted one node at a time
+// because their certificates are likely to expire at the same time.
+func restartNodes(outdated, renewal []*cke.Node) []*cke.Node {
+	if len(outdated) > 0 {
+		return outdated
+	}
+	if len(renewal) > 0 {
+		return renewal[:1]
+	}
+	return nil
+}
+
+// k8sUpgradeOps returns operations to upgrade Kubernetes step by step.
+// The stages are executed in the following order, as required by the version skew policy:
+//
+// 1. etcd
+// 2. kube-apiserver, one node at a time
+// 3. kube-controller-manager and kube-scheduler
+// 4. kubelet and kube-proxy, in batches
+//
+// The current stage is recorded in the storage so that the upgrade can be
+// resumed after a leader change.  If the upgrade is not necessary, this returns
+// an empty phase.  If the upgrade is necessary but cannot proceed, this returns
+// no operations with a non-empty phase.
+func k8sUpgradeOps(c *cke.Cluster, cs *cke.ClusterStatus, constraints *cke.Constraints, nf *NodeFilter) ([]cke.Operator, cke.OperationPhase) {
+	u := cs.KubernetesUpgrade
+	if u != nil && u.To != cke.KubernetesImage.Name() {
+		// CKE has been updated during the upgrade.  Start over for the new target.
+		u = nil
+	}
+
+	if u == nil {
+		target, err := cke.ParseKubernetesImageVersion(cke.KubernetesImage.Name())
+		if err != nil {
+			log.Error("invalid kubernetes image", map[string]interface{}{
+				log.FnError: err,
+			})
+			return nil, ""
+		}
+
+		// Any change of the image, including its build number, is an upgrade.
+		// Images without a valid version tag are restarted as usual.
+		cpImages, nodeImages := nf.RunningKubernetesImages()
+		needed := false
+		for _, img := range append(cpImages, nodeImages...) {
+			if _, err := cke.ParseKubernetesImageVersion(img); err == nil && img != cke.KubernetesImage.Name() {
+				needed = true
+			}
+		}
+		if !needed {
+			if cs.KubernetesUpgrade != nil {
+				return []cke.Operator{op.KubernetesUpgradeFinishOp()}, cke.PhaseK8sUpgrade
+			}
+			return nil, ""
+		}
+
+		cpVersions := parseKubernetesImageVersions(cpImages)
+		nodeVersions := parseKubernetesImageVersions(nodeImages)
+		oldest := target
+		for _, v := range append(cpVersions, nodeVersions...) {
+			if v.Compare(oldest) < 0 {
+				oldest = v
+			}
+		}
+		if err := cke.CheckKubernetesVersionSkew(target, cpVersions, nodeVersions); err != nil {
+			log.Error("cannot upgrade kubernetes", map[string]interface{}{
+				log.FnError: err,
+			})
+			return nil, cke.PhaseK8sUpgradeAborted
+		}
+		if len(nf.SSHNotConnectedNodes(nf.cluster.Nodes, true, false)) > 0 {
+			log.Warn("cannot upgrade kubernetes for unreachable nodes", nil)
+			return nil, cke.PhaseK8sUpgradeAborted
+		}
+		if !nf.EtcdIsGood() {
+			log.Warn("cannot upgrade kubernetes because etcd cluster is not responding and in-sync", nil)
+			return nil, cke.PhaseK8sUpgradeAborted
+		}
+
+		return []cke.Operator{op.KubernetesUpgradeRecordOp(&cke.KubernetesUpgrade{
+			From:      oldest.String(),
+			To:        cke.KubernetesImage.Name(),
+			Stage:     cke.UpgradeStageEtcd,
+			StartedAt: time.Now().UTC(),
+		})}, cke.PhaseK8sUpgrade
+	}
+
+	// Control plane components are upgraded only when all CPs are SSH reachable.
+	if u.Stage != cke.UpgradeStageNodes && len(nf.SSHNotConnectedNodes(nf.cluster.Nodes, true, false)) > 0 {
+		log.Warn("cannot upgrade kubernetes for unreachable nodes", nil)
+		return nil, cke.PhaseK8sUpgradeAborted
+	}
+
+	next := func(stage cke.KubernetesUpgradeStage) []cke.Operator {
+		nu := *u
+		nu.Stage = stage
+		return []cke.Operator{op.KubernetesUpgradeRecordOp(&nu)}
+	}
+
+	switch u.Stage {
+	case cke.UpgradeStageEtcd:
+		if !nf.EtcdIsGood() {
+			log.Info("waiting for etcd cluster to become in-sync", nil)
+			return nil, cke.PhaseK8sUpgrade
+		}
+		if nodes := nf.EtcdOutdatedMembers(); len(nodes) > 0 {
+			return []cke.Operator{etcd.RestartOp(nf.EtcdNodes(), nodes[0], c.Options.Etcd)}, cke.PhaseK8sUpgrade
+		}
+		return next(cke.UpgradeStageAPIServer), cke.PhaseK8sUpgrade
+
+	case cke.UpgradeStageAPIServer:
+		if nodes := nf.UnhealthyRunningAPIServerNodes(); len(nodes) > 0 {
+			log.Info("waiting for kube-apiserver to become healthy", map[string]interface{}{
+				"node": nodes[0].Nodename(),
+			})
+			return nil, cke.PhaseK8sUpgrade
+		}
+		nodes := append(nf.APIServerStoppedNodes(), nf.APIServerOutdatedNodes()...)
+		if len(nodes) > 0 {
+			return []cke.Operator{k8s.APIServerRestartOp(nodes[:1], nf.ControlPlane(), c.ServiceSubnet, c.Options.APIServer, c.FeatureGates)}, cke.PhaseK8sUpgrade
+		}
+		return next(cke.UpgradeStageControllers), cke.PhaseK8sUpgrade
+
+	case cke.UpgradeStageControllers:
+		var ops []cke.Operator
+		if nodes := nf.ControllerManagerStoppedNodes(); len(nodes) > 0 {
+			ops = append(ops, k8s.ControllerManagerBootOp(nodes, c.Name, c.ServiceSubnet, c.Options.ControllerManager, c.FeatureGates))
+		}
+		if nodes := nf.ControllerManagerOutdatedNodes(); len(nodes) > 0 {
+			ops = append(ops, k8s.ControllerManagerRestartOp(nodes, c.Name, c.ServiceSubnet, c.Options.ControllerManager, c.FeatureGates))
+		}
+		if nodes := nf.SchedulerStoppedNodes(); len(nodes) > 0 {
+			ops = append(ops, k8s.SchedulerBootOp(nodes, c.Name, c.Options.Scheduler, c.FeatureGates))
+		}
+		if nodes := nf.SchedulerOutdatedNodes(c.Options.Scheduler); len(nodes) > 0 {
+			ops = append(ops, k8s.SchedulerRestartOp(nodes, c.Name, c.Options.Scheduler, c.FeatureGates))
+		}
+		if len(ops) > 0 {
+			return ops, cke.PhaseK8sUpgrade
+		}
+		if nodes := nf.UnhealthyRunningAPIServerNodes(); len(nodes) > 0 {
+			log.Info("waiting for kube-apiserver to become healthy", map[string]interface{}{
+				"node": nodes[0].Nodename(),
+			})
+			return nil, cke.PhaseK8sUpgrade
+		}
+		return next(cke.UpgradeStageNodes), cke.PhaseK8sUpgrade
+
+	case cke.UpgradeStageNodes:
+		// Stopped kubelets and kube-proxies are booted by k8sOps.
+		if len(nf.SSHConnectedNodes(nf.KubeletStoppedNodes(), true, true)) > 0 ||
+			len(nf.SSHConnectedNodes(nf.ProxyStoppedNodes(), true, true)) > 0 {
+			return nil, cke.PhaseK8sUpgrade
+		}
+		if nodes := nf.UpgradedNotReadyNodes(); len(nodes) > 0 {
+			log.Info("waiting for upgraded nodes to become ready", map[string]interface{}{
+				"node": nodes[0].Nodename(),
+			})
+			return nil, cke.PhaseK8sUpgrade
+		}
+		return nodeUpgradeOps(c, cs, constraints.GetNodeUpgradeBatchSize(), nf), cke.PhaseK8sUpgrade
+	}
+
+	log.Warn("unknown kubernetes upgrade stage", map[string]interface{}{
+		"stage": u.Stage,
+	})
+	return next(cke.UpgradeStageEtcd), cke.PhaseK8sUpgrade
+}
+
+// parseKubernetesImageVersions returns the Kubernetes versions of images.
+// Images without a valid version tag are ignored.
+func parseKubernetesImageVersions(images []string) []cke.KubernetesVersion {
+	var versions []cke.KubernetesVersion
+	for _, img := range images {
+		v, err := cke.ParseKubernetesImageVersion(img)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+// nodeUpgradeOps returns operations to restart kubelet and kube-proxy on
+// at most batchSize nodes.  This returns KubernetesUpgradeFinishOp if there
+// are no more nodes to be upgraded.
+func nodeUpgradeOps(c *cke.Cluster, cs *cke.ClusterStatus, batchSize int, nf *NodeFilter) []cke.Operator {
+	kubelets := nf.SSHConnectedNodes(nf.KubeletOutdatedNodes(), true, true)
+	proxies := nf.SSHConnectedNodes(nf.ProxyOutdatedNodes(), true, true)
+
+	outdated := make(map[string]bool)
+	for _, n := range kubelets {
+		outdated[n.Address] = true
+	}
+	for _, n := range proxies {
+		outdated[n.Address] = true
+	}
+
+	batch := make(map[string]bool)
+	for _, n := range c.Nodes {
+		if len(batch) == batchSize {
+			break
+		}
+		if outdated[n.Address] {
+			batch[n.Address] = true
+		}
+	}
+	if len(batch) == 0 {
+		return []cke.Operator{op.KubernetesUpgradeFinishOp()}
+	}
+
+	var ops []cke.Operator
+	if nodes := filterNodes(kubelets, batch); len(nodes) > 0 {
+		ops = append(ops, k8s.KubeletRestartOp(nodes, c.Name, c.Options.Kubelet, c.FeatureGates, cs.NodeStatuses))
+	}
+	if nodes := filterNodes(proxies, batch); len(nodes) > 0 {
+		ops = append(ops, k8s.KubeProxyRestartOp(nodes, c.Name, c.Options.Proxy, c.FeatureGates))
+	}
+	return ops
+}
+
+func filterNodes(nodes []*cke.Node, addresses map[string]bool) (filtered []*cke.Node) {
+	for _, n := range nodes {
+		if addresses[n.Address] {
+			filtered = append(filtered, n)
+		}
+	}
+	return filtered
+}
+
+// encryptionKeyOps returns operations to rotate the encryption key for encrypted resources.
+// API servers are restarted one by one in each stage, and the progress is
+// recorded in the storage for each node.
+func encryptionKeyOps(c *cke.Cluster, cs *cke.ClusterStatus, nf *NodeFilter) []cke.Operator {
+	r := cs.EncryptionKeyRotation
+	if r == nil || r.Stage == cke.EncryptionKeyStagePrepare {
+		return nil
+	}
+	if !cs.Kubernetes.IsControlPlaneReady {
+		return nil
+	}
+	if len(nf.SSHNotConnectedNodes(nf.ControlPlane(), true, false)) > 0 {
+		log.Warn("cannot rotate encryption key for unreachable nodes", nil)
+		return nil
+	}
+	if nodes := nf.UnhealthyRunningAPIServerNodes(); len(nodes) > 0 {
+		log.Info("waiting for kube-apiserver to become healthy", map[string]interface{}{
+			"node": nodes[0].Nodename(),
+		})
+		return nil
+	}
+
+	if r.Stage == cke.EncryptionKeyStageRewrite {
+		resources := c.Options.APIServer.Encryption.GetResources()
+		return []cke.Operator{k8s.EncryptionKeyRewriteOp(nf.HealthyAPIServer(), resources, r)}
+	}
+
+	for _, n := range nf.ControlPlane() {
+		if r.IsRestarted(n.Address) {
+			continue
+		}
+		return []cke.Operator{
+			k8s.APIServerRestartOp([]*cke.Node{n}, nf.ControlPlane(), c.ServiceSubnet, c.Options.APIServer, c.FeatureGates),
+			k8s.EncryptionKeyRecordOp(r.WithRestarted(n.Address)),
+		}
+	}
+
+	switch r.Stage {
+	case cke.EncryptionKeyStageAdd:
+		return []cke.Operator{k8s.EncryptionKeyRecordOp(r.WithStage(cke.EncryptionKeyStagePromote))}
+	case cke.EncryptionKeyStagePromote:
+		return []cke.Operator{k8s.EncryptionKeyRecordOp(r.WithStage(cke.EncryptionKeyStageRewrite))}
+	case cke.EncryptionKeyStageDrop:
+		return []cke.Operator{k8s.EncryptionKeyFinishOp(r)}
+	}
+
+	log.Warn("unknown encryption key rotation stage", map[string]interface{}{
+		"stage": r.Stage,
+	})
+	return nil
+}
+
+// serviceAccountKeyOps returns operations to rotate the key to sign service account tokens.
+// API servers or controller managers are restarted one by one in each stage,
+// and the progress is recorded in the storage for each node.
+func serviceAccountKeyOps(c *cke.Cluster, cs *cke.ClusterStatus, nf *NodeFilter, now time.Time) []cke.Operator {
+	r := cs.ServiceAccountKeyRotation
+	if r == nil {
+		return nil
+	}
+	if !cs.Kubernetes.IsControlPlaneReady {
+		return nil
+	}
+	if len(nf.SSHNotConnectedNodes(nf.ControlPlane(), true, false)) > 0 {
+		log.Warn("cannot rotate service account key for unreachable nodes", nil)
+		return nil
+	}
+	if nodes := nf.UnhealthyRunningAPIServerNodes(); len(nodes) > 0 {
+		log.Info("waiting for kube-apiserver to become healthy", map[string]interface{}{
+			"node": nodes[0].Nodename(),
+		})
+		return nil
+	}
+
+	if r.Stage == cke.ServiceAccountKeyStageGrace {
+		// Legacy token Secrets never expire, so they are regenerated
+		// with the new key before the old key is dropped.
+		if tokens := cs.Kubernetes.OldServiceAccountTokens; len(tokens) > 0 {
+			return []cke.Operator{k8s.ServiceAccountTokenRegenerateOp(nf.HealthyAPIServer(), tokens)}
+		}
+		if now.Before(r.SwitchedAt.Add(r.GetGracePeriod())) {
+			return nil
+		}
+		return []cke.Operator{k8s.ServiceAccountKeyRecordOp(r.WithStage(cke.ServiceAccountKeyStageDrop))}
+	}
+
+	for _, n := range nf.ControlPlane() {
+		if r.IsRestarted(n.Address) {
+			continue
+		}
+		var o cke.Operator
+		if r.Stage == cke.ServiceAccountKeyStageSwitch {
+			o = k8s.ControllerManagerRestartOp([]*cke.Node{n}, c.Name, c.ServiceSubnet, c.Options.ControllerManager, c.FeatureGates)
+		} else {
+			o = k8s.APIServerRestartOp([]*cke.Node{n}, nf.ControlPlane(), c.ServiceSubnet, c.Options.APIServer, c.FeatureGates)
+		}
+		return []cke.Operator{o, k8s.ServiceAccountKeyRecordOp(r.WithRestarted(n.Address))}
+	}
+
+	switch r.Stage {
+	case cke.ServiceAccountKeyStageAdd:
+		return []cke.Operator{k8s.ServiceAccountKeySwitchOp(r)}
+	case cke.ServiceAccountKeyStageSwitch:
+		nr := r.WithStage(cke.ServiceAccountKeyStageGrace)
+		nr.SwitchedAt = now.UTC()
+		return []cke.Operator{k8s.ServiceAccountKeyRecordOp(nr)}
+	case cke.ServiceAccountKeyStageDrop:
+		return []cke.Operator{k8s.ServiceAccountKeyFinishOp()}
+	}
+
+	log.Warn("unknown service account key rotation stage", map[string]interface{}{
+		"stage": r.Stage,
+	})
+	return nil
+}
+
+// caRotationOps returns operations to rotate a CA.
+// Components using the CA are restarted node by node in each stage,
+// and the progress is recorded in the storage for each node.
+func caRotationOps(c *cke.Cluster, cs *cke.ClusterStatus, resources []cke.ResourceDefinition, nf *NodeFilter) []cke.Operator {
+	r := cs.CARotation
+	if r == nil {
+		return nil
+	}
+	if r.Stage == cke.CARotationStagePrepare {
+		log.Info("waiting for the new CA to be generated", map[string]interface{}{
+			"ca": r.CA,
+		})
+		return nil
+	}
+	if !cs.Kubernetes.IsControlPlaneReady {
+		return nil
+	}
+	if nodes := nf.UnhealthyRunningAPIServerNodes(); len(nodes) > 0 {
+		log.Info("waiting for kube-apiserver to become healthy", map[string]interface{}{
+			"node": nodes[0].Nodename(),
+		})
+		return nil
+	}
+
+	for _, n := range c.Nodes {
+		if r.IsRestarted(n.Address) {
+			continue
+		}
+		ops := caConsumerOps(c, cs, nf, r.CA, n)
+		if len(ops) == 0 {
+			continue
+		}
+		if len(nf.SSHNotConnectedNodes([]*cke.Node{n}, true, true)) > 0 {
+			log.Warn("cannot rotate CA for unreachable nodes", map[string]interface{}{
+				"ca":   r.CA,
+				"node": n.Nodename(),
+			})
+			return nil
+		}
+		return append(ops, op.CARotationRecordOp(r.WithRestarted(n.Address)))
+	}
+
+	var ops []cke.Operator
+	if r.CA == cke.CAWebhook {
+		// Resources are applied again to inject the CA certificate or
+		// to issue certificates from the CA.
+		apiServer := nf.HealthyAPIServer()
+		for _, res := range resources {
+			status, ok := cs.Kubernetes.ResourceStatuses[res.Key]
+			if ok && usesWebhookCA(res, status) {
+				ops = append(ops, op.ResourceApplyOp(apiServer, res, !status.HasBeenSSA))
+			}
+		}
+	}
+
+	switch r.Stage {
+	case cke.CARotationStageBundle:
+		return append(ops, op.CARotationSwitchOp(r))
+	case cke.CARotationStageReissue:
+		return append(ops, op.CARotationRecordOp(r.WithStage(cke.CARotationStageDrop)))
+	case cke.CARotationStageDrop:
+		return append(ops, op.CARotationFinishOp(r))
+	}
+
+	log.Warn("unknown CA rotation stage", map[string]interface{}{
+		"stage": r.Stage,
+	})
+	return nil
+}
+
+// caConsumerOps returns operations to restart components on the node
+// so that they load the CA certificate and certificates issued by the CA.
+func caConsumerOps(c *cke.Cluster, cs *cke.ClusterStatus, nf *NodeFilter, ca string, n *cke.Node) (ops []cke.Operator) {
+	nodes := []*cke.Node{n}
+	etcdRestart := func() {
+		if n.IsEtcdMember() {
+			ops = append(ops, etcd.CertsRestartOp(nf.EtcdNodes(), n, c.Options.Etcd))
+		}
+	}
+	apiServerRestart := func() {
+		if n.ControlPlane {
+			ops = append(ops, k8s.APIServerRestartOp(nodes, nf.ControlPlane(), c.ServiceSubnet, c.Options.APIServer, c.FeatureGates))
+		}
+	}
+
+	switch ca {
+	case cke.CAServer, cke.CAEtcdClient:
+		etcdRestart()
+		apiServerRestart()
+	case cke.CAEtcdPeer:
+		etcdRestart()
+	case cke.CAKubernetesAggregation:
+		apiServerRestart()
+	case cke.CAKubernetes:
+		apiServerRestart()
+		if n.ControlPlane {
+			ops = append(ops,
+				k8s.ControllerManagerRestartOp(nodes, c.Name, c.ServiceSubnet, c.Options.ControllerManager, c.FeatureGates),
+				k8s.SchedulerRestartOp(nodes, c.Name, c.Options.Scheduler, c.FeatureGates),
+			)
+		}
+		if n.IsKubernetesNode() {
+			ops = append(ops,
+				k8s.KubeletRestartOp(nodes, c.Name, c.Options.Kubelet, c.FeatureGates, cs.NodeStatuses),
+				k8s.KubeProxyRestartOp(nodes, c.Name, c.Options.Proxy, c.FeatureGates),
+			)
+		}
+	}
+	return ops
+}
+
+// usesWebhookCA returns true if the resource is given the CA certificate
+// or a certificate issued by the webhook CA.
+func usesWebhookCA(res cke.ResourceDefinition, status cke.ResourceStatus) bool {
+	switch res.Kind {
+	case cke.KindValidatingWebhookConfiguration, cke.KindMutatingWebhookConfiguration:
+		return status.Annotations[cke.AnnotationResourceInjectCA] == "true"
+	case cke.KindSecret:
+		return status.Annotations[cke.AnnotationResourceIssueCert] != ""
+	}
+	return false
+}
+
+// encryptionConfigError returns an error if the encryption parameters cannot be applied.
+func encryptionConfigError(c *cke.Cluster, cs *cke.ClusterStatus) error {
+	params := c.Options.APIServer.Encryption
+	if unknown := cs.Kubernetes.UnknownEncryptionResources; len(unknown) > 0 {
+		return errors.New("unknown resources to be encrypted: " + strings.Join(unknown, ","))
+	}
+	if cs.EncryptedResources != nil && cs.EncryptedResources.Provider == cke.EncryptionProviderKMS &&
+		params.GetProvider() != cke.EncryptionProviderKMS {
+		return errors.New("encryption provider cannot be changed from kms")
+	}
+	return nil
+}
+
+// encryptionRewriteOps returns operations to rewrite objects of resources
+// that are newly encrypted or no longer encrypted.
+// Objects are rewritten after all API servers are restarted with the current parameters.
+func encryptionRewriteOps(c *cke.Cluster, cs *cke.ClusterStatus, nf *NodeFilter) []cke.Operator {
+	if cs.EncryptionKeyRotation != nil || cs.EncryptedResources == nil {
+		return nil
+	}
+	if !cs.Kubernetes.IsControlPlaneReady {
+		return nil
+	}
+
+	params := c.Options.APIServer.Encryption
+	added, removed := cs.EncryptedResources.PendingResources(params)
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+	if err := encryptionConfigError(c, cs); err != nil {
+		log.Error("cannot apply encryption parameters", map[string]interface{}{
+			log.FnError: err,
+		})
+		return nil
+	}
+	if len(nf.APIServerStoppedNodes()) > 0 || len(nf.APIServerOutdatedNodes()) > 0 {
+		log.Info("waiting for kube-apiserver to be restarted with the encryption parameters", nil)
+		return nil
+	}
+	if nodes := nf.UnhealthyRunningAPIServerNodes(); len(nodes) > 0 {
+		log.Info("waiting for kube-apiserver to become healthy", map[string]interface{}{
+			"node": nodes[0].Nodename(),
+		})
+		return nil
+	}
+	apiServer := nf.HealthyAPIServer()
+	if apiServer == nil {
+		return nil
+	}
+
+	encrypted := &cke.EncryptedResources{
+		Provider:  params.GetProvider(),
+		Resources: params.GetResources(),
+	}
+	return []cke.Operator{k8s.EncryptionRewriteOp(apiServer, append(added, removed...), encrypted)}
+}
+
 func etcdMaintOp(c *cke.Cluster, nf *NodeFilter) cke.Operator {
 	// this function is called only when all the CPs are reachable.
 	// so, filtering by SSHConnectedNodes(nodes, true, ...) is not required.
 
 	if members := nf.EtcdNonClusterMembers(false); len(members) > 0 {
-		return etcd.RemoveMemberOp(nf.ControlPlane(), members)
+		return etcd.RemoveMemberOp(nf.EtcdNodes(), members)
 	}
-	if nodes, ids := nf.EtcdNonCPMembers(false); len(nodes) > 0 {
-		return etcd.DestroyMemberOp(nf.ControlPlane(), nf.SSHConnectedNodes(nodes, false, true), ids)
+	if nodes, ids := nf.EtcdNonEtcdNodeMembers(false); len(nodes) > 0 {
+		return etcd.DestroyMemberOp(nf.EtcdNodes(), nf.SSHConnectedNodes(nodes, true, true), ids)
 	}
 	if nodes := nf.EtcdUnstartedMembers(); len(nodes) > 0 {
-		return etcd.AddMemberOp(nf.ControlPlane(), nodes[0], c.Options.Etcd)
+		return etcd.AddMemberOp(nf.EtcdNodes(), nodes[0], c.Options.Etcd)
+	}
+	if nodes := nf.EtcdLearnerMembers(); len(nodes) > 0 {
+		return etcd.PromoteMemberOp(nf.EtcdNodes(), nodes[0])
 	}
 
 	if !nf.EtcdIsGood() {
@@ -180,16 +838,19 @@ func etcdMaintOp(c *cke.Cluster, nf *NodeFilter) cke.Operator {
 	// all members are in sync.
 
 	if nodes := nf.EtcdNewMembers(); len(nodes) > 0 {
-		return etcd.AddMemberOp(nf.ControlPlane(), nodes[0], c.Options.Etcd)
+		return etcd.AddMemberOp(nf.EtcdNodes(), nodes[0], c.Options.Etcd)
 	}
 	if members := nf.EtcdNonClusterMembers(true); len(members) > 0 {
-		return etcd.RemoveMemberOp(nf.ControlPlane(), members)
+		return etcd.RemoveMemberOp(nf.EtcdNodes(), members)
 	}
-	if nodes, ids := nf.EtcdNonCPMembers(true); len(nodes) > 0 {
-		return etcd.DestroyMemberOp(nf.ControlPlane(), nf.SSHConnectedNodes(nodes, false, true), ids)
+	if nodes, ids := nf.EtcdNonEtcdNodeMembers(true); len(nodes) > 0 {
+		return etcd.DestroyMemberOp(nf.EtcdNodes(), nf.SSHConnectedNodes(nodes, true, true), ids)
 	}
 	if nodes := nf.EtcdOutdatedMembers(); len(nodes) > 0 {
-		return etcd.RestartOp(nf.ControlPlane(), nodes[0], c.Options.Etcd)
+		return etcd.RestartOp(nf.EtcdNodes(), nodes[0], c.Options.Etcd)
+	}
+	if nodes := nf.EtcdFragmentedMembers(); len(nodes) > 0 {
+		return etcd.DefragOp(nf.EtcdNodes(), nodes[0])
 	}
 
 	return nil
@@ -203,7 +864,8 @@ func k8sMaintOps(c *cke.Cluster, cs *cke.ClusterStatus, resources []cke.Resource
 		return []cke.Operator{op.KubeWaitOp(apiServer)}
 	}
 
-	ops = append(ops, decideResourceOps(apiServer, ks, resources, ks.IsReady(c))...)
+	ops = append(ops, decideResourceOps(apiServer, ks, static.ResourcesFor(c), resources, ks.IsReady(c))...)
+	ops = append(ops, decideObsoleteResourceOps(apiServer, ks, static.ObsoleteResourcesFor(c))...)
 
 	ops = append(ops, decideClusterDNSOps(apiServer, c, ks)...)
 
@@ -251,10 +913,10 @@ func k8sMaintOps(c *cke.Cluster, cs *cke.ClusterStatus, resources []cke.Resource
 		ops = append(ops, svcOp)
 	}
 
-	cpAddresses := make([]corev1.EndpointAddress, len(nf.ControlPlane()))
-	for i, cp := range nf.ControlPlane() {
-		cpAddresses[i] = corev1.EndpointAddress{
-			IP: cp.Address,
+	etcdAddresses := make([]corev1.EndpointAddress, len(nf.EtcdNodes()))
+	for i, n := range nf.EtcdNodes() {
+		etcdAddresses[i] = corev1.EndpointAddress{
+			IP: n.Address,
 		}
 	}
 	etcdEP := &corev1.Endpoints{}
@@ -262,7 +924,7 @@ func k8sMaintOps(c *cke.Cluster, cs *cke.ClusterStatus, resources []cke.Resource
 	etcdEP.Name = op.EtcdEndpointsName
 	etcdEP.Subsets = []corev1.EndpointSubset{
 		{
-			Addresses: cpAddresses,
+			Addresses: etcdAddresses,
 			Ports: []corev1.EndpointPort{
 				{
 					Port:     2379,
@@ -297,7 +959,7 @@ func decideClusterDNSOps(apiServer *cke.Node, c *cke.Cluster, ks cke.KubernetesC
 		}
 	}
 
-	kubeletConfig := k8s.GenerateKubeletConfiguration(c.Options.Kubelet, "0.0.0.0", nil)
+	kubeletConfig := k8s.GenerateKubeletConfiguration(c.Options.Kubelet, c.FeatureGates, "0.0.0.0", nil)
 	desiredClusterDomain := kubeletConfig.ClusterDomain
 
 	if ks.ClusterDNS.ConfigMap == nil {
@@ -327,14 +989,14 @@ func decideNodeDNSOps(apiServer *cke.Node, c *cke.Cluster, ks cke.KubernetesClus
 		}
 	}
 
-	kubeletConfig := k8s.GenerateKubeletConfiguration(c.Options.Kubelet, "0.0.0.0", nil)
+	kubeletConfig := k8s.GenerateKubeletConfiguration(c.Options.Kubelet, c.FeatureGates, "0.0.0.0", nil)
 	desiredClusterDomain := kubeletConfig.ClusterDomain
 
 	if ks.NodeDNS.ConfigMap == nil {
-		ops = append(ops, nodedns.CreateConfigMapOp(apiServer, ks.ClusterDNS.ClusterIP, desiredClusterDomain, desiredDNSServers))
+		ops = append(ops, nodedns.CreateConfigMapOp(apiServer, ks.ClusterDNS.ClusterIP, desiredClusterDomain, desiredDNSServers, c.HasIPv6()))
 	} else {
 		actualConfigData := ks.NodeDNS.ConfigMap.Data
-		expectedConfig := nodedns.ConfigMap(ks.ClusterDNS.ClusterIP, desiredClusterDomain, desiredDNSServers)
+		expectedConfig := nodedns.ConfigMap(ks.ClusterDNS.ClusterIP, desiredClusterDomain, desiredDNSServers, c.HasIPv6())
 		if actualConfigData["unbound.conf"] != expectedConfig.Data["unbound.conf"] {
 			ops = append(ops, nodedns.UpdateConfigMapOp(apiServer, expectedConfig))
 		}
@@ -408,8 +1070,17 @@ func decideEtcdServiceOps(apiServer *cke.Node, svc *corev1.Service) cke.Operator
 	return nil
 }
 
-func decideResourceOps(apiServer *cke.Node, ks cke.KubernetesClusterStatus, resources []cke.ResourceDefinition, isReady bool) (ops []cke.Operator) {
-	for _, res := range static.Resources {
+func decideObsoleteResourceOps(apiServer *cke.Node, ks cke.KubernetesClusterStatus, obsolete []cke.ResourceDefinition) (ops []cke.Operator) {
+	for _, res := range obsolete {
+		if _, ok := ks.ResourceStatuses[res.Key]; ok {
+			ops = append(ops, op.ResourceDeleteOp(apiServer, res))
+		}
+	}
+	return ops
+}
+
+func decideResourceOps(apiServer *cke.Node, ks cke.KubernetesClusterStatus, staticResources, resources []cke.ResourceDefinition, isReady bool) (ops []cke.Operator) {
+	for _, res := range staticResources {
 		// To avoid thundering herd problem. Deployments need to be created only after enough nodes become ready.
 		if res.Kind == cke.KindDeployment && !isReady {
 			continue
@@ -432,17 +1103,28 @@ func decideResourceOps(apiServer *cke.Node, ks cke.KubernetesClusterStatus, reso
 }
 
 func cleanOps(c *cke.Cluster, nf *NodeFilter) (ops []cke.Operator) {
-	var apiServers, controllerManagers, schedulers, etcds, etcdRivers []*cke.Node
+	var apiServers, controllerManagers, schedulers, etcds, etcdRivers, kmsPlugins, kubelets, proxies []*cke.Node
 
 	for _, n := range c.Nodes {
-		if !nf.status.NodeStatuses[n.Address].SSHConnected || n.ControlPlane {
+		if !nf.status.NodeStatuses[n.Address].SSHConnected {
 			continue
 		}
 
 		st := nf.nodeStatus(n)
-		if st.Etcd.Running && nf.EtcdIsGood() {
+		if !n.IsEtcdMember() && st.Etcd.Running && nf.EtcdIsGood() {
 			etcds = append(etcds, n)
 		}
+		if !n.IsKubernetesNode() {
+			if st.Kubelet.Running {
+				kubelets = append(kubelets, n)
+			}
+			if st.Proxy.Running {
+				proxies = append(proxies, n)
+			}
+		}
+		if n.ControlPlane {
+			continue
+		}
 		if st.APIServer.Running {
 			apiServers = append(apiServers, n)
 		}
@@ -455,6 +1137,9 @@ func cleanOps(c *cke.Cluster, nf *NodeFilter) (ops []cke.Operator) {
 		if st.EtcdRivers.Running {
 			etcdRivers = append(etcdRivers, n)
 		}
+		if st.KMSPlugin.Running {
+			kmsPlugins = append(kmsPlugins, n)
+		}
 	}
 
 	if len(apiServers) > 0 {
@@ -472,6 +1157,15 @@ func cleanOps(c *cke.Cluster, nf *NodeFilter) (ops []cke.Operator) {
 	if len(etcdRivers) > 0 {
 		ops = append(ops, op.EtcdRiversStopOp(etcdRivers))
 	}
+	if len(kmsPlugins) > 0 {
+		ops = append(ops, op.KMSPluginStopOp(kmsPlugins))
+	}
+	if len(kubelets) > 0 {
+		ops = append(ops, op.KubeletStopOp(kubelets))
+	}
+	if len(proxies) > 0 {
+		ops = append(ops, op.KubeProxyStopOp(proxies))
+	}
 	return ops
 }
 
@@ -1,7 +1,9 @@
 package server
 
 import (
+	"fmt"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,6 +19,9 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	controllermanagerv1alpha1 "k8s.io/kube-controller-manager/config/v1alpha1"
+	proxyv1alpha1 "k8s.io/kube-proxy/config/v1alpha1"
 	schedulerv1beta1 "k8s.io/kube-scheduler/config/v1beta1"
 	kubeletv1beta1 "k8s.io/kubelet/config/v1beta1"
 )
@@ -160,8 +165,9 @@ func newData() testData {
 	nodeList[3].Labels = cluster.Nodes[3].Labels
 	nodeList[3].Spec.Taints = cluster.Nodes[3].Taints
 	status := &cke.ClusterStatus{
-		ConfigVersion: cke.ConfigVersion,
-		NodeStatuses:  nodeStatuses,
+		ConfigVersion:      cke.ConfigVersion,
+		NodeStatuses:       nodeStatuses,
+		EncryptedResources: cke.DefaultEncryptedResources(),
 		Kubernetes: cke.KubernetesClusterStatus{
 			ResourceStatuses: map[string]cke.ResourceStatus{
 				"Namespace/foo": {Annotations: map[string]string{cke.AnnotationResourceRevision: "1"}},
@@ -207,6 +213,14 @@ func (d testData) withEtcdRivers() testData {
 	return d
 }
 
+func (d testData) updateEtcdRiversUpstreams() {
+	etcdNodes := cke.EtcdNodes(d.Cluster.Nodes)
+	for _, n := range d.ControlPlane() {
+		st := &d.NodeStatus(n).EtcdRivers
+		st.BuiltInParams = op.RiversParams(etcdNodes, op.EtcdRiversUpstreamPort, op.EtcdRiversListenPort)
+	}
+}
+
 func (d testData) withStoppedEtcd() testData {
 	for _, n := range d.ControlPlane() {
 		d.NodeStatus(n).Etcd.HasData = true
@@ -246,13 +260,72 @@ func (d testData) withHealthyEtcd() testData {
 	return d
 }
 
+// withDedicatedEtcdNode makes the first non control plane node a running etcd member
+// that does not run kubelet and kube-proxy.
+func (d testData) withDedicatedEtcdNode() testData {
+	n := d.NonCPWorkers()[0]
+	etcdNode := true
+	n.Etcd = &etcdNode
+
+	st := d.NodeStatus(n)
+	st.Etcd.Running = true
+	st.Etcd.HasData = true
+	st.Etcd.Image = cke.EtcdImage.Name()
+	st.Etcd.BuiltInParams = etcd.BuiltInParams(n, nil, "")
+	st.Kubelet = cke.KubeletStatus{}
+	st.Proxy = cke.ProxyStatus{}
+
+	if d.Status.Etcd.Members != nil {
+		d.Status.Etcd.Members[n.Address] = &etcdserverpb.Member{
+			ID:   uint64(len(d.Status.Etcd.Members)),
+			Name: n.Address,
+		}
+		d.Status.Etcd.InSyncMembers[n.Address] = true
+	}
+	d.updateEtcdRiversUpstreams()
+
+	if ep := d.Status.Kubernetes.EtcdEndpoints; ep != nil {
+		ep.Subsets[0].Addresses = append(ep.Subsets[0].Addresses, corev1.EndpointAddress{IP: n.Address})
+	}
+
+	var nodes []corev1.Node
+	for _, kn := range d.Status.Kubernetes.Nodes {
+		if kn.Name != n.Address {
+			nodes = append(nodes, kn)
+		}
+	}
+	d.Status.Kubernetes.Nodes = nodes
+	return d
+}
+
 func (d testData) withAPIServer(serviceSubnet string) testData {
 	for _, n := range d.ControlPlane() {
 		st := &d.NodeStatus(n).APIServer
 		st.Running = true
 		st.IsHealthy = true
 		st.Image = cke.KubernetesImage.Name()
-		st.BuiltInParams = k8s.APIServerParams(d.ControlPlane(), n.Address, serviceSubnet, false, "")
+		st.BuiltInParams, _ = k8s.APIServerParams(d.ControlPlane(), n.Address, serviceSubnet, cke.APIServerParams{}, nil, false)
+	}
+	return d
+}
+
+func (d testData) withKMSPlugin() testData {
+	d.Cluster.Options.APIServer.Encryption.Provider = cke.EncryptionProviderKMS
+	for _, n := range d.ControlPlane() {
+		st := &d.NodeStatus(n).KMSPlugin
+		st.Running = true
+		st.Image = cke.ToolsImage.Name()
+		st.BuiltInParams = k8s.KMSPluginParams(d.Cluster.Options.APIServer.Encryption)
+		d.NodeStatus(n).APIServer.BuiltInParams, _ = k8s.APIServerParams(d.ControlPlane(), n.Address, d.Cluster.ServiceSubnet, d.Cluster.Options.APIServer, d.Cluster.FeatureGates, false)
+	}
+	return d
+}
+
+func (d testData) withEncryptionResources(resources ...string) testData {
+	d.Cluster.Options.APIServer.Encryption.Resources = resources
+	for _, n := range d.ControlPlane() {
+		st := &d.NodeStatus(n).APIServer
+		st.BuiltInParams, _ = k8s.APIServerParams(d.ControlPlane(), n.Address, d.Cluster.ServiceSubnet, d.Cluster.Options.APIServer, d.Cluster.FeatureGates, false)
 	}
 	return d
 }
@@ -263,7 +336,7 @@ func (d testData) withControllerManager(name, serviceSubnet string) testData {
 		st.Running = true
 		st.IsHealthy = true
 		st.Image = cke.KubernetesImage.Name()
-		st.BuiltInParams = k8s.ControllerManagerParams(name, serviceSubnet)
+		st.BuiltInParams = k8s.ControllerManagerParams(name, serviceSubnet, &controllermanagerv1alpha1.KubeControllerManagerConfiguration{}, nil)
 	}
 	return d
 }
@@ -274,7 +347,7 @@ func (d testData) withScheduler() testData {
 		st.Running = true
 		st.IsHealthy = true
 		st.Image = cke.KubernetesImage.Name()
-		st.BuiltInParams = k8s.SchedulerParams()
+		st.BuiltInParams = k8s.SchedulerParams(nil)
 
 		address := "0.0.0.0"
 		leaderElect := true
@@ -327,7 +400,12 @@ func (d testData) withProxy() testData {
 		st.Running = true
 		st.IsHealthy = true
 		st.Image = cke.KubernetesImage.Name()
-		st.BuiltInParams = k8s.ProxyParams(n, "ipvs")
+		st.BuiltInParams = k8s.ProxyParams()
+		st.Config = &proxyv1alpha1.KubeProxyConfiguration{
+			HostnameOverride: n.Nodename(),
+			Mode:             proxyv1alpha1.ProxyMode(cke.ProxyModeIPVS),
+		}
+		st.Config.ClientConnection.Kubeconfig = op.ProxyKubeConfigPath
 	}
 	return d
 }
@@ -344,6 +422,66 @@ func (d testData) withAllServices() testData {
 	return d
 }
 
+// withOldKubernetes makes all Kubernetes components run an image older than
+// the current one by the given number of minor versions.
+func (d testData) withOldKubernetes(minors int) testData {
+	v, err := cke.ParseKubernetesImageVersion(cke.KubernetesImage.Name())
+	if err != nil {
+		panic(err)
+	}
+	image := fmt.Sprintf("quay.io/cybozu/kubernetes:%d.%d.0.1", v.Major, v.Minor-minors)
+
+	for _, n := range d.ControlPlane() {
+		st := d.NodeStatus(n)
+		st.APIServer.Image = image
+		st.ControllerManager.Image = image
+		st.Scheduler.Image = image
+	}
+	for _, n := range d.Cluster.Nodes {
+		st := d.NodeStatus(n)
+		st.Kubelet.Image = image
+		st.Proxy.Image = image
+	}
+	return d
+}
+
+func newKubernetesUpgrade(stage cke.KubernetesUpgradeStage) *cke.KubernetesUpgrade {
+	return &cke.KubernetesUpgrade{
+		From:  "1.0.0",
+		To:    cke.KubernetesImage.Name(),
+		Stage: stage,
+	}
+}
+
+func newEncryptionKeyRotation(stage cke.EncryptionKeyRotationStage) *cke.EncryptionKeyRotation {
+	return &cke.EncryptionKeyRotation{
+		Stage:  stage,
+		OldKey: "old",
+		NewKey: "new",
+	}
+}
+
+func newCARotation(ca string, stage cke.CARotationStage) *cke.CARotation {
+	return &cke.CARotation{
+		CA:        ca,
+		Stage:     stage,
+		OldCert:   "old",
+		NewCert:   "new",
+		OldIssuer: "old-issuer",
+		NewIssuer: "new-issuer",
+	}
+}
+
+func newServiceAccountKeyRotation(stage cke.ServiceAccountKeyRotationStage) *cke.ServiceAccountKeyRotation {
+	return &cke.ServiceAccountKeyRotation{
+		Stage:       stage,
+		OldCert:     "old",
+		NewCert:     "new",
+		NewKey:      "key",
+		GracePeriod: "1h",
+	}
+}
+
 func (d testData) withK8sReady() testData {
 	for i, n := range d.Status.Kubernetes.Nodes {
 		n.Status.Conditions = append(n.Status.Conditions, corev1.NodeCondition{
@@ -370,7 +508,7 @@ func (d testData) withK8sResourceReady() testData {
 	ks.ResourceStatuses["DaemonSet/kube-system/node-dns"].Annotations[cke.AnnotationResourceImage] = cke.UnboundImage.Name()
 	ks.ClusterDNS.ConfigMap = clusterdns.ConfigMap(testDefaultDNSDomain, testDefaultDNSServers)
 	ks.ClusterDNS.ClusterIP = testDefaultDNSAddr
-	ks.NodeDNS.ConfigMap = nodedns.ConfigMap(testDefaultDNSAddr, testDefaultDNSDomain, testDefaultDNSServers)
+	ks.NodeDNS.ConfigMap = nodedns.ConfigMap(testDefaultDNSAddr, testDefaultDNSDomain, testDefaultDNSServers, false)
 
 	ks.MasterEndpoints = &corev1.Endpoints{
 		Subsets: []corev1.EndpointSubset{
@@ -467,6 +605,18 @@ func (d testData) withRebootEntry(entry *cke.RebootQueueEntry) testData {
 	return d
 }
 
+func (d testData) withEtcdBackup() testData {
+	d.Cluster.EtcdBackup = cke.EtcdBackup{
+		Enabled:  true,
+		Interval: "1h",
+		Targets: []cke.EtcdBackupTarget{
+			{Name: "local", Local: &cke.EtcdBackupLocalTarget{Node: nodeNames[3], Dir: "/var/cke/etcd-backups"}},
+			{Name: "s3", S3: &cke.EtcdBackupS3Target{Endpoint: "http://10.0.0.100:9000", Bucket: "backup"}},
+		},
+	}
+	return d
+}
+
 func TestDecideOps(t *testing.T) {
 	t.Parallel()
 
@@ -475,6 +625,7 @@ func TestDecideOps(t *testing.T) {
 		Input              testData
 		ExpectedOps        []string
 		ExpectedTargetNums map[string]int
+		ExpectedPhase      cke.OperationPhase
 	}{
 		{
 			Name:               "BootRivers",
@@ -665,6 +816,69 @@ func TestDecideOps(t *testing.T) {
 				"kube-apiserver-restart": 1,
 			},
 		},
+		{
+			Name: "RestartAPIServerAdmission",
+			Input: newData().withAllServices().with(func(d testData) {
+				d.Cluster.Options.APIServer.Admission.EnablePlugins = []string{"EventRateLimit"}
+			}).withSSHNotConnectedNodes(),
+			ExpectedOps: []string{
+				"kube-apiserver-restart",
+			},
+			ExpectedTargetNums: map[string]int{
+				"kube-apiserver-restart": 2,
+			},
+		},
+		{
+			Name: "RestartForFeatureGates",
+			Input: newData().withAllServices().with(func(d testData) {
+				d.Cluster.FeatureGates = map[string]bool{"EphemeralContainers": true}
+			}),
+			ExpectedOps: []string{
+				"kube-apiserver-restart",
+				"kube-controller-manager-restart",
+				"kube-proxy-restart",
+				"kube-scheduler-restart",
+				"kubelet-restart",
+			},
+		},
+		{
+			Name: "BootKMSPlugin",
+			Input: newData().withAllServices().with(func(d testData) {
+				d.Cluster.Options.APIServer.Encryption.Provider = cke.EncryptionProviderKMS
+			}).withSSHNotConnectedNodes(),
+			ExpectedOps: []string{
+				"kms-plugin-bootstrap",
+				"kube-apiserver-restart",
+			},
+			ExpectedTargetNums: map[string]int{
+				"kms-plugin-bootstrap":   2,
+				"kube-apiserver-restart": 2,
+			},
+		},
+		{
+			Name: "RestartKMSPlugin",
+			Input: newData().withAllServices().withKMSPlugin().with(func(d testData) {
+				d.NodeStatus(d.ControlPlane()[0]).KMSPlugin.Image = ""
+			}),
+			ExpectedOps: []string{
+				"kms-plugin-restart",
+			},
+			ExpectedTargetNums: map[string]int{
+				"kms-plugin-restart": 1,
+			},
+		},
+		{
+			Name: "RestartKMSPluginTransitKey",
+			Input: newData().withAllServices().withKMSPlugin().with(func(d testData) {
+				d.Cluster.Options.APIServer.Encryption.KMS.TransitKey = "another"
+			}),
+			ExpectedOps: []string{
+				"kms-plugin-restart",
+			},
+			ExpectedTargetNums: map[string]int{
+				"kms-plugin-restart": 3,
+			},
+		},
 		{
 			Name:  "RestartControllerManager",
 			Input: newData().withAllServices().withControllerManager("another", testServiceSubnet).withSSHNotConnectedNodes(),
@@ -701,6 +915,23 @@ func TestDecideOps(t *testing.T) {
 				"kube-controller-manager-restart": 1,
 			},
 		},
+		{
+			Name: "RestartControllerManagerConfig",
+			Input: newData().withAllServices().with(func(d testData) {
+				d.Cluster.Options.ControllerManager.Config = &unstructured.Unstructured{}
+				d.Cluster.Options.ControllerManager.Config.SetAPIVersion("kubecontrollermanager.config.k8s.io/v1alpha1")
+				d.Cluster.Options.ControllerManager.Config.SetKind("KubeControllerManagerConfiguration")
+				d.Cluster.Options.ControllerManager.Config.Object["nodeLifecycleController"] = map[string]interface{}{
+					"podEvictionTimeout": "1m",
+				}
+			}).withSSHNotConnectedNodes(),
+			ExpectedOps: []string{
+				"kube-controller-manager-restart",
+			},
+			ExpectedTargetNums: map[string]int{
+				"kube-controller-manager-restart": 2,
+			},
+		},
 		{
 			Name: "RestartScheduler",
 			Input: newData().withAllServices().with(func(d testData) {
@@ -905,6 +1136,111 @@ func TestDecideOps(t *testing.T) {
 				"kube-proxy-restart": 1,
 			},
 		},
+		{
+			Name: "RestartProxyConfig",
+			Input: newData().withAllServices().with(func(d testData) {
+				d.Cluster.Options.Proxy.Config = &unstructured.Unstructured{}
+				d.Cluster.Options.Proxy.Config.SetAPIVersion("kubeproxy.config.k8s.io/v1alpha1")
+				d.Cluster.Options.Proxy.Config.SetKind("KubeProxyConfiguration")
+				d.Cluster.Options.Proxy.Config.Object["ipvs"] = map[string]interface{}{
+					"scheduler": "lc",
+				}
+			}).withSSHNotConnectedNodes(),
+			ExpectedOps: []string{
+				"kube-proxy-restart",
+			},
+			ExpectedTargetNums: map[string]int{
+				"kube-proxy-restart": 4,
+			},
+		},
+		{
+			Name: "RenewAPIServerCertificate",
+			Input: newData().withAllServices().with(func(d testData) {
+				d.NodeStatus(d.ControlPlane()[0]).APIServer.CertExpiry = time.Now().Add(time.Hour)
+				d.NodeStatus(d.ControlPlane()[1]).APIServer.CertExpiry = time.Now().Add(time.Hour)
+			}).withSSHNotConnectedNodes(),
+			ExpectedOps: []string{
+				"kube-apiserver-restart",
+			},
+			ExpectedTargetNums: map[string]int{
+				"kube-apiserver-restart": 1,
+			},
+		},
+		{
+			Name: "RenewControllerManagerCertificate",
+			Input: newData().withAllServices().with(func(d testData) {
+				d.Cluster.Options.ControllerManager.CertTTL = "720h"
+				for _, n := range d.ControlPlane() {
+					d.NodeStatus(n).ControllerManager.CertExpiry = time.Now().Add(24 * time.Hour)
+				}
+			}).withSSHNotConnectedNodes(),
+			ExpectedOps: []string{
+				"kube-controller-manager-restart",
+			},
+			ExpectedTargetNums: map[string]int{
+				"kube-controller-manager-restart": 1,
+			},
+		},
+		{
+			Name: "RenewShortenedCertificate",
+			Input: newData().withAllServices().with(func(d testData) {
+				d.Cluster.Options.Proxy.CertTTL = "720h"
+				d.Cluster.Options.Kubelet.CertTTL = "720h"
+				for _, n := range d.Cluster.Nodes {
+					d.NodeStatus(n).Proxy.CertExpiry = time.Now().Add(87600 * time.Hour)
+					d.NodeStatus(n).Kubelet.CertExpiry = time.Now().Add(87600 * time.Hour)
+				}
+			}).withSSHNotConnectedNodes(),
+			ExpectedOps: []string{
+				"kube-proxy-restart",
+				"kubelet-restart",
+			},
+			ExpectedTargetNums: map[string]int{
+				"kube-proxy-restart": 1,
+				"kubelet-restart":    1,
+			},
+		},
+		{
+			Name: "RenewCertificateBefore",
+			Input: newData().withAllServices().with(func(d testData) {
+				d.Cluster.Options.APIServer.CertTTL = "720h"
+				d.Cluster.Options.APIServer.CertRenewBefore = "600h"
+				for _, n := range d.ControlPlane() {
+					d.NodeStatus(n).APIServer.CertExpiry = time.Now().Add(500 * time.Hour)
+				}
+			}),
+			ExpectedOps: []string{
+				"kube-apiserver-restart",
+			},
+			ExpectedTargetNums: map[string]int{
+				"kube-apiserver-restart": 1,
+			},
+		},
+		{
+			Name: "RenewCertificateWithOutdatedParams",
+			Input: newData().withAllServices().with(func(d testData) {
+				d.Cluster.Options.Kubelet.CertTTL = "720h"
+				d.NodeStatus(d.Cluster.Nodes[0]).Kubelet.CertExpiry = time.Now().Add(24 * time.Hour)
+				d.NodeStatus(d.Cluster.Nodes[1]).Kubelet.Image = ""
+				d.NodeStatus(d.Cluster.Nodes[2]).Kubelet.Image = ""
+			}),
+			ExpectedOps: []string{
+				"kubelet-restart",
+			},
+			ExpectedTargetNums: map[string]int{
+				"kubelet-restart": 2,
+			},
+		},
+		{
+			Name: "KeepValidCertificate",
+			Input: newData().withAllServices().with(func(d testData) {
+				d.Cluster.Options.Scheduler.CertTTL = "720h"
+				for _, n := range d.ControlPlane() {
+					d.NodeStatus(n).Scheduler.CertExpiry = time.Now().Add(500 * time.Hour)
+				}
+			}),
+			ExpectedOps: []string{"wait-kubernetes"},
+		},
 		{
 			Name:        "WaitKube",
 			Input:       newData().withAllServices(),
@@ -934,6 +1270,40 @@ func TestDecideOps(t *testing.T) {
 				"resource-apply",
 			},
 		},
+		{
+			Name: "K8sResourcesWithoutPSP",
+			Input: newData().withK8sReady().with(func(d testData) {
+				d.Cluster.Options.APIServer.Admission.SkipPodSecurityPolicy = true
+			}),
+			ExpectedOps: []string{
+				"create-cluster-dns-configmap",
+				"create-endpoints",
+				"create-endpoints",
+				"create-etcd-service",
+				"resource-apply",
+				"resource-apply",
+				"resource-apply",
+				"resource-apply",
+				"resource-apply",
+				"resource-apply",
+				"resource-apply",
+				"resource-apply",
+				"resource-apply",
+				"resource-apply",
+				"resource-apply",
+				"resource-apply",
+			},
+		},
+		{
+			Name: "DeletePSP",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Cluster.Options.APIServer.Admission.SkipPodSecurityPolicy = true
+			}),
+			ExpectedOps: []string{
+				"resource-delete",
+				"resource-delete",
+			},
+		},
 		{
 			Name: "UpdateDNSService",
 			Input: newData().withK8sResourceReady().with(func(d testData) {
@@ -1685,6 +2055,82 @@ func TestDecideOps(t *testing.T) {
 			}),
 			ExpectedOps: []string{"etcd-add-member"},
 		},
+		{
+			Name: "EtcdPromoteLearner",
+			Input: newData().withAllServices().with(func(d testData) {
+				// the learner has not caught up yet
+				d.Status.Etcd.Learners = map[string]bool{"10.0.0.13": true}
+				delete(d.Status.Etcd.InSyncMembers, "10.0.0.13")
+			}),
+			ExpectedOps:        []string{"etcd-promote-member"},
+			ExpectedTargetNums: map[string]int{"etcd-promote-member": 1},
+		},
+		{
+			Name: "EtcdReAddStoppedLearner",
+			Input: newData().withAllServices().with(func(d testData) {
+				d.Status.Etcd.Learners = map[string]bool{"10.0.0.13": true}
+				delete(d.Status.Etcd.InSyncMembers, "10.0.0.13")
+				// learners do not have the volume to mark added members
+				st := &d.NodeStatus(d.ControlPlane()[2]).Etcd
+				st.Running = false
+				st.HasData = false
+			}),
+			ExpectedOps: []string{"etcd-add-member"},
+		},
+		{
+			Name: "EtcdRiversDedicatedEtcdNode",
+			Input: newData().withAllServices().with(func(d testData) {
+				etcdNode := true
+				d.Cluster.Nodes[3].Etcd = &etcdNode
+			}),
+			ExpectedOps:        []string{"etcd-rivers-restart"},
+			ExpectedTargetNums: map[string]int{"etcd-rivers-restart": 3},
+		},
+		{
+			Name: "EtcdAddDedicatedEtcdNode",
+			Input: newData().withAllServices().with(func(d testData) {
+				etcdNode := true
+				d.Cluster.Nodes[3].Etcd = &etcdNode
+				d.updateEtcdRiversUpstreams()
+			}),
+			ExpectedOps:        []string{"etcd-add-member"},
+			ExpectedTargetNums: map[string]int{"etcd-add-member": 1},
+		},
+		{
+			Name:        "DedicatedEtcdNodeRunsOnlyEtcd",
+			Input:       newData().withK8sResourceReady().withDedicatedEtcdNode(),
+			ExpectedOps: nil,
+		},
+		{
+			Name: "DedicatedEtcdNodeStopsKubelet",
+			Input: newData().withK8sResourceReady().withDedicatedEtcdNode().with(func(d testData) {
+				st := d.NodeStatus(d.NonCPWorkers()[0])
+				st.Kubelet.Running = true
+				st.Proxy.Running = true
+			}),
+			ExpectedOps:        []string{"stop-kube-proxy", "stop-kubelet"},
+			ExpectedTargetNums: map[string]int{"stop-kube-proxy": 1, "stop-kubelet": 1},
+		},
+		{
+			Name: "DedicatedEtcdNodeRemovesNode",
+			Input: newData().withK8sResourceReady().withDedicatedEtcdNode().with(func(d testData) {
+				d.Status.Kubernetes.Nodes = append(d.Status.Kubernetes.Nodes, corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{Name: d.NonCPWorkers()[0].Address},
+				})
+			}),
+			ExpectedOps:        []string{"remove-node"},
+			ExpectedTargetNums: map[string]int{"remove-node": 1},
+		},
+		{
+			Name: "EtcdDestroyControlPlaneWithoutEtcd",
+			Input: newData().withAllServices().with(func(d testData) {
+				etcdNode := false
+				d.Cluster.Nodes[0].Etcd = &etcdNode
+				d.updateEtcdRiversUpstreams()
+			}),
+			ExpectedOps:        []string{"etcd-destroy-member"},
+			ExpectedTargetNums: map[string]int{"etcd-destroy-member": 1},
+		},
 		{
 			Name: "EtcdIsNotGood",
 			Input: newData().withK8sResourceReady().with(func(d testData) {
@@ -1738,19 +2184,577 @@ func TestDecideOps(t *testing.T) {
 			ExpectedOps: []string{"etcd-restart"},
 		},
 		{
-			Name: "Clean",
+			Name: "EtcdDefrag",
 			Input: newData().withK8sResourceReady().with(func(d testData) {
-				for _, node := range []string{"10.0.0.14", "10.0.0.15"} {
-					st := d.Status.NodeStatuses[node]
-					st.Etcd.Running = true
-					st.Etcd.HasData = true
-					st.APIServer.Running = true
-					st.ControllerManager.Running = true
+				d.Status.Etcd.DBSize = map[string]int64{
+					"10.0.0.11": 300 << 20,
+					"10.0.0.12": 1 << 30,
+					"10.0.0.13": 1 << 30,
+				}
+				d.Status.Etcd.DBSizeInUse = map[string]int64{
+					"10.0.0.11": 100 << 20,
+					"10.0.0.12": 900 << 20,
+					"10.0.0.13": 100 << 20,
+				}
+			}),
+			ExpectedOps:        []string{"etcd-defrag"},
+			ExpectedTargetNums: map[string]int{"etcd-defrag": 1},
+		},
+		{
+			Name: "EtcdDefragSmall",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.Etcd.DBSize = map[string]int64{"10.0.0.11": 90 << 20}
+				d.Status.Etcd.DBSizeInUse = map[string]int64{"10.0.0.11": 1 << 20}
+			}),
+			ExpectedOps: nil,
+		},
+		{
+			Name: "EtcdDefragNotGood",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.Etcd.DBSize = map[string]int64{"10.0.0.11": 1 << 30}
+				d.Status.Etcd.DBSizeInUse = map[string]int64{"10.0.0.11": 100 << 20}
+				delete(d.Status.Etcd.InSyncMembers, "10.0.0.12")
+			}),
+			ExpectedOps: nil,
+		},
+		{
+			Name: "EtcdNoSpace",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.Etcd.IsHealthy = false
+				d.Status.Etcd.Alarms = []*etcdserverpb.AlarmMember{
+					{MemberID: 1, Alarm: etcdserverpb.AlarmType_NOSPACE},
+				}
+			}),
+			ExpectedOps:        []string{"etcd-recover-nospace"},
+			ExpectedTargetNums: map[string]int{"etcd-recover-nospace": 3},
+		},
+		{
+			Name: "EtcdNoSpaceUnreachable",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.Etcd.IsHealthy = false
+				d.Status.Etcd.Alarms = []*etcdserverpb.AlarmMember{
+					{MemberID: 1, Alarm: etcdserverpb.AlarmType_NOSPACE},
+				}
+			}).withSSHNotConnectedCP(),
+			ExpectedOps: []string{"etcd-wait-cluster"},
+		},
+		{
+			Name: "EtcdNoSpaceNotResponding",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.Etcd.IsHealthy = false
+				d.Status.Etcd.Alarms = []*etcdserverpb.AlarmMember{
+					{MemberID: 1, Alarm: etcdserverpb.AlarmType_NOSPACE},
+				}
+				d.Status.Etcd.InSyncMembers["10.0.0.12"] = false
+			}),
+			ExpectedOps: []string{"etcd-wait-cluster"},
+		},
+		{
+			Name:        "K8sUpgradeStart",
+			Input:       newData().withK8sResourceReady().withOldKubernetes(1),
+			ExpectedOps: []string{"k8s-upgrade-record"},
+		},
+		{
+			Name: "K8sUpgradeBuildNumber",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				image := cke.KubernetesImage.Name()
+				image = image[:strings.LastIndex(image, ".")] + ".0"
+				for _, n := range d.ControlPlane() {
+					d.NodeStatus(n).APIServer.Image = image
+				}
+			}),
+			ExpectedOps: []string{"k8s-upgrade-record"},
+		},
+		{
+			Name:          "K8sUpgradeSkipMinor",
+			Input:         newData().withK8sResourceReady().withOldKubernetes(2),
+			ExpectedOps:   nil,
+			ExpectedPhase: cke.PhaseK8sUpgradeAborted,
+		},
+		{
+			Name: "K8sUpgradeSkipMinorBoot",
+			Input: newData().withK8sResourceReady().withOldKubernetes(2).with(func(d testData) {
+				d.NodeStatus(d.Cluster.Nodes[5]).Kubelet.Running = false
+			}),
+			ExpectedOps:        []string{"kubelet-bootstrap"},
+			ExpectedTargetNums: map[string]int{"kubelet-bootstrap": 1},
+		},
+		{
+			Name: "K8sUpgradeSkipMinorMaintain",
+			Input: newData().withK8sResourceReady().withOldKubernetes(2).with(func(d testData) {
+				d.Status.Kubernetes.EtcdEndpoints.Subsets = []corev1.EndpointSubset{}
+			}),
+			ExpectedOps: []string{"update-endpoints"},
+		},
+		{
+			Name: "K8sUpgradeNotStartedUnreachable",
+			Input: newData().withK8sResourceReady().withOldKubernetes(1).with(func(d testData) {
+				d.NodeStatus(d.Cluster.Nodes[5]).Kubelet.Running = false
+			}).withSSHNotConnectedCP(),
+			ExpectedOps:        []string{"kubelet-bootstrap"},
+			ExpectedTargetNums: map[string]int{"kubelet-bootstrap": 1},
+		},
+		{
+			Name: "K8sUpgradeUnreachable",
+			Input: newData().withK8sResourceReady().withOldKubernetes(1).with(func(d testData) {
+				d.Status.KubernetesUpgrade = newKubernetesUpgrade(cke.UpgradeStageAPIServer)
+			}).withSSHNotConnectedCP(),
+			ExpectedOps: nil,
+		},
+		{
+			Name: "K8sUpgradeEtcd",
+			Input: newData().withK8sResourceReady().withOldKubernetes(1).with(func(d testData) {
+				d.Status.KubernetesUpgrade = newKubernetesUpgrade(cke.UpgradeStageEtcd)
+				d.NodeStatus(d.ControlPlane()[0]).Etcd.Image = ""
+			}),
+			ExpectedOps:        []string{"etcd-restart"},
+			ExpectedTargetNums: map[string]int{"etcd-restart": 1},
+		},
+		{
+			Name: "K8sUpgradeEtcdDone",
+			Input: newData().withK8sResourceReady().withOldKubernetes(1).with(func(d testData) {
+				d.Status.KubernetesUpgrade = newKubernetesUpgrade(cke.UpgradeStageEtcd)
+			}),
+			ExpectedOps: []string{"k8s-upgrade-record"},
+		},
+		{
+			Name: "K8sUpgradeEtcdNotGood",
+			Input: newData().withK8sResourceReady().withOldKubernetes(1).with(func(d testData) {
+				d.Status.KubernetesUpgrade = newKubernetesUpgrade(cke.UpgradeStageEtcd)
+				d.Status.Etcd.Learners = map[string]bool{"10.0.0.13": true}
+				delete(d.Status.Etcd.InSyncMembers, "10.0.0.13")
+				d.NodeStatus(d.ControlPlane()[0]).Scheduler.Running = false
+			}),
+			ExpectedOps:        []string{"etcd-promote-member"},
+			ExpectedTargetNums: map[string]int{"etcd-promote-member": 1},
+		},
+		{
+			Name: "K8sUpgradeAPIServer",
+			Input: newData().withK8sResourceReady().withOldKubernetes(1).with(func(d testData) {
+				d.Status.KubernetesUpgrade = newKubernetesUpgrade(cke.UpgradeStageAPIServer)
+			}),
+			ExpectedOps:        []string{"kube-apiserver-restart"},
+			ExpectedTargetNums: map[string]int{"kube-apiserver-restart": 1},
+		},
+		{
+			Name: "K8sUpgradeAPIServerUnhealthy",
+			Input: newData().withK8sResourceReady().withOldKubernetes(1).with(func(d testData) {
+				d.Status.KubernetesUpgrade = newKubernetesUpgrade(cke.UpgradeStageAPIServer)
+				st := &d.NodeStatus(d.ControlPlane()[0]).APIServer
+				st.Image = cke.KubernetesImage.Name()
+				st.IsHealthy = false
+			}),
+			ExpectedOps: nil,
+		},
+		{
+			Name: "K8sUpgradeAPIServerUnhealthyStopped",
+			Input: newData().withK8sResourceReady().withOldKubernetes(1).with(func(d testData) {
+				d.Status.KubernetesUpgrade = newKubernetesUpgrade(cke.UpgradeStageAPIServer)
+				st := &d.NodeStatus(d.ControlPlane()[0]).APIServer
+				st.Image = cke.KubernetesImage.Name()
+				st.IsHealthy = false
+				d.NodeStatus(d.ControlPlane()[1]).APIServer.Running = false
+			}),
+			ExpectedOps:        []string{"kube-apiserver-restart"},
+			ExpectedTargetNums: map[string]int{"kube-apiserver-restart": 1},
+		},
+		{
+			Name: "K8sUpgradeControllers",
+			Input: newData().withK8sResourceReady().withOldKubernetes(1).with(func(d testData) {
+				d.Status.KubernetesUpgrade = newKubernetesUpgrade(cke.UpgradeStageControllers)
+				for _, n := range d.ControlPlane() {
+					d.NodeStatus(n).APIServer.Image = cke.KubernetesImage.Name()
+				}
+			}),
+			ExpectedOps: []string{"kube-controller-manager-restart", "kube-scheduler-restart"},
+			ExpectedTargetNums: map[string]int{
+				"kube-controller-manager-restart": 3,
+				"kube-scheduler-restart":          3,
+			},
+		},
+		{
+			Name: "K8sUpgradeNodes",
+			Input: newData().withK8sResourceReady().withOldKubernetes(1).with(func(d testData) {
+				d.Status.KubernetesUpgrade = newKubernetesUpgrade(cke.UpgradeStageNodes)
+				for _, n := range d.ControlPlane() {
+					d.NodeStatus(n).APIServer.Image = cke.KubernetesImage.Name()
+					d.NodeStatus(n).ControllerManager.Image = cke.KubernetesImage.Name()
+					d.NodeStatus(n).Scheduler.Image = cke.KubernetesImage.Name()
+				}
+			}),
+			ExpectedOps: []string{"kube-proxy-restart", "kubelet-restart"},
+			ExpectedTargetNums: map[string]int{
+				"kube-proxy-restart": 1,
+				"kubelet-restart":    1,
+			},
+		},
+		{
+			Name: "K8sUpgradeNodesNotReady",
+			Input: newData().withK8sResourceReady().withOldKubernetes(1).with(func(d testData) {
+				d.Status.KubernetesUpgrade = newKubernetesUpgrade(cke.UpgradeStageNodes)
+				for _, n := range d.ControlPlane() {
+					d.NodeStatus(n).APIServer.Image = cke.KubernetesImage.Name()
+					d.NodeStatus(n).ControllerManager.Image = cke.KubernetesImage.Name()
+					d.NodeStatus(n).Scheduler.Image = cke.KubernetesImage.Name()
+				}
+				d.NodeStatus(d.Cluster.Nodes[0]).Kubelet.Image = cke.KubernetesImage.Name()
+				d.Status.Kubernetes.Nodes[0].Status.Conditions = nil
+			}),
+			ExpectedOps: nil,
+		},
+		{
+			Name: "K8sUpgradeNodesStopped",
+			Input: newData().withK8sResourceReady().withOldKubernetes(1).with(func(d testData) {
+				d.Status.KubernetesUpgrade = newKubernetesUpgrade(cke.UpgradeStageNodes)
+				for _, n := range d.ControlPlane() {
+					d.NodeStatus(n).APIServer.Image = cke.KubernetesImage.Name()
+					d.NodeStatus(n).ControllerManager.Image = cke.KubernetesImage.Name()
+					d.NodeStatus(n).Scheduler.Image = cke.KubernetesImage.Name()
+				}
+				d.NodeStatus(d.Cluster.Nodes[5]).Kubelet.Running = false
+			}),
+			ExpectedOps:        []string{"kubelet-bootstrap"},
+			ExpectedTargetNums: map[string]int{"kubelet-bootstrap": 1},
+		},
+		{
+			Name: "K8sUpgradeFinish",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.KubernetesUpgrade = newKubernetesUpgrade(cke.UpgradeStageNodes)
+			}),
+			ExpectedOps: []string{"k8s-upgrade-finish"},
+		},
+		{
+			Name: "K8sUpgradeNewTarget",
+			Input: newData().withK8sResourceReady().withOldKubernetes(1).with(func(d testData) {
+				d.Status.KubernetesUpgrade = newKubernetesUpgrade(cke.UpgradeStageNodes)
+				d.Status.KubernetesUpgrade.To = "quay.io/cybozu/kubernetes:0.0.0.1"
+			}),
+			ExpectedOps: []string{"k8s-upgrade-record"},
+		},
+		{
+			Name: "EncryptionKeyPrepare",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.EncryptionKeyRotation = newEncryptionKeyRotation(cke.EncryptionKeyStagePrepare)
+			}),
+			ExpectedOps: nil,
+		},
+		{
+			Name: "EncryptionKeyRestart",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.EncryptionKeyRotation = newEncryptionKeyRotation(cke.EncryptionKeyStageAdd)
+				d.Status.EncryptionKeyRotation.Restarted = []string{d.ControlPlane()[0].Address}
+			}),
+			ExpectedOps: []string{"encryption-key-record", "kube-apiserver-restart"},
+			ExpectedTargetNums: map[string]int{
+				"encryption-key-record":  0,
+				"kube-apiserver-restart": 1,
+			},
+		},
+		{
+			Name: "EncryptionKeyWaitAPIServer",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.EncryptionKeyRotation = newEncryptionKeyRotation(cke.EncryptionKeyStagePromote)
+				d.NodeStatus(d.ControlPlane()[0]).APIServer.IsHealthy = false
+			}),
+			ExpectedOps: []string{"update-endpoints"},
+		},
+		{
+			Name: "EncryptionKeyPromote",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.EncryptionKeyRotation = newEncryptionKeyRotation(cke.EncryptionKeyStageAdd)
+				for _, n := range d.ControlPlane() {
+					d.Status.EncryptionKeyRotation.Restarted = append(d.Status.EncryptionKeyRotation.Restarted, n.Address)
+				}
+			}),
+			ExpectedOps: []string{"encryption-key-record"},
+		},
+		{
+			Name: "EncryptionKeyRewrite",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.EncryptionKeyRotation = newEncryptionKeyRotation(cke.EncryptionKeyStageRewrite)
+			}),
+			ExpectedOps:        []string{"encryption-key-rewrite"},
+			ExpectedTargetNums: map[string]int{"encryption-key-rewrite": 1},
+		},
+		{
+			Name: "EncryptionKeyRewriteResources",
+			Input: newData().withK8sResourceReady().withEncryptionResources("secrets", "configmaps").with(func(d testData) {
+				d.Status.EncryptedResources.Resources = []string{"secrets", "configmaps"}
+				d.Status.EncryptionKeyRotation = newEncryptionKeyRotation(cke.EncryptionKeyStageRewrite)
+			}),
+			ExpectedOps:        []string{"encryption-key-rewrite"},
+			ExpectedTargetNums: map[string]int{"encryption-key-rewrite": 1},
+		},
+		{
+			Name: "EncryptionKeyFinish",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.EncryptionKeyRotation = newEncryptionKeyRotation(cke.EncryptionKeyStageDrop)
+				for _, n := range d.ControlPlane() {
+					d.Status.EncryptionKeyRotation.Restarted = append(d.Status.EncryptionKeyRotation.Restarted, n.Address)
+				}
+			}),
+			ExpectedOps: []string{"encryption-key-finish"},
+		},
+		{
+			Name: "EncryptionRestartAPIServer",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Cluster.Options.APIServer.Encryption.Resources = []string{"secrets", "configmaps"}
+			}),
+			ExpectedOps:        []string{"kube-apiserver-restart"},
+			ExpectedTargetNums: map[string]int{"kube-apiserver-restart": 3},
+		},
+		{
+			Name:               "EncryptionRewrite",
+			Input:              newData().withK8sResourceReady().withEncryptionResources("secrets", "configmaps"),
+			ExpectedOps:        []string{"encryption-rewrite-resources"},
+			ExpectedTargetNums: map[string]int{"encryption-rewrite-resources": 1},
+		},
+		{
+			Name: "EncryptionRewriteDone",
+			Input: newData().withK8sResourceReady().withEncryptionResources("secrets", "configmaps").with(func(d testData) {
+				d.Status.EncryptedResources.Resources = []string{"secrets", "configmaps"}
+			}),
+			ExpectedOps: nil,
+		},
+		{
+			Name: "EncryptionRewriteRemoved",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.EncryptedResources.Resources = []string{"secrets", "configmaps"}
+			}),
+			ExpectedOps: []string{"encryption-rewrite-resources"},
+		},
+		{
+			Name: "EncryptionUnknownResource",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Cluster.Options.APIServer.Encryption.Resources = []string{"secrets", "foos.example.com"}
+				d.Status.Kubernetes.UnknownEncryptionResources = []string{"foos.example.com"}
+			}),
+			ExpectedOps: nil,
+		},
+		{
+			Name: "EncryptionFromKMS",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Cluster.Options.APIServer.Encryption.Resources = []string{"configmaps"}
+				d.Status.EncryptedResources.Provider = cke.EncryptionProviderKMS
+			}),
+			ExpectedOps: nil,
+		},
+		{
+			Name: "EncryptionKeyUnreachable",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.EncryptionKeyRotation = newEncryptionKeyRotation(cke.EncryptionKeyStageAdd)
+			}).withSSHNotConnectedCP(),
+			ExpectedOps: []string{"update-endpoints"},
+		},
+		{
+			Name: "CARotationPrepare",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.CARotation = newCARotation(cke.CAKubernetes, cke.CARotationStagePrepare)
+			}),
+			ExpectedOps: nil,
+		},
+		{
+			Name: "CARotationKubernetesControlPlane",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.CARotation = newCARotation(cke.CAKubernetes, cke.CARotationStageBundle)
+			}),
+			ExpectedOps: []string{
+				"ca-rotation-record",
+				"kube-apiserver-restart",
+				"kube-controller-manager-restart",
+				"kube-proxy-restart",
+				"kube-scheduler-restart",
+				"kubelet-restart",
+			},
+			ExpectedTargetNums: map[string]int{
+				"ca-rotation-record":              0,
+				"kube-apiserver-restart":          1,
+				"kube-controller-manager-restart": 1,
+				"kube-proxy-restart":              1,
+				"kube-scheduler-restart":          1,
+				"kubelet-restart":                 1,
+			},
+		},
+		{
+			Name: "CARotationKubernetesWorker",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.CARotation = newCARotation(cke.CAKubernetes, cke.CARotationStageReissue)
+				for _, n := range d.ControlPlane() {
+					d.Status.CARotation.Restarted = append(d.Status.CARotation.Restarted, n.Address)
+				}
+			}),
+			ExpectedOps: []string{"ca-rotation-record", "kube-proxy-restart", "kubelet-restart"},
+			ExpectedTargetNums: map[string]int{
+				"ca-rotation-record": 0,
+				"kube-proxy-restart": 1,
+				"kubelet-restart":    1,
+			},
+		},
+		{
+			Name: "CARotationEtcdPeer",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.CARotation = newCARotation(cke.CAEtcdPeer, cke.CARotationStageBundle)
+				d.Status.CARotation.Restarted = []string{d.ControlPlane()[0].Address}
+			}),
+			ExpectedOps:        []string{"ca-rotation-record", "etcd-restart"},
+			ExpectedTargetNums: map[string]int{"ca-rotation-record": 0, "etcd-restart": 1},
+		},
+		{
+			Name: "CARotationSwitch",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.CARotation = newCARotation(cke.CAEtcdClient, cke.CARotationStageBundle)
+				for _, n := range d.ControlPlane() {
+					d.Status.CARotation.Restarted = append(d.Status.CARotation.Restarted, n.Address)
+				}
+			}),
+			ExpectedOps: []string{"ca-rotation-switch"},
+		},
+		{
+			Name: "CARotationDrop",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.CARotation = newCARotation(cke.CAKubernetesAggregation, cke.CARotationStageReissue)
+				for _, n := range d.ControlPlane() {
+					d.Status.CARotation.Restarted = append(d.Status.CARotation.Restarted, n.Address)
+				}
+			}),
+			ExpectedOps: []string{"ca-rotation-record"},
+		},
+		{
+			Name: "CARotationFinish",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.CARotation = newCARotation(cke.CAServer, cke.CARotationStageDrop)
+				for _, n := range d.ControlPlane() {
+					d.Status.CARotation.Restarted = append(d.Status.CARotation.Restarted, n.Address)
+				}
+			}),
+			ExpectedOps: []string{"ca-rotation-finish"},
+		},
+		{
+			Name: "CARotationWebhook",
+			Input: newData().withK8sResourceReady().withResources(
+				append(testResources, cke.ResourceDefinition{
+					Key:        "Secret/foo/webhook-cert",
+					Kind:       cke.KindSecret,
+					Namespace:  "foo",
+					Name:       "webhook-cert",
+					Revision:   1,
+					Definition: []byte(`{"apiversion":"v1","kind":"Secret","metadata":{"namespace":"foo","name":"webhook-cert","annotations":{"cke.cybozu.com/issue-cert":"webhook"}}}`),
+				})).with(func(d testData) {
+				d.Status.Kubernetes.ResourceStatuses["Secret/foo/webhook-cert"] = cke.ResourceStatus{
+					Annotations: map[string]string{
+						cke.AnnotationResourceRevision:  "1",
+						cke.AnnotationResourceIssueCert: "webhook",
+					},
+					HasBeenSSA: true,
+				}
+				d.Status.CARotation = newCARotation(cke.CAWebhook, cke.CARotationStageBundle)
+			}),
+			ExpectedOps: []string{"ca-rotation-switch", "resource-apply"},
+		},
+		{
+			Name: "CARotationUnreachable",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.CARotation = newCARotation(cke.CAKubernetes, cke.CARotationStageBundle)
+			}).withSSHNotConnectedCP(),
+			ExpectedOps: []string{"update-endpoints"},
+		},
+		{
+			Name: "ServiceAccountKeyRestartAPIServer",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.ServiceAccountKeyRotation = newServiceAccountKeyRotation(cke.ServiceAccountKeyStageAdd)
+				d.Status.ServiceAccountKeyRotation.Restarted = []string{d.ControlPlane()[0].Address}
+			}),
+			ExpectedOps: []string{"kube-apiserver-restart", "sa-key-record"},
+			ExpectedTargetNums: map[string]int{
+				"kube-apiserver-restart": 1,
+				"sa-key-record":          0,
+			},
+		},
+		{
+			Name: "ServiceAccountKeySwitch",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.ServiceAccountKeyRotation = newServiceAccountKeyRotation(cke.ServiceAccountKeyStageAdd)
+				for _, n := range d.ControlPlane() {
+					d.Status.ServiceAccountKeyRotation.Restarted = append(d.Status.ServiceAccountKeyRotation.Restarted, n.Address)
+				}
+			}),
+			ExpectedOps: []string{"sa-key-switch"},
+		},
+		{
+			Name: "ServiceAccountKeyRestartControllerManager",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.ServiceAccountKeyRotation = newServiceAccountKeyRotation(cke.ServiceAccountKeyStageSwitch)
+			}),
+			ExpectedOps: []string{"kube-controller-manager-restart", "sa-key-record"},
+			ExpectedTargetNums: map[string]int{
+				"kube-controller-manager-restart": 1,
+				"sa-key-record":                   0,
+			},
+		},
+		{
+			Name: "ServiceAccountKeyStartGrace",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.ServiceAccountKeyRotation = newServiceAccountKeyRotation(cke.ServiceAccountKeyStageSwitch)
+				for _, n := range d.ControlPlane() {
+					d.Status.ServiceAccountKeyRotation.Restarted = append(d.Status.ServiceAccountKeyRotation.Restarted, n.Address)
+				}
+			}),
+			ExpectedOps: []string{"sa-key-record"},
+		},
+		{
+			Name: "ServiceAccountKeyInGrace",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.ServiceAccountKeyRotation = newServiceAccountKeyRotation(cke.ServiceAccountKeyStageGrace)
+				d.Status.ServiceAccountKeyRotation.SwitchedAt = time.Now()
+			}),
+			ExpectedOps: nil,
+		},
+		{
+			Name: "ServiceAccountKeyRegenerateTokens",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.ServiceAccountKeyRotation = newServiceAccountKeyRotation(cke.ServiceAccountKeyStageGrace)
+				d.Status.ServiceAccountKeyRotation.SwitchedAt = time.Now().Add(-2 * time.Hour)
+				d.Status.Kubernetes.OldServiceAccountTokens = []types.NamespacedName{
+					{Namespace: "kube-system", Name: "cke-cluster-dns-token-abcde"},
+				}
+			}),
+			ExpectedOps:        []string{"sa-token-regenerate"},
+			ExpectedTargetNums: map[string]int{"sa-token-regenerate": 1},
+		},
+		{
+			Name: "ServiceAccountKeyGraceExpired",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.ServiceAccountKeyRotation = newServiceAccountKeyRotation(cke.ServiceAccountKeyStageGrace)
+				d.Status.ServiceAccountKeyRotation.SwitchedAt = time.Now().Add(-2 * time.Hour)
+			}),
+			ExpectedOps: []string{"sa-key-record"},
+		},
+		{
+			Name: "ServiceAccountKeyFinish",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.ServiceAccountKeyRotation = newServiceAccountKeyRotation(cke.ServiceAccountKeyStageDrop)
+				for _, n := range d.ControlPlane() {
+					d.Status.ServiceAccountKeyRotation.Restarted = append(d.Status.ServiceAccountKeyRotation.Restarted, n.Address)
+				}
+			}),
+			ExpectedOps: []string{"sa-key-finish"},
+		},
+		{
+			Name: "Clean",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				for _, node := range []string{"10.0.0.14", "10.0.0.15"} {
+					st := d.Status.NodeStatuses[node]
+					st.Etcd.Running = true
+					st.Etcd.HasData = true
+					st.APIServer.Running = true
+					st.ControllerManager.Running = true
 					st.Scheduler.Running = true
 					st.EtcdRivers.Running = true
+					st.KMSPlugin.Running = true
 				}
 			}).withSSHNotConnectedNonCPWorker(1),
 			ExpectedOps: []string{
+				"stop-cke-kms-plugin",
 				"stop-etcd",
 				"stop-etcd-rivers",
 				"stop-kube-apiserver",
@@ -1758,6 +2762,7 @@ func TestDecideOps(t *testing.T) {
 				"stop-kube-scheduler",
 			},
 			ExpectedTargetNums: map[string]int{
+				"stop-cke-kms-plugin":          1,
 				"stop-etcd":                    1,
 				"stop-etcd-rivers":             1,
 				"stop-kube-apiserver":          1,
@@ -1893,6 +2898,64 @@ func TestDecideOps(t *testing.T) {
 			ExpectedOps:        nil,
 			ExpectedTargetNums: nil,
 		},
+		{
+			Name:               "EtcdBackup",
+			Input:              newData().withK8sResourceReady().withEtcdBackup(),
+			ExpectedOps:        []string{"etcd-backup"},
+			ExpectedTargetNums: map[string]int{"etcd-backup": 2},
+		},
+		{
+			Name: "EtcdBackupNotYet",
+			Input: newData().withK8sResourceReady().withEtcdBackup().with(func(d testData) {
+				d.Status.EtcdBackup.LastSuccess = time.Now().Add(-30 * time.Minute)
+			}),
+			ExpectedOps: nil,
+		},
+		{
+			Name: "EtcdBackupExpired",
+			Input: newData().withK8sResourceReady().withEtcdBackup().with(func(d testData) {
+				d.Status.EtcdBackup.LastSuccess = time.Now().Add(-2 * time.Hour)
+				d.Status.EtcdBackup.LastTry = time.Now().Add(-2 * time.Hour)
+			}),
+			ExpectedOps: []string{"etcd-backup"},
+		},
+		{
+			Name: "EtcdBackupRetryLater",
+			Input: newData().withK8sResourceReady().withEtcdBackup().with(func(d testData) {
+				d.Status.EtcdBackup.LastSuccess = time.Now().Add(-2 * time.Hour)
+				d.Status.EtcdBackup.LastTry = time.Now().Add(-time.Minute)
+			}),
+			ExpectedOps: nil,
+		},
+		{
+			Name: "EtcdBackupUnhealthyEtcd",
+			Input: newData().withK8sResourceReady().withEtcdBackup().with(func(d testData) {
+				delete(d.Status.Etcd.InSyncMembers, "10.0.0.11")
+			}),
+			ExpectedOps: nil,
+		},
+		{
+			Name: "EtcdBackupDisabled",
+			Input: newData().withK8sResourceReady().withEtcdBackup().with(func(d testData) {
+				d.Cluster.EtcdBackup.Enabled = false
+			}),
+			ExpectedOps: nil,
+		},
+		{
+			Name: "EtcdRestore",
+			Input: newData().withK8sResourceReady().withEtcdBackup().with(func(d testData) {
+				d.Status.EtcdRestore = &cke.EtcdRestoreRequest{Snapshot: "etcd-20210102-030405.backup"}
+			}),
+			ExpectedOps:        []string{"etcd-restore"},
+			ExpectedTargetNums: map[string]int{"etcd-restore": 3},
+		},
+		{
+			Name: "EtcdRestoreAborted",
+			Input: newData().withK8sResourceReady().withEtcdBackup().withSSHNotConnectedCP().with(func(d testData) {
+				d.Status.EtcdRestore = &cke.EtcdRestoreRequest{Snapshot: "etcd-20210102-030405.backup"}
+			}),
+			ExpectedOps: nil,
+		},
 		{
 			Name: "CancelReboot",
 			Input: newData().withK8sResourceReady().withRebootConfig().withRebootEntry(&cke.RebootQueueEntry{
@@ -1907,7 +2970,10 @@ func TestDecideOps(t *testing.T) {
 
 	for _, c := range cases {
 		t.Run(c.Name, func(t *testing.T) {
-			ops, _ := DecideOps(c.Input.Cluster, c.Input.Status, c.Input.Constraints, c.Input.Resources, c.Input.Reboot)
+			ops, phase := DecideOps(c.Input.Cluster, c.Input.Status, c.Input.Constraints, c.Input.Resources, c.Input.Reboot)
+			if c.ExpectedPhase != "" && phase != c.ExpectedPhase {
+				t.Errorf("unexpected phase: expected=%s, actual=%s", c.ExpectedPhase, phase)
+			}
 			if len(ops) == 0 && len(c.ExpectedOps) == 0 {
 				return
 			}
@@ -0,0 +1,147 @@
+package cke
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// DefaultServiceAccountKeyGracePeriod is the default period to keep the old
+// service account key after controller managers start signing with the new key.
+const DefaultServiceAccountKeyGracePeriod = 24 * time.Hour
+
+// ServiceAccountKeyRotationStage is the type of the stages of service account key rotation.
+type ServiceAccountKeyRotationStage string
+
+// Service account key rotation stages in the order of execution.
+const (
+	// ServiceAccountKeyStageAdd adds the new key to verify tokens.
+	ServiceAccountKeyStageAdd = ServiceAccountKeyRotationStage("add")
+	// ServiceAccountKeyStageSwitch makes controller managers sign tokens with the new key.
+	ServiceAccountKeyStageSwitch = ServiceAccountKeyRotationStage("switch")
+	// ServiceAccountKeyStageGrace waits for tokens signed with the old key to expire.
+	ServiceAccountKeyStageGrace = ServiceAccountKeyRotationStage("grace")
+	// ServiceAccountKeyStageDrop removes the old key to verify tokens.
+	ServiceAccountKeyStageDrop = ServiceAccountKeyRotationStage("drop")
+)
+
+// ServiceAccountKeyRotation records the progress of the rotation of the key
+// to sign service account tokens.
+type ServiceAccountKeyRotation struct {
+	Stage ServiceAccountKeyRotationStage `json:"stage"`
+
+	// OldCert is the certificate of the key being replaced.
+	OldCert string `json:"old_cert"`
+
+	// NewCert and NewKey are the certificate and the private key of the new key.
+	NewCert string `json:"new_cert"`
+	NewKey  string `json:"new_key"`
+
+	// GracePeriod is the period to keep the old key after the switch, such as "24h".
+	GracePeriod string `json:"grace_period"`
+
+	// Restarted is the list of addresses of nodes where kube-apiserver or
+	// kube-controller-manager has been restarted in the current stage.
+	Restarted []string `json:"restarted,omitempty"`
+
+	StartedAt time.Time `json:"started_at"`
+
+	// SwitchedAt is the time when all controller managers started signing with the new key.
+	SwitchedAt time.Time `json:"switched_at,omitempty"`
+}
+
+// GetGracePeriod returns the period to keep the old key after the switch.
+func (r *ServiceAccountKeyRotation) GetGracePeriod() time.Duration {
+	d, err := time.ParseDuration(r.GracePeriod)
+	if err != nil {
+		return DefaultServiceAccountKeyGracePeriod
+	}
+	return d
+}
+
+// AdditionalCert returns the certificate to verify tokens in addition to
+// the certificate of the current signing key.
+// If r is nil or the old key has been dropped, this returns an empty string.
+func (r *ServiceAccountKeyRotation) AdditionalCert() string {
+	if r == nil {
+		return ""
+	}
+	switch r.Stage {
+	case ServiceAccountKeyStageAdd:
+		return r.NewCert
+	case ServiceAccountKeyStageSwitch, ServiceAccountKeyStageGrace:
+		return r.OldCert
+	}
+	return ""
+}
+
+// IsRestarted returns true if the component on the node has been restarted in the current stage.
+func (r *ServiceAccountKeyRotation) IsRestarted(address string) bool {
+	for _, a := range r.Restarted {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+// WithRestarted returns a copy of r with address added to Restarted.
+func (r *ServiceAccountKeyRotation) WithRestarted(address string) *ServiceAccountKeyRotation {
+	nr := *r
+	nr.Restarted = append(append([]string(nil), r.Restarted...), address)
+	return &nr
+}
+
+// WithStage returns a copy of r proceeded to the stage.
+func (r *ServiceAccountKeyRotation) WithStage(stage ServiceAccountKeyRotationStage) *ServiceAccountKeyRotation {
+	nr := *r
+	nr.Stage = stage
+	nr.Restarted = nil
+	return &nr
+}
+
+// ServiceAccountTokenSignedBy returns true if the service account token
+// is signed with the key of the certificate.
+// Only RS256 and ES256 are supported as they are the algorithms of the
+// keys issued by CKE.
+func ServiceAccountTokenSignedBy(token, cert string) (bool, error) {
+	block, _ := pem.Decode([]byte(cert))
+	if block == nil {
+		return false, errors.New("invalid certificate")
+	}
+	c, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false, err
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false, errors.New("invalid token")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false, err
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	switch pub := c.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], sig) == nil, nil
+	case *ecdsa.PublicKey:
+		if len(sig) != 64 {
+			return false, nil
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(pub, hash[:], r, s), nil
+	}
+	return false, errors.New("unsupported key type")
+}
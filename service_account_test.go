@@ -0,0 +1,60 @@
+package cke
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+)
+
+func testSignToken(t *testing.T, key string) string {
+	block, _ := pem.Decode([]byte(key))
+	priv, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString([]byte(`{"alg":"ES256"}`)) + "." + enc.EncodeToString([]byte(`{"sub":"system:serviceaccount:kube-system:default"}`))
+	hash := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, priv, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return signed + "." + enc.EncodeToString(sig)
+}
+
+func TestServiceAccountTokenSignedBy(t *testing.T) {
+	t.Parallel()
+
+	oldCert, oldKey := testKeyPair(t, "old")
+	newCert, _ := testKeyPair(t, "new")
+	token := testSignToken(t, oldKey)
+
+	signed, err := ServiceAccountTokenSignedBy(token, oldCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !signed {
+		t.Error("token should be signed with the old key")
+	}
+
+	signed, err = ServiceAccountTokenSignedBy(token, newCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed {
+		t.Error("token should not be signed with the new key")
+	}
+
+	_, err = ServiceAccountTokenSignedBy("invalid", oldCert)
+	if err == nil {
+		t.Error("invalid token should be an error")
+	}
+}
@@ -0,0 +1,105 @@
+package cke
+
+import "time"
+
+// SSHKeyRotationStage is the type of the stages of SSH key rotation.
+type SSHKeyRotationStage string
+
+// SSH key rotation stages in the order of execution.
+const (
+	// SSHKeyStageInstall installs the new public key on reachable nodes.
+	SSHKeyStageInstall = SSHKeyRotationStage("install")
+	// SSHKeyStageVerify verifies login with the new key, then swaps the secret.
+	SSHKeyStageVerify = SSHKeyRotationStage("verify")
+	// SSHKeyStageRemove removes the old public keys from the nodes.
+	SSHKeyStageRemove = SSHKeyRotationStage("remove")
+)
+
+// SSHKeyRotation records the progress of the rotation of SSH keys to login to nodes.
+// The new private key is stored in SSHNextSecret until it replaces SSHSecret.
+type SSHKeyRotation struct {
+	Stage SSHKeyRotationStage `json:"stage"`
+
+	// NewPublicKey is the new public key in authorized_keys format.
+	// This is empty until the new private key is stored in SSHNextSecret.
+	NewPublicKey string `json:"new_public_key"`
+
+	// OldPublicKeys are the public keys used to login to nodes before the rotation.
+	// Keys are node addresses.
+	OldPublicKeys map[string]string `json:"old_public_keys,omitempty"`
+
+	// Installed is the list of addresses of nodes where the new key has been installed.
+	Installed []string `json:"installed,omitempty"`
+
+	// Done is the list of addresses of nodes processed in the current stage.
+	Done []string `json:"done,omitempty"`
+
+	StartedAt time.Time `json:"started_at"`
+}
+
+// IsInstalled returns true if the new key has been installed on the node.
+func (r *SSHKeyRotation) IsInstalled(address string) bool {
+	for _, a := range r.Installed {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDone returns true if the node has been processed in the current stage.
+func (r *SSHKeyRotation) IsDone(address string) bool {
+	for _, a := range r.Done {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+// WithInstalled returns a copy of r with the node added to Installed and Done.
+// oldKey is the public key used to login to the node.
+func (r *SSHKeyRotation) WithInstalled(address, oldKey string) *SSHKeyRotation {
+	nr := r.WithDone(address)
+	nr.Installed = append(append([]string(nil), r.Installed...), address)
+	nr.OldPublicKeys = make(map[string]string)
+	for k, v := range r.OldPublicKeys {
+		nr.OldPublicKeys[k] = v
+	}
+	nr.OldPublicKeys[address] = oldKey
+	return nr
+}
+
+// WithUninstalled returns a copy of r with the node removed from Installed.
+// The node keeps using its current key.
+func (r *SSHKeyRotation) WithUninstalled(address string) *SSHKeyRotation {
+	nr := *r
+	nr.Installed = nil
+	for _, a := range r.Installed {
+		if a != address {
+			nr.Installed = append(nr.Installed, a)
+		}
+	}
+	nr.OldPublicKeys = make(map[string]string)
+	for k, v := range r.OldPublicKeys {
+		if k != address {
+			nr.OldPublicKeys[k] = v
+		}
+	}
+	return &nr
+}
+
+// WithDone returns a copy of r with address added to Done.
+func (r *SSHKeyRotation) WithDone(address string) *SSHKeyRotation {
+	nr := *r
+	nr.Done = append(append([]string(nil), r.Done...), address)
+	return &nr
+}
+
+// WithStage returns a copy of r proceeded to the stage.
+func (r *SSHKeyRotation) WithStage(stage SSHKeyRotationStage) *SSHKeyRotation {
+	nr := *r
+	nr.Stage = stage
+	nr.Done = nil
+	return &nr
+}
@@ -0,0 +1,36 @@
+package static
+
+import (
+	"github.com/cybozu-go/cke"
+)
+
+// ResourcesFor returns the static resources to be applied to the cluster.
+func ResourcesFor(c *cke.Cluster) []cke.ResourceDefinition {
+	if !c.Options.APIServer.Admission.SkipPodSecurityPolicy {
+		return Resources
+	}
+
+	resources := make([]cke.ResourceDefinition, 0, len(Resources))
+	for _, res := range Resources {
+		if res.Kind == cke.KindPodSecurityPolicy {
+			continue
+		}
+		resources = append(resources, res)
+	}
+	return resources
+}
+
+// ObsoleteResourcesFor returns the static resources to be removed from the cluster.
+func ObsoleteResourcesFor(c *cke.Cluster) []cke.ResourceDefinition {
+	if !c.Options.APIServer.Admission.SkipPodSecurityPolicy {
+		return nil
+	}
+
+	var resources []cke.ResourceDefinition
+	for _, res := range Resources {
+		if res.Kind == cke.KindPodSecurityPolicy {
+			resources = append(resources, res)
+		}
+	}
+	return resources
+}
@@ -1,8 +1,12 @@
 package cke
 
 import (
+	"time"
+
 	"github.com/coreos/etcd/etcdserver/etcdserverpb"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubeproxyv1alpha1 "k8s.io/kube-proxy/config/v1alpha1"
 	schedulerv1beta1 "k8s.io/kube-scheduler/config/v1beta1"
 	kubeletv1beta1 "k8s.io/kubelet/config/v1beta1"
 )
@@ -12,6 +16,31 @@ type EtcdClusterStatus struct {
 	IsHealthy     bool
 	Members       map[string]*etcdserverpb.Member
 	InSyncMembers map[string]bool
+	// Learners is the set of members that are added as learners and not yet promoted.
+	Learners map[string]bool
+	// DBSize and DBSizeInUse are the physical and logical sizes of
+	// the backend database of each member in bytes.
+	DBSize      map[string]int64
+	DBSizeInUse map[string]int64
+	Alarms      []*etcdserverpb.AlarmMember
+}
+
+// HasNoSpaceAlarm returns true if NOSPACE alarm is raised on any member.
+func (s EtcdClusterStatus) HasNoSpaceAlarm() bool {
+	for _, a := range s.Alarms {
+		if a.Alarm == etcdserverpb.AlarmType_NOSPACE {
+			return true
+		}
+	}
+	return false
+}
+
+// EtcdBackupStatus is the status of scheduled etcd backups.
+type EtcdBackupStatus struct {
+	// LastTry is the time when CKE tried to take a backup last time.
+	LastTry time.Time
+	// LastSuccess is the timestamp of the newest successful backup.
+	LastSuccess time.Time
 }
 
 // ClusterDNSStatus contains cluster resolver status.
@@ -36,6 +65,15 @@ type KubernetesClusterStatus struct {
 	EtcdService         *corev1.Service
 	EtcdEndpoints       *corev1.Endpoints
 	ResourceStatuses    map[string]ResourceStatus
+
+	// UnknownEncryptionResources is the list of resources to be encrypted
+	// that are not served by API server.
+	UnknownEncryptionResources []string
+
+	// OldServiceAccountTokens is the list of Secrets of service account tokens
+	// signed with the old key.  This is collected only in the grace stage of
+	// service account key rotation.
+	OldServiceAccountTokens []types.NamespacedName
 }
 
 // ResourceStatus represents the status of registered K8s resources
@@ -44,6 +82,9 @@ type ResourceStatus struct {
 	Annotations map[string]string
 	// HasBeenSSA indicates that this resource has been already updated by server-side apply
 	HasBeenSSA bool
+	// CertExpiry is the expiry date of the certificate issued for a Secret
+	// annotated with cke.cybozu.com/issue-cert.  Zero otherwise.
+	CertExpiry time.Time
 }
 
 // IsReady returns the cluster condition whether or not Pod can be scheduled
@@ -84,6 +125,25 @@ type ClusterStatus struct {
 
 	Etcd       EtcdClusterStatus
 	Kubernetes KubernetesClusterStatus
+	EtcdBackup EtcdBackupStatus
+
+	// EtcdRestore is non-nil when the etcd cluster is requested to be restored.
+	EtcdRestore *EtcdRestoreRequest
+
+	// KubernetesUpgrade is non-nil while Kubernetes is being upgraded.
+	KubernetesUpgrade *KubernetesUpgrade
+
+	// EncryptionKeyRotation is non-nil while the encryption key for encrypted resources is being rotated.
+	EncryptionKeyRotation *EncryptionKeyRotation
+
+	// CARotation is non-nil while a CA is being rotated.
+	CARotation *CARotation
+
+	// ServiceAccountKeyRotation is non-nil while the key to sign service account tokens is being rotated.
+	ServiceAccountKeyRotation *ServiceAccountKeyRotation
+
+	// EncryptedResources is the resources whose objects have been encrypted.
+	EncryptedResources *EncryptedResources
 }
 
 // NodeStatus status of a node.
@@ -92,10 +152,11 @@ type NodeStatus struct {
 	Etcd              EtcdStatus
 	Rivers            ServiceStatus
 	EtcdRivers        ServiceStatus
-	APIServer         KubeComponentStatus
+	KMSPlugin         ServiceStatus
+	APIServer         APIServerStatus
 	ControllerManager KubeComponentStatus
 	Scheduler         SchedulerStatus
-	Proxy             KubeComponentStatus
+	Proxy             ProxyStatus
 	Kubelet           KubeletStatus
 	Labels            map[string]string // are labels for k8s Node resource.
 }
@@ -115,12 +176,25 @@ type ServiceStatus struct {
 type EtcdStatus struct {
 	ServiceStatus
 	HasData bool
+	// CertExpiry is the expiry date of the server certificate.  Zero if unknown.
+	CertExpiry time.Time
+	// PeerCertExpiry is the expiry date of the peer certificate.  Zero if unknown.
+	PeerCertExpiry time.Time
 }
 
 // KubeComponentStatus represents service status and endpoint's health
 type KubeComponentStatus struct {
 	ServiceStatus
 	IsHealthy bool
+	// CertExpiry is the expiry date of the certificate.  Zero if unknown.
+	CertExpiry time.Time
+}
+
+// APIServerStatus represents kube-apiserver status and health
+type APIServerStatus struct {
+	KubeComponentStatus
+	// EtcdClientCertExpiry is the expiry date of the client certificate for etcd.  Zero if unknown.
+	EtcdClientCertExpiry time.Time
 }
 
 // SchedulerStatus represents kube-scheduler status and health
@@ -128,6 +202,17 @@ type SchedulerStatus struct {
 	ServiceStatus
 	IsHealthy bool
 	Config    *schedulerv1beta1.KubeSchedulerConfiguration
+	// CertExpiry is the expiry date of the certificate.  Zero if unknown.
+	CertExpiry time.Time
+}
+
+// ProxyStatus represents kube-proxy status and health
+type ProxyStatus struct {
+	ServiceStatus
+	IsHealthy bool
+	Config    *kubeproxyv1alpha1.KubeProxyConfiguration
+	// CertExpiry is the expiry date of the certificate.  Zero if unknown.
+	CertExpiry time.Time
 }
 
 // KubeletStatus represents kubelet status and health
@@ -135,4 +220,6 @@ type KubeletStatus struct {
 	ServiceStatus
 	IsHealthy bool
 	Config    *kubeletv1beta1.KubeletConfiguration
+	// CertExpiry is the expiry date of the certificate.  Zero if unknown.
+	CertExpiry time.Time
 }
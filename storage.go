@@ -9,6 +9,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/coreos/etcd/clientv3"
 	"github.com/coreos/etcd/clientv3/clientv3util"
@@ -24,26 +25,41 @@ type RecordChan <-chan *Record
 
 // etcd keys and prefixes
 const (
-	KeyCA                    = "ca/"
-	KeyConfigVersion         = "config-version"
-	KeyCluster               = "cluster"
-	KeyClusterRevision       = "cluster-revision"
-	KeyConstraints           = "constraints"
-	KeyLeader                = "leader/"
-	KeyRebootsDisabled       = "reboots/disabled"
-	KeyRebootsPrefix         = "reboots/data/"
-	KeyRebootsWriteIndex     = "reboots/write-index"
-	KeyRecords               = "records/"
-	KeyRecordID              = "records"
-	KeyResourcePrefix        = "resource/"
-	KeySabakanDisabled       = "sabakan/disabled"
-	KeySabakanQueryVariables = "sabakan/query-variables"
-	KeySabakanTemplate       = "sabakan/template"
-	KeySabakanURL            = "sabakan/url"
-	KeyServiceAccountCert    = "service-account/certificate"
-	KeyServiceAccountKey     = "service-account/key"
-	KeyStatus                = "status"
-	KeyVault                 = "vault"
+	KeyCA                        = "ca/"
+	KeyCARotation                = "ca-rotation"
+	KeyCertificates              = "certificates"
+	KeyConfigVersion             = "config-version"
+	KeyCluster                   = "cluster"
+	KeyClusterRevision           = "cluster-revision"
+	KeyConstraints               = "constraints"
+	KeyEtcdBackupsLastTry        = "etcd-backups/last-try"
+	KeyEtcdBackupsPrefix         = "etcd-backups/data/"
+	KeyEncryptedResources        = "encrypted-resources"
+	KeyEncryptionKeyRotation     = "encryption-key-rotation"
+	KeyEtcdRestore               = "etcd-restore"
+	KeyIssuedCertsPrefix         = "issued-certs/"
+	KeyKubernetesUpgrade         = "kubernetes-upgrade"
+	KeyLeader                    = "leader/"
+	KeyLocalSecretsPrefix        = "local-secrets/"
+	KeyRebootsDisabled           = "reboots/disabled"
+	KeyRebootsPrefix             = "reboots/data/"
+	KeyRebootsWriteIndex         = "reboots/write-index"
+	KeyRecords                   = "records/"
+	KeyRecordID                  = "records"
+	KeyResourcePrefix            = "resource/"
+	KeyRevokedCredentialsPrefix  = "revoked-credentials/"
+	KeySabakanDisabled           = "sabakan/disabled"
+	KeySabakanQueryVariables     = "sabakan/query-variables"
+	KeySabakanTemplate           = "sabakan/template"
+	KeySabakanURL                = "sabakan/url"
+	KeySSHKeyRotation            = "ssh-key-rotation"
+	KeyServiceAccountCert        = "service-account/certificate"
+	KeyServiceAccountKey         = "service-account/key"
+	KeyServiceAccountKeyRotation = "service-account/rotation"
+	KeyStatus                    = "status"
+	KeyUserGroupsPrefix          = "user-groups/"
+	KeyVault                     = "vault"
+	KeyKMSVault                  = "kms-vault"
 )
 
 const maxRecords = 1000
@@ -55,6 +71,10 @@ var (
 	ErrNotFound = errors.New("not found")
 	// ErrNoLeader is returned when the session lost leadership.
 	ErrNoLeader = errors.New("lost leadership")
+	// ErrRotationInProgress is returned when a key rotation is requested while another is in progress.
+	ErrRotationInProgress = errors.New("rotation is in progress")
+	// ErrRestoreInProgress is returned when an etcd restore is requested while another is in progress.
+	ErrRestoreInProgress = errors.New("etcd restore is in progress")
 )
 
 func (s Storage) getStringValue(ctx context.Context, key string) (string, error) {
@@ -252,6 +272,36 @@ func (s Storage) GetVaultConfig(ctx context.Context) (*VaultConfig, error) {
 	return cfg, nil
 }
 
+// PutKMSVaultConfig stores *VaultConfig for the KMS plugin into etcd.
+func (s Storage) PutKMSVaultConfig(ctx context.Context, c *VaultConfig) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Put(ctx, KeyKMSVault, string(data))
+	return err
+}
+
+// GetKMSVaultConfig loads *VaultConfig for the KMS plugin from etcd.
+func (s Storage) GetKMSVaultConfig(ctx context.Context) (*VaultConfig, error) {
+	resp, err := s.Get(ctx, KeyKMSVault)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	cfg := new(VaultConfig)
+	err = json.Unmarshal(resp.Kvs[0].Value, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
 // GetCACertificate loads CA certificate from etcd.
 func (s Storage) GetCACertificate(ctx context.Context, name string) (string, error) {
 	return s.getStringValue(ctx, KeyCA+name)
@@ -894,3 +944,861 @@ func (s Storage) GetStatus(ctx context.Context) (*ServerStatus, error) {
 	}
 	return st, nil
 }
+
+// UpdateCertificateStatuses stores the inventory of certificates managed by CKE.
+// To reduce writes to etcd, this does nothing if the inventory is not changed.
+func (s Storage) UpdateCertificateStatuses(ctx context.Context, leaderKey string, certs []CertificateStatus) error {
+	if certs == nil {
+		certs = []CertificateStatus{}
+	}
+	data, err := json.Marshal(certs)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Get(ctx, KeyCertificates)
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) > 0 && string(resp.Kvs[0].Value) == string(data) {
+		return nil
+	}
+
+	tresp, err := s.Txn(ctx).
+		If(clientv3util.KeyExists(leaderKey)).
+		Then(clientv3.OpPut(KeyCertificates, string(data))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !tresp.Succeeded {
+		return ErrNoLeader
+	}
+	return nil
+}
+
+// GetCertificateStatuses retrieves the inventory of certificates managed by CKE.
+// If the inventory is not found, this returns ErrNotFound.
+func (s Storage) GetCertificateStatuses(ctx context.Context) ([]CertificateStatus, error) {
+	resp, err := s.Get(ctx, KeyCertificates)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	var certs []CertificateStatus
+	err = json.Unmarshal(resp.Kvs[0].Value, &certs)
+	if err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+func etcdBackupEntryKey(name string) string {
+	return KeyEtcdBackupsPrefix + name
+}
+
+// RegisterEtcdBackupEntry stores an entry of a successful etcd backup
+// and the time of the backup attempt.
+func (s Storage) RegisterEtcdBackupEntry(ctx context.Context, leaderKey string, e *EtcdBackupEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyExists(leaderKey)).
+		Then(
+			clientv3.OpPut(etcdBackupEntryKey(e.Name), string(data)),
+			clientv3.OpPut(KeyEtcdBackupsLastTry, e.Timestamp.UTC().Format(time.RFC3339Nano)),
+		).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrNoLeader
+	}
+	return nil
+}
+
+// GetEtcdBackupEntries loads the entries of etcd backups.
+// The returned entries are sorted from the oldest to the newest.
+func (s Storage) GetEtcdBackupEntries(ctx context.Context) ([]*EtcdBackupEntry, error) {
+	opts := []clientv3.OpOption{
+		clientv3.WithPrefix(),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend),
+	}
+	resp, err := s.Get(ctx, KeyEtcdBackupsPrefix, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+
+	entries := make([]*EtcdBackupEntry, len(resp.Kvs))
+	for i, kv := range resp.Kvs {
+		e := new(EtcdBackupEntry)
+		err = json.Unmarshal(kv.Value, e)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = e
+	}
+
+	return entries, nil
+}
+
+// DeleteEtcdBackupEntry deletes the entry of an etcd backup.
+func (s Storage) DeleteEtcdBackupEntry(ctx context.Context, leaderKey, name string) error {
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyExists(leaderKey)).
+		Then(clientv3.OpDelete(etcdBackupEntryKey(name))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrNoLeader
+	}
+	return nil
+}
+
+// GetEtcdBackupLastTry returns the time when CKE tried to take an etcd backup last time.
+// If CKE has never tried, this returns the zero time.
+func (s Storage) GetEtcdBackupLastTry(ctx context.Context) (time.Time, error) {
+	val, err := s.getStringValue(ctx, KeyEtcdBackupsLastTry)
+	if err == ErrNotFound {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, val)
+}
+
+// PutEtcdBackupLastTry records the time when CKE tried to take an etcd backup.
+func (s Storage) PutEtcdBackupLastTry(ctx context.Context, leaderKey string, t time.Time) error {
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyExists(leaderKey)).
+		Then(clientv3.OpPut(KeyEtcdBackupsLastTry, t.UTC().Format(time.RFC3339Nano))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrNoLeader
+	}
+	return nil
+}
+
+// PutEtcdRestoreRequest stores a request to restore etcd from a backup.
+// If a request already exists, this returns ErrRestoreInProgress unless force is true.
+func (s Storage) PutEtcdRestoreRequest(ctx context.Context, r *EtcdRestoreRequest, force bool) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	if force {
+		_, err = s.Put(ctx, KeyEtcdRestore, string(data))
+		return err
+	}
+
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyMissing(KeyEtcdRestore)).
+		Then(clientv3.OpPut(KeyEtcdRestore, string(data))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrRestoreInProgress
+	}
+	return nil
+}
+
+// GetEtcdRestoreRequest loads the request to restore etcd.
+// If there is no request, this returns ErrNotFound.
+func (s Storage) GetEtcdRestoreRequest(ctx context.Context) (*EtcdRestoreRequest, error) {
+	resp, err := s.Get(ctx, KeyEtcdRestore)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	r := new(EtcdRestoreRequest)
+	err = json.Unmarshal(resp.Kvs[0].Value, r)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// UpdateEtcdRestoreRequest updates the progress of the request to restore etcd.
+func (s Storage) UpdateEtcdRestoreRequest(ctx context.Context, r *EtcdRestoreRequest, leaderKey string) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyExists(leaderKey), clientv3util.KeyExists(KeyEtcdRestore)).
+		Then(clientv3.OpPut(KeyEtcdRestore, string(data))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrNoLeader
+	}
+	return nil
+}
+
+// DeleteEtcdRestoreRequest deletes the request to restore etcd.
+func (s Storage) DeleteEtcdRestoreRequest(ctx context.Context, leaderKey string) error {
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyExists(leaderKey)).
+		Then(clientv3.OpDelete(KeyEtcdRestore)).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrNoLeader
+	}
+	return nil
+}
+
+// GetKubernetesUpgrade loads the progress of the ongoing Kubernetes upgrade.
+// If no upgrade is in progress, this returns ErrNotFound.
+func (s Storage) GetKubernetesUpgrade(ctx context.Context) (*KubernetesUpgrade, error) {
+	resp, err := s.Get(ctx, KeyKubernetesUpgrade)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	u := new(KubernetesUpgrade)
+	err = json.Unmarshal(resp.Kvs[0].Value, u)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// PutKubernetesUpgrade stores the progress of Kubernetes upgrade.
+func (s Storage) PutKubernetesUpgrade(ctx context.Context, leaderKey string, u *KubernetesUpgrade) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyExists(leaderKey)).
+		Then(clientv3.OpPut(KeyKubernetesUpgrade, string(data))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrNoLeader
+	}
+	return nil
+}
+
+// DeleteKubernetesUpgrade deletes the progress of Kubernetes upgrade.
+func (s Storage) DeleteKubernetesUpgrade(ctx context.Context, leaderKey string) error {
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyExists(leaderKey)).
+		Then(clientv3.OpDelete(KeyKubernetesUpgrade)).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrNoLeader
+	}
+	return nil
+}
+
+// StartEncryptionKeyRotation stores the initial state of encryption key rotation.
+// If another rotation is in progress, this returns ErrRotationInProgress.
+func (s Storage) StartEncryptionKeyRotation(ctx context.Context, r *EncryptionKeyRotation) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyMissing(KeyEncryptionKeyRotation)).
+		Then(clientv3.OpPut(KeyEncryptionKeyRotation, string(data))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrRotationInProgress
+	}
+	return nil
+}
+
+// GetEncryptionKeyRotation loads the state of encryption key rotation.
+// If no rotation is in progress, this returns ErrNotFound.
+func (s Storage) GetEncryptionKeyRotation(ctx context.Context) (*EncryptionKeyRotation, error) {
+	resp, err := s.Get(ctx, KeyEncryptionKeyRotation)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	r := new(EncryptionKeyRotation)
+	err = json.Unmarshal(resp.Kvs[0].Value, r)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// UpdateEncryptionKeyRotation updates the state of encryption key rotation.
+func (s Storage) UpdateEncryptionKeyRotation(ctx context.Context, leaderKey string, r *EncryptionKeyRotation) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyExists(leaderKey)).
+		Then(clientv3.OpPut(KeyEncryptionKeyRotation, string(data))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrNoLeader
+	}
+	return nil
+}
+
+// ProceedEncryptionKeyRotation updates the state of encryption key rotation
+// from prev to r.  If the state has been changed from prev, this returns
+// ErrRotationInProgress.  This is used by ckecli that is not the leader.
+func (s Storage) ProceedEncryptionKeyRotation(ctx context.Context, prev, r *EncryptionKeyRotation) error {
+	prevData, err := json.Marshal(prev)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Txn(ctx).
+		If(clientv3.Compare(clientv3.Value(KeyEncryptionKeyRotation), "=", string(prevData))).
+		Then(clientv3.OpPut(KeyEncryptionKeyRotation, string(data))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrRotationInProgress
+	}
+	return nil
+}
+
+// DeleteEncryptionKeyRotation deletes the state of completed encryption key rotation.
+func (s Storage) DeleteEncryptionKeyRotation(ctx context.Context, leaderKey string) error {
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyExists(leaderKey)).
+		Then(clientv3.OpDelete(KeyEncryptionKeyRotation)).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrNoLeader
+	}
+	return nil
+}
+
+// StartServiceAccountKeyRotation stores the initial state of service account key rotation.
+// If another rotation is in progress, this returns ErrRotationInProgress.
+func (s Storage) StartServiceAccountKeyRotation(ctx context.Context, r *ServiceAccountKeyRotation) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyMissing(KeyServiceAccountKeyRotation)).
+		Then(clientv3.OpPut(KeyServiceAccountKeyRotation, string(data))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrRotationInProgress
+	}
+	return nil
+}
+
+// GetServiceAccountKeyRotation loads the state of service account key rotation.
+// If no rotation is in progress, this returns ErrNotFound.
+func (s Storage) GetServiceAccountKeyRotation(ctx context.Context) (*ServiceAccountKeyRotation, error) {
+	resp, err := s.Get(ctx, KeyServiceAccountKeyRotation)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	r := new(ServiceAccountKeyRotation)
+	err = json.Unmarshal(resp.Kvs[0].Value, r)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// UpdateServiceAccountKeyRotation updates the state of service account key rotation.
+func (s Storage) UpdateServiceAccountKeyRotation(ctx context.Context, leaderKey string, r *ServiceAccountKeyRotation) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyExists(leaderKey)).
+		Then(clientv3.OpPut(KeyServiceAccountKeyRotation, string(data))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrNoLeader
+	}
+	return nil
+}
+
+// DeleteServiceAccountKeyRotation deletes the state of completed service account key rotation.
+func (s Storage) DeleteServiceAccountKeyRotation(ctx context.Context, leaderKey string) error {
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyExists(leaderKey)).
+		Then(clientv3.OpDelete(KeyServiceAccountKeyRotation)).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrNoLeader
+	}
+	return nil
+}
+
+// StartCARotation stores the initial state of CA rotation together with
+// the CA certificate to be distributed in the initial stage.
+// If another rotation is in progress, this returns ErrRotationInProgress.
+func (s Storage) StartCARotation(ctx context.Context, r *CARotation) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyMissing(KeyCARotation)).
+		Then(
+			clientv3.OpPut(KeyCARotation, string(data)),
+			clientv3.OpPut(KeyCA+r.CA, r.Certificate()),
+		).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrRotationInProgress
+	}
+	return nil
+}
+
+// ProceedCARotation updates the state of CA rotation from prev to r
+// together with the CA certificate to be distributed in the stage of r.
+// If the state has been changed from prev, this returns ErrRotationInProgress.
+// This is used by ckecli that is not the leader.
+func (s Storage) ProceedCARotation(ctx context.Context, prev, r *CARotation) error {
+	prevData, err := json.Marshal(prev)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Txn(ctx).
+		If(clientv3.Compare(clientv3.Value(KeyCARotation), "=", string(prevData))).
+		Then(
+			clientv3.OpPut(KeyCARotation, string(data)),
+			clientv3.OpPut(KeyCA+r.CA, r.Certificate()),
+		).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrRotationInProgress
+	}
+	return nil
+}
+
+// GetCARotation loads the state of CA rotation.
+// If no rotation is in progress, this returns ErrNotFound.
+func (s Storage) GetCARotation(ctx context.Context) (*CARotation, error) {
+	resp, err := s.Get(ctx, KeyCARotation)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	r := new(CARotation)
+	err = json.Unmarshal(resp.Kvs[0].Value, r)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// UpdateCARotation updates the state of CA rotation together with
+// the CA certificate to be distributed in the current stage.
+func (s Storage) UpdateCARotation(ctx context.Context, leaderKey string, r *CARotation) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyExists(leaderKey)).
+		Then(
+			clientv3.OpPut(KeyCARotation, string(data)),
+			clientv3.OpPut(KeyCA+r.CA, r.Certificate()),
+		).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrNoLeader
+	}
+	return nil
+}
+
+// DeleteCARotation deletes the state of completed CA rotation.
+func (s Storage) DeleteCARotation(ctx context.Context, leaderKey string) error {
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyExists(leaderKey)).
+		Then(clientv3.OpDelete(KeyCARotation)).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrNoLeader
+	}
+	return nil
+}
+
+// GetEncryptedResources loads the resources whose objects have been encrypted.
+// If nothing has been recorded, this returns ErrNotFound.
+func (s Storage) GetEncryptedResources(ctx context.Context) (*EncryptedResources, error) {
+	resp, err := s.Get(ctx, KeyEncryptedResources)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	e := new(EncryptedResources)
+	err = json.Unmarshal(resp.Kvs[0].Value, e)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// PutEncryptedResources stores the resources whose objects have been encrypted.
+func (s Storage) PutEncryptedResources(ctx context.Context, leaderKey string, e *EncryptedResources) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyExists(leaderKey)).
+		Then(clientv3.OpPut(KeyEncryptedResources, string(data))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrNoLeader
+	}
+	return nil
+}
+
+// PutIssuedCertificate records a client certificate issued for a user.
+func (s Storage) PutIssuedCertificate(ctx context.Context, c *IssuedCertificate) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Put(ctx, KeyIssuedCertsPrefix+c.Serial, string(data))
+	return err
+}
+
+// GetIssuedCertificate loads the record of a client certificate by the serial number.
+// If the certificate is not recorded, this returns ErrNotFound.
+func (s Storage) GetIssuedCertificate(ctx context.Context, serial string) (*IssuedCertificate, error) {
+	resp, err := s.Get(ctx, KeyIssuedCertsPrefix+serial)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	c := new(IssuedCertificate)
+	err = json.Unmarshal(resp.Kvs[0].Value, c)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetIssuedCertificates loads the records of all client certificates issued for users.
+func (s Storage) GetIssuedCertificates(ctx context.Context) ([]*IssuedCertificate, error) {
+	resp, err := s.Get(ctx, KeyIssuedCertsPrefix,
+		clientv3.WithPrefix(),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	certs := make([]*IssuedCertificate, len(resp.Kvs))
+	for i, kv := range resp.Kvs {
+		c := new(IssuedCertificate)
+		err = json.Unmarshal(kv.Value, c)
+		if err != nil {
+			return nil, err
+		}
+		certs[i] = c
+	}
+	return certs, nil
+}
+
+// RevokeIssuedCertificate marks the client certificate as revoked.
+// If the certificate has a credential ID, the ID is added to the denylist.
+func (s Storage) RevokeIssuedCertificate(ctx context.Context, c *IssuedCertificate, revokedAt time.Time) error {
+	nc := *c
+	nc.RevokedAt = revokedAt
+	data, err := json.Marshal(&nc)
+	if err != nil {
+		return err
+	}
+
+	ops := []clientv3.Op{clientv3.OpPut(KeyIssuedCertsPrefix+c.Serial, string(data))}
+	if len(c.CredentialID) > 0 {
+		ops = append(ops, clientv3.OpPut(KeyRevokedCredentialsPrefix+c.CredentialID, c.Serial))
+	}
+	_, err = s.Txn(ctx).Then(ops...).Commit()
+	return err
+}
+
+// IsCredentialRevoked returns true if the credential ID is in the denylist.
+func (s Storage) IsCredentialRevoked(ctx context.Context, credentialID string) (bool, error) {
+	resp, err := s.Get(ctx, KeyRevokedCredentialsPrefix+credentialID, clientv3.WithCountOnly())
+	if err != nil {
+		return false, err
+	}
+	return resp.Count > 0, nil
+}
+
+// DeleteExpiredIssuedCertificates deletes the records of client certificates
+// expired before `now`, together with their credential IDs in the denylist.
+func (s Storage) DeleteExpiredIssuedCertificates(ctx context.Context, now time.Time) error {
+	certs, err := s.GetIssuedCertificates(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range certs {
+		if now.Before(c.Expiry) {
+			continue
+		}
+		ops := []clientv3.Op{clientv3.OpDelete(KeyIssuedCertsPrefix + c.Serial)}
+		if len(c.CredentialID) > 0 {
+			ops = append(ops, clientv3.OpDelete(KeyRevokedCredentialsPrefix+c.CredentialID))
+		}
+		_, err := s.Txn(ctx).Then(ops...).Commit()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PutUserGroups stores the groups of a Kubernetes user for "ckecli kubernetes credential".
+func (s Storage) PutUserGroups(ctx context.Context, userName string, groups []string) error {
+	data, err := json.Marshal(groups)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Put(ctx, KeyUserGroupsPrefix+userName, string(data))
+	return err
+}
+
+// GetUserGroups loads the groups of a Kubernetes user.
+// If no groups are mapped to the user, this returns ErrNotFound.
+func (s Storage) GetUserGroups(ctx context.Context, userName string) ([]string, error) {
+	resp, err := s.Get(ctx, KeyUserGroupsPrefix+userName)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	var groups []string
+	err = json.Unmarshal(resp.Kvs[0].Value, &groups)
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// GetAllUserGroups loads the groups of all Kubernetes users keyed by the user name.
+func (s Storage) GetAllUserGroups(ctx context.Context) (map[string][]string, error) {
+	resp, err := s.Get(ctx, KeyUserGroupsPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string][]string, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var groups []string
+		err = json.Unmarshal(kv.Value, &groups)
+		if err != nil {
+			return nil, err
+		}
+		m[string(kv.Key[len(KeyUserGroupsPrefix):])] = groups
+	}
+	return m, nil
+}
+
+// DeleteUserGroups deletes the groups of a Kubernetes user.
+func (s Storage) DeleteUserGroups(ctx context.Context, userName string) error {
+	_, err := s.Delete(ctx, KeyUserGroupsPrefix+userName)
+	return err
+}
+
+// GetLocalSecret loads encrypted data of the local secret backend.
+// If the data does not exist, this returns ErrNotFound.
+func (s Storage) GetLocalSecret(ctx context.Context, name string) ([]byte, error) {
+	resp, err := s.Get(ctx, KeyLocalSecretsPrefix+name)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+	return resp.Kvs[0].Value, nil
+}
+
+// PutLocalSecret stores encrypted data of the local secret backend.
+func (s Storage) PutLocalSecret(ctx context.Context, name string, data []byte) error {
+	_, err := s.Put(ctx, KeyLocalSecretsPrefix+name, string(data))
+	return err
+}
+
+// StartSSHKeyRotation stores the initial state of SSH key rotation.
+// If another rotation is in progress, this returns ErrRotationInProgress.
+func (s Storage) StartSSHKeyRotation(ctx context.Context, r *SSHKeyRotation) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyMissing(KeySSHKeyRotation)).
+		Then(clientv3.OpPut(KeySSHKeyRotation, string(data))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrRotationInProgress
+	}
+	return nil
+}
+
+// GetSSHKeyRotation loads the state of SSH key rotation.
+// If no rotation is in progress, this returns ErrNotFound.
+func (s Storage) GetSSHKeyRotation(ctx context.Context) (*SSHKeyRotation, error) {
+	resp, err := s.Get(ctx, KeySSHKeyRotation)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	r := new(SSHKeyRotation)
+	err = json.Unmarshal(resp.Kvs[0].Value, r)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// UpdateSSHKeyRotation updates the state of SSH key rotation.
+// If the rotation has been deleted, this returns ErrNotFound.
+func (s Storage) UpdateSSHKeyRotation(ctx context.Context, r *SSHKeyRotation) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyExists(KeySSHKeyRotation)).
+		Then(clientv3.OpPut(KeySSHKeyRotation, string(data))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteSSHKeyRotation deletes the state of completed SSH key rotation.
+func (s Storage) DeleteSSHKeyRotation(ctx context.Context) error {
+	_, err := s.Delete(ctx, KeySSHKeyRotation)
+	return err
+}
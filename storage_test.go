@@ -761,6 +761,188 @@ func testStorageReboot(t *testing.T) {
 	}
 }
 
+func testStorageEtcdBackup(t *testing.T) {
+	t.Parallel()
+
+	client := newEtcdClient(t)
+	defer client.Close()
+	storage := Storage{client}
+	ctx := context.Background()
+
+	s, err := concurrency.NewSession(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	e := concurrency.NewElection(s, KeyLeader)
+	err = e.Campaign(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaderKey := e.Key()
+
+	lastTry, err := storage.GetEtcdBackupLastTry(ctx)
+	if err != nil {
+		t.Fatal("GetEtcdBackupLastTry failed:", err)
+	}
+	if !lastTry.IsZero() {
+		t.Error("last try should be zero:", lastTry)
+	}
+
+	ents, err := storage.GetEtcdBackupEntries(ctx)
+	if err != nil {
+		t.Fatal("GetEtcdBackupEntries failed:", err)
+	}
+	if len(ents) != 0 {
+		t.Error("Unknown entries:", ents)
+	}
+
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	err = storage.PutEtcdBackupLastTry(ctx, leaderKey, now)
+	if err != nil {
+		t.Fatal("PutEtcdBackupLastTry failed:", err)
+	}
+	lastTry, err = storage.GetEtcdBackupLastTry(ctx)
+	if err != nil {
+		t.Fatal("GetEtcdBackupLastTry failed:", err)
+	}
+	if !lastTry.Equal(now) {
+		t.Error("wrong last try:", lastTry)
+	}
+
+	entries := []*EtcdBackupEntry{
+		{
+			Name:      EtcdBackupName(now.Add(time.Hour)),
+			Timestamp: now.Add(time.Hour),
+			Size:      1024,
+			Revision:  100,
+			Hash:      1234,
+			TotalKey:  10,
+			Targets:   []string{"local"},
+		},
+		{
+			Name:      EtcdBackupName(now),
+			Timestamp: now,
+			Size:      512,
+			Revision:  50,
+			Hash:      5678,
+			TotalKey:  5,
+			Targets:   []string{"local", "s3"},
+		},
+	}
+	for _, entry := range entries {
+		err = storage.RegisterEtcdBackupEntry(ctx, leaderKey, entry)
+		if err != nil {
+			t.Fatal("RegisterEtcdBackupEntry failed:", err)
+		}
+	}
+
+	lastTry, err = storage.GetEtcdBackupLastTry(ctx)
+	if err != nil {
+		t.Fatal("GetEtcdBackupLastTry failed:", err)
+	}
+	if !lastTry.Equal(now) {
+		t.Error("last try should be updated:", lastTry)
+	}
+
+	ents, err = storage.GetEtcdBackupEntries(ctx)
+	if err != nil {
+		t.Fatal("GetEtcdBackupEntries failed:", err)
+	}
+	if !cmp.Equal(ents, []*EtcdBackupEntry{entries[1], entries[0]}) {
+		t.Error("GetEtcdBackupEntries returned unexpected result:", cmp.Diff(ents, []*EtcdBackupEntry{entries[1], entries[0]}))
+	}
+
+	err = storage.DeleteEtcdBackupEntry(ctx, leaderKey, entries[1].Name)
+	if err != nil {
+		t.Fatal("DeleteEtcdBackupEntry failed:", err)
+	}
+	ents, err = storage.GetEtcdBackupEntries(ctx)
+	if err != nil {
+		t.Fatal("GetEtcdBackupEntries failed:", err)
+	}
+	if !cmp.Equal(ents, entries[:1]) {
+		t.Error("GetEtcdBackupEntries returned unexpected result:", cmp.Diff(ents, entries[:1]))
+	}
+}
+
+func testStorageEtcdRestore(t *testing.T) {
+	t.Parallel()
+
+	client := newEtcdClient(t)
+	defer client.Close()
+	storage := Storage{client}
+	ctx := context.Background()
+
+	s, err := concurrency.NewSession(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	e := concurrency.NewElection(s, KeyLeader)
+	err = e.Campaign(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaderKey := e.Key()
+
+	_, err = storage.GetEtcdRestoreRequest(ctx)
+	if err != ErrNotFound {
+		t.Error("unexpected error:", err)
+	}
+
+	req := &EtcdRestoreRequest{
+		Snapshot:    EtcdBackupName(time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)),
+		Target:      "s3",
+		RequestedAt: time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC),
+	}
+	err = storage.PutEtcdRestoreRequest(ctx, req, false)
+	if err != nil {
+		t.Fatal("PutEtcdRestoreRequest failed:", err)
+	}
+	err = storage.PutEtcdRestoreRequest(ctx, req, false)
+	if err != ErrRestoreInProgress {
+		t.Error("PutEtcdRestoreRequest should fail while in progress:", err)
+	}
+	req.Target = "local"
+	err = storage.PutEtcdRestoreRequest(ctx, req, true)
+	if err != nil {
+		t.Fatal("PutEtcdRestoreRequest with force failed:", err)
+	}
+
+	got, err := storage.GetEtcdRestoreRequest(ctx)
+	if err != nil {
+		t.Fatal("GetEtcdRestoreRequest failed:", err)
+	}
+	if !cmp.Equal(got, req) {
+		t.Error("GetEtcdRestoreRequest returned unexpected result:", cmp.Diff(got, req))
+	}
+
+	req.Step = 9
+	err = storage.UpdateEtcdRestoreRequest(ctx, req, leaderKey)
+	if err != nil {
+		t.Fatal("UpdateEtcdRestoreRequest failed:", err)
+	}
+	got, err = storage.GetEtcdRestoreRequest(ctx)
+	if err != nil {
+		t.Fatal("GetEtcdRestoreRequest failed:", err)
+	}
+	if got.Step != 9 {
+		t.Error("step is not updated:", got.Step)
+	}
+
+	err = storage.DeleteEtcdRestoreRequest(ctx, leaderKey)
+	if err != nil {
+		t.Fatal("DeleteEtcdRestoreRequest failed:", err)
+	}
+	_, err = storage.GetEtcdRestoreRequest(ctx)
+	if err != ErrNotFound {
+		t.Error("unexpected error:", err)
+	}
+}
+
 func testStatus(t *testing.T) {
 	t.Parallel()
 
@@ -803,6 +985,679 @@ func testStatus(t *testing.T) {
 	}
 }
 
+func testStorageCertificates(t *testing.T) {
+	t.Parallel()
+
+	client := newEtcdClient(t)
+	defer client.Close()
+	storage := Storage{client}
+	ctx := context.Background()
+
+	s, err := concurrency.NewSession(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	e := concurrency.NewElection(s, KeyLeader)
+	err = e.Campaign(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaderKey := e.Key()
+
+	_, err = storage.GetCertificateStatuses(ctx)
+	if err != ErrNotFound {
+		t.Error("unexpected error:", err)
+	}
+
+	certs := []CertificateStatus{
+		{Node: "10.0.0.11", Component: "kubelet", CA: CAKubernetes, Expiry: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Component: CertComponentCA, CA: CAServer, Expiry: time.Date(2035, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	err = storage.UpdateCertificateStatuses(ctx, leaderKey, certs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := storage.GetCertificateStatuses(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(got, certs) {
+		t.Error("unexpected certificates:", cmp.Diff(got, certs))
+	}
+
+	resp, err := client.Get(ctx, KeyCertificates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev := resp.Kvs[0].ModRevision
+
+	// an unchanged inventory must not be written again, even without leadership.
+	err = storage.UpdateCertificateStatuses(ctx, "wrong", certs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = client.Get(ctx, KeyCertificates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Kvs[0].ModRevision != rev {
+		t.Error("unchanged inventory was written")
+	}
+
+	err = storage.UpdateCertificateStatuses(ctx, "wrong", certs[:1])
+	if err != ErrNoLeader {
+		t.Error("unexpected error:", err)
+	}
+
+	err = storage.UpdateCertificateStatuses(ctx, leaderKey, certs[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = storage.GetCertificateStatuses(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(got, certs[:1]) {
+		t.Error("unexpected certificates:", cmp.Diff(got, certs[:1]))
+	}
+}
+
+func testStorageKubernetesUpgrade(t *testing.T) {
+	t.Parallel()
+
+	client := newEtcdClient(t)
+	defer client.Close()
+	storage := Storage{client}
+	ctx := context.Background()
+
+	s, err := concurrency.NewSession(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	e := concurrency.NewElection(s, KeyLeader)
+	err = e.Campaign(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaderKey := e.Key()
+
+	_, err = storage.GetKubernetesUpgrade(ctx)
+	if err != ErrNotFound {
+		t.Error("unexpected error:", err)
+	}
+
+	u := &KubernetesUpgrade{
+		From:      "1.18.15",
+		To:        KubernetesImage.Name(),
+		Stage:     UpgradeStageAPIServer,
+		StartedAt: time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC),
+	}
+	err = storage.PutKubernetesUpgrade(ctx, leaderKey, u)
+	if err != nil {
+		t.Fatal("PutKubernetesUpgrade failed:", err)
+	}
+
+	err = storage.PutKubernetesUpgrade(ctx, "wrong-leader", u)
+	if err != ErrNoLeader {
+		t.Error("PutKubernetesUpgrade succeeded without leadership:", err)
+	}
+
+	got, err := storage.GetKubernetesUpgrade(ctx)
+	if err != nil {
+		t.Fatal("GetKubernetesUpgrade failed:", err)
+	}
+	if !cmp.Equal(got, u) {
+		t.Error("GetKubernetesUpgrade returned unexpected result:", cmp.Diff(got, u))
+	}
+
+	err = storage.DeleteKubernetesUpgrade(ctx, leaderKey)
+	if err != nil {
+		t.Fatal("DeleteKubernetesUpgrade failed:", err)
+	}
+	_, err = storage.GetKubernetesUpgrade(ctx)
+	if err != ErrNotFound {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func testStorageEncryptionKeyRotation(t *testing.T) {
+	t.Parallel()
+
+	client := newEtcdClient(t)
+	defer client.Close()
+	storage := Storage{client}
+	ctx := context.Background()
+
+	s, err := concurrency.NewSession(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	e := concurrency.NewElection(s, KeyLeader)
+	err = e.Campaign(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaderKey := e.Key()
+
+	_, err = storage.GetEncryptionKeyRotation(ctx)
+	if err != ErrNotFound {
+		t.Error("unexpected error:", err)
+	}
+
+	r := &EncryptionKeyRotation{
+		Stage:     EncryptionKeyStagePrepare,
+		OldKey:    "2021-01-01T00:00:00Z",
+		NewKey:    "2021-02-01T00:00:00Z",
+		StartedAt: time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC),
+	}
+	err = storage.StartEncryptionKeyRotation(ctx, r)
+	if err != nil {
+		t.Fatal("StartEncryptionKeyRotation failed:", err)
+	}
+	err = storage.StartEncryptionKeyRotation(ctx, r)
+	if err != ErrRotationInProgress {
+		t.Error("StartEncryptionKeyRotation should fail while in progress:", err)
+	}
+
+	added := r.WithStage(EncryptionKeyStageAdd)
+	err = storage.ProceedEncryptionKeyRotation(ctx, r, added)
+	if err != nil {
+		t.Fatal("ProceedEncryptionKeyRotation failed:", err)
+	}
+	err = storage.ProceedEncryptionKeyRotation(ctx, r, added)
+	if err != ErrRotationInProgress {
+		t.Error("ProceedEncryptionKeyRotation should fail for a stale state:", err)
+	}
+	r = added
+
+	r = r.WithRestarted("10.0.0.1")
+	err = storage.UpdateEncryptionKeyRotation(ctx, leaderKey, r)
+	if err != nil {
+		t.Fatal("UpdateEncryptionKeyRotation failed:", err)
+	}
+
+	got, err := storage.GetEncryptionKeyRotation(ctx)
+	if err != nil {
+		t.Fatal("GetEncryptionKeyRotation failed:", err)
+	}
+	if !cmp.Equal(got, r) {
+		t.Error("GetEncryptionKeyRotation returned unexpected result:", cmp.Diff(got, r))
+	}
+	if !got.IsRestarted("10.0.0.1") || got.IsRestarted("10.0.0.2") {
+		t.Error("unexpected restarted nodes:", got.Restarted)
+	}
+
+	err = storage.DeleteEncryptionKeyRotation(ctx, leaderKey)
+	if err != nil {
+		t.Fatal("DeleteEncryptionKeyRotation failed:", err)
+	}
+	_, err = storage.GetEncryptionKeyRotation(ctx)
+	if err != ErrNotFound {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func testStorageServiceAccountKeyRotation(t *testing.T) {
+	t.Parallel()
+
+	client := newEtcdClient(t)
+	defer client.Close()
+	storage := Storage{client}
+	ctx := context.Background()
+
+	s, err := concurrency.NewSession(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	e := concurrency.NewElection(s, KeyLeader)
+	err = e.Campaign(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaderKey := e.Key()
+
+	_, err = storage.GetServiceAccountKeyRotation(ctx)
+	if err != ErrNotFound {
+		t.Error("unexpected error:", err)
+	}
+
+	r := &ServiceAccountKeyRotation{
+		Stage:       ServiceAccountKeyStageAdd,
+		OldCert:     "old",
+		NewCert:     "new",
+		NewKey:      "key",
+		GracePeriod: "1h",
+		StartedAt:   time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC),
+	}
+	err = storage.StartServiceAccountKeyRotation(ctx, r)
+	if err != nil {
+		t.Fatal("StartServiceAccountKeyRotation failed:", err)
+	}
+	err = storage.StartServiceAccountKeyRotation(ctx, r)
+	if err != ErrRotationInProgress {
+		t.Error("StartServiceAccountKeyRotation should fail while in progress:", err)
+	}
+
+	r = r.WithRestarted("10.0.0.1")
+	err = storage.UpdateServiceAccountKeyRotation(ctx, leaderKey, r)
+	if err != nil {
+		t.Fatal("UpdateServiceAccountKeyRotation failed:", err)
+	}
+
+	got, err := storage.GetServiceAccountKeyRotation(ctx)
+	if err != nil {
+		t.Fatal("GetServiceAccountKeyRotation failed:", err)
+	}
+	if !cmp.Equal(got, r) {
+		t.Error("GetServiceAccountKeyRotation returned unexpected result:", cmp.Diff(got, r))
+	}
+	if got.AdditionalCert() != "new" {
+		t.Error("unexpected additional certificate:", got.AdditionalCert())
+	}
+	if got.GetGracePeriod() != time.Hour {
+		t.Error("unexpected grace period:", got.GetGracePeriod())
+	}
+
+	err = storage.DeleteServiceAccountKeyRotation(ctx, leaderKey)
+	if err != nil {
+		t.Fatal("DeleteServiceAccountKeyRotation failed:", err)
+	}
+	_, err = storage.GetServiceAccountKeyRotation(ctx)
+	if err != ErrNotFound {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func testStorageCARotation(t *testing.T) {
+	t.Parallel()
+
+	client := newEtcdClient(t)
+	defer client.Close()
+	storage := Storage{client}
+	ctx := context.Background()
+
+	s, err := concurrency.NewSession(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	e := concurrency.NewElection(s, KeyLeader)
+	err = e.Campaign(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaderKey := e.Key()
+
+	_, err = storage.GetCARotation(ctx)
+	if err != ErrNotFound {
+		t.Error("unexpected error:", err)
+	}
+
+	prepare := &CARotation{
+		CA:        CAKubernetes,
+		Stage:     CARotationStagePrepare,
+		OldCert:   "old\n",
+		OldIssuer: "old-issuer",
+		NewIssuer: "kubernetes-20210201000000",
+		StartedAt: time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC),
+	}
+	err = storage.StartCARotation(ctx, prepare)
+	if err != nil {
+		t.Fatal("StartCARotation failed:", err)
+	}
+	err = storage.StartCARotation(ctx, prepare)
+	if err != ErrRotationInProgress {
+		t.Error("StartCARotation should fail while in progress:", err)
+	}
+	ca, err := storage.GetCACertificate(ctx, CAKubernetes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca != "old\n" {
+		t.Error("CA certificate should be the old one:", ca)
+	}
+
+	r := *prepare
+	r.Stage = CARotationStageBundle
+	r.NewCert = "new\n"
+	r.NewIssuer = "new-issuer"
+	err = storage.ProceedCARotation(ctx, prepare, &r)
+	if err != nil {
+		t.Fatal("ProceedCARotation failed:", err)
+	}
+	err = storage.ProceedCARotation(ctx, prepare, &r)
+	if err != ErrRotationInProgress {
+		t.Error("ProceedCARotation should fail for a stale state:", err)
+	}
+	ca, err = storage.GetCACertificate(ctx, CAKubernetes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca != "old\nnew\n" {
+		t.Error("CA certificate should be the bundle:", ca)
+	}
+
+	rr := r.WithRestarted("10.0.0.1")
+	err = storage.UpdateCARotation(ctx, leaderKey, rr)
+	if err != nil {
+		t.Fatal("UpdateCARotation failed:", err)
+	}
+
+	got, err := storage.GetCARotation(ctx)
+	if err != nil {
+		t.Fatal("GetCARotation failed:", err)
+	}
+	if !cmp.Equal(got, rr) {
+		t.Error("GetCARotation returned unexpected result:", cmp.Diff(got, rr))
+	}
+	if !got.IsRestarted("10.0.0.1") || got.IsRestarted("10.0.0.2") {
+		t.Error("unexpected restarted nodes:", got.Restarted)
+	}
+
+	rr = rr.WithStage(CARotationStageDrop)
+	err = storage.UpdateCARotation(ctx, leaderKey, rr)
+	if err != nil {
+		t.Fatal("UpdateCARotation failed:", err)
+	}
+	ca, err = storage.GetCACertificate(ctx, CAKubernetes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca != "new\n" {
+		t.Error("CA certificate should be the new one:", ca)
+	}
+
+	err = storage.DeleteCARotation(ctx, leaderKey)
+	if err != nil {
+		t.Fatal("DeleteCARotation failed:", err)
+	}
+	_, err = storage.GetCARotation(ctx)
+	if err != ErrNotFound {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func testStorageIssuedCertificates(t *testing.T) {
+	t.Parallel()
+
+	client := newEtcdClient(t)
+	defer client.Close()
+	storage := Storage{client}
+	ctx := context.Background()
+
+	_, err := storage.GetIssuedCertificate(ctx, "01:02")
+	if err != ErrNotFound {
+		t.Error("unexpected error:", err)
+	}
+
+	issuedAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	c1 := &IssuedCertificate{
+		Serial:       "01:02",
+		Kind:         IssuedCertKubernetes,
+		User:         "alice",
+		Groups:       []string{"system:masters"},
+		TTL:          "2h",
+		IssuedBy:     "alice@host",
+		IssuedAt:     issuedAt,
+		Expiry:       issuedAt.Add(2 * time.Hour),
+		CredentialID: "abcd",
+	}
+	c2 := &IssuedCertificate{
+		Serial:   "03:04",
+		Kind:     IssuedCertEtcd,
+		User:     "bob",
+		TTL:      "1h",
+		IssuedBy: "bob@host",
+		IssuedAt: issuedAt,
+		Expiry:   issuedAt.Add(time.Hour),
+	}
+	for _, c := range []*IssuedCertificate{c2, c1} {
+		err = storage.PutIssuedCertificate(ctx, c)
+		if err != nil {
+			t.Fatal("PutIssuedCertificate failed:", err)
+		}
+	}
+
+	certs, err := storage.GetIssuedCertificates(ctx)
+	if err != nil {
+		t.Fatal("GetIssuedCertificates failed:", err)
+	}
+	expected := []*IssuedCertificate{c1, c2}
+	if !cmp.Equal(certs, expected) {
+		t.Error("GetIssuedCertificates returned unexpected result:", cmp.Diff(certs, expected))
+	}
+
+	revoked, err := storage.IsCredentialRevoked(ctx, "abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked {
+		t.Error("credential should not be revoked")
+	}
+
+	revokedAt := issuedAt.Add(time.Minute)
+	err = storage.RevokeIssuedCertificate(ctx, c1, revokedAt)
+	if err != nil {
+		t.Fatal("RevokeIssuedCertificate failed:", err)
+	}
+	got, err := storage.GetIssuedCertificate(ctx, "01:02")
+	if err != nil {
+		t.Fatal("GetIssuedCertificate failed:", err)
+	}
+	if !got.IsRevoked() || !got.RevokedAt.Equal(revokedAt) {
+		t.Error("certificate is not revoked:", got)
+	}
+	revoked, err = storage.IsCredentialRevoked(ctx, "abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !revoked {
+		t.Error("credential should be revoked")
+	}
+
+	err = storage.DeleteExpiredIssuedCertificates(ctx, issuedAt.Add(90*time.Minute))
+	if err != nil {
+		t.Fatal("DeleteExpiredIssuedCertificates failed:", err)
+	}
+	_, err = storage.GetIssuedCertificate(ctx, "03:04")
+	if err != ErrNotFound {
+		t.Error("expired certificate should be deleted:", err)
+	}
+
+	err = storage.DeleteExpiredIssuedCertificates(ctx, issuedAt.Add(3*time.Hour))
+	if err != nil {
+		t.Fatal("DeleteExpiredIssuedCertificates failed:", err)
+	}
+	certs, err = storage.GetIssuedCertificates(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 0 {
+		t.Error("expired certificates remain:", certs)
+	}
+	revoked, err = storage.IsCredentialRevoked(ctx, "abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked {
+		t.Error("expired credential should be removed from the denylist")
+	}
+}
+
+func testStorageSSHKeyRotation(t *testing.T) {
+	t.Parallel()
+
+	client := newEtcdClient(t)
+	defer client.Close()
+	storage := Storage{client}
+	ctx := context.Background()
+
+	_, err := storage.GetSSHKeyRotation(ctx)
+	if err != ErrNotFound {
+		t.Error("unexpected error:", err)
+	}
+
+	r := &SSHKeyRotation{
+		Stage:        SSHKeyStageInstall,
+		NewPublicKey: "ssh-rsa AAAAnew",
+		StartedAt:    time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC),
+	}
+	err = storage.UpdateSSHKeyRotation(ctx, r)
+	if err != ErrNotFound {
+		t.Error("UpdateSSHKeyRotation should fail before start:", err)
+	}
+	err = storage.StartSSHKeyRotation(ctx, r)
+	if err != nil {
+		t.Fatal("StartSSHKeyRotation failed:", err)
+	}
+	err = storage.StartSSHKeyRotation(ctx, r)
+	if err != ErrRotationInProgress {
+		t.Error("StartSSHKeyRotation should fail while in progress:", err)
+	}
+
+	r = r.WithInstalled("10.0.0.1", "ssh-rsa AAAAold")
+	err = storage.UpdateSSHKeyRotation(ctx, r)
+	if err != nil {
+		t.Fatal("UpdateSSHKeyRotation failed:", err)
+	}
+
+	got, err := storage.GetSSHKeyRotation(ctx)
+	if err != nil {
+		t.Fatal("GetSSHKeyRotation failed:", err)
+	}
+	if !cmp.Equal(got, r) {
+		t.Error("GetSSHKeyRotation returned unexpected result:", cmp.Diff(got, r))
+	}
+	if !got.IsInstalled("10.0.0.1") || !got.IsDone("10.0.0.1") || got.IsInstalled("10.0.0.2") {
+		t.Error("unexpected installed nodes:", got.Installed, got.Done)
+	}
+
+	got = got.WithStage(SSHKeyStageVerify)
+	if got.IsDone("10.0.0.1") || !got.IsInstalled("10.0.0.1") {
+		t.Error("WithStage should reset only done nodes:", got.Installed, got.Done)
+	}
+
+	err = storage.DeleteSSHKeyRotation(ctx)
+	if err != nil {
+		t.Fatal("DeleteSSHKeyRotation failed:", err)
+	}
+	_, err = storage.GetSSHKeyRotation(ctx)
+	if err != ErrNotFound {
+		t.Error("rotation should be deleted:", err)
+	}
+}
+
+func testStorageUserGroups(t *testing.T) {
+	t.Parallel()
+
+	client := newEtcdClient(t)
+	defer client.Close()
+	storage := Storage{client}
+	ctx := context.Background()
+
+	_, err := storage.GetUserGroups(ctx, "alice")
+	if err != ErrNotFound {
+		t.Error("unexpected error:", err)
+	}
+
+	err = storage.PutUserGroups(ctx, "alice", []string{"dev", "ops"})
+	if err != nil {
+		t.Fatal("PutUserGroups failed:", err)
+	}
+	err = storage.PutUserGroups(ctx, "bob", []string{"dev"})
+	if err != nil {
+		t.Fatal("PutUserGroups failed:", err)
+	}
+
+	groups, err := storage.GetUserGroups(ctx, "alice")
+	if err != nil {
+		t.Fatal("GetUserGroups failed:", err)
+	}
+	if !cmp.Equal(groups, []string{"dev", "ops"}) {
+		t.Error("GetUserGroups returned unexpected result:", groups)
+	}
+
+	all, err := storage.GetAllUserGroups(ctx)
+	if err != nil {
+		t.Fatal("GetAllUserGroups failed:", err)
+	}
+	expected := map[string][]string{
+		"alice": {"dev", "ops"},
+		"bob":   {"dev"},
+	}
+	if !cmp.Equal(all, expected) {
+		t.Error("GetAllUserGroups returned unexpected result:", cmp.Diff(all, expected))
+	}
+
+	err = storage.DeleteUserGroups(ctx, "alice")
+	if err != nil {
+		t.Fatal("DeleteUserGroups failed:", err)
+	}
+	_, err = storage.GetUserGroups(ctx, "alice")
+	if err != ErrNotFound {
+		t.Error("groups should be deleted:", err)
+	}
+}
+
+func testStorageEncryptedResources(t *testing.T) {
+	t.Parallel()
+
+	client := newEtcdClient(t)
+	defer client.Close()
+	storage := Storage{client}
+	ctx := context.Background()
+
+	s, err := concurrency.NewSession(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	e := concurrency.NewElection(s, KeyLeader)
+	err = e.Campaign(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaderKey := e.Key()
+
+	_, err = storage.GetEncryptedResources(ctx)
+	if err != ErrNotFound {
+		t.Error("unexpected error:", err)
+	}
+
+	er := &EncryptedResources{
+		Provider:  EncryptionProviderKMS,
+		Resources: []string{"secrets", "configmaps"},
+	}
+	err = storage.PutEncryptedResources(ctx, leaderKey, er)
+	if err != nil {
+		t.Fatal("PutEncryptedResources failed:", err)
+	}
+
+	got, err := storage.GetEncryptedResources(ctx)
+	if err != nil {
+		t.Fatal("GetEncryptedResources failed:", err)
+	}
+	if !cmp.Equal(got, er) {
+		t.Error("GetEncryptedResources returned unexpected result:", cmp.Diff(got, er))
+	}
+
+	err = storage.PutEncryptedResources(ctx, "wrong-leader", er)
+	if err != ErrNoLeader {
+		t.Error("PutEncryptedResources should fail without leadership:", err)
+	}
+}
+
 func TestStorage(t *testing.T) {
 	t.Run("ConfigVersion", testConfigVersion)
 	t.Run("Cluster", testStorageCluster)
@@ -812,5 +1667,16 @@ func TestStorage(t *testing.T) {
 	t.Run("Resource", testStorageResource)
 	t.Run("Sabakan", testStorageSabakan)
 	t.Run("Reboot", testStorageReboot)
+	t.Run("EtcdBackup", testStorageEtcdBackup)
+	t.Run("EtcdRestore", testStorageEtcdRestore)
+	t.Run("Certificates", testStorageCertificates)
+	t.Run("KubernetesUpgrade", testStorageKubernetesUpgrade)
+	t.Run("EncryptionKeyRotation", testStorageEncryptionKeyRotation)
+	t.Run("EncryptedResources", testStorageEncryptedResources)
+	t.Run("CARotation", testStorageCARotation)
+	t.Run("ServiceAccountKeyRotation", testStorageServiceAccountKeyRotation)
+	t.Run("IssuedCertificates", testStorageIssuedCertificates)
+	t.Run("UserGroups", testStorageUserGroups)
+	t.Run("SSHKeyRotation", testStorageSSHKeyRotation)
 	t.Run("Status", testStatus)
 }
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/well"
+)
+
+// Types of health checks
+const (
+	HealthCheckTCP   = "tcp"
+	HealthCheckHTTPS = "https"
+)
+
+// HealthCheckConfig presents active health checks of upstream servers
+type HealthCheckConfig struct {
+	// Type is either HealthCheckTCP or HealthCheckHTTPS.
+	Type string
+
+	// Path is the path of HTTPS GET request such as "/healthz" or "/readyz".
+	Path string
+
+	// TLSConfig is used for HTTPS health checks.
+	TLSConfig *tls.Config
+
+	Interval time.Duration
+	Timeout  time.Duration
+
+	// Rise is the number of consecutive successes to mark an upstream healthy.
+	Rise int
+
+	// Fall is the number of consecutive failures to mark an upstream unhealthy.
+	Fall int
+}
+
+// upstream keeps the health state of an upstream server.
+// Upstreams are healthy until the checks fail Fall times in a row.
+type upstream struct {
+	addr string
+
+	mu        sync.Mutex
+	healthy   bool
+	successes int
+	failures  int
+}
+
+func newUpstream(addr string) *upstream {
+	return &upstream{addr: addr, healthy: true}
+}
+
+func (u *upstream) isHealthy() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.healthy
+}
+
+// update records the result of a health check and returns true
+// if the health state has changed.
+func (u *upstream) update(ok bool, rise, fall int) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if ok {
+		u.failures = 0
+		u.successes++
+		if !u.healthy && u.successes >= rise {
+			u.healthy = true
+			return true
+		}
+		return false
+	}
+
+	u.successes = 0
+	u.failures++
+	if u.healthy && u.failures >= fall {
+		u.healthy = false
+		return true
+	}
+	return false
+}
+
+// RunHealthCheck checks upstream servers periodically until ctx is canceled.
+func (s *Server) RunHealthCheck(ctx context.Context) error {
+	cfg := s.healthCheck
+	if cfg == nil {
+		return nil
+	}
+
+	var check func(ctx context.Context, addr string) error
+	switch cfg.Type {
+	case HealthCheckTCP:
+		check = s.checkTCP
+	case HealthCheckHTTPS:
+		client := &http.Client{
+			Transport: &http.Transport{
+				DialContext:       s.dialer.DialContext,
+				TLSClientConfig:   cfg.TLSConfig,
+				DisableKeepAlives: true,
+			},
+		}
+		check = func(ctx context.Context, addr string) error {
+			return s.checkHTTPS(ctx, client, addr)
+		}
+	default:
+		return errors.New("unknown health check type: " + cfg.Type)
+	}
+
+	env := well.NewEnvironment(ctx)
+	for _, u := range s.upstreams {
+		u := u
+		env.Go(func(ctx context.Context) error {
+			ticker := time.NewTicker(cfg.Interval)
+			defer ticker.Stop()
+
+			for {
+				s.checkUpstream(ctx, u, check)
+
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-ticker.C:
+				}
+			}
+		})
+	}
+	env.Stop()
+	return env.Wait()
+}
+
+func (s *Server) checkUpstream(ctx context.Context, u *upstream, check func(ctx context.Context, addr string) error) {
+	cfg := s.healthCheck
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	err := check(ctx, u.addr)
+	if !u.update(err == nil, cfg.Rise, cfg.Fall) {
+		return
+	}
+
+	if err == nil {
+		s.logger.Info("upstream became healthy", map[string]interface{}{
+			"upstream": u.addr,
+		})
+		return
+	}
+	s.logger.Warn("upstream became unhealthy", map[string]interface{}{
+		"upstream":  u.addr,
+		log.FnError: err,
+	})
+}
+
+func (s *Server) checkTCP(ctx context.Context, addr string) error {
+	conn, err := s.dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (s *Server) checkHTTPS(ctx context.Context, client *http.Client, addr string) error {
+	u := "https://" + addr + s.healthCheck.Path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code from %s: %d", u, resp.StatusCode)
+	}
+	return nil
+}
+
+// healthyUpstreams returns the addresses of healthy upstream servers.
+// If no upstreams are healthy, this returns all upstreams so that
+// connections are not refused due to false negatives.
+func (s *Server) healthyUpstreams() []string {
+	ups := make([]string, 0, len(s.upstreams))
+	for _, u := range s.upstreams {
+		if u.isHealthy() {
+			ups = append(ups, u.addr)
+		}
+	}
+	if len(ups) > 0 {
+		return ups
+	}
+
+	for _, u := range s.upstreams {
+		ups = append(ups, u.addr)
+	}
+	return ups
+}
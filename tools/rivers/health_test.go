@@ -0,0 +1,132 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUpstreamUpdate(t *testing.T) {
+	t.Parallel()
+
+	const rise, fall = 2, 3
+
+	testCases := []struct {
+		name    string
+		results []bool
+		changed []bool
+		healthy bool
+	}{
+		{
+			"initial",
+			nil,
+			nil,
+			true,
+		},
+		{
+			"successes",
+			[]bool{true, true, true},
+			[]bool{false, false, false},
+			true,
+		},
+		{
+			"failures below fall",
+			[]bool{false, false},
+			[]bool{false, false},
+			true,
+		},
+		{
+			"failures reach fall",
+			[]bool{false, false, false},
+			[]bool{false, false, true},
+			false,
+		},
+		{
+			"failures reset by a success",
+			[]bool{false, false, true, false, false},
+			[]bool{false, false, false, false, false},
+			true,
+		},
+		{
+			"more failures after unhealthy",
+			[]bool{false, false, false, false},
+			[]bool{false, false, true, false},
+			false,
+		},
+		{
+			"successes below rise",
+			[]bool{false, false, false, true},
+			[]bool{false, false, true, false},
+			false,
+		},
+		{
+			"successes reach rise",
+			[]bool{false, false, false, true, true},
+			[]bool{false, false, true, false, true},
+			true,
+		},
+		{
+			"successes reset by a failure",
+			[]bool{false, false, false, true, false, true},
+			[]bool{false, false, true, false, false, false},
+			false,
+		},
+	}
+
+	for _, tc := range testCases {
+		u := newUpstream("10.0.0.1:6443")
+		for i, ok := range tc.results {
+			changed := u.update(ok, rise, fall)
+			if changed != tc.changed[i] {
+				t.Errorf("%s: unexpected change at %d: %v", tc.name, i, changed)
+			}
+		}
+		if u.isHealthy() != tc.healthy {
+			t.Errorf("%s: unexpected health: %v", tc.name, u.isHealthy())
+		}
+	}
+}
+
+func TestHealthyUpstreams(t *testing.T) {
+	t.Parallel()
+
+	addrs := []string{"10.0.0.1:6443", "10.0.0.2:6443", "10.0.0.3:6443"}
+
+	testCases := []struct {
+		name      string
+		unhealthy []int
+		expected  []string
+	}{
+		{
+			"all healthy",
+			nil,
+			addrs,
+		},
+		{
+			"one unhealthy",
+			[]int{1},
+			[]string{"10.0.0.1:6443", "10.0.0.3:6443"},
+		},
+		{
+			"one healthy",
+			[]int{0, 2},
+			[]string{"10.0.0.2:6443"},
+		},
+		{
+			"all unhealthy",
+			[]int{0, 1, 2},
+			addrs,
+		},
+	}
+
+	for _, tc := range testCases {
+		s := NewServer(addrs, Config{})
+		for _, i := range tc.unhealthy {
+			s.upstreams[i].update(false, 1, 1)
+		}
+		ups := s.healthyUpstreams()
+		if !cmp.Equal(ups, tc.expected) {
+			t.Errorf("%s: unexpected upstreams: %s", tc.name, cmp.Diff(ups, tc.expected))
+		}
+	}
+}
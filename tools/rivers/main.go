@@ -1,8 +1,11 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"flag"
+	"io/ioutil"
 	"net"
 	"strings"
 	"time"
@@ -17,8 +20,70 @@ var (
 	flgShutdownTimeout = flag.String("shutdown-timeout", "0", "Timeout for server shutting-down gracefully (disabled if specified \"0\")")
 	flgDialTimeout     = flag.String("dial-timeout", "5s", "Timeout for dial to an upstream server")
 	flgDialKeepAlive   = flag.String("dial-keep-alive", "3m", "Timeout for dial keepalive to an upstream server")
+
+	flgHealthCheck         = flag.String("health-check", "", "Type of active health checks of upstream servers (tcp or https, disabled if not specified)")
+	flgHealthCheckPath     = flag.String("health-check-path", "/healthz", "Path of HTTPS health checks such as /healthz or /readyz")
+	flgHealthCheckCAFile   = flag.String("health-check-ca-file", "", "CA certificate file to verify upstream servers in HTTPS health checks (required for https)")
+	flgHealthCheckInterval = flag.String("health-check-interval", "5s", "Interval of health checks")
+	flgHealthCheckTimeout  = flag.String("health-check-timeout", "3s", "Timeout of a health check")
+	flgHealthCheckRise     = flag.Int("health-check-rise", 2, "Consecutive successes to mark an upstream server healthy")
+	flgHealthCheckFall     = flag.Int("health-check-fall", 3, "Consecutive failures to mark an upstream server unhealthy")
 )
 
+func healthCheckConfig() (*HealthCheckConfig, error) {
+	switch *flgHealthCheck {
+	case "":
+		return nil, nil
+	case HealthCheckTCP, HealthCheckHTTPS:
+	default:
+		return nil, errors.New("unknown --health-check: " + *flgHealthCheck)
+	}
+
+	cfg := &HealthCheckConfig{
+		Type: *flgHealthCheck,
+		Path: *flgHealthCheckPath,
+		Rise: *flgHealthCheckRise,
+		Fall: *flgHealthCheckFall,
+	}
+	if !strings.HasPrefix(cfg.Path, "/") {
+		return nil, errors.New("--health-check-path must start with /")
+	}
+	if cfg.Rise < 1 || cfg.Fall < 1 {
+		return nil, errors.New("--health-check-rise and --health-check-fall must be positive")
+	}
+
+	var err error
+	cfg.Interval, err = time.ParseDuration(*flgHealthCheckInterval)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Timeout, err = time.ParseDuration(*flgHealthCheckTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Interval <= 0 || cfg.Timeout <= 0 {
+		return nil, errors.New("--health-check-interval and --health-check-timeout must be positive")
+	}
+
+	// Upstream servers such as kube-apiserver have certificates issued by
+	// private CAs, so the system roots must not be used for verification.
+	if cfg.Type == HealthCheckHTTPS && len(*flgHealthCheckCAFile) == 0 {
+		return nil, errors.New("--health-check-ca-file is required for https health checks")
+	}
+	if len(*flgHealthCheckCAFile) > 0 {
+		data, err := ioutil.ReadFile(*flgHealthCheckCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cp := x509.NewCertPool()
+		if !cp.AppendCertsFromPEM(data) {
+			return nil, errors.New("no certificates in " + *flgHealthCheckCAFile)
+		}
+		cfg.TLSConfig = &tls.Config{RootCAs: cp}
+	}
+	return cfg, nil
+}
+
 func run() error {
 	if len(*flgUpstreams) == 0 {
 		return errors.New("--upstreams is blank")
@@ -41,6 +106,10 @@ func run() error {
 	if err != nil {
 		return err
 	}
+	cfg.HealthCheck, err = healthCheckConfig()
+	if err != nil {
+		return err
+	}
 
 	if len(*flgListen) == 0 {
 		return errors.New("--listen is blank")
@@ -51,6 +120,9 @@ func run() error {
 	}
 
 	s := NewServer(upstreams, cfg)
+	if cfg.HealthCheck != nil {
+		well.Go(s.RunHealthCheck)
+	}
 	s.Serve(listen)
 
 	return well.Wait()
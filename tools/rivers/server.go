@@ -23,16 +23,18 @@ type Config struct {
 	ShutdownTimeout time.Duration
 	Logger          *log.Logger
 	Dialer          *net.Dialer
+	HealthCheck     *HealthCheckConfig
 }
 
 // Server presents TCP proxy server
 type Server struct {
 	well.Server
 
-	upstreams []string
-	logger    *log.Logger
-	dialer    *net.Dialer
-	pool      sync.Pool
+	upstreams   []*upstream
+	logger      *log.Logger
+	dialer      *net.Dialer
+	healthCheck *HealthCheckConfig
+	pool        sync.Pool
 }
 
 // NewServer creates a new Server
@@ -46,14 +48,20 @@ func NewServer(upstreams []string, cfg Config) *Server {
 		logger = log.DefaultLogger()
 	}
 
+	ups := make([]*upstream, len(upstreams))
+	for i, addr := range upstreams {
+		ups[i] = newUpstream(addr)
+	}
+
 	s := &Server{
 		Server: well.Server{
 			ShutdownTimeout: cfg.ShutdownTimeout,
 		},
 
-		upstreams: upstreams,
-		logger:    logger,
-		dialer:    dialer,
+		upstreams:   ups,
+		logger:      logger,
+		dialer:      dialer,
+		healthCheck: cfg.HealthCheck,
 		pool: sync.Pool{
 			New: func() interface{} {
 				buf := make([]byte, copyBufferSize)
@@ -123,8 +131,7 @@ func (s *Server) handleConnection(ctx context.Context, conn net.Conn) {
 }
 
 func (s *Server) randomUpstream() (net.Conn, error) {
-	ups := make([]string, len(s.upstreams))
-	copy(ups, s.upstreams)
+	ups := s.healthyUpstreams()
 	rand.Shuffle(len(ups), func(i, j int) {
 		ups[i], ups[j] = ups[j], ups[i]
 	})
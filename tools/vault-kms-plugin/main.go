@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"net"
+	"os"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/well"
+	"google.golang.org/grpc"
+	pb "k8s.io/apiserver/pkg/storage/value/encrypt/envelope/v1beta1"
+)
+
+var (
+	flgListen = flag.String("listen", "/var/run/cke-kms/kms.sock", "Path of UNIX domain socket to listen on")
+	flgConfig = flag.String("config", "/etc/kubernetes/kms/vault.json", "Path of Vault connection config")
+	flgKey    = flag.String("key", cke.DefaultKMSTransitKey, "Name of the key in Vault transit secrets engine")
+)
+
+func loadConfig(p string) (*cke.VaultConfig, error) {
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := new(cke.VaultConfig)
+	err = json.Unmarshal(data, cfg)
+	if err != nil {
+		return nil, err
+	}
+	err = cfg.ValidateForKMS()
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func run() error {
+	if len(*flgKey) == 0 {
+		return errors.New("--key is blank")
+	}
+
+	cfg, err := loadConfig(*flgConfig)
+	if err != nil {
+		return err
+	}
+
+	// remove the socket left by the previous run.
+	err = os.Remove(*flgListen)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	listen, err := net.Listen("unix", *flgListen)
+	if err != nil {
+		return err
+	}
+
+	s := NewServer(cfg, *flgKey)
+	grpcServer := grpc.NewServer()
+	pb.RegisterKeyManagementServiceServer(grpcServer, s)
+
+	well.Go(s.KeepLogin)
+	well.Go(func(ctx context.Context) error {
+		return grpcServer.Serve(listen)
+	})
+	well.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		grpcServer.GracefulStop()
+		return nil
+	})
+
+	return well.Wait()
+}
+
+func main() {
+	flag.Parse()
+	well.LogConfig{}.Apply()
+
+	err := run()
+	if err != nil && !well.IsSignaled(err) {
+		log.ErrorExit(err)
+	}
+}
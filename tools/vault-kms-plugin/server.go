@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/log"
+	vault "github.com/hashicorp/vault/api"
+	pb "k8s.io/apiserver/pkg/storage/value/encrypt/envelope/v1beta1"
+)
+
+const (
+	// kmsAPIVersion is the version of KMS plugin API implemented by this server.
+	kmsAPIVersion = "v1beta1"
+
+	runtimeName    = "vault-transit"
+	runtimeVersion = "0.1.0"
+
+	reloginInterval = 10 * time.Second
+)
+
+// Server implements KeyManagementServiceServer using Vault transit secrets engine.
+type Server struct {
+	cfg *cke.VaultConfig
+	key string
+
+	mu     sync.RWMutex
+	client *vault.Client
+}
+
+// NewServer creates a new Server.
+// key is the name of the key in the transit secrets engine.
+func NewServer(cfg *cke.VaultConfig, key string) *Server {
+	return &Server{
+		cfg: cfg,
+		key: key,
+	}
+}
+
+// Version implements KeyManagementServiceServer.
+func (s *Server) Version(ctx context.Context, req *pb.VersionRequest) (*pb.VersionResponse, error) {
+	return &pb.VersionResponse{
+		Version:        kmsAPIVersion,
+		RuntimeName:    runtimeName,
+		RuntimeVersion: runtimeVersion,
+	}, nil
+}
+
+// Encrypt implements KeyManagementServiceServer.
+func (s *Server) Encrypt(ctx context.Context, req *pb.EncryptRequest) (*pb.EncryptResponse, error) {
+	vc, err := s.vaultClient()
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := vc.Logical().Write(path.Join(cke.TransitSecret, "encrypt", s.key), map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString(req.Plain),
+	})
+	if err != nil {
+		log.Error("failed to encrypt", map[string]interface{}{
+			log.FnError: err,
+		})
+		return nil, err
+	}
+	if secret == nil {
+		return nil, errors.New("no response from vault")
+	}
+
+	cipher, ok := secret.Data["ciphertext"].(string)
+	if !ok {
+		return nil, errors.New("no ciphertext in the response")
+	}
+	return &pb.EncryptResponse{Cipher: []byte(cipher)}, nil
+}
+
+// Decrypt implements KeyManagementServiceServer.
+func (s *Server) Decrypt(ctx context.Context, req *pb.DecryptRequest) (*pb.DecryptResponse, error) {
+	vc, err := s.vaultClient()
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := vc.Logical().Write(path.Join(cke.TransitSecret, "decrypt", s.key), map[string]interface{}{
+		"ciphertext": string(req.Cipher),
+	})
+	if err != nil {
+		log.Error("failed to decrypt", map[string]interface{}{
+			log.FnError: err,
+		})
+		return nil, err
+	}
+	if secret == nil {
+		return nil, errors.New("no response from vault")
+	}
+
+	data, ok := secret.Data["plaintext"].(string)
+	if !ok {
+		return nil, errors.New("no plaintext in the response")
+	}
+	plain, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.DecryptResponse{Plain: plain}, nil
+}
+
+func (s *Server) vaultClient() (*vault.Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.client == nil {
+		return nil, errors.New("not logged in to vault")
+	}
+	return s.client, nil
+}
+
+// KeepLogin logs in to Vault and keeps the token renewed until ctx is done.
+// When the token cannot be renewed any longer, it logs in again.
+func (s *Server) KeepLogin(ctx context.Context) error {
+	for {
+		err := s.login(ctx)
+		if err != nil {
+			log.Error("failed to login to vault", map[string]interface{}{
+				log.FnError: err,
+				"endpoint":  s.cfg.Endpoint,
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(reloginInterval):
+		}
+	}
+}
+
+// login logs in to Vault and renews the token until it expires or ctx is done.
+func (s *Server) login(ctx context.Context) error {
+	client, secret, err := cke.VaultClient(s.cfg)
+	if err != nil {
+		return err
+	}
+
+	watcher, err := client.NewLifetimeWatcher(&vault.LifetimeWatcherInput{
+		Secret: secret,
+	})
+	if err != nil {
+		return err
+	}
+	go watcher.Start()
+	defer watcher.Stop()
+
+	s.mu.Lock()
+	s.client = client
+	s.mu.Unlock()
+	log.Info("logged in to vault", map[string]interface{}{
+		"endpoint": s.cfg.Endpoint,
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-watcher.DoneCh():
+		return err
+	}
+}
@@ -7,9 +7,15 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/cybozu-go/log"
@@ -22,11 +28,41 @@ const CKESecret = "cke/secrets"
 // SSHSecret is the path of SSH private keys in Vault.
 const SSHSecret = CKESecret + "/ssh"
 
+// SSHNextSecret is the path of the new SSH private key during its rotation.
+const SSHNextSecret = CKESecret + "/ssh-next"
+
 // K8sSecret is the path of encryption keys used for Kubernetes Secrets.
 const K8sSecret = CKESecret + "/k8s"
 
+// TransitSecret is the path of transit secret engine for CKE.
+// This is used by the KMS plugin to encrypt resource data of Kubernetes.
+const TransitSecret = "cke/transit"
+
+// KMSVaultPolicy is the name of the Vault policy for the KMS plugin.
+// The policy allows only encryption and decryption with the transit keys.
+const KMSVaultPolicy = "cke-kms"
+
+// EtcdBackupSecret is the path prefix of credentials for etcd backup targets.
+// Credentials for a target are stored in EtcdBackupSecret + "/" + target name.
+const EtcdBackupSecret = CKESecret + "/etcd-backup"
+
 type anyMap = map[string]interface{}
 
+// Auth methods to login to Vault.
+const (
+	VaultAuthAppRole    = "approle"
+	VaultAuthCert       = "cert"
+	VaultAuthToken      = "token"
+	VaultAuthKubernetes = "kubernetes"
+)
+
+// DefaultVaultServiceAccountTokenFile is the default path of the service account
+// token for Kubernetes auth method.
+const DefaultVaultServiceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// vaultReloginInterval is the interval to retry login to Vault after the token expired.
+const vaultReloginInterval = 10 * time.Second
+
 // VaultConfig is data to store in etcd
 type VaultConfig struct {
 	// Endpoint is the address of the Vault server.
@@ -35,11 +71,91 @@ type VaultConfig struct {
 	// CACert is x509 certificate in PEM format of the endpoint CA.
 	CACert string `json:"ca-cert"`
 
+	// Namespace is the namespace of Vault Enterprise.
+	Namespace string `json:"namespace,omitempty"`
+
+	// AuthMethod is the auth method to login to Vault.
+	// One of "approle", "cert", "token", or "kubernetes".  Default is "approle".
+	AuthMethod string `json:"auth-method,omitempty"`
+
+	// AuthMount is the path where the auth method is enabled.
+	// Default is the name of the auth method.  Not used for "token".
+	AuthMount string `json:"auth-mount,omitempty"`
+
 	// RoleID is AppRole ID to login to Vault.
 	RoleID string `json:"role-id"`
 
 	// SecretID is AppRole secret to login to Vault.
 	SecretID string `json:"secret-id"`
+
+	// ClientCertFile and ClientKeyFile are the paths of the client certificate
+	// and its private key in PEM format for TLS certificate auth method.
+	ClientCertFile string `json:"client-cert-file,omitempty"`
+	ClientKeyFile  string `json:"client-key-file,omitempty"`
+
+	// CertRole is the name of the role for TLS certificate auth method.
+	// If empty, Vault tries all the roles matching the client certificate.
+	CertRole string `json:"cert-role,omitempty"`
+
+	// TokenFile is the path of the file containing a Vault token.
+	// The file is read at each login so that it can be updated by an agent.
+	TokenFile string `json:"token-file,omitempty"`
+
+	// KubernetesRole is the name of the role for Kubernetes auth method.
+	KubernetesRole string `json:"kubernetes-role,omitempty"`
+
+	// ServiceAccountTokenFile is the path of the service account token
+	// for Kubernetes auth method.  Default is DefaultVaultServiceAccountTokenFile.
+	ServiceAccountTokenFile string `json:"service-account-token-file,omitempty"`
+}
+
+// GetAuthMethod returns the auth method to login to Vault.
+func (c *VaultConfig) GetAuthMethod() string {
+	if len(c.AuthMethod) == 0 {
+		return VaultAuthAppRole
+	}
+	return c.AuthMethod
+}
+
+// GetAuthMount returns the path where the auth method is enabled.
+func (c *VaultConfig) GetAuthMount() string {
+	if len(c.AuthMount) == 0 {
+		return c.GetAuthMethod()
+	}
+	return strings.Trim(c.AuthMount, "/")
+}
+
+// GetServiceAccountTokenFile returns the path of the service account token.
+func (c *VaultConfig) GetServiceAccountTokenFile() string {
+	if len(c.ServiceAccountTokenFile) == 0 {
+		return DefaultVaultServiceAccountTokenFile
+	}
+	return c.ServiceAccountTokenFile
+}
+
+// ValidateForKMS validates the vault configuration for the KMS plugin.
+// The configuration is distributed to control plane nodes, so only
+// AppRole that carries its credentials in itself is allowed.
+func (c *VaultConfig) ValidateForKMS() error {
+	if c.GetAuthMethod() != VaultAuthAppRole {
+		return errors.New("auth method for the KMS plugin must be " + VaultAuthAppRole)
+	}
+	return c.Validate()
+}
+
+// ValidateForCluster validates the vault configuration against the cluster.
+// When the KMS encryption provider is enabled, ckecli needs to login to Vault
+// on the operator's host to manage the transit key.  Auth methods other than
+// AppRole refer to files that exist only on the hosts running CKE, so they
+// are rejected.
+func (c *VaultConfig) ValidateForCluster(cluster *Cluster) error {
+	if cluster == nil || cluster.Options.APIServer.Encryption.GetProvider() != EncryptionProviderKMS {
+		return nil
+	}
+	if c.GetAuthMethod() != VaultAuthAppRole {
+		return errors.New("auth method must be " + VaultAuthAppRole + " while the kms encryption provider is enabled")
+	}
+	return nil
 }
 
 // Validate validates the vault configuration
@@ -61,17 +177,52 @@ func (c *VaultConfig) Validate() error {
 			return errors.New("invalid certificate")
 		}
 	}
-	if len(c.RoleID) == 0 {
-		return errors.New("role-id is empty")
+
+	method := c.GetAuthMethod()
+	if method != VaultAuthAppRole && (len(c.RoleID) > 0 || len(c.SecretID) > 0) {
+		return fmt.Errorf("role-id and secret-id are not used for %s auth method", method)
 	}
-	if len(c.SecretID) == 0 {
-		return errors.New("secret-id is empty")
+
+	switch method {
+	case VaultAuthAppRole:
+		if len(c.RoleID) == 0 {
+			return errors.New("role-id is empty")
+		}
+		if len(c.SecretID) == 0 {
+			return errors.New("secret-id is empty")
+		}
+	case VaultAuthCert:
+		if len(c.ClientCertFile) == 0 || len(c.ClientKeyFile) == 0 {
+			return errors.New("client-cert-file and client-key-file are required for cert auth method")
+		}
+		if !filepath.IsAbs(c.ClientCertFile) || !filepath.IsAbs(c.ClientKeyFile) {
+			return errors.New("client-cert-file and client-key-file must be absolute paths")
+		}
+	case VaultAuthToken:
+		if len(c.TokenFile) == 0 {
+			return errors.New("token-file is required for token auth method")
+		}
+		if !filepath.IsAbs(c.TokenFile) {
+			return errors.New("token-file must be an absolute path")
+		}
+		if len(c.AuthMount) > 0 {
+			return errors.New("auth-mount is not used for token auth method")
+		}
+	case VaultAuthKubernetes:
+		if len(c.KubernetesRole) == 0 {
+			return errors.New("kubernetes-role is required for kubernetes auth method")
+		}
+		if len(c.ServiceAccountTokenFile) > 0 && !filepath.IsAbs(c.ServiceAccountTokenFile) {
+			return errors.New("service-account-token-file must be an absolute path")
+		}
+	default:
+		return errors.New("unknown auth-method: " + c.AuthMethod)
 	}
 	return nil
 }
 
 // VaultClient creates vault client.
-// The client has logged-in to Vault using RoleID and SecretID in cfg.
+// The client has logged-in to Vault using the auth method in cfg.
 func VaultClient(cfg *VaultConfig) (*vault.Client, *vault.Secret, error) {
 	transport := &http.Transport{
 		Proxy:             http.ProxyFromEnvironment,
@@ -86,16 +237,24 @@ func VaultClient(cfg *VaultConfig) (*vault.Client, *vault.Secret, error) {
 		ExpectContinueTimeout: 1 * time.Second,
 	}
 
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
 	if len(cfg.CACert) > 0 {
 		cp := x509.NewCertPool()
 		if !cp.AppendCertsFromPEM([]byte(cfg.CACert)) {
 			return nil, nil, errors.New("invalid CA cert")
 		}
-
-		transport.TLSClientConfig = &tls.Config{
-			RootCAs:    cp,
-			MinVersion: tls.VersionTLS12,
+		tlsConfig.RootCAs = cp
+		transport.TLSClientConfig = tlsConfig
+	}
+	if cfg.GetAuthMethod() == VaultAuthCert {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, nil, err
 		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		transport.TLSClientConfig = tlsConfig
 	}
 
 	client, err := vault.NewClient(&vault.Config{
@@ -111,20 +270,21 @@ func VaultClient(cfg *VaultConfig) (*vault.Client, *vault.Secret, error) {
 		})
 		return nil, nil, err
 	}
+	if len(cfg.Namespace) > 0 {
+		client.SetNamespace(cfg.Namespace)
+	}
 
-	secret, err := client.Logical().Write("auth/approle/login", anyMap{
-		"role_id":   cfg.RoleID,
-		"secret_id": cfg.SecretID,
-	})
+	secret, err := vaultLogin(client, cfg)
 	if err != nil {
 		log.Error("failed to login to vault", anyMap{
-			log.FnError: err,
-			"endpoint":  cfg.Endpoint,
+			log.FnError:   err,
+			"endpoint":    cfg.Endpoint,
+			"auth_method": cfg.GetAuthMethod(),
 		})
 		return nil, nil, err
 	}
 	// If cke accesses while vault is initializing, then vault returns io.EOF and the secret is nil
-	if secret == nil {
+	if secret == nil || secret.Auth == nil {
 		log.Error("failed to get secret", anyMap{
 			"endpoint": cfg.Endpoint,
 		})
@@ -135,8 +295,72 @@ func VaultClient(cfg *VaultConfig) (*vault.Client, *vault.Secret, error) {
 	return client, secret, nil
 }
 
+func vaultLogin(client *vault.Client, cfg *VaultConfig) (*vault.Secret, error) {
+	loginPath := path.Join("auth", cfg.GetAuthMount(), "login")
+
+	switch cfg.GetAuthMethod() {
+	case VaultAuthAppRole:
+		return client.Logical().Write(loginPath, anyMap{
+			"role_id":   cfg.RoleID,
+			"secret_id": cfg.SecretID,
+		})
+	case VaultAuthCert:
+		params := anyMap{}
+		if len(cfg.CertRole) > 0 {
+			params["name"] = cfg.CertRole
+		}
+		return client.Logical().Write(loginPath, params)
+	case VaultAuthKubernetes:
+		jwt, err := ioutil.ReadFile(cfg.GetServiceAccountTokenFile())
+		if err != nil {
+			return nil, err
+		}
+		return client.Logical().Write(loginPath, anyMap{
+			"role": cfg.KubernetesRole,
+			"jwt":  strings.TrimSpace(string(jwt)),
+		})
+	case VaultAuthToken:
+		data, err := ioutil.ReadFile(cfg.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token := strings.TrimSpace(string(data))
+		client.SetToken(token)
+		self, err := client.Auth().Token().LookupSelf()
+		if err != nil {
+			return nil, err
+		}
+		if self == nil {
+			return nil, nil
+		}
+		ttl, err := self.TokenTTL()
+		if err != nil {
+			return nil, err
+		}
+		renewable, err := self.TokenIsRenewable()
+		if err != nil {
+			return nil, err
+		}
+		return &vault.Secret{
+			Auth: &vault.SecretAuth{
+				ClientToken:   token,
+				Renewable:     renewable,
+				LeaseDuration: int(ttl.Seconds()),
+			},
+		}, nil
+	}
+	return nil, errors.New("unknown auth-method: " + cfg.AuthMethod)
+}
+
+var (
+	vaultRenewalMu     sync.Mutex
+	stopVaultRenewal   context.CancelFunc
+	vaultRenewalFinish <-chan struct{}
+)
+
 // ConnectVault unmarshal data to get VaultConfig and call VaultClient
 // with it.  It then start renewing login token for long-running process.
+// When the token cannot be renewed any longer, it logs in to Vault again.
 func ConnectVault(ctx context.Context, data []byte) error {
 	c := new(VaultConfig)
 	err := json.Unmarshal(data, c)
@@ -149,27 +373,101 @@ func ConnectVault(ctx context.Context, data []byte) error {
 		return err
 	}
 
+	vaultRenewalMu.Lock()
+	if stopVaultRenewal != nil {
+		stopVaultRenewal()
+		<-vaultRenewalFinish
+	}
+	renewCtx, cancel := context.WithCancel(ctx)
+	finish := make(chan struct{})
+	stopVaultRenewal = cancel
+	vaultRenewalFinish = finish
+	vaultRenewalMu.Unlock()
+
+	setVaultClient(client)
+	log.Info("connected to vault", anyMap{
+		"endpoint":    c.Endpoint,
+		"auth_method": c.GetAuthMethod(),
+	})
+
+	go func() {
+		defer close(finish)
+		keepVaultLogin(renewCtx, c, client, secret)
+	}()
+	return nil
+}
+
+// keepVaultLogin renews the login token until ctx is done.
+// When the token expires, it logs in to Vault again and replaces the client.
+func keepVaultLogin(ctx context.Context, c *VaultConfig, client *vault.Client, secret *vault.Secret) {
+	for {
+		loginAt := time.Now()
+		err := watchVaultToken(ctx, client, secret)
+		if err != nil {
+			log.Warn("vault token is no longer renewed", anyMap{
+				log.FnError: err,
+				"endpoint":  c.Endpoint,
+			})
+		}
+
+		// Do not hammer Vault when a new token cannot be renewed at all.
+		if wait := vaultReloginInterval - time.Since(loginAt); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			client, secret, err = VaultClient(c)
+			if err == nil {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(vaultReloginInterval):
+			}
+		}
+
+		setVaultClient(client)
+		log.Info("logged in to vault again", anyMap{
+			"endpoint":    c.Endpoint,
+			"auth_method": c.GetAuthMethod(),
+		})
+	}
+}
+
+// watchVaultToken renews the token of secret until it expires or ctx is done.
+func watchVaultToken(ctx context.Context, client *vault.Client, secret *vault.Secret) error {
+	// Tokens without TTL never expire.
+	if secret.Auth.LeaseDuration == 0 {
+		<-ctx.Done()
+		return nil
+	}
+
 	watcher, err := client.NewLifetimeWatcher(&vault.LifetimeWatcherInput{
 		Secret:        secret,
 		RenewBehavior: vault.RenewBehaviorIgnoreErrors,
 	})
 	if err != nil {
-		log.Error("failed to create vault renewer", anyMap{
-			log.FnError: err,
-			"endpoint":  c.Endpoint,
-		})
 		return err
 	}
-
 	go watcher.Start()
-	go func() {
-		<-ctx.Done()
-		watcher.Stop()
-	}()
+	defer watcher.Stop()
 
-	setVaultClient(client)
-	log.Info("connected to vault", anyMap{
-		"endpoint": c.Endpoint,
-	})
-	return nil
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-watcher.DoneCh():
+		return err
+	}
 }
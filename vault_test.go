@@ -0,0 +1,161 @@
+package cke
+
+import "testing"
+
+func TestVaultConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name  string
+		cfg   VaultConfig
+		valid bool
+	}{
+		{
+			"approle",
+			VaultConfig{Endpoint: "https://vault:8200", RoleID: "role", SecretID: "secret"},
+			true,
+		},
+		{
+			"approle without secret-id",
+			VaultConfig{Endpoint: "https://vault:8200", RoleID: "role"},
+			false,
+		},
+		{
+			"no endpoint",
+			VaultConfig{RoleID: "role", SecretID: "secret"},
+			false,
+		},
+		{
+			"cert",
+			VaultConfig{
+				Endpoint:       "https://vault:8200",
+				AuthMethod:     VaultAuthCert,
+				ClientCertFile: "/etc/cke/vault.crt",
+				ClientKeyFile:  "/etc/cke/vault.key",
+			},
+			true,
+		},
+		{
+			"cert without key",
+			VaultConfig{
+				Endpoint:       "https://vault:8200",
+				AuthMethod:     VaultAuthCert,
+				ClientCertFile: "/etc/cke/vault.crt",
+			},
+			false,
+		},
+		{
+			"cert with relative path",
+			VaultConfig{
+				Endpoint:       "https://vault:8200",
+				AuthMethod:     VaultAuthCert,
+				ClientCertFile: "vault.crt",
+				ClientKeyFile:  "vault.key",
+			},
+			false,
+		},
+		{
+			"cert with secret-id",
+			VaultConfig{
+				Endpoint:       "https://vault:8200",
+				AuthMethod:     VaultAuthCert,
+				ClientCertFile: "/etc/cke/vault.crt",
+				ClientKeyFile:  "/etc/cke/vault.key",
+				SecretID:       "secret",
+			},
+			false,
+		},
+		{
+			"token",
+			VaultConfig{
+				Endpoint:   "https://vault:8200",
+				Namespace:  "ns1/",
+				AuthMethod: VaultAuthToken,
+				TokenFile:  "/run/vault/token",
+			},
+			true,
+		},
+		{
+			"token with auth-mount",
+			VaultConfig{
+				Endpoint:   "https://vault:8200",
+				AuthMethod: VaultAuthToken,
+				AuthMount:  "token",
+				TokenFile:  "/run/vault/token",
+			},
+			false,
+		},
+		{
+			"kubernetes",
+			VaultConfig{
+				Endpoint:       "https://vault:8200",
+				AuthMethod:     VaultAuthKubernetes,
+				AuthMount:      "kubernetes/cluster1",
+				KubernetesRole: "cke",
+			},
+			true,
+		},
+		{
+			"kubernetes without role",
+			VaultConfig{
+				Endpoint:   "https://vault:8200",
+				AuthMethod: VaultAuthKubernetes,
+			},
+			false,
+		},
+		{
+			"unknown auth method",
+			VaultConfig{
+				Endpoint:   "https://vault:8200",
+				AuthMethod: "ldap",
+			},
+			false,
+		},
+	}
+
+	for _, tc := range testCases {
+		err := tc.cfg.Validate()
+		if tc.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%s: should be invalid", tc.name)
+		}
+	}
+}
+
+func TestVaultConfigValidateForCluster(t *testing.T) {
+	approle := VaultConfig{Endpoint: "https://vault:8200", RoleID: "role", SecretID: "secret"}
+	token := VaultConfig{Endpoint: "https://vault:8200", AuthMethod: VaultAuthToken, TokenFile: "/etc/vault/token"}
+
+	cluster := NewCluster()
+	if err := token.ValidateForCluster(cluster); err != nil {
+		t.Error("unexpected error:", err)
+	}
+
+	cluster.Options.APIServer.Encryption.Provider = EncryptionProviderKMS
+	if err := approle.ValidateForCluster(cluster); err != nil {
+		t.Error("unexpected error:", err)
+	}
+	if err := token.ValidateForCluster(cluster); err == nil {
+		t.Error("auth methods other than approle should be rejected with kms")
+	}
+	if err := token.ValidateForCluster(nil); err != nil {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func TestVaultConfigValidateForKMS(t *testing.T) {
+	approle := VaultConfig{Endpoint: "https://vault:8200", RoleID: "role", SecretID: "secret"}
+	if err := approle.ValidateForKMS(); err != nil {
+		t.Error("unexpected error:", err)
+	}
+
+	token := VaultConfig{Endpoint: "https://vault:8200", AuthMethod: VaultAuthToken, TokenFile: "/etc/vault/token"}
+	if err := token.Validate(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := token.ValidateForKMS(); err == nil {
+		t.Error("auth methods other than approle should be rejected")
+	}
+}